@@ -1,18 +1,44 @@
-use std::collections::HashMap;
+use std::collections::{HashMap, HashSet, VecDeque};
 use std::path::{Path, PathBuf};
+use std::time::Duration;
 
 use lasso::Spur;
+use petgraph::graph::{Graph, NodeIndex};
 use rayon::prelude::*;
-use rustc_hash::FxHashMap;
+use rustc_hash::{FxHashMap, FxHashSet};
 
 use crate::cache::FileCache;
+use crate::cycles::{self, Cycle};
+use crate::entrypoint::boost_entry_points;
 use crate::find_references::{
-    Location, ReferenceEdge, ReferenceScan, find_references, find_references_cached,
+    ImportEdge, Location, ReferenceEdge, ReferenceScan, find_references_cached, find_references_in,
 };
-use crate::graph::build_file_graph;
-use crate::intern::intern;
-use crate::io::{CruxlinesError, gather_paths};
-use crate::languages::Ecosystem;
+use crate::git::{ChangedLines, changed_lines_since, decayed_frecency, read_blobs, tree_paths};
+use crate::graph::{SymbolGraph, build_file_graph, page_rank, personalized_page_rank, reachable};
+use crate::intern::{intern, resolve};
+use crate::io::{
+    CruxlinesError, IGNORE_FILE_NAME, IgnoreFiles, PathFilter, find_repo_root, gather_paths,
+    select_paths,
+};
+use crate::languages::kind::{DefinitionInfo, Visibility};
+use crate::languages::project_files::{ProjectFiles, is_project_file};
+use crate::languages::test_code::is_test_file;
+use crate::languages::{Ecosystem, Language, SymbolKind, language_for_file};
+use crate::options::{EdgeMode, FileScore, Options, RankMode, TestMode};
+use crate::profile::{Phase, Profile};
+use crate::query::boost_query;
+use crate::snippet::{Snippet, attach_snippets};
+
+/// Rank multiplier for definitions changed since `Options::since`.
+const SINCE_BOOST: f64 = 10.0;
+
+/// Iteration cap for the personalized PageRank of `Options::focus`, which
+/// stops earlier once it converges.
+const FOCUS_ITERATIONS: usize = 100;
+
+/// Rank multiplier for definitions whose declaration overlaps a syntax
+/// error, since tree-sitter's recovery may have misread them.
+const PARSE_ERROR_PENALTY: f64 = 0.5;
 
 #[derive(Debug, Clone)]
 pub struct OutputRow {
@@ -20,150 +46,750 @@ pub struct OutputRow {
     pub local_score: f64,
     pub file_rank: f64,
     pub definition: Location,
+    pub kind: SymbolKind,
+    /// Last line of the definition's declaration (e.g. end of a function body).
+    pub end_line: usize,
+    pub visibility: Visibility,
+    /// Whether the definition matched the entry-point heuristics of its
+    /// ecosystem, which multiplies its rank by `Options::entrypoint_boost`.
+    pub entry_point: bool,
+    /// Number of syntax errors tree-sitter recovered from in the
+    /// definition's file.
+    pub parse_errors: usize,
+    /// Whether the declaration overlaps one of those errors, which
+    /// multiplies its rank by [`PARSE_ERROR_PENALTY`].
+    pub parse_error: bool,
     /// Definition line text from the input snapshot.
     pub definition_line: String,
     /// Heuristic reference locations; may include false positives.
     pub references: Vec<Location>,
+    /// Source around the definition, when `Options::context` is set.
+    pub snippet: Option<Snippet>,
+}
+
+/// A ranked definition, as returned by [`analyze`].
+pub type CruxLine = OutputRow;
+
+/// A file ranked by the definitions it contains, as returned by
+/// [`rank_by_file`].
+#[derive(Debug, Clone)]
+pub struct FileRank {
+    pub path: Spur,
+    /// The sum or the highest of its definitions' ranks, per [`FileScore`].
+    pub score: f64,
+    /// How many ranked definitions the file contains.
+    pub definitions: usize,
+}
+
+impl FileRank {
+    /// Get the path as a string slice
+    #[inline]
+    pub fn path_str(&self) -> &'static str {
+        resolve(self.path)
+    }
+}
+
+/// Ranks the definitions found under `paths` (files or directories).
+///
+/// Directories are walked with gitignore rules applied. Git history (for
+/// frecency and `since`) and the parse cache come from the repository that
+/// contains the first path, if any.
+pub fn analyze(paths: &[PathBuf], options: &Options) -> Result<Vec<CruxLine>, CruxlinesError> {
+    analyze_profiled(paths, options).map(|(rows, _)| rows)
+}
+
+/// Like [`analyze`], also returning how long each phase of the run took and
+/// how many files, graph nodes and edges and definitions it went through.
+pub fn analyze_profiled(
+    paths: &[PathBuf],
+    options: &Options,
+) -> Result<(Vec<CruxLine>, Profile), CruxlinesError> {
+    let mut profile = Profile::default();
+    if paths.is_empty() {
+        return Ok((Vec::new(), profile));
+    }
+    let (files, repo_root) = profile.time(Phase::Walk, || gather_roots(paths, options))?;
+    profile.files_walked = files.len();
+    let rows = analyze_files(files, repo_root, options, &mut profile)?;
+    Ok((rows, profile))
+}
+
+/// Ranks the files under `paths` instead of their definitions: the
+/// definitions are ranked as in [`analyze`], then each file is scored by
+/// the sum or the highest of their ranks. `kinds` selects the definitions
+/// that count, `min_score` and `limit` apply to the files, and
+/// `max_per_file`, `depth` and `context` have no effect.
+pub fn rank_by_file(
+    paths: &[PathBuf],
+    options: &Options,
+    score: FileScore,
+) -> Result<Vec<FileRank>, CruxlinesError> {
+    rank_by_file_profiled(paths, options, score).map(|(files, _)| files)
+}
+
+/// Like [`rank_by_file`], also returning the [`Profile`] of the run.
+pub fn rank_by_file_profiled(
+    paths: &[PathBuf],
+    options: &Options,
+    score: FileScore,
+) -> Result<(Vec<FileRank>, Profile), CruxlinesError> {
+    let definition_options = Options {
+        limit: None,
+        min_score: None,
+        max_per_file: None,
+        depth: 0,
+        context: None,
+        ..options.clone()
+    };
+    let (rows, mut profile) = analyze_profiled(paths, &definition_options)?;
+    let files = profile.time(Phase::Rank, || {
+        let mut files = collapse_to_files(&rows, score);
+        let top = files.first().map_or(0.0, |file| file.score);
+        if let Some(min_score) = options.min_score
+            && top > 0.0
+        {
+            files.retain(|file| file.score / top >= min_score);
+        }
+        if let Some(limit) = options.limit {
+            files.truncate(limit);
+        }
+        files
+    });
+    Ok((files, profile))
+}
+
+/// Groups rows by file, scoring each file by `score`, highest score first
+/// and ties broken by path.
+fn collapse_to_files(rows: &[OutputRow], score: FileScore) -> Vec<FileRank> {
+    let mut by_path: FxHashMap<Spur, FileRank> = FxHashMap::default();
+    for row in rows {
+        let file = by_path
+            .entry(row.definition.path)
+            .or_insert_with(|| FileRank {
+                path: row.definition.path,
+                score: 0.0,
+                definitions: 0,
+            });
+        file.score = match score {
+            FileScore::Sum => file.score + row.rank,
+            FileScore::Max => file.score.max(row.rank),
+        };
+        file.definitions += 1;
+    }
+    let mut files: Vec<FileRank> = by_path.into_values().collect();
+    files.sort_by(|a, b| {
+        b.score
+            .total_cmp(&a.score)
+            .then_with(|| a.path_str().cmp(b.path_str()))
+    });
+    files
+}
+
+/// The files [`analyze`] would read under `paths`, with their detected
+/// language, without parsing them; only `ecosystems`, `languages`,
+/// `exclude`, `include`, `follow_symlinks` and `git_ref` apply.
+pub fn list_files(
+    paths: &[PathBuf],
+    options: &Options,
+) -> Result<Vec<(PathBuf, Language)>, CruxlinesError> {
+    if paths.is_empty() {
+        return Ok(Vec::new());
+    }
+    let (files, _) = gather_roots(paths, options)?;
+    let mut files: Vec<(PathBuf, Language)> = files
+        .into_iter()
+        .filter_map(|path| language_for_file(&path).map(|language| (path, language)))
+        .collect();
+    files.sort_by(|a, b| a.0.cmp(&b.0));
+    Ok(files)
+}
+
+/// Finds the dependency cycles between the files under `paths`, which are
+/// gathered and parsed as in [`analyze`]; only `ecosystems`, `languages`,
+/// `exclude`, `include`, `follow_symlinks`, `git_ref`, `edges`, `use_cache`
+/// and `threads` apply.
+pub fn file_cycles(
+    paths: &[PathBuf],
+    options: &Options,
+) -> Result<Vec<Cycle<Spur>>, CruxlinesError> {
+    if paths.is_empty() {
+        return Ok(Vec::new());
+    }
+    let (scan, _) = scan_roots(paths, options)?;
+    Ok(cycles::file_cycles(&scan, options.edges))
+}
+
+/// Finds the dependency cycles between the definitions under `paths`, like
+/// [`file_cycles`].
+pub fn symbol_cycles(
+    paths: &[PathBuf],
+    options: &Options,
+) -> Result<Vec<Cycle<Location>>, CruxlinesError> {
+    if paths.is_empty() {
+        return Ok(Vec::new());
+    }
+    let (scan, frecency) = scan_roots(paths, options)?;
+    let rows = rank_scan(scan, &frecency, options, &mut Profile::default());
+    Ok(cycles::symbol_cycles(&rows))
+}
+
+/// The graph of the definitions under `paths`, ranked as in [`analyze`],
+/// and the references between them. With `top`, only the `top` highest
+/// ranked definitions and the edges among them are kept.
+pub fn symbol_graph(
+    paths: &[PathBuf],
+    options: &Options,
+    top: Option<usize>,
+) -> Result<SymbolGraph, CruxlinesError> {
+    if paths.is_empty() {
+        return Ok(SymbolGraph::default());
+    }
+    let (scan, frecency) = scan_roots(paths, options)?;
+    let mut rows = rank_scan(scan, &frecency, options, &mut Profile::default());
+    if let Some(top) = top {
+        rows.truncate(top);
+    }
+    Ok(SymbolGraph::new(&rows))
+}
+
+/// Gathers and parses the files under `paths` without ranking them.
+fn scan_roots(
+    paths: &[PathBuf],
+    options: &Options,
+) -> Result<(ReferenceScan, HashMap<Spur, f64>), CruxlinesError> {
+    let (files, repo_root) = gather_roots(paths, options)?;
+    with_thread_pool(options, || {
+        scan_paths(files, repo_root, options, &mut Profile::default())
+    })
+}
+
+/// Walks `paths` (or, with `options.git_ref`, lists the files committed
+/// under them) with the filters in `options`, returning the files found and
+/// the repository containing the first path.
+fn gather_roots(
+    paths: &[PathBuf],
+    options: &Options,
+) -> Result<(Vec<PathBuf>, Option<PathBuf>), CruxlinesError> {
+    let roots = absolute_paths(paths);
+    let repo_root = roots.first().and_then(|root| find_repo_root(root));
+    let filter = path_filter(&roots, repo_root.as_deref(), options)?;
+    let files = match (options.git_ref.as_deref(), repo_root.as_deref()) {
+        (Some(git_ref), Some(repo_root)) => {
+            let paths = tree_paths(repo_root, git_ref)?;
+            let ignore_paths = paths
+                .iter()
+                .filter(|path| {
+                    path.file_name()
+                        .is_some_and(|name| name == IGNORE_FILE_NAME)
+                })
+                .cloned()
+                .collect();
+            let ignore_files = IgnoreFiles::new(read_blobs(repo_root, git_ref, ignore_paths)?);
+            select_paths(
+                paths,
+                &roots,
+                &options.ecosystems,
+                &options.languages,
+                &filter,
+                &ignore_files,
+            )
+        }
+        (Some(_), None) => {
+            return Err(CruxlinesError::Git {
+                message: "--git-ref needs a git repository".to_string(),
+            });
+        }
+        (None, _) => gather_paths(
+            &roots,
+            &options.ecosystems,
+            &options.languages,
+            &filter,
+            options.follow_symlinks,
+        ),
+    };
+    Ok((files, repo_root))
+}
+
+pub(crate) fn absolute_paths(paths: &[PathBuf]) -> Vec<PathBuf> {
+    paths
+        .iter()
+        .map(|path| std::path::absolute(path).unwrap_or_else(|_| path.clone()))
+        .collect()
+}
+
+/// Builds the `exclude`/`include` filter, with globs relative to the repo
+/// root, or to the first root when there is no repository.
+pub(crate) fn path_filter(
+    roots: &[PathBuf],
+    repo_root: Option<&Path>,
+    options: &Options,
+) -> Result<PathFilter, CruxlinesError> {
+    let base = match (repo_root, roots.first()) {
+        (Some(repo_root), _) => repo_root.to_path_buf(),
+        (None, Some(root)) if root.is_file() => root.parent().unwrap_or(root).to_path_buf(),
+        (None, Some(root)) => root.clone(),
+        (None, None) => PathBuf::new(),
+    };
+    PathFilter::new(&base, &options.exclude, &options.include)
+}
+
+/// Ranks already-gathered `files`, using `repo_root` for git history and the
+/// parse cache, and recording the time of each phase in `profile`.
+pub(crate) fn analyze_files(
+    files: Vec<PathBuf>,
+    repo_root: Option<PathBuf>,
+    options: &Options,
+    profile: &mut Profile,
+) -> Result<Vec<CruxLine>, CruxlinesError> {
+    let changed = profile.time(Phase::History, || {
+        match (options.since.as_deref(), repo_root.as_deref()) {
+            (Some(since), Some(repo_root)) => {
+                let head = options.git_ref.as_deref().unwrap_or("HEAD");
+                changed_lines_since(repo_root, since, head).map(Some)
+            }
+            (Some(_), None) => Err(CruxlinesError::Git {
+                message: "--since needs a git repository".to_string(),
+            }),
+            (None, _) => Ok(None),
+        }
+    })?;
+    let (mut rows, sources) = with_thread_pool(options, || {
+        cruxlines_from_paths(files, repo_root.clone(), options, profile)
+    })?;
+    profile.time(Phase::Rank, || {
+        if let Some(changed) = changed {
+            boost_changed(&mut rows, &changed);
+        }
+        apply_limit(&mut rows, options);
+        if let Some(context) = options.context {
+            attach_snippets(&mut rows, &sources, context);
+        }
+    });
+    Ok(rows)
 }
 
 pub fn cruxlines(
     repo_root: &PathBuf,
     ecosystems: &std::collections::HashSet<Ecosystem>,
 ) -> Result<Vec<OutputRow>, CruxlinesError> {
-    let paths = gather_paths(repo_root, ecosystems);
-    cruxlines_from_paths(paths, Some(repo_root.clone()))
+    let options = Options {
+        ecosystems: ecosystems.clone(),
+        ..Options::default()
+    };
+    analyze(std::slice::from_ref(repo_root), &options)
 }
 
 #[doc(hidden)]
 pub fn cruxlines_from_inputs(
     inputs: Vec<(PathBuf, String)>,
     repo_root: Option<PathBuf>,
-) -> Vec<OutputRow> {
-    let inputs = inputs.into_iter().map(Ok);
-    let (scan, frecency) = compute_edges_and_frecency(inputs, repo_root).unwrap_or_else(|_| {
-        (
-            ReferenceScan {
-                edges: Vec::new(),
-                definition_lines: HashMap::new(),
-            },
-            HashMap::new(),
-        )
-    });
+) -> Result<Vec<OutputRow>, CruxlinesError> {
+    cruxlines_from_inputs_with_options(inputs, repo_root, &Options::default())
+}
 
-    let grouped_by_ecosystem = group_edges_by_ecosystem(scan.edges);
-    let capacity: usize = grouped_by_ecosystem
-        .values()
-        .map(|grouped| grouped.len())
-        .sum();
-    let mut output_rows = Vec::with_capacity(capacity);
-    for grouped in grouped_by_ecosystem.into_values() {
-        let file_ranks = rank_files(&grouped);
+#[doc(hidden)]
+pub fn cruxlines_from_inputs_with_options(
+    inputs: Vec<(PathBuf, String)>,
+    repo_root: Option<PathBuf>,
+    options: &Options,
+) -> Result<Vec<OutputRow>, CruxlinesError> {
+    with_thread_pool(options, || {
+        let mut profile = Profile::default();
+        let inputs = inputs.into_iter().map(Ok);
+        let (mut scan, frecency) = compute_edges_and_frecency(
+            inputs,
+            &ProjectFiles::Disk,
+            repo_root,
+            options,
+            &mut profile,
+        )?;
 
-        let mut name_counts: FxHashMap<Spur, usize> = FxHashMap::default();
-        for definition in grouped.keys() {
-            *name_counts.entry(definition.name).or_default() += 1;
+        let sources = std::mem::take(&mut scan.sources);
+        let mut rows = rank_scan(scan, &frecency, options, &mut profile);
+        apply_limit(&mut rows, options);
+        if let Some(context) = options.context {
+            attach_snippets(&mut rows, &sources, context);
         }
+        Ok(rows)
+    })
+}
 
-        output_rows.extend(build_rows(
-            grouped,
-            &file_ranks,
-            &frecency,
-            &name_counts,
-            &scan.definition_lines,
-        ));
+/// Applies `kinds`, `min_score`, `depth`, `max_per_file` and then `limit` to
+/// rows already in rank order.
+///
+/// Rows of other kinds, rows below the score threshold and rows dropped by
+/// the per-file cap free up room under the global limit. Equal ranks within
+/// a file are ordered by line, so which rows survive the cap is
+/// deterministic. With a `depth`, the rows left by the filters are reordered
+/// so each is followed by its dependencies, before the cap and the limit.
+fn apply_limit(rows: &mut Vec<OutputRow>, options: &Options) {
+    let max_rank = rows.first().map(|row| row.rank).unwrap_or(0.0);
+    if options.kinds.len() < SymbolKind::ALL.len() {
+        rows.retain(|row| options.kinds.contains(&row.kind));
+    }
+    if let Some(min_score) = options.min_score
+        && max_rank > 0.0
+    {
+        rows.retain(|row| row.rank / max_rank >= min_score);
+    }
+    if options.depth > 0 {
+        expand_to_neighbors(rows, options.depth);
     }
+    if let Some(max_per_file) = options.max_per_file {
+        let mut per_file: FxHashMap<Spur, usize> = FxHashMap::default();
+        rows.retain(|row| {
+            let count = per_file.entry(row.definition.path).or_default();
+            *count += 1;
+            *count <= max_per_file
+        });
+    }
+    if let Some(limit) = options.limit {
+        rows.truncate(limit);
+    }
+}
 
-    output_rows.sort_by(|a, b| {
-        b.rank
-            .partial_cmp(&a.rank)
-            .unwrap_or(std::cmp::Ordering::Equal)
-            .then_with(|| {
-                let key_a = (
-                    a.definition.path,
-                    a.definition.line,
-                    a.definition.column,
-                    a.definition.name,
-                );
-                let key_b = (
-                    b.definition.path,
-                    b.definition.line,
-                    b.definition.column,
-                    b.definition.name,
-                );
-                key_a.cmp(&key_b)
-            })
-    });
-    output_rows
+/// Reorders rows so that, in rank order, each row not yet output is followed
+/// by the definitions it depends on within `depth` hops, breadth first.
+///
+/// A row depends on another when one of the other row's references lies
+/// inside its declaration (e.g. a call in a function body). Each row is
+/// output once, at its first position.
+fn expand_to_neighbors(rows: &mut Vec<OutputRow>, depth: usize) {
+    let dependencies = dependencies(rows);
+    let mut seen = vec![false; rows.len()];
+    let mut order = Vec::with_capacity(rows.len());
+    for seed in 0..rows.len() {
+        if seen[seed] {
+            continue;
+        }
+        seen[seed] = true;
+        order.push(seed);
+        let mut queue = VecDeque::from([(seed, 0)]);
+        while let Some((index, distance)) = queue.pop_front() {
+            if distance == depth {
+                continue;
+            }
+            for &dependency in &dependencies[index] {
+                if !seen[dependency] {
+                    seen[dependency] = true;
+                    order.push(dependency);
+                    queue.push_back((dependency, distance + 1));
+                }
+            }
+        }
+    }
+
+    let mut slots: Vec<Option<OutputRow>> = rows.drain(..).map(Some).collect();
+    rows.extend(order.into_iter().filter_map(|index| slots[index].take()));
+}
+
+/// For each row, the indices of the rows it depends on, in rank order.
+pub(crate) fn dependencies(rows: &[OutputRow]) -> Vec<Vec<usize>> {
+    dependency_counts(rows)
+        .into_iter()
+        .map(|counts| counts.into_iter().map(|(index, _)| index).collect())
+        .collect()
+}
+
+/// For each row, the rows it depends on in rank order, each with the number
+/// of its references that lie inside the row's declaration.
+pub(crate) fn dependency_counts(rows: &[OutputRow]) -> Vec<Vec<(usize, usize)>> {
+    let mut by_path: FxHashMap<Spur, Vec<usize>> = FxHashMap::default();
+    for (index, row) in rows.iter().enumerate() {
+        by_path.entry(row.definition.path).or_default().push(index);
+    }
+    for indices in by_path.values_mut() {
+        indices.sort_by_key(|&index| rows[index].definition.line);
+    }
+
+    let mut dependencies: Vec<FxHashMap<usize, usize>> = vec![FxHashMap::default(); rows.len()];
+    for (dependency, row) in rows.iter().enumerate() {
+        for reference in &row.references {
+            if let Some(dependent) = enclosing_row(rows, &by_path, reference)
+                && dependent != dependency
+            {
+                *dependencies[dependent].entry(dependency).or_default() += 1;
+            }
+        }
+    }
+    dependencies
+        .into_iter()
+        .map(|counts| {
+            let mut counts: Vec<(usize, usize)> = counts.into_iter().collect();
+            counts.sort_unstable();
+            counts
+        })
+        .collect()
+}
+
+/// The innermost row whose declaration contains `location`.
+fn enclosing_row(
+    rows: &[OutputRow],
+    by_path: &FxHashMap<Spur, Vec<usize>>,
+    location: &Location,
+) -> Option<usize> {
+    let indices = by_path.get(&location.path)?;
+    let before = indices.partition_point(|&index| rows[index].definition.line <= location.line);
+    // Nested declarations start later than the ones around them, so the
+    // closest preceding declaration that contains the line is the innermost.
+    indices[..before]
+        .iter()
+        .rev()
+        .copied()
+        .find(|&index| rows[index].end_line >= location.line)
+}
+
+/// Multiplies the rank of definitions whose declaration overlaps a changed
+/// line by [`SINCE_BOOST`], then restores rank order.
+fn boost_changed(rows: &mut [OutputRow], changed: &ChangedLines) {
+    for row in rows.iter_mut() {
+        if changed.touches(row.definition.path, row.definition.line, row.end_line) {
+            row.rank *= SINCE_BOOST;
+        }
+    }
+    sort_rows(rows);
+}
+
+/// Runs `run` on a dedicated pool when a thread count is set, otherwise on
+/// rayon's global pool (one thread per logical CPU).
+fn with_thread_pool<T: Send>(options: &Options, run: impl FnOnce() -> T + Send) -> T {
+    if let Some(threads) = options.threads
+        && let Ok(pool) = rayon::ThreadPoolBuilder::new().num_threads(threads).build()
+    {
+        return pool.install(run);
+    }
+    run()
 }
 
+/// Ranks `paths`, returning the rows along with the sources that were read
+/// (empty unless `options.context` asks for snippets).
 pub fn cruxlines_from_paths(
     paths: Vec<PathBuf>,
     repo_root: Option<PathBuf>,
-) -> Result<Vec<OutputRow>, CruxlinesError> {
-    let (scan, frecency) = if let Some(ref root) = repo_root {
-        compute_edges_and_frecency_cached(paths, root)?
+    options: &Options,
+    profile: &mut Profile,
+) -> Result<(Vec<OutputRow>, HashMap<Spur, String>), CruxlinesError> {
+    let (mut scan, frecency) = scan_paths(paths, repo_root, options, profile)?;
+
+    let sources = match options.context {
+        Some(_) => std::mem::take(&mut scan.sources),
+        None => HashMap::new(),
+    };
+    Ok((rank_scan(scan, &frecency, options, profile), sources))
+}
+
+fn scan_paths(
+    paths: Vec<PathBuf>,
+    repo_root: Option<PathBuf>,
+    options: &Options,
+    profile: &mut Profile,
+) -> Result<(ReferenceScan, HashMap<Spur, f64>), CruxlinesError> {
+    if let Some(ref root) = repo_root
+        && let Some(git_ref) = options.git_ref.as_deref()
+    {
+        let (inputs, project_files) = profile.time(Phase::Parse, || {
+            let project_paths = tree_paths(root, git_ref)?
+                .into_iter()
+                .filter(|path| is_project_file(path))
+                .collect();
+            let project_files = read_blobs(root, git_ref, project_paths)?;
+            let inputs = read_blobs(root, git_ref, paths)?;
+            Ok::<_, CruxlinesError>((
+                inputs,
+                ProjectFiles::Snapshot(project_files.into_iter().collect()),
+            ))
+        })?;
+        compute_edges_and_frecency(
+            inputs.into_iter().map(Ok),
+            &project_files,
+            repo_root,
+            options,
+            profile,
+        )
+    } else if let Some(ref root) = repo_root
+        && options.use_cache
+    {
+        compute_edges_and_frecency_cached(paths, root, options, profile)
     } else {
         let inputs = paths.into_iter().filter_map(read_input);
-        compute_edges_and_frecency(inputs, repo_root)?
+        compute_edges_and_frecency(inputs, &ProjectFiles::Disk, repo_root, options, profile)
+    }
+}
+
+fn rank_scan(
+    mut scan: ReferenceScan,
+    frecency: &HashMap<Spur, f64>,
+    options: &Options,
+    profile: &mut Profile,
+) -> Vec<OutputRow> {
+    if options.strict_parse {
+        drop_unparsed_definitions(&mut scan);
+    }
+    let tests: HashSet<Location> = match options.tests {
+        TestMode::Include => HashSet::new(),
+        TestMode::Exclude => {
+            drop_test_code(&mut scan);
+            HashSet::new()
+        }
+        TestMode::Only => scan
+            .definition_info
+            .keys()
+            .filter(|definition| scan.is_test(definition))
+            .copied()
+            .collect(),
     };
+    // Only the default mode weights individual references by frecency.
+    let empty = HashMap::new();
+    let reference_frecency = match options.rank {
+        RankMode::Frecency => frecency,
+        RankMode::PageRank | RankMode::Hybrid => &empty,
+    };
+
+    let focus = options.focus.as_deref().map(|path| {
+        let path = std::path::absolute(path).unwrap_or_else(|_| path.to_path_buf());
+        intern(&path.to_string_lossy())
+    });
 
-    let grouped_by_ecosystem = group_edges_by_ecosystem(scan.edges);
+    let (mut imports_by_ecosystem, grouped_by_ecosystem) = profile.time(Phase::Graph, || {
+        let edges = match options.edges {
+            EdgeMode::References => scan.edges,
+            EdgeMode::Calls => scan.calls,
+        };
+        (
+            group_imports_by_ecosystem(scan.imports),
+            group_edges_by_ecosystem(edges),
+        )
+    });
     let capacity: usize = grouped_by_ecosystem
         .values()
         .map(|grouped| grouped.len())
         .sum();
 
     let mut output_rows = Vec::with_capacity(capacity);
-    for (_ecosystem, grouped) in grouped_by_ecosystem {
-        let file_ranks = rank_files(&grouped);
+    for (ecosystem, grouped) in grouped_by_ecosystem {
+        let imports = imports_by_ecosystem.remove(&ecosystem).unwrap_or_default();
+        let (graph, indices) = profile.time(Phase::Graph, || build_file_graph(&grouped, &imports));
+        profile.nodes += graph.node_count();
+        profile.edges += graph.edge_count();
 
-        let mut name_counts: FxHashMap<Spur, usize> = FxHashMap::default();
-        for definition in grouped.keys() {
-            *name_counts.entry(definition.name).or_default() += 1;
-        }
+        let rows = profile.time(Phase::Rank, || {
+            let reach = focus.map(|focus| focus_reach(&graph, &indices, focus));
+            let file_ranks = rank_files(&graph, indices, options.pagerank_damping, focus);
 
-        let rows = build_rows(
-            grouped,
-            &file_ranks,
-            &frecency,
-            &name_counts,
-            &scan.definition_lines,
-        );
+            let mut fanout: FxHashMap<Location, usize> = FxHashMap::default();
+            for usage in grouped.values().flatten() {
+                *fanout.entry(*usage).or_default() += 1;
+            }
+
+            let mut rows = build_rows(
+                grouped,
+                &file_ranks,
+                reference_frecency,
+                &fanout,
+                &scan.definition_lines,
+                &scan.definition_info,
+            );
+            if let Some(rules) = options.entrypoints.get(&ecosystem) {
+                boost_entry_points(&mut rows, rules, options.entrypoint_boost);
+            }
+            penalize_parse_errors(&mut rows, &scan.parse_errors);
+            if let Some(reach) = &reach {
+                rows.retain(|row| reach.contains(&row.definition.path));
+            }
+            rows
+        });
         output_rows.extend(rows);
     }
+    profile.time(Phase::Rank, || {
+        if options.rank == RankMode::Hybrid {
+            apply_hybrid_rank(&mut output_rows, frecency);
+        }
+        if let Some(query) = options.query.as_deref() {
+            boost_query(&mut output_rows, query, options.query_weight);
+        }
 
-    output_rows.sort_by(|a, b| {
+        sort_rows(&mut output_rows);
+        if options.tests == TestMode::Only {
+            output_rows = rank_tests(
+                std::mem::take(&mut output_rows),
+                &tests,
+                &scan.definition_lines,
+                &scan.definition_info,
+            );
+            penalize_parse_errors(&mut output_rows, &scan.parse_errors);
+            sort_rows(&mut output_rows);
+        }
+    });
+    profile.definitions = output_rows.len();
+    output_rows
+}
+
+fn sort_rows(rows: &mut [OutputRow]) {
+    rows.sort_by(|a, b| {
         b.rank
             .partial_cmp(&a.rank)
             .unwrap_or(std::cmp::Ordering::Equal)
-            .then_with(|| {
-                let key_a = (
-                    a.definition.path,
-                    a.definition.line,
-                    a.definition.column,
-                    a.definition.name,
-                );
-                let key_b = (
-                    b.definition.path,
-                    b.definition.line,
-                    b.definition.column,
-                    b.definition.name,
-                );
-                key_a.cmp(&key_b)
-            })
+            .then_with(|| a.definition.sort_key().cmp(&b.definition.sort_key()))
     });
+}
 
-    Ok(output_rows)
+/// Replaces each row's rank with `pagerank / max_pagerank * frecency /
+/// max_frecency`, where frecency is that of the definition's file. Both
+/// factors land in `[0, 1]`, so neither signal dominates by scale alone.
+fn apply_hybrid_rank(rows: &mut [OutputRow], frecency: &HashMap<Spur, f64>) {
+    let definition_frecency =
+        |row: &OutputRow| frecency.get(&row.definition.path).copied().unwrap_or(1.0);
+    let max_rank = rows.iter().map(|row| row.rank).fold(0.0, f64::max);
+    let max_frecency = rows.iter().map(definition_frecency).fold(0.0, f64::max);
+    for row in rows.iter_mut() {
+        let rank = normalize(row.rank, max_rank);
+        let frecency = normalize(definition_frecency(row), max_frecency);
+        row.rank = rank * frecency;
+    }
+}
+
+fn normalize(value: f64, max: f64) -> f64 {
+    if max > 0.0 { value / max } else { 0.0 }
 }
 
-fn rank_files(grouped: &HashMap<Location, Vec<Location>>) -> FxHashMap<Spur, f64> {
-    let (graph, indices) = build_file_graph(grouped);
+/// Files connected to the `focus` file in the file graph, in either
+/// direction and through any number of files; empty when the focus file is
+/// not in the graph.
+fn focus_reach(
+    graph: &Graph<Spur, usize>,
+    indices: &FxHashMap<Spur, NodeIndex>,
+    focus: Spur,
+) -> FxHashSet<Spur> {
+    let seeds: Vec<NodeIndex> = indices.get(&focus).copied().into_iter().collect();
+    let reached = reachable(graph, &seeds);
+    indices
+        .iter()
+        .filter(|(_, index)| reached[index.index()])
+        .map(|(path, _)| *path)
+        .collect()
+}
 
+/// PageRank of each file, or with a `focus` file, personalized PageRank
+/// seeded from it (all zero when the focus file is not in the graph).
+/// Personalized PageRank moves rank one file per iteration, so it runs up
+/// to [`FOCUS_ITERATIONS`] to reach far files before it converges.
+fn rank_files(
+    graph: &Graph<Spur, usize>,
+    indices: FxHashMap<Spur, NodeIndex>,
+    damping: f64,
+    focus: Option<Spur>,
+) -> FxHashMap<Spur, f64> {
     if graph.node_count() == 0 {
         return FxHashMap::default();
     }
 
-    let ranks = petgraph::algo::page_rank::parallel_page_rank(&graph, 0.85_f64, 5, None);
+    let ranks = match focus {
+        Some(focus) => {
+            let seeds: Vec<NodeIndex> = indices.get(&focus).copied().into_iter().collect();
+            personalized_page_rank(graph, damping, FOCUS_ITERATIONS, &seeds)
+        }
+        None => page_rank(graph, damping, 5),
+    };
 
     let mut out = FxHashMap::default();
     for (path, idx) in indices {
@@ -174,12 +800,26 @@ fn rank_files(grouped: &HashMap<Location, Vec<Location>>) -> FxHashMap<Spur, f64
 
 fn compute_edges_and_frecency(
     inputs: impl IntoIterator<Item = Result<(PathBuf, String), CruxlinesError>>,
+    project_files: &ProjectFiles,
     repo_root: Option<PathBuf>,
+    options: &Options,
+    profile: &mut Profile,
 ) -> Result<(ReferenceScan, HashMap<Spur, f64>), CruxlinesError> {
-    let frecency_handle = std::thread::spawn(move || frecency_scores(repo_root.as_deref()));
+    let half_life = options.frecency_half_life;
+    let test_root = repo_root.clone();
+    let frecency_handle =
+        std::thread::spawn(move || frecency_scores(repo_root.as_deref(), half_life));
 
-    let scan = find_references(inputs)?;
-    let frecency = frecency_handle.join().unwrap_or_default();
+    let scan = profile.time(Phase::Parse, || {
+        find_references_in(inputs, project_files)
+            .map(|scan| mark_test_files(scan, test_root.as_deref()))
+    })?;
+    let frecency = profile.time(Phase::History, || {
+        frecency_handle.join().unwrap_or_default()
+    });
+    profile.files_parsed = scan.parsed_files;
+    profile.cache_hits = scan.cache_hits;
+    profile.parse_errors = scan.parse_errors.len();
 
     Ok((scan, frecency))
 }
@@ -187,57 +827,228 @@ fn compute_edges_and_frecency(
 fn compute_edges_and_frecency_cached(
     paths: Vec<PathBuf>,
     repo_root: &Path,
+    options: &Options,
+    profile: &mut Profile,
 ) -> Result<(ReferenceScan, HashMap<Spur, f64>), CruxlinesError> {
     let cache = FileCache::new(repo_root);
 
     let repo_root_clone = repo_root.to_path_buf();
+    let half_life = options.frecency_half_life;
     let frecency_handle =
-        std::thread::spawn(move || frecency_scores(Some(repo_root_clone.as_path())));
+        std::thread::spawn(move || frecency_scores(Some(repo_root_clone.as_path()), half_life));
 
-    let scan = find_references_cached(paths, &cache)?;
-    let frecency = frecency_handle.join().unwrap_or_default();
+    let scan = profile.time(Phase::Parse, || {
+        find_references_cached(paths, &cache).map(|scan| mark_test_files(scan, Some(repo_root)))
+    })?;
+    let frecency = profile.time(Phase::History, || {
+        frecency_handle.join().unwrap_or_default()
+    });
+    profile.files_parsed = scan.parsed_files;
+    profile.cache_hits = scan.cache_hits;
+    profile.parse_errors = scan.parse_errors.len();
 
     Ok((scan, frecency))
 }
 
+/// Fills in `test_files`, classifying each file by its path relative to
+/// `repo_root`, so that a checkout under a `tests/` directory is not all
+/// test code.
+fn mark_test_files(mut scan: ReferenceScan, repo_root: Option<&Path>) -> ReferenceScan {
+    scan.test_files = scan
+        .sources
+        .keys()
+        .copied()
+        .filter(|path| {
+            let path = Path::new(resolve(*path));
+            let relative = repo_root
+                .and_then(|root| path.strip_prefix(root).ok())
+                .unwrap_or(path);
+            language_for_file(path).is_some_and(|language| is_test_file(relative, language))
+        })
+        .collect();
+    scan
+}
+
+/// Flags the rows of files with syntax errors and multiplies the rank of
+/// those whose declaration overlaps an error by [`PARSE_ERROR_PENALTY`].
+fn penalize_parse_errors(
+    rows: &mut [OutputRow],
+    parse_errors: &HashMap<Spur, Vec<(usize, usize)>>,
+) {
+    for row in rows {
+        let Some(errors) = parse_errors.get(&row.definition.path) else {
+            continue;
+        };
+        row.parse_errors = errors.len();
+        row.parse_error = errors
+            .iter()
+            .any(|&(start, end)| start <= row.end_line && end >= row.definition.line);
+        if row.parse_error {
+            row.rank *= PARSE_ERROR_PENALTY;
+        }
+    }
+}
+
+/// Drops the definitions of files with syntax errors, for `strict_parse`;
+/// their references to other files still count.
+fn drop_unparsed_definitions(scan: &mut ReferenceScan) {
+    let errors = &scan.parse_errors;
+    scan.edges
+        .retain(|edge| !errors.contains_key(&edge.definition.path));
+    scan.calls
+        .retain(|edge| !errors.contains_key(&edge.definition.path));
+    scan.definition_lines
+        .retain(|definition, _| !errors.contains_key(&definition.path));
+    scan.definition_info
+        .retain(|definition, _| !errors.contains_key(&definition.path));
+}
+
+/// Drops the edges and imports that start or end in test code.
+fn drop_test_code(scan: &mut ReferenceScan) {
+    let mut edges = std::mem::take(&mut scan.edges);
+    edges.retain(|edge| !scan.is_test(&edge.definition) && !scan.is_test(&edge.usage));
+    let mut calls = std::mem::take(&mut scan.calls);
+    calls.retain(|edge| !scan.is_test(&edge.definition) && !scan.is_test(&edge.usage));
+    scan.edges = edges;
+    scan.calls = calls;
+    let test_files = &scan.test_files;
+    scan.imports.retain(|import| {
+        !test_files.contains(&import.importer) && !test_files.contains(&import.imported)
+    });
+}
+
+/// Replaces `rows` (in rank order, test code included) with one row per
+/// test definition, ranked by the summed rank of the distinct non-test rows
+/// it references. A reference counts for the innermost test definition
+/// around it. Tests that reference no ranked code are left out.
+fn rank_tests(
+    rows: Vec<OutputRow>,
+    tests: &HashSet<Location>,
+    definition_lines: &HashMap<Location, String>,
+    definition_info: &HashMap<Location, DefinitionInfo>,
+) -> Vec<OutputRow> {
+    let mut by_path: FxHashMap<Spur, Vec<(Location, usize)>> = FxHashMap::default();
+    for test in tests {
+        let end_line = definition_info
+            .get(test)
+            .map_or(test.line, |info| info.end_line);
+        by_path
+            .entry(test.path)
+            .or_default()
+            .push((*test, end_line));
+    }
+    for definitions in by_path.values_mut() {
+        definitions.sort_by_key(|(definition, _)| definition.sort_key());
+    }
+    let enclosing_test = |location: &Location| {
+        let definitions = by_path.get(&location.path)?;
+        let before = definitions.partition_point(|(test, _)| test.line <= location.line);
+        definitions[..before]
+            .iter()
+            .rev()
+            .find(|(_, end_line)| *end_line >= location.line)
+            .map(|(test, _)| *test)
+    };
+
+    let (test_rows, code_rows): (Vec<OutputRow>, Vec<OutputRow>) = rows
+        .into_iter()
+        .partition(|row| tests.contains(&row.definition));
+    let mut scores: FxHashMap<Location, f64> = FxHashMap::default();
+    for row in &code_rows {
+        let mut exercised_by: Vec<Location> =
+            row.references.iter().filter_map(enclosing_test).collect();
+        exercised_by.sort_by_key(Location::sort_key);
+        exercised_by.dedup();
+        for test in exercised_by {
+            *scores.entry(test).or_default() += row.rank;
+        }
+    }
+
+    let mut test_rows: FxHashMap<Location, OutputRow> = test_rows
+        .into_iter()
+        .map(|row| (row.definition, row))
+        .collect();
+    let mut rows: Vec<OutputRow> = scores
+        .into_iter()
+        .filter(|(_, score)| *score > 0.0)
+        .map(|(definition, score)| {
+            let mut row = test_rows.remove(&definition).unwrap_or_else(|| {
+                let info = definition_info.get(&definition);
+                OutputRow {
+                    rank: 0.0,
+                    local_score: 0.0,
+                    file_rank: 0.0,
+                    definition,
+                    kind: info.map_or(SymbolKind::Other, |info| info.kind),
+                    end_line: info.map_or(definition.line, |info| info.end_line),
+                    visibility: info.map_or(Visibility::Unknown, |info| info.visibility),
+                    entry_point: false,
+                    parse_errors: 0,
+                    parse_error: false,
+                    definition_line: definition_lines
+                        .get(&definition)
+                        .cloned()
+                        .unwrap_or_default(),
+                    references: Vec::new(),
+                    snippet: None,
+                }
+            });
+            row.rank = score;
+            row.local_score = score;
+            row
+        })
+        .collect();
+    sort_rows(&mut rows);
+    rows
+}
+
 fn build_rows(
     grouped: HashMap<Location, Vec<Location>>,
     file_ranks: &FxHashMap<Spur, f64>,
     frecency: &HashMap<Spur, f64>,
-    name_counts: &FxHashMap<Spur, usize>,
+    fanout: &FxHashMap<Location, usize>,
     definition_lines: &HashMap<Location, String>,
+    definition_info: &HashMap<Location, DefinitionInfo>,
 ) -> Vec<OutputRow> {
     grouped
         .into_par_iter()
         .map(|(definition, mut references)| {
-            references.sort_by(|a, b| {
-                let key_a = (a.path, a.line, a.column, a.name);
-                let key_b = (b.path, b.line, b.column, b.name);
-                key_a.cmp(&key_b)
-            });
-            let name_count = name_counts.get(&definition.name).copied().unwrap_or(1) as f64;
-            let weighted_refs: f64 = references
+            references.sort_by_key(|reference| reference.sort_key());
+            // A reference that matches several same-named definitions is
+            // split evenly between them.
+            let local_score: f64 = references
                 .iter()
                 .map(|reference| {
                     let file_rank = file_ranks.get(&reference.path).copied().unwrap_or(0.0);
                     let frecency = frecency.get(&reference.path).copied().unwrap_or(1.0);
-                    file_rank * frecency
+                    let fanout = fanout.get(reference).copied().unwrap_or(1) as f64;
+                    file_rank * frecency / fanout
                 })
                 .sum();
-            let local_score = weighted_refs / name_count;
             let file_rank = file_ranks.get(&definition.path).copied().unwrap_or(0.0);
             let rank = local_score * file_rank;
             let definition_line = definition_lines
                 .get(&definition)
                 .cloned()
                 .unwrap_or_default();
+            let (kind, end_line, visibility) = definition_info
+                .get(&definition)
+                .map(|info| (info.kind, info.end_line, info.visibility))
+                .unwrap_or((SymbolKind::Other, definition.line, Visibility::Unknown));
             OutputRow {
                 rank,
                 local_score,
                 file_rank,
                 definition,
+                kind,
+                end_line,
+                visibility,
+                entry_point: false,
+                parse_errors: 0,
+                parse_error: false,
                 definition_line,
                 references,
+                snippet: None,
             }
         })
         .collect()
@@ -260,13 +1071,31 @@ fn group_edges_by_ecosystem(
     grouped_by_ecosystem
 }
 
-fn frecency_scores(repo_root: Option<&std::path::Path>) -> HashMap<Spur, f64> {
+fn group_imports_by_ecosystem(imports: Vec<ImportEdge>) -> HashMap<Ecosystem, Vec<ImportEdge>> {
+    let mut grouped: HashMap<Ecosystem, Vec<ImportEdge>> = HashMap::new();
+    for import in imports {
+        grouped.entry(import.ecosystem).or_default().push(import);
+    }
+    grouped
+}
+
+/// Frecency per file from git history: `frecenfile`'s scores, or an
+/// exponential decay when a `half_life` is given.
+fn frecency_scores(
+    repo_root: Option<&std::path::Path>,
+    half_life: Option<Duration>,
+) -> HashMap<Spur, f64> {
     let Some(repo_root) = repo_root else {
         return HashMap::new();
     };
     if !repo_root.join(".git").is_dir() {
         return HashMap::new();
     }
+    if let Some(half_life) = half_life {
+        return decayed_frecency(repo_root, half_life)
+            .map(|scores| scores.into_iter().collect())
+            .unwrap_or_default();
+    }
     let Ok(scores) = frecenfile::analyze_repo(repo_root, None, None) else {
         return HashMap::new();
     };
@@ -294,12 +1123,55 @@ fn read_input(path: PathBuf) -> Option<Result<(PathBuf, String), CruxlinesError>
 
 #[cfg(test)]
 mod tests {
-    use super::{cruxlines_from_inputs, group_edges_by_ecosystem};
-    use crate::find_references::{Location, ReferenceEdge};
+    use super::{
+        OutputRow, collapse_to_files, cruxlines_from_inputs, cruxlines_from_inputs_with_options,
+        group_edges_by_ecosystem, rank_scan,
+    };
+    use crate::find_references::{Location, ReferenceEdge, find_references};
     use crate::intern::intern;
-    use crate::languages::Ecosystem;
+    use crate::languages::{Ecosystem, SymbolKind};
+    use crate::options::{EntryPoints, FileScore, Options, RankMode, TestMode};
+    use crate::profile::Profile;
+    use std::collections::HashMap;
     use std::path::PathBuf;
 
+    fn rank_with_hot_alpha(rank: RankMode) -> (f64, f64) {
+        let inputs = vec![
+            (
+                PathBuf::from("a.py"),
+                "def alpha():\n    pass\n".to_string(),
+            ),
+            (PathBuf::from("b.py"), "def beta():\n    pass\n".to_string()),
+            (
+                PathBuf::from("c.py"),
+                "from a import alpha\n\nalpha()\n".to_string(),
+            ),
+            (
+                PathBuf::from("d.py"),
+                "from b import beta\n\nbeta()\n".to_string(),
+            ),
+        ];
+        let scan = find_references(inputs.into_iter().map(Ok)).expect("scan");
+        let frecency = HashMap::from([
+            (intern("a.py"), 10.0),
+            (intern("c.py"), 10.0),
+            (intern("b.py"), 1.0),
+            (intern("d.py"), 1.0),
+        ]);
+        let options = Options {
+            rank,
+            ..Options::default()
+        };
+        let rows = rank_scan(scan, &frecency, &options, &mut Profile::default());
+        let score = |name: &str| {
+            rows.iter()
+                .find(|row: &&OutputRow| row.definition.name_str() == name)
+                .map(|row| row.rank)
+                .expect("row")
+        };
+        (score("alpha"), score("beta"))
+    }
+
     #[test]
     fn analyze_paths_produces_rows() {
         let files = vec![
@@ -316,7 +1188,7 @@ mod tests {
                 std::fs::read_to_string("src/languages/python/fixtures/models.py").expect("read"),
             ),
         ];
-        let rows = cruxlines_from_inputs(files, None);
+        let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
         assert!(!rows.is_empty());
         assert!(rows.iter().any(|row| row.definition.name_str() == "add"));
     }
@@ -334,7 +1206,7 @@ mod tests {
                 "from a import foo, bar\n\nfoo()\nbar()\n".to_string(),
             ),
         ];
-        let rows = cruxlines_from_inputs(inputs, None);
+        let rows = cruxlines_from_inputs(inputs, None).expect("analyze inputs");
         let foo_scores: Vec<f64> = rows
             .iter()
             .filter(|row| row.definition.name_str() == "foo")
@@ -361,7 +1233,7 @@ mod tests {
                 "from a import foo\nfrom b import foo\n\nfoo()\n".to_string(),
             ),
         ];
-        let rows = cruxlines_from_inputs(inputs, None);
+        let rows = cruxlines_from_inputs(inputs, None).expect("analyze inputs");
         let a_score = rows
             .iter()
             .find(|row| row.definition.path_str().ends_with("a.py"))
@@ -398,4 +1270,458 @@ mod tests {
         let count: usize = grouped.values().map(|map| map.len()).sum();
         assert_eq!(count, 1, "expected edge to be grouped by ecosystem");
     }
+
+    #[test]
+    fn frecency_mode_prefers_recently_touched_files() {
+        let (alpha, beta) = rank_with_hot_alpha(RankMode::Frecency);
+        assert!(alpha > beta, "alpha={alpha} beta={beta}");
+    }
+
+    #[test]
+    fn pagerank_mode_ignores_frecency() {
+        let (alpha, beta) = rank_with_hot_alpha(RankMode::PageRank);
+        assert!((alpha - beta).abs() < 1e-9, "alpha={alpha} beta={beta}");
+    }
+
+    #[test]
+    fn hybrid_mode_multiplies_normalized_signals() {
+        let (alpha, beta) = rank_with_hot_alpha(RankMode::Hybrid);
+        assert!((alpha - 1.0).abs() < 1e-9, "alpha={alpha}");
+        assert!((beta - 0.1).abs() < 1e-9, "beta={beta}");
+    }
+
+    #[test]
+    fn output_order_is_independent_of_thread_count_and_input_order() {
+        let mut inputs: Vec<(PathBuf, String)> = (0..24)
+            .map(|i| {
+                (
+                    PathBuf::from(format!("mod{i}.py")),
+                    format!("def shared():\n    pass\n\ndef f{i}():\n    shared()\n"),
+                )
+            })
+            .collect();
+        let summarize = |rows: Vec<OutputRow>| -> Vec<(String, String, usize, u64)> {
+            rows.into_iter()
+                .map(|row| {
+                    (
+                        row.definition.path_str().to_string(),
+                        row.definition.name_str().to_string(),
+                        row.definition.line,
+                        row.rank.to_bits(),
+                    )
+                })
+                .collect()
+        };
+        let run = |inputs: Vec<(PathBuf, String)>, threads: usize| {
+            let options = Options {
+                threads: Some(threads),
+                ..Options::default()
+            };
+            summarize(
+                cruxlines_from_inputs_with_options(inputs, None, &options).expect("analyze inputs"),
+            )
+        };
+
+        let single = run(inputs.clone(), 1);
+        assert!(!single.is_empty());
+        assert_eq!(single, run(inputs.clone(), 4));
+        inputs.reverse();
+        assert_eq!(single, run(inputs, 8));
+    }
+
+    #[test]
+    fn collapses_rows_onto_files_by_sum_or_max() {
+        let inputs = vec![
+            (
+                PathBuf::from("a.py"),
+                "def alpha():\n    pass\n\ndef beta():\n    pass\n\ndef gamma():\n    pass\n"
+                    .to_string(),
+            ),
+            (PathBuf::from("b.py"), "def delta():\n    pass\n".to_string()),
+            (
+                PathBuf::from("c.py"),
+                "from a import alpha, beta, gamma\nfrom b import delta\n\nalpha()\nbeta()\ngamma()\ndelta()\ndelta()\n"
+                    .to_string(),
+            ),
+        ];
+        let rows = cruxlines_from_inputs_with_options(inputs, None, &Options::default())
+            .expect("analyze inputs");
+        let files = |score: FileScore| -> Vec<(&str, usize)> {
+            collapse_to_files(&rows, score)
+                .iter()
+                .map(|file| (file.path_str(), file.definitions))
+                .collect()
+        };
+
+        assert_eq!(files(FileScore::Sum), vec![("a.py", 3), ("b.py", 1)]);
+        assert_eq!(files(FileScore::Max), vec![("b.py", 1), ("a.py", 3)]);
+    }
+
+    #[test]
+    fn max_per_file_caps_rows_and_spills_over_to_other_files() {
+        let inputs = vec![
+            (
+                PathBuf::from("a.py"),
+                "def alpha():\n    pass\n\ndef beta():\n    pass\n\ndef gamma():\n    pass\n"
+                    .to_string(),
+            ),
+            (PathBuf::from("b.py"), "def delta():\n    pass\n".to_string()),
+            (
+                PathBuf::from("c.py"),
+                "from a import alpha, beta, gamma\nfrom b import delta\n\nalpha()\nbeta()\ngamma()\ndelta()\n"
+                    .to_string(),
+            ),
+        ];
+        let options = Options {
+            max_per_file: Some(1),
+            limit: Some(3),
+            ..Options::default()
+        };
+        let rows =
+            cruxlines_from_inputs_with_options(inputs, None, &options).expect("analyze inputs");
+        let names: Vec<&str> = rows.iter().map(|row| row.definition.name_str()).collect();
+        assert_eq!(names.len(), 2, "got: {names:?}");
+        assert!(
+            names.contains(&"alpha"),
+            "expected lowest line of a.py, got: {names:?}"
+        );
+        assert!(
+            names.contains(&"delta"),
+            "expected b.py to fill the budget, got: {names:?}"
+        );
+    }
+
+    #[test]
+    fn min_score_drops_rows_below_a_share_of_the_top_rank() {
+        let inputs = vec![
+            (
+                PathBuf::from("lib.py"),
+                "def hot():\n    pass\n\ndef warm():\n    pass\n\ndef cold():\n    pass\n"
+                    .to_string(),
+            ),
+            (
+                PathBuf::from("main.py"),
+                "from lib import hot, warm, cold\n\nhot()\nhot()\nhot()\nhot()\nhot()\nhot()\nhot()\nwarm()\nwarm()\nwarm()\ncold()\n"
+                    .to_string(),
+            ),
+        ];
+        let names = |min_score: f64| -> Vec<String> {
+            let options = Options {
+                min_score: Some(min_score),
+                ..Options::default()
+            };
+            cruxlines_from_inputs_with_options(inputs.clone(), None, &options)
+                .expect("analyze inputs")
+                .iter()
+                .map(|row| row.definition.name_str().to_string())
+                .collect()
+        };
+
+        assert_eq!(names(0.0), vec!["hot", "warm", "cold"]);
+        assert_eq!(names(0.4), vec!["hot", "warm"]);
+        assert_eq!(names(1.0), vec!["hot"]);
+    }
+
+    #[test]
+    fn focus_ranks_only_files_connected_to_the_focus_file() {
+        let inputs = vec![
+            (
+                PathBuf::from("/repo/tokens.py"),
+                "def sign():\n    pass\n".to_string(),
+            ),
+            (
+                PathBuf::from("/repo/session.py"),
+                "from tokens import sign\n\ndef login():\n    return sign()\n".to_string(),
+            ),
+            (
+                PathBuf::from("/repo/app.py"),
+                "from session import login\n\nlogin()\n".to_string(),
+            ),
+            (
+                PathBuf::from("/repo/billing.py"),
+                "def total():\n    pass\n".to_string(),
+            ),
+            (
+                PathBuf::from("/repo/report.py"),
+                "from billing import total\n\ntotal()\ntotal()\n".to_string(),
+            ),
+            (
+                PathBuf::from("/repo/solo.py"),
+                "def alone():\n    pass\n\nalone()\n".to_string(),
+            ),
+        ];
+        let names = |focus: &str| -> Vec<String> {
+            let options = Options {
+                focus: Some(PathBuf::from(focus)),
+                ..Options::default()
+            };
+            let mut names: Vec<String> =
+                cruxlines_from_inputs_with_options(inputs.clone(), None, &options)
+                    .expect("analyze inputs")
+                    .iter()
+                    .map(|row| row.definition.name_str().to_string())
+                    .collect();
+            names.sort();
+            names
+        };
+
+        assert_eq!(names("/repo/session.py"), vec!["login", "sign"]);
+        assert_eq!(
+            names("/repo/solo.py"),
+            vec!["alone"],
+            "a focus file without cross-file edges keeps its own symbols"
+        );
+        assert!(names("/repo/missing.py").is_empty());
+    }
+
+    #[test]
+    fn focus_keeps_files_many_hops_away() {
+        // step0 uses step1, which uses step2, ... up to step7.
+        let inputs: Vec<(PathBuf, String)> = (0..8)
+            .map(|index| {
+                let next = index + 1;
+                let source = if next < 8 {
+                    format!(
+                        "from step{next} import run{next}\n\ndef run{index}():\n    return run{next}()\n"
+                    )
+                } else {
+                    format!("def run{index}():\n    pass\n")
+                };
+                (PathBuf::from(format!("/repo/step{index}.py")), source)
+            })
+            .collect();
+        let options = Options {
+            focus: Some(PathBuf::from("/repo/step0.py")),
+            ..Options::default()
+        };
+        let rows =
+            cruxlines_from_inputs_with_options(inputs, None, &options).expect("analyze inputs");
+        let names: Vec<&str> = rows.iter().map(|row| row.definition.name_str()).collect();
+        assert!(names.contains(&"run7"), "got: {names:?}");
+        assert!(names.contains(&"run1"), "got: {names:?}");
+    }
+
+    #[test]
+    fn tests_are_left_out_by_default_and_ranked_by_the_code_they_exercise() {
+        let inputs = vec![
+            (
+                PathBuf::from("/repo/tokens.py"),
+                "def sign():\n    pass\n\ndef verify():\n    pass\n".to_string(),
+            ),
+            (
+                PathBuf::from("/repo/app.py"),
+                "from tokens import sign\n\nsign()\nsign()\n".to_string(),
+            ),
+            (
+                PathBuf::from("/repo/tests/test_tokens.py"),
+                "from tokens import sign, verify\n\ndef test_sign():\n    sign()\n\ndef test_verify():\n    verify()\n"
+                    .to_string(),
+            ),
+        ];
+        let rows = |tests: TestMode| {
+            let options = Options {
+                tests,
+                ..Options::default()
+            };
+            cruxlines_from_inputs_with_options(
+                inputs.clone(),
+                Some(PathBuf::from("/repo")),
+                &options,
+            )
+            .expect("analyze inputs")
+        };
+        let names = |rows: &[OutputRow]| -> Vec<String> {
+            rows.iter()
+                .map(|row| row.definition.name_str().to_string())
+                .collect()
+        };
+
+        let excluded = rows(TestMode::Exclude);
+        assert_eq!(names(&excluded), vec!["sign"]);
+        assert!(
+            excluded[0]
+                .references
+                .iter()
+                .all(|reference| reference.path_str() == "/repo/app.py")
+        );
+        assert_eq!(names(&rows(TestMode::Include)), vec!["sign", "verify"]);
+        assert_eq!(
+            names(&rows(TestMode::Only)),
+            vec!["test_sign", "test_verify"]
+        );
+    }
+
+    #[test]
+    fn rust_test_modules_are_test_code() {
+        let inputs = vec![(
+            PathBuf::from("/repo/src/lib.rs"),
+            "pub fn parse() {}\n\npub fn helper() {}\n\n#[cfg(test)]\nmod tests {\n    use super::*;\n\n    fn fixture() {\n        helper();\n    }\n\n    #[test]\n    fn parses() {\n        parse();\n        fixture();\n    }\n}\n"
+                .to_string(),
+        )];
+        let names = |tests: TestMode| -> Vec<String> {
+            let options = Options {
+                tests,
+                ..Options::default()
+            };
+            cruxlines_from_inputs_with_options(inputs.clone(), None, &options)
+                .expect("analyze inputs")
+                .iter()
+                .map(|row| row.definition.name_str().to_string())
+                .collect()
+        };
+
+        assert!(names(TestMode::Exclude).is_empty());
+        let mut included = names(TestMode::Include);
+        included.sort();
+        assert_eq!(included, vec!["fixture", "helper", "parse"]);
+        assert_eq!(names(TestMode::Only), vec!["fixture", "parses"]);
+    }
+
+    #[test]
+    fn kinds_filter_rows_before_the_limit() {
+        let inputs = vec![
+            (
+                PathBuf::from("lib.py"),
+                "class Config:\n    def reload(self):\n        pass\n\ndef load():\n    pass\n"
+                    .to_string(),
+            ),
+            (
+                PathBuf::from("main.py"),
+                "from lib import Config, load\n\nConfig()\nConfig()\nConfig()\nload()\n"
+                    .to_string(),
+            ),
+        ];
+        let names = |options: &Options| -> Vec<String> {
+            cruxlines_from_inputs_with_options(inputs.clone(), None, options)
+                .expect("analyze inputs")
+                .iter()
+                .map(|row| row.definition.name_str().to_string())
+                .collect()
+        };
+
+        let limited = Options {
+            limit: Some(1),
+            ..Options::default()
+        };
+        assert_eq!(names(&limited), vec!["Config"]);
+        let functions = Options {
+            kinds: [SymbolKind::Function].into(),
+            ..limited
+        };
+        assert_eq!(names(&functions), vec!["load"]);
+    }
+
+    #[test]
+    fn query_boosts_matching_definitions() {
+        let inputs = vec![
+            (
+                PathBuf::from("lib.py"),
+                "def parse_config():\n    pass\n\ndef validate_user_login():\n    pass\n"
+                    .to_string(),
+            ),
+            (
+                PathBuf::from("main.py"),
+                "from lib import parse_config, validate_user_login\n\nparse_config()\nparse_config()\nvalidate_user_login()\n"
+                    .to_string(),
+            ),
+        ];
+        let first = |options: &Options| {
+            cruxlines_from_inputs_with_options(inputs.clone(), None, options)
+                .expect("analyze inputs")
+                .first()
+                .map(|row| row.definition.name_str().to_string())
+        };
+
+        assert_eq!(first(&Options::default()).as_deref(), Some("parse_config"));
+        let query = Options {
+            query: Some("user authentication login".to_string()),
+            ..Options::default()
+        };
+        assert_eq!(first(&query).as_deref(), Some("validate_user_login"));
+        let disabled = Options {
+            query_weight: 0.0,
+            ..query
+        };
+        assert_eq!(first(&disabled).as_deref(), Some("parse_config"));
+    }
+
+    #[test]
+    fn entrypoint_boost_lifts_public_definitions() {
+        let inputs = vec![
+            (
+                PathBuf::from("lib.py"),
+                "def _load():\n    pass\n\ndef serve():\n    pass\n".to_string(),
+            ),
+            (
+                PathBuf::from("main.py"),
+                "from lib import _load, serve\n\n_load()\n_load()\n_load()\nserve()\n".to_string(),
+            ),
+        ];
+        let rows = |options: &Options| -> Vec<(String, bool)> {
+            cruxlines_from_inputs_with_options(inputs.clone(), None, options)
+                .expect("analyze inputs")
+                .into_iter()
+                .map(|row| (row.definition.name_str().to_string(), row.entry_point))
+                .collect()
+        };
+
+        let boosted = Options {
+            entrypoint_boost: 4.0,
+            ..Options::default()
+        };
+        assert_eq!(
+            rows(&boosted),
+            vec![("serve".to_string(), true), ("_load".to_string(), false)]
+        );
+        let disabled = Options {
+            entrypoint_boost: 1.0,
+            ..Options::default()
+        };
+        assert_eq!(rows(&disabled)[0].0, "_load");
+
+        let mut names_only = boosted.clone();
+        names_only.entrypoints.insert(
+            Ecosystem::Python,
+            EntryPoints {
+                names: vec!["_load".to_string()],
+                public: false,
+                test_prefixes: Vec::new(),
+            },
+        );
+        assert_eq!(
+            rows(&names_only),
+            vec![("_load".to_string(), true), ("serve".to_string(), false)]
+        );
+    }
+
+    #[test]
+    fn depth_follows_crux_lines_with_their_dependencies() {
+        let inputs = vec![
+            (
+                PathBuf::from("lib.py"),
+                "def helper():\n    pass\n\ndef alpha():\n    helper()\n\ndef beta():\n    pass\n"
+                    .to_string(),
+            ),
+            (
+                PathBuf::from("main.py"),
+                "from lib import alpha, beta, helper\n\nalpha()\nalpha()\nalpha()\nalpha()\nalpha()\nbeta()\nbeta()\nbeta()\n"
+                    .to_string(),
+            ),
+        ];
+        let names = |depth: usize| -> Vec<String> {
+            let options = Options {
+                depth,
+                limit: Some(2),
+                ..Options::default()
+            };
+            cruxlines_from_inputs_with_options(inputs.clone(), None, &options)
+                .expect("analyze inputs")
+                .iter()
+                .map(|row| row.definition.name_str().to_string())
+                .collect()
+        };
+
+        assert_eq!(names(0), vec!["alpha", "beta"]);
+        assert_eq!(names(1), vec!["alpha", "helper"]);
+    }
 }
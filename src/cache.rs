@@ -1,39 +1,45 @@
 use std::fs;
 use std::io;
 use std::path::{Path, PathBuf};
-use std::time::SystemTime;
 
 use directories::ProjectDirs;
 use rustc_hash::FxHashMap;
 use serde::{Deserialize, Serialize};
 
-use crate::find_references::{Location, SerializedLocation};
+use crate::find_references::{FileResult, Location, SerializedLocation};
 use crate::languages::Ecosystem;
+use crate::languages::kind::DefinitionInfo;
 
 // Bump version when cache format changes
-const CACHE_VERSION: u32 = 3;
+const CACHE_VERSION: u32 = 21;
 
 #[derive(Serialize, Deserialize)]
 struct CachedFile {
     version: u32,
-    mtime_secs: u64,
-    mtime_nanos: u32,
-    size: u64,
+    /// Entries written by another cruxlines release or with other grammars
+    /// may use different extraction rules, so they are never reused.
+    cruxlines_version: String,
+    grammar_fingerprint: u64,
+    content_hash: u64,
     ecosystem: Ecosystem,
     definitions: Vec<SerializedLocation>,
+    declarations: Vec<SerializedLocation>,
     references: Vec<SerializedLocation>,
+    calls: Vec<SerializedLocation>,
+    receivers: Vec<SerializedLocation>,
     definition_lines: Vec<(SerializedLocation, String)>,
+    definition_info: Vec<(SerializedLocation, DefinitionInfo)>,
+    imports: Vec<Vec<PathBuf>>,
+    package_exports: Vec<String>,
+    package_imports: Vec<String>,
+    module_imports: Vec<String>,
+    test_ranges: Vec<(usize, usize)>,
+    parse_errors: Vec<(usize, usize)>,
 }
 
 pub struct FileCache {
     cache_dir: PathBuf,
-}
-
-pub struct CachedFileResult {
-    pub ecosystem: Ecosystem,
-    pub definitions: Vec<Location>,
-    pub references: Vec<Location>,
-    pub definition_lines: FxHashMap<Location, String>,
+    grammar_fingerprint: u64,
 }
 
 impl FileCache {
@@ -48,86 +54,128 @@ impl FileCache {
 
         let repo_hash = hash_path(repo_root);
         let cache_dir = cache_base.join(format!("{:016x}", repo_hash));
-        Self { cache_dir }
+        Self {
+            cache_dir,
+            grammar_fingerprint: crate::languages::grammar_fingerprint(),
+        }
     }
 
-    /// Try to load cached data for a file. Returns None if cache miss or invalid.
-    pub fn get(&self, path: &Path) -> Option<CachedFileResult> {
+    /// Try to load cached data for a file with the given contents. Returns
+    /// None if cache miss or invalid.
+    pub fn get(&self, path: &Path, source: &str) -> Option<FileResult> {
         let cache_path = self.cache_path(path);
         let bytes = fs::read(&cache_path).ok()?;
         let (cached, _): (CachedFile, _) =
             bincode::serde::decode_from_slice(&bytes, bincode::config::standard()).ok()?;
 
         // Check version
-        if cached.version != CACHE_VERSION {
+        if cached.version != CACHE_VERSION
+            || cached.cruxlines_version != env!("CARGO_PKG_VERSION")
+            || cached.grammar_fingerprint != self.grammar_fingerprint
+        {
             return None;
         }
 
-        // Check mtime and size
-        let metadata = fs::metadata(path).ok()?;
-        let mtime = metadata.modified().ok()?;
-        let size = metadata.len();
-
-        let (mtime_secs, mtime_nanos) = system_time_to_parts(mtime);
-        if cached.mtime_secs != mtime_secs
-            || cached.mtime_nanos != mtime_nanos
-            || cached.size != size
-        {
+        // Check contents
+        if cached.content_hash != content_hash(source) {
             return None;
         }
 
         // Convert SerializedLocation back to Location
         let definitions: Vec<Location> =
             cached.definitions.into_iter().map(Location::from).collect();
+        let declarations: Vec<Location> = cached
+            .declarations
+            .into_iter()
+            .map(Location::from)
+            .collect();
         let references: Vec<Location> = cached.references.into_iter().map(Location::from).collect();
+        let calls: Vec<Location> = cached.calls.into_iter().map(Location::from).collect();
+        let receivers: Vec<Location> = cached.receivers.into_iter().map(Location::from).collect();
         let definition_lines: FxHashMap<Location, String> = cached
             .definition_lines
             .into_iter()
             .map(|(loc, line)| (Location::from(loc), line))
             .collect();
+        let definition_info: FxHashMap<Location, DefinitionInfo> = cached
+            .definition_info
+            .into_iter()
+            .map(|(loc, info)| (Location::from(loc), info))
+            .collect();
 
-        Some(CachedFileResult {
+        Some(FileResult {
             ecosystem: cached.ecosystem,
             definitions,
+            declarations,
             references,
+            calls,
+            receivers,
             definition_lines,
+            definition_info,
+            imports: cached.imports,
+            package_exports: cached.package_exports,
+            package_imports: cached.package_imports,
+            module_imports: cached.module_imports,
+            test_ranges: cached.test_ranges,
+            parse_errors: cached.parse_errors,
         })
     }
 
-    /// Store cached data for a file.
-    pub fn set(
-        &self,
-        path: &Path,
-        ecosystem: Ecosystem,
-        definitions: &[Location],
-        references: &[Location],
-        definition_lines: &FxHashMap<Location, String>,
-    ) -> io::Result<()> {
-        // Get current mtime and size
-        let metadata = fs::metadata(path)?;
-        let mtime = metadata.modified()?;
-        let size = metadata.len();
-        let (mtime_secs, mtime_nanos) = system_time_to_parts(mtime);
-
+    /// Store cached data for a file parsed from `source`.
+    pub fn set(&self, path: &Path, source: &str, result: &FileResult) -> io::Result<()> {
         // Convert Location to SerializedLocation for storage
-        let definitions_ser: Vec<SerializedLocation> =
-            definitions.iter().map(SerializedLocation::from).collect();
-        let references_ser: Vec<SerializedLocation> =
-            references.iter().map(SerializedLocation::from).collect();
-        let definition_lines_ser: Vec<(SerializedLocation, String)> = definition_lines
+        let definitions_ser: Vec<SerializedLocation> = result
+            .definitions
+            .iter()
+            .map(SerializedLocation::from)
+            .collect();
+        let declarations_ser: Vec<SerializedLocation> = result
+            .declarations
+            .iter()
+            .map(SerializedLocation::from)
+            .collect();
+        let references_ser: Vec<SerializedLocation> = result
+            .references
+            .iter()
+            .map(SerializedLocation::from)
+            .collect();
+        let calls_ser: Vec<SerializedLocation> =
+            result.calls.iter().map(SerializedLocation::from).collect();
+        let receivers_ser: Vec<SerializedLocation> = result
+            .receivers
+            .iter()
+            .map(SerializedLocation::from)
+            .collect();
+        let definition_lines_ser: Vec<(SerializedLocation, String)> = result
+            .definition_lines
             .iter()
             .map(|(k, v)| (SerializedLocation::from(k), v.clone()))
             .collect();
+        let definition_info_ser: Vec<(SerializedLocation, DefinitionInfo)> = result
+            .definition_info
+            .iter()
+            .map(|(k, v)| (SerializedLocation::from(k), *v))
+            .collect();
 
         let cached = CachedFile {
             version: CACHE_VERSION,
-            mtime_secs,
-            mtime_nanos,
-            size,
-            ecosystem,
+            cruxlines_version: env!("CARGO_PKG_VERSION").to_string(),
+            grammar_fingerprint: self.grammar_fingerprint,
+            content_hash: content_hash(source),
+            ecosystem: result.ecosystem,
             definitions: definitions_ser,
+            declarations: declarations_ser,
             references: references_ser,
+            calls: calls_ser,
+            receivers: receivers_ser,
             definition_lines: definition_lines_ser,
+            definition_info: definition_info_ser,
+            imports: result.imports.clone(),
+            package_exports: result.package_exports.clone(),
+            package_imports: result.package_imports.clone(),
+            module_imports: result.module_imports.clone(),
+            test_ranges: result.test_ranges.clone(),
+            parse_errors: result.parse_errors.clone(),
         };
 
         let bytes = bincode::serde::encode_to_vec(&cached, bincode::config::standard())
@@ -155,9 +203,94 @@ fn hash_path(path: &Path) -> u64 {
     hasher.finish()
 }
 
-fn system_time_to_parts(time: SystemTime) -> (u64, u32) {
-    match time.duration_since(SystemTime::UNIX_EPOCH) {
-        Ok(duration) => (duration.as_secs(), duration.subsec_nanos()),
-        Err(_) => (0, 0),
+fn content_hash(source: &str) -> u64 {
+    use std::hash::{Hash, Hasher};
+    let mut hasher = rustc_hash::FxHasher::default();
+    source.hash(&mut hasher);
+    hasher.finish()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::FileCache;
+    use crate::find_references::{FileResult, Location};
+    use crate::intern::intern;
+    use crate::languages::Ecosystem;
+    use rustc_hash::FxHashMap;
+    use std::path::{Path, PathBuf};
+
+    fn temp_cache(name: &str) -> FileCache {
+        let nanos = std::time::SystemTime::now()
+            .duration_since(std::time::UNIX_EPOCH)
+            .expect("time")
+            .as_nanos();
+        FileCache {
+            cache_dir: std::env::temp_dir().join(format!("{name}-{nanos}")),
+            grammar_fingerprint: 1,
+        }
+    }
+
+    fn result() -> FileResult {
+        FileResult {
+            ecosystem: Ecosystem::Python,
+            definitions: vec![Location {
+                path: intern("cached.py"),
+                line: 1,
+                column: 5,
+                name: intern("cached"),
+            }],
+            declarations: Vec::new(),
+            references: Vec::new(),
+            calls: Vec::new(),
+            receivers: Vec::new(),
+            definition_lines: FxHashMap::default(),
+            definition_info: FxHashMap::default(),
+            imports: vec![vec![PathBuf::from("other.py")]],
+            package_exports: Vec::new(),
+            package_imports: Vec::new(),
+            module_imports: Vec::new(),
+            test_ranges: Vec::new(),
+            parse_errors: Vec::new(),
+        }
+    }
+
+    #[test]
+    fn reuses_entries_for_unchanged_contents() {
+        let cache = temp_cache("cruxlines-cache-hit");
+        let path = Path::new("cached.py");
+        let source = "def cached():\n    pass\n";
+        cache.set(path, source, &result()).expect("write cache");
+
+        let cached = cache.get(path, source).expect("cache hit");
+        assert_eq!(cached.definitions, result().definitions);
+        assert_eq!(cached.imports, result().imports);
+
+        let _ = std::fs::remove_dir_all(&cache.cache_dir);
+    }
+
+    #[test]
+    fn misses_when_contents_change() {
+        let cache = temp_cache("cruxlines-cache-content");
+        let path = Path::new("cached.py");
+        cache
+            .set(path, "def cached():\n    pass\n", &result())
+            .expect("write cache");
+
+        assert!(cache.get(path, "def renamed():\n    pass\n").is_none());
+
+        let _ = std::fs::remove_dir_all(&cache.cache_dir);
+    }
+
+    #[test]
+    fn misses_when_grammars_change() {
+        let mut cache = temp_cache("cruxlines-cache-grammar");
+        let path = Path::new("cached.py");
+        let source = "def cached():\n    pass\n";
+        cache.set(path, source, &result()).expect("write cache");
+
+        cache.grammar_fingerprint = 2;
+        assert!(cache.get(path, source).is_none());
+
+        let _ = std::fs::remove_dir_all(&cache.cache_dir);
     }
 }
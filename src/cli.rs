@@ -0,0 +1,605 @@
+use std::collections::{HashMap, HashSet};
+use std::num::NonZeroUsize;
+use std::path::PathBuf;
+use std::time::Duration;
+
+use clap::{Parser, ValueEnum};
+use serde::Serialize;
+
+use cruxlines::{
+    DEFAULT_ENTRYPOINT_BOOST, DEFAULT_PAGERANK_DAMPING, DEFAULT_QUERY_WEIGHT, Ecosystem, EdgeMode,
+    EntryPoints, FileScore, Language, Options, OutputRow, RankMode, SymbolKind, TestMode,
+    Visibility,
+};
+
+#[derive(Debug, Parser)]
+pub(crate) struct Cli {
+    #[arg(short = 'e', long = "ecosystem", value_enum)]
+    pub(crate) ecosystems: Vec<EcosystemArg>,
+    /// Only analyze these languages, e.g. `go,rust`; files of other
+    /// languages are not read
+    #[arg(
+        long = "languages",
+        value_enum,
+        value_delimiter = ',',
+        value_name = "LANGUAGES"
+    )]
+    pub(crate) languages: Vec<LanguageArg>,
+    /// Skip these languages, e.g. `javascript,typescript`
+    #[arg(
+        long = "exclude-languages",
+        value_enum,
+        value_delimiter = ',',
+        value_name = "LANGUAGES"
+    )]
+    pub(crate) exclude_languages: Vec<LanguageArg>,
+    /// Only print crux lines of these kinds, e.g. `function,method`; rows
+    /// are filtered after ranking and before `--limit`
+    #[arg(
+        long = "kinds",
+        value_enum,
+        value_delimiter = ',',
+        value_name = "KINDS"
+    )]
+    pub(crate) kinds: Vec<KindArg>,
+    /// Skip paths matching this glob (`.gitignore` syntax, relative to the
+    /// repo root), e.g. `vendor/**` or `*.pb.go`; repeatable
+    #[arg(long = "exclude", value_name = "GLOB")]
+    pub(crate) exclude: Vec<String>,
+    /// Analyze paths matching this glob even if `.gitignore` or `--exclude`
+    /// skips them; repeatable
+    #[arg(long = "include", value_name = "GLOB")]
+    pub(crate) include: Vec<String>,
+    /// Follow symlinks to directories and files, which are skipped by
+    /// default as git does; files reached twice are analyzed once
+    #[arg(long = "follow-symlinks")]
+    pub(crate) follow_symlinks: bool,
+    /// Leave out the definitions of files with syntax errors; by default
+    /// only the definitions an error overlaps are down-weighted
+    #[arg(long = "strict-parse")]
+    pub(crate) strict_parse: bool,
+    #[arg(short = 'm', long = "metadata")]
+    pub(crate) metadata: bool,
+    /// Maximum number of crux lines to print
+    #[arg(short = 'n', long = "limit")]
+    pub(crate) limit: Option<usize>,
+    /// Only print crux lines scoring at least this share of the top score,
+    /// between 0 and 1: each score is divided by the highest score of the
+    /// run, so 0.1 keeps rows within a tenth of the best one. Applied before
+    /// `--limit`
+    #[arg(long = "min-score", value_name = "SCORE", value_parser = parse_min_score)]
+    pub(crate) min_score: Option<f64>,
+    /// Maximum number of crux lines to print from any one file
+    #[arg(long = "max-per-file", value_name = "N")]
+    pub(crate) max_per_file: Option<usize>,
+    /// Follow each crux line with the definitions it depends on, up to N
+    /// hops away
+    #[arg(long = "depth", value_name = "N", default_value_t = 0)]
+    pub(crate) depth: usize,
+    /// Print each crux line's declaration plus N lines of source before and
+    /// after it
+    #[arg(long = "context", value_name = "N")]
+    pub(crate) context: Option<usize>,
+    /// Output format: quickfix-style text, a JSON array, one JSON line per
+    /// refresh as each completes (`--watch` only), a SARIF log for code
+    /// scanning, or Graphviz DOT for `--report graph`.
+    #[arg(short = 'f', long = "format", value_enum, default_value_t = OutputFormat::Text)]
+    pub(crate) format: OutputFormat,
+    /// Ranking signal: git frecency, structural PageRank, or both combined.
+    #[arg(long = "rank", value_enum, default_value_t = RankArg::Frecency)]
+    pub(crate) rank: RankArg,
+    /// Edges between definitions: every reference, or only call sites.
+    #[arg(long = "edges", value_enum, default_value_t = EdgeArg::Refs)]
+    pub(crate) edges: EdgeArg,
+    /// Test code (`*_test.go`, `test_*.py`, `*.test.ts`, Rust `tests/` and
+    /// `#[cfg(test)]`, ...): rank it like other code, leave it out, or rank
+    /// only tests, by how central the code they exercise is.
+    #[arg(long = "tests", value_enum, default_value_t = TestsArg::Exclude)]
+    pub(crate) tests: TestsArg,
+    /// PageRank damping factor, between 0 and 1 (exclusive).
+    #[arg(long = "pagerank-damping", default_value_t = DEFAULT_PAGERANK_DAMPING, value_parser = parse_damping)]
+    pub(crate) pagerank_damping: f64,
+    /// Parse every file again instead of reusing the on-disk cache.
+    #[arg(long = "no-cache")]
+    pub(crate) no_cache: bool,
+    /// Number of parser threads [default: number of logical CPUs]
+    #[arg(short = 'j', long = "threads")]
+    pub(crate) threads: Option<NonZeroUsize>,
+    /// Boost definitions changed since a git ref (e.g. `main`) or a duration
+    /// (e.g. `2w`, `3days`)
+    #[arg(long = "since", value_name = "REF_OR_DURATION")]
+    pub(crate) since: Option<String>,
+    /// Weigh git history with this half-life (e.g. `12h`, `3d`, `2w`): a
+    /// commit this old counts half as much as one made now [default: the
+    /// frecenfile weighting]
+    #[arg(long = "frecency-half-life", value_name = "DURATION", value_parser = parse_half_life)]
+    pub(crate) frecency_half_life: Option<Duration>,
+    /// Analyze the files committed at a git ref (e.g. `origin/main`) instead
+    /// of the working tree, without checking it out
+    #[arg(
+        long = "git-ref",
+        value_name = "REF",
+        conflicts_with_all = ["watch", "stdin_paths"]
+    )]
+    pub(crate) git_ref: Option<String>,
+    /// Rank by proximity to this file: the crux lines most related to it,
+    /// through what it uses and what uses it
+    #[arg(
+        long = "focus",
+        value_name = "PATH",
+        conflicts_with_all = ["report", "list_files"]
+    )]
+    pub(crate) focus: Option<PathBuf>,
+    /// Boost definitions whose name, definition line or path match these
+    /// words (e.g. "user authentication login")
+    #[arg(long = "query", value_name = "TEXT")]
+    pub(crate) query: Option<String>,
+    /// How strongly `--query` matches are boosted; 0 disables the boost.
+    #[arg(long = "query-weight", default_value_t = DEFAULT_QUERY_WEIGHT, value_parser = parse_query_weight)]
+    pub(crate) query_weight: f64,
+    /// Rank multiplier for entry points: `main`/`init` functions, public or
+    /// exported definitions and test functions; 1 only marks them.
+    #[arg(long = "entrypoint-boost", value_name = "FACTOR", default_value_t = DEFAULT_ENTRYPOINT_BOOST, value_parser = parse_entrypoint_boost)]
+    pub(crate) entrypoint_boost: f64,
+    /// Per-ecosystem entry-point heuristics from `cruxlines.toml`; other
+    /// ecosystems keep the defaults.
+    #[arg(skip)]
+    pub(crate) entrypoints: HashMap<Ecosystem, EntryPoints>,
+    /// Keep running and print the ranking as one JSON line per refresh
+    /// whenever files change
+    #[arg(long = "watch")]
+    pub(crate) watch: bool,
+    /// Analyze only the newline-separated file paths read from stdin (e.g.
+    /// from `git diff --name-only`) instead of walking the repository
+    #[arg(long = "stdin-paths")]
+    pub(crate) stdin_paths: bool,
+    /// Print a report instead of the ranking: `cycles` lists groups of files
+    /// or definitions that depend on each other, `graph` prints the graph
+    /// between definitions (with `--format dot`)
+    #[arg(long = "report", value_enum, conflicts_with = "watch")]
+    pub(crate) report: Option<ReportArg>,
+    /// Whether `--report cycles` looks for cycles between files or between
+    /// definitions
+    #[arg(long = "cycle-level", value_enum, default_value_t = CycleLevelArg::File)]
+    pub(crate) cycle_level: CycleLevelArg,
+    /// Limit `--report graph` to the N highest ranked definitions and the
+    /// edges among them
+    #[arg(long = "graph-top", value_name = "N")]
+    pub(crate) graph_top: Option<usize>,
+    /// Label `--report graph` edges with the number of references they stand
+    /// for
+    #[arg(long = "graph-weights")]
+    pub(crate) graph_weights: bool,
+    /// Rank and print definitions (`symbol`), or the files that contain them
+    /// (`file`), each scored by `--file-score` over its definitions
+    #[arg(
+        long = "granularity",
+        value_enum,
+        default_value_t = GranularityArg::Symbol,
+        conflicts_with_all = ["watch", "report", "list_files"]
+    )]
+    pub(crate) granularity: GranularityArg,
+    /// How `--granularity file` scores a file: the sum of its definitions'
+    /// scores, or the highest of them
+    #[arg(long = "file-score", value_enum, default_value_t = FileScoreArg::Sum)]
+    pub(crate) file_score: FileScoreArg,
+    /// Print only the number of crux lines (after `--limit` and the other
+    /// filters), e.g. for CI gates
+    #[arg(long = "count", conflicts_with_all = ["watch", "report", "list_files"])]
+    pub(crate) count: bool,
+    /// Print the files that would be analyzed, with their language, without
+    /// parsing or ranking them
+    #[arg(
+        long = "list-files",
+        alias = "dry-run",
+        conflicts_with_all = ["watch", "report"]
+    )]
+    pub(crate) list_files: bool,
+    /// Print the time spent walking, parsing, reading git history, building
+    /// the file graph and ranking, with file, node, edge and definition
+    /// counts, to stderr
+    #[arg(long = "profile", conflicts_with_all = ["watch", "report", "list_files"])]
+    pub(crate) profile: bool,
+    /// Write the result to this file instead of stdout, creating missing
+    /// directories; the file is replaced in one step, so it is never left
+    /// half-written
+    #[arg(short = 'o', long = "output", value_name = "PATH")]
+    pub(crate) output: Option<PathBuf>,
+    /// Read default flags from this file instead of the nearest
+    /// `cruxlines.toml`
+    #[arg(long = "config", value_name = "PATH")]
+    pub(crate) config: Option<PathBuf>,
+    /// Ignore `cruxlines.toml`
+    #[arg(long = "no-config", conflicts_with = "config")]
+    pub(crate) no_config: bool,
+}
+
+impl Cli {
+    pub(crate) fn options(&self) -> Options {
+        Options {
+            ecosystems: selected_ecosystems(&self.ecosystems),
+            languages: selected_languages(&self.languages, &self.exclude_languages),
+            kinds: selected_kinds(&self.kinds),
+            exclude: self.exclude.clone(),
+            include: self.include.clone(),
+            follow_symlinks: self.follow_symlinks,
+            strict_parse: self.strict_parse,
+            limit: self.limit,
+            min_score: self.min_score,
+            max_per_file: self.max_per_file,
+            depth: self.depth,
+            context: self.context,
+            rank: match self.rank {
+                RankArg::Frecency => RankMode::Frecency,
+                RankArg::PageRank => RankMode::PageRank,
+                RankArg::Hybrid => RankMode::Hybrid,
+            },
+            edges: match self.edges {
+                EdgeArg::Refs => EdgeMode::References,
+                EdgeArg::Calls => EdgeMode::Calls,
+            },
+            tests: match self.tests {
+                TestsArg::Include => TestMode::Include,
+                TestsArg::Exclude => TestMode::Exclude,
+                TestsArg::Only => TestMode::Only,
+            },
+            pagerank_damping: self.pagerank_damping,
+            use_cache: !self.no_cache,
+            threads: self.threads.map(NonZeroUsize::get),
+            since: self.since.clone(),
+            frecency_half_life: self.frecency_half_life,
+            git_ref: self.git_ref.clone(),
+            focus: self.focus.clone(),
+            query: self.query.clone(),
+            query_weight: self.query_weight,
+            entrypoint_boost: self.entrypoint_boost,
+            entrypoints: Ecosystem::ALL
+                .iter()
+                .map(|ecosystem| {
+                    let rules = self.entrypoints.get(ecosystem).cloned();
+                    (
+                        *ecosystem,
+                        rules.unwrap_or_else(|| EntryPoints::defaults(*ecosystem)),
+                    )
+                })
+                .collect(),
+        }
+    }
+}
+
+#[derive(Copy, Clone, Debug, PartialEq, Eq, ValueEnum)]
+pub(crate) enum RankArg {
+    Frecency,
+    #[value(name = "pagerank")]
+    PageRank,
+    Hybrid,
+}
+
+#[derive(Copy, Clone, Debug, PartialEq, Eq, ValueEnum)]
+pub(crate) enum EdgeArg {
+    Refs,
+    Calls,
+}
+
+#[derive(Copy, Clone, Debug, PartialEq, Eq, ValueEnum)]
+pub(crate) enum TestsArg {
+    Include,
+    Exclude,
+    Only,
+}
+
+pub(crate) fn parse_damping(value: &str) -> Result<f64, String> {
+    let damping: f64 = value
+        .parse()
+        .map_err(|_| format!("`{value}` is not a number"))?;
+    if damping > 0.0 && damping < 1.0 {
+        Ok(damping)
+    } else {
+        Err(format!("damping must be between 0 and 1, got {damping}"))
+    }
+}
+
+pub(crate) fn parse_half_life(value: &str) -> Result<Duration, String> {
+    let half_life = humantime::parse_duration(value)
+        .map_err(|_| format!("`{value}` is not a duration like `3d` or `12h`"))?;
+    if half_life.is_zero() {
+        Err("half-life must be greater than 0".to_string())
+    } else {
+        Ok(half_life)
+    }
+}
+
+pub(crate) fn parse_min_score(value: &str) -> Result<f64, String> {
+    let score: f64 = value
+        .parse()
+        .map_err(|_| format!("`{value}` is not a number"))?;
+    if (0.0..=1.0).contains(&score) {
+        Ok(score)
+    } else {
+        Err(format!("min score must be between 0 and 1, got {score}"))
+    }
+}
+
+pub(crate) fn parse_query_weight(value: &str) -> Result<f64, String> {
+    let weight: f64 = value
+        .parse()
+        .map_err(|_| format!("`{value}` is not a number"))?;
+    if weight.is_finite() && weight >= 0.0 {
+        Ok(weight)
+    } else {
+        Err(format!("query weight must be 0 or more, got {weight}"))
+    }
+}
+
+pub(crate) fn parse_entrypoint_boost(value: &str) -> Result<f64, String> {
+    let boost: f64 = value
+        .parse()
+        .map_err(|_| format!("`{value}` is not a number"))?;
+    if boost.is_finite() && boost > 0.0 {
+        Ok(boost)
+    } else {
+        Err(format!(
+            "entrypoint boost must be greater than 0, got {boost}"
+        ))
+    }
+}
+
+#[derive(Copy, Clone, Debug, ValueEnum)]
+pub(crate) enum EcosystemArg {
+    #[value(name = "c", alias = "cpp", alias = "cxx")]
+    C,
+    #[value(name = "dotnet", alias = "csharp", alias = "cs")]
+    Dotnet,
+    #[value(name = "go")]
+    Go,
+    #[value(name = "java", alias = "jvm")]
+    Java,
+    #[value(name = "php")]
+    Php,
+    #[value(name = "python", alias = "py")]
+    Python,
+    #[value(name = "javascript", alias = "js", alias = "ts", alias = "tsx")]
+    JavaScript,
+    #[value(name = "ruby", alias = "rb")]
+    Ruby,
+    #[value(name = "rust", alias = "rs")]
+    Rust,
+    #[value(name = "shell", alias = "bash", alias = "sh")]
+    Shell,
+    #[value(name = "swift")]
+    Swift,
+}
+
+impl EcosystemArg {
+    pub(crate) fn ecosystem(self) -> Ecosystem {
+        match self {
+            EcosystemArg::C => Ecosystem::C,
+            EcosystemArg::Dotnet => Ecosystem::Dotnet,
+            EcosystemArg::Go => Ecosystem::Go,
+            EcosystemArg::Java => Ecosystem::Java,
+            EcosystemArg::Php => Ecosystem::Php,
+            EcosystemArg::Python => Ecosystem::Python,
+            EcosystemArg::JavaScript => Ecosystem::JavaScript,
+            EcosystemArg::Ruby => Ecosystem::Ruby,
+            EcosystemArg::Rust => Ecosystem::Rust,
+            EcosystemArg::Shell => Ecosystem::Shell,
+            EcosystemArg::Swift => Ecosystem::Swift,
+        }
+    }
+}
+
+#[derive(Copy, Clone, Debug, ValueEnum)]
+pub(crate) enum LanguageArg {
+    #[value(name = "bash", alias = "sh", alias = "shell")]
+    Bash,
+    #[value(name = "c")]
+    C,
+    #[value(name = "cpp", alias = "c++", alias = "cxx")]
+    Cpp,
+    #[value(name = "csharp", alias = "cs", alias = "c#")]
+    CSharp,
+    #[value(name = "go")]
+    Go,
+    #[value(name = "java")]
+    Java,
+    #[value(name = "kotlin", alias = "kt")]
+    Kotlin,
+    #[value(name = "php")]
+    Php,
+    #[value(name = "python", alias = "py")]
+    Python,
+    #[value(name = "javascript", alias = "js")]
+    JavaScript,
+    /// `.ts` and `.tsx` files.
+    #[value(name = "typescript", alias = "ts")]
+    TypeScript,
+    #[value(name = "ruby", alias = "rb")]
+    Ruby,
+    #[value(name = "rust", alias = "rs")]
+    Rust,
+    #[value(name = "swift")]
+    Swift,
+}
+
+impl LanguageArg {
+    fn languages(self) -> &'static [Language] {
+        match self {
+            LanguageArg::Bash => &[Language::Bash],
+            LanguageArg::C => &[Language::C],
+            LanguageArg::Cpp => &[Language::Cpp],
+            LanguageArg::CSharp => &[Language::CSharp],
+            LanguageArg::Go => &[Language::Go],
+            LanguageArg::Java => &[Language::Java],
+            LanguageArg::Kotlin => &[Language::Kotlin],
+            LanguageArg::Php => &[Language::Php],
+            LanguageArg::Python => &[Language::Python],
+            LanguageArg::JavaScript => &[Language::JavaScript],
+            LanguageArg::TypeScript => &[Language::TypeScript, Language::TypeScriptReact],
+            LanguageArg::Ruby => &[Language::Ruby],
+            LanguageArg::Rust => &[Language::Rust],
+            LanguageArg::Swift => &[Language::Swift],
+        }
+    }
+}
+
+/// The kinds of `--kinds`, the same for every language.
+#[derive(Copy, Clone, Debug, PartialEq, Eq, ValueEnum)]
+pub(crate) enum KindArg {
+    /// Functions, including top-level and static functions.
+    Function,
+    /// Methods of classes, structs, traits and interfaces.
+    Method,
+    /// Classes, structs, enums, interfaces, traits and type aliases.
+    Type,
+    /// Modules, namespaces and packages.
+    Module,
+    /// `const` declarations and SCREAMING_CASE assignments.
+    Constant,
+    /// Other variables, properties and fields.
+    Variable,
+    /// Definitions that fit none of the above.
+    Other,
+}
+
+impl KindArg {
+    pub(crate) fn kind(self) -> SymbolKind {
+        match self {
+            KindArg::Function => SymbolKind::Function,
+            KindArg::Method => SymbolKind::Method,
+            KindArg::Type => SymbolKind::Type,
+            KindArg::Module => SymbolKind::Module,
+            KindArg::Constant => SymbolKind::Constant,
+            KindArg::Variable => SymbolKind::Variable,
+            KindArg::Other => SymbolKind::Other,
+        }
+    }
+}
+
+#[derive(Copy, Clone, Debug, PartialEq, Eq, ValueEnum)]
+pub(crate) enum ReportArg {
+    Cycles,
+    Graph,
+}
+
+#[derive(Copy, Clone, Debug, PartialEq, Eq, ValueEnum)]
+pub(crate) enum CycleLevelArg {
+    File,
+    Symbol,
+}
+
+#[derive(Copy, Clone, Debug, PartialEq, Eq, ValueEnum)]
+pub(crate) enum GranularityArg {
+    Symbol,
+    File,
+}
+
+#[derive(Copy, Clone, Debug, PartialEq, Eq, ValueEnum)]
+pub(crate) enum FileScoreArg {
+    Sum,
+    Max,
+}
+
+impl FileScoreArg {
+    pub(crate) fn file_score(self) -> FileScore {
+        match self {
+            FileScoreArg::Sum => FileScore::Sum,
+            FileScoreArg::Max => FileScore::Max,
+        }
+    }
+}
+
+#[derive(Copy, Clone, Debug, PartialEq, Eq, ValueEnum)]
+pub(crate) enum OutputFormat {
+    Text,
+    Json,
+    #[value(alias = "ndjson")]
+    Jsonl,
+    Sarif,
+    Dot,
+}
+
+/// One crux line in `--format json` output.
+///
+/// This is a stable schema: fields may be added, but existing fields keep
+/// their names and meaning. `line` and `column` are 1-based, `file` is
+/// relative to the repo root, and `score` is the same rank used for sorting.
+#[derive(Debug, Serialize)]
+pub(crate) struct JsonRow {
+    pub(crate) file: String,
+    pub(crate) line: usize,
+    pub(crate) column: usize,
+    pub(crate) symbol: String,
+    pub(crate) kind: SymbolKind,
+    pub(crate) visibility: Visibility,
+    pub(crate) entry_point: bool,
+    pub(crate) parse_errors: usize,
+    pub(crate) parse_error: bool,
+    pub(crate) score: f64,
+    /// Present with `--context`.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub(crate) snippet: Option<JsonSnippet>,
+}
+
+/// Source lines around a crux line; `start_line` and `end_line` are 1-based
+/// and inclusive.
+#[derive(Debug, Serialize)]
+pub(crate) struct JsonSnippet {
+    pub(crate) start_line: usize,
+    pub(crate) end_line: usize,
+    pub(crate) text: String,
+}
+
+impl JsonRow {
+    pub(crate) fn new(row: &OutputRow, file: String) -> Self {
+        Self {
+            file,
+            line: row.definition.line,
+            column: row.definition.column,
+            symbol: row.definition.name_str().to_string(),
+            kind: row.kind,
+            visibility: row.visibility,
+            entry_point: row.entry_point,
+            parse_errors: row.parse_errors,
+            parse_error: row.parse_error,
+            score: row.rank,
+            snippet: row.snippet.as_ref().map(|snippet| JsonSnippet {
+                start_line: snippet.start_line,
+                end_line: snippet.end_line(),
+                text: snippet.lines.join("\n"),
+            }),
+        }
+    }
+}
+
+fn selected_ecosystems(values: &[EcosystemArg]) -> HashSet<Ecosystem> {
+    if values.is_empty() {
+        return Ecosystem::ALL.iter().copied().collect();
+    }
+    values.iter().map(|value| value.ecosystem()).collect()
+}
+
+/// All kinds when `values` is empty, otherwise only those listed.
+fn selected_kinds(values: &[KindArg]) -> HashSet<SymbolKind> {
+    if values.is_empty() {
+        return SymbolKind::ALL.iter().copied().collect();
+    }
+    values.iter().map(|value| value.kind()).collect()
+}
+
+/// All languages when `include` is empty, otherwise only those listed;
+/// `exclude` is removed from either.
+fn selected_languages(include: &[LanguageArg], exclude: &[LanguageArg]) -> HashSet<Language> {
+    let mut languages: HashSet<Language> = if include.is_empty() {
+        Language::ALL.iter().copied().collect()
+    } else {
+        include
+            .iter()
+            .flat_map(|value| value.languages())
+            .copied()
+            .collect()
+    };
+    for language in exclude.iter().flat_map(|value| value.languages()) {
+        languages.remove(language);
+    }
+    languages
+}
@@ -0,0 +1,523 @@
+use std::collections::BTreeMap;
+use std::num::NonZeroUsize;
+use std::path::{Path, PathBuf};
+
+use clap::parser::ValueSource;
+use clap::{Arg, ArgMatches, CommandFactory, ValueEnum};
+use serde::Deserialize;
+
+use cruxlines::EntryPoints;
+
+use crate::cli::{
+    Cli, EcosystemArg, GranularityArg, parse_damping, parse_entrypoint_boost, parse_half_life,
+    parse_min_score, parse_query_weight,
+};
+
+const CONFIG_FILE_NAME: &str = "cruxlines.toml";
+
+/// Defaults read from `cruxlines.toml`. Keys are the long CLI flag names;
+/// flags given on the command line win over the file.
+#[derive(Debug, Default, Deserialize)]
+#[serde(deny_unknown_fields, rename_all = "kebab-case")]
+struct Config {
+    ecosystem: Option<Vec<String>>,
+    languages: Option<Vec<String>>,
+    exclude_languages: Option<Vec<String>>,
+    kinds: Option<Vec<String>>,
+    exclude: Option<Vec<String>>,
+    include: Option<Vec<String>>,
+    follow_symlinks: Option<bool>,
+    strict_parse: Option<bool>,
+    metadata: Option<bool>,
+    limit: Option<usize>,
+    min_score: Option<f64>,
+    max_per_file: Option<usize>,
+    depth: Option<usize>,
+    context: Option<usize>,
+    format: Option<String>,
+    rank: Option<String>,
+    edges: Option<String>,
+    tests: Option<String>,
+    pagerank_damping: Option<f64>,
+    no_cache: Option<bool>,
+    threads: Option<NonZeroUsize>,
+    since: Option<String>,
+    frecency_half_life: Option<String>,
+    query: Option<String>,
+    query_weight: Option<f64>,
+    entrypoint_boost: Option<f64>,
+    entrypoints: Option<BTreeMap<String, EntryPointsConfig>>,
+    watch: Option<bool>,
+    stdin_paths: Option<bool>,
+    report: Option<String>,
+    cycle_level: Option<String>,
+    graph_top: Option<usize>,
+    graph_weights: Option<bool>,
+    granularity: Option<String>,
+    file_score: Option<String>,
+    git_ref: Option<String>,
+    count: Option<bool>,
+    profile: Option<bool>,
+    output: Option<PathBuf>,
+}
+
+/// Overrides for one ecosystem's entry-point heuristics, as an
+/// `[entrypoints.<ecosystem>]` table; missing keys keep the defaults.
+#[derive(Debug, Default, Deserialize)]
+#[serde(deny_unknown_fields, rename_all = "kebab-case")]
+struct EntryPointsConfig {
+    names: Option<Vec<String>>,
+    public: Option<bool>,
+    test_prefixes: Option<Vec<String>>,
+}
+
+/// Fills in flags not given on the command line from the config file: the
+/// one passed with `--config`, or the nearest `cruxlines.toml` above `cwd`.
+pub(crate) fn apply_config(cli: &mut Cli, matches: &ArgMatches, cwd: &Path) -> Result<(), String> {
+    if cli.no_config {
+        return Ok(());
+    }
+    let Some(path) = cli.config.clone().or_else(|| find_config(cwd)) else {
+        return Ok(());
+    };
+    let text = std::fs::read_to_string(&path)
+        .map_err(|err| format!("failed to read {}: {err}", path.display()))?;
+    let config: Config =
+        toml::from_str(&text).map_err(|err| format!("invalid {}: {err}", path.display()))?;
+    config
+        .apply(cli, matches)
+        .and_then(|()| check_conflicts(cli, matches))
+        .map_err(|err| format!("invalid {}: {err}", path.display()))
+}
+
+/// Rejects the combinations that `conflicts_with` rejects on the command
+/// line when the file set either side: clap checked the command line before
+/// the file was read.
+fn check_conflicts(cli: &Cli, matches: &ArgMatches) -> Result<(), String> {
+    let command = Cli::command();
+    let name = |arg: &Arg| {
+        let id = arg.get_id().as_str();
+        let long = arg.get_long().unwrap_or(id);
+        if matches.value_source(id) == Some(ValueSource::CommandLine) {
+            format!("--{long}")
+        } else {
+            long.to_string()
+        }
+    };
+    for arg in command.get_arguments() {
+        if !is_set(cli, arg.get_id().as_str()) {
+            continue;
+        }
+        for other in command.get_arg_conflicts_with(arg) {
+            if is_set(cli, other.get_id().as_str()) {
+                return Err(format!(
+                    "`{}` cannot be used with `{}`",
+                    name(arg),
+                    name(other)
+                ));
+            }
+        }
+    }
+    Ok(())
+}
+
+/// Whether `id` is set to something other than its default, for the
+/// arguments that take part in `conflicts_with` rules.
+fn is_set(cli: &Cli, id: &str) -> bool {
+    match id {
+        "git_ref" => cli.git_ref.is_some(),
+        "focus" => cli.focus.is_some(),
+        "watch" => cli.watch,
+        "stdin_paths" => cli.stdin_paths,
+        "report" => cli.report.is_some(),
+        "granularity" => cli.granularity != GranularityArg::Symbol,
+        "count" => cli.count,
+        "list_files" => cli.list_files,
+        "profile" => cli.profile,
+        _ => false,
+    }
+}
+
+fn find_config(cwd: &Path) -> Option<PathBuf> {
+    cwd.ancestors()
+        .map(|dir| dir.join(CONFIG_FILE_NAME))
+        .find(|path| path.is_file())
+}
+
+impl Config {
+    fn apply(self, cli: &mut Cli, matches: &ArgMatches) -> Result<(), String> {
+        let unset = |id: &str| matches.value_source(id) != Some(ValueSource::CommandLine);
+
+        if let Some(values) = self.ecosystem
+            && unset("ecosystems")
+        {
+            cli.ecosystems = values
+                .iter()
+                .map(|value| parse_value("ecosystem", value))
+                .collect::<Result<_, _>>()?;
+        }
+        if let Some(values) = self.languages
+            && unset("languages")
+        {
+            cli.languages = values
+                .iter()
+                .map(|value| parse_value("languages", value))
+                .collect::<Result<_, _>>()?;
+        }
+        if let Some(values) = self.exclude_languages
+            && unset("exclude_languages")
+        {
+            cli.exclude_languages = values
+                .iter()
+                .map(|value| parse_value("exclude-languages", value))
+                .collect::<Result<_, _>>()?;
+        }
+        if let Some(values) = self.kinds
+            && unset("kinds")
+        {
+            cli.kinds = values
+                .iter()
+                .map(|value| parse_value("kinds", value))
+                .collect::<Result<_, _>>()?;
+        }
+        if let Some(exclude) = self.exclude
+            && unset("exclude")
+        {
+            cli.exclude = exclude;
+        }
+        if let Some(include) = self.include
+            && unset("include")
+        {
+            cli.include = include;
+        }
+        if let Some(follow_symlinks) = self.follow_symlinks
+            && unset("follow_symlinks")
+        {
+            cli.follow_symlinks = follow_symlinks;
+        }
+        if let Some(strict_parse) = self.strict_parse
+            && unset("strict_parse")
+        {
+            cli.strict_parse = strict_parse;
+        }
+        if let Some(metadata) = self.metadata
+            && unset("metadata")
+        {
+            cli.metadata = metadata;
+        }
+        if let Some(limit) = self.limit
+            && unset("limit")
+        {
+            cli.limit = Some(limit);
+        }
+        if let Some(min_score) = self.min_score
+            && unset("min_score")
+        {
+            cli.min_score = Some(
+                parse_min_score(&min_score.to_string())
+                    .map_err(|err| format!("`min-score`: {err}"))?,
+            );
+        }
+        if let Some(max_per_file) = self.max_per_file
+            && unset("max_per_file")
+        {
+            cli.max_per_file = Some(max_per_file);
+        }
+        if let Some(depth) = self.depth
+            && unset("depth")
+        {
+            cli.depth = depth;
+        }
+        if let Some(context) = self.context
+            && unset("context")
+        {
+            cli.context = Some(context);
+        }
+        if let Some(format) = self.format
+            && unset("format")
+        {
+            cli.format = parse_value("format", &format)?;
+        }
+        if let Some(rank) = self.rank
+            && unset("rank")
+        {
+            cli.rank = parse_value("rank", &rank)?;
+        }
+        if let Some(edges) = self.edges
+            && unset("edges")
+        {
+            cli.edges = parse_value("edges", &edges)?;
+        }
+        if let Some(tests) = self.tests
+            && unset("tests")
+        {
+            cli.tests = parse_value("tests", &tests)?;
+        }
+        if let Some(damping) = self.pagerank_damping
+            && unset("pagerank_damping")
+        {
+            cli.pagerank_damping = parse_damping(&damping.to_string())
+                .map_err(|err| format!("`pagerank-damping`: {err}"))?;
+        }
+        if let Some(no_cache) = self.no_cache
+            && unset("no_cache")
+        {
+            cli.no_cache = no_cache;
+        }
+        if let Some(threads) = self.threads
+            && unset("threads")
+        {
+            cli.threads = Some(threads);
+        }
+        if let Some(since) = self.since
+            && unset("since")
+        {
+            cli.since = Some(since);
+        }
+        if let Some(half_life) = self.frecency_half_life
+            && unset("frecency_half_life")
+        {
+            cli.frecency_half_life = Some(
+                parse_half_life(&half_life)
+                    .map_err(|err| format!("`frecency-half-life`: {err}"))?,
+            );
+        }
+        if let Some(query) = self.query
+            && unset("query")
+        {
+            cli.query = Some(query);
+        }
+        if let Some(weight) = self.query_weight
+            && unset("query_weight")
+        {
+            cli.query_weight = parse_query_weight(&weight.to_string())
+                .map_err(|err| format!("`query-weight`: {err}"))?;
+        }
+        if let Some(boost) = self.entrypoint_boost
+            && unset("entrypoint_boost")
+        {
+            cli.entrypoint_boost = parse_entrypoint_boost(&boost.to_string())
+                .map_err(|err| format!("`entrypoint-boost`: {err}"))?;
+        }
+        for (key, overrides) in self.entrypoints.unwrap_or_default() {
+            let ecosystem = parse_value::<EcosystemArg>("entrypoints", &key)?.ecosystem();
+            let mut rules = EntryPoints::defaults(ecosystem);
+            if let Some(names) = overrides.names {
+                rules.names = names;
+            }
+            if let Some(public) = overrides.public {
+                rules.public = public;
+            }
+            if let Some(test_prefixes) = overrides.test_prefixes {
+                rules.test_prefixes = test_prefixes;
+            }
+            cli.entrypoints.insert(ecosystem, rules);
+        }
+        if let Some(watch) = self.watch
+            && unset("watch")
+        {
+            cli.watch = watch;
+        }
+        if let Some(stdin_paths) = self.stdin_paths
+            && unset("stdin_paths")
+        {
+            cli.stdin_paths = stdin_paths;
+        }
+        if let Some(report) = self.report
+            && unset("report")
+        {
+            cli.report = Some(parse_value("report", &report)?);
+        }
+        if let Some(cycle_level) = self.cycle_level
+            && unset("cycle_level")
+        {
+            cli.cycle_level = parse_value("cycle-level", &cycle_level)?;
+        }
+        if let Some(graph_top) = self.graph_top
+            && unset("graph_top")
+        {
+            cli.graph_top = Some(graph_top);
+        }
+        if let Some(graph_weights) = self.graph_weights
+            && unset("graph_weights")
+        {
+            cli.graph_weights = graph_weights;
+        }
+        if let Some(granularity) = self.granularity
+            && unset("granularity")
+        {
+            cli.granularity = parse_value("granularity", &granularity)?;
+        }
+        if let Some(file_score) = self.file_score
+            && unset("file_score")
+        {
+            cli.file_score = parse_value("file-score", &file_score)?;
+        }
+        if let Some(git_ref) = self.git_ref
+            && unset("git_ref")
+        {
+            cli.git_ref = Some(git_ref);
+        }
+        if let Some(count) = self.count
+            && unset("count")
+        {
+            cli.count = count;
+        }
+        if let Some(profile) = self.profile
+            && unset("profile")
+        {
+            cli.profile = profile;
+        }
+        if let Some(output) = self.output
+            && unset("output")
+        {
+            cli.output = Some(output);
+        }
+        Ok(())
+    }
+}
+
+/// Parses an enum value the same way clap does, aliases included.
+fn parse_value<T: ValueEnum>(key: &str, value: &str) -> Result<T, String> {
+    T::from_str(value, false).map_err(|_| {
+        let expected: Vec<String> = T::value_variants()
+            .iter()
+            .filter_map(|variant| variant.to_possible_value())
+            .map(|value| value.get_name().to_string())
+            .collect();
+        format!(
+            "`{key}`: unknown value `{value}`, expected one of {}",
+            expected.join(", ")
+        )
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::{Config, check_conflicts};
+    use crate::cli::{Cli, OutputFormat, RankArg};
+    use clap::{CommandFactory, FromArgMatches};
+    use cruxlines::{Ecosystem, EntryPoints, Language};
+
+    fn parse(args: &[&str]) -> (Cli, clap::ArgMatches) {
+        let matches = Cli::command()
+            .try_get_matches_from(std::iter::once("cruxlines").chain(args.iter().copied()))
+            .expect("parse args");
+        let cli = Cli::from_arg_matches(&matches).expect("cli");
+        (cli, matches)
+    }
+
+    fn config(text: &str) -> Config {
+        toml::from_str(text).expect("parse config")
+    }
+
+    #[test]
+    fn fills_flags_not_given_on_the_command_line() {
+        let (mut cli, matches) = parse(&["--rank", "pagerank"]);
+        config("rank = \"hybrid\"\nmax-per-file = 3\nformat = \"json\"\necosystem = [\"go\", \"rs\"]\n")
+            .apply(&mut cli, &matches)
+            .expect("apply");
+        assert_eq!(cli.rank, RankArg::PageRank);
+        assert_eq!(cli.max_per_file, Some(3));
+        assert_eq!(cli.format, OutputFormat::Json);
+        assert_eq!(cli.ecosystems.len(), 2);
+    }
+
+    #[test]
+    fn overrides_entry_points_per_ecosystem() {
+        let (mut cli, matches) = parse(&[]);
+        config("entrypoint-boost = 3.0\n\n[entrypoints.go]\nnames = [\"run\"]\npublic = false\n")
+            .apply(&mut cli, &matches)
+            .expect("apply");
+        assert_eq!(cli.entrypoint_boost, 3.0);
+        let options = cli.options();
+        let go = &options.entrypoints[&Ecosystem::Go];
+        assert_eq!(go.names, vec!["run"]);
+        assert!(!go.public);
+        assert_eq!(
+            go.test_prefixes,
+            EntryPoints::defaults(Ecosystem::Go).test_prefixes
+        );
+        assert_eq!(
+            options.entrypoints[&Ecosystem::Rust],
+            EntryPoints::defaults(Ecosystem::Rust)
+        );
+
+        let err = config("[entrypoints.cobol]\nnames = [\"main\"]\n")
+            .apply(&mut cli, &matches)
+            .expect_err("unknown ecosystem");
+        assert!(err.contains("`entrypoints`"), "got: {err}");
+    }
+
+    #[test]
+    fn reads_language_filters() {
+        let (mut cli, matches) = parse(&[]);
+        config("languages = [\"go\", \"ts\"]\nexclude-languages = [\"go\"]\n")
+            .apply(&mut cli, &matches)
+            .expect("apply");
+        let languages = cli.options().languages;
+        assert_eq!(
+            languages,
+            [Language::TypeScript, Language::TypeScriptReact].into()
+        );
+
+        let err = config("languages = [\"cobol\"]\n")
+            .apply(&mut cli, &matches)
+            .expect_err("unknown language");
+        assert!(err.contains("expected one of bash, c, cpp"), "got: {err}");
+    }
+
+    #[test]
+    fn reads_output_and_git_ref() {
+        let (mut cli, matches) = parse(&["--output", "cli.json"]);
+        config("output = \"reports/cruxlines.json\"\ngit-ref = \"origin/main\"\ncount = true\nprofile = true\n")
+            .apply(&mut cli, &matches)
+            .expect("apply");
+        assert_eq!(cli.output, Some("cli.json".into()));
+        assert_eq!(cli.git_ref.as_deref(), Some("origin/main"));
+        assert!(cli.count && cli.profile);
+        assert!(toml::from_str::<Config>("focus = \"src/main.rs\"\n").is_err());
+    }
+
+    #[test]
+    fn rejects_mode_keys_that_conflict_with_flags() {
+        let conflict = |args: &[&str], text: &str| {
+            let (mut cli, matches) = parse(args);
+            config(text).apply(&mut cli, &matches).expect("apply");
+            check_conflicts(&cli, &matches).expect_err("conflict")
+        };
+        assert_eq!(
+            conflict(&["--watch"], "report = \"graph\"\n"),
+            "`report` cannot be used with `--watch`"
+        );
+        assert_eq!(
+            conflict(&["--report", "cycles"], "count = true\n"),
+            "`count` cannot be used with `--report`"
+        );
+        assert_eq!(
+            conflict(&["--report", "cycles"], "granularity = \"file\"\n"),
+            "`granularity` cannot be used with `--report`"
+        );
+        assert_eq!(
+            conflict(&["--stdin-paths"], "git-ref = \"main\"\n"),
+            "`git-ref` cannot be used with `--stdin-paths`"
+        );
+
+        let (mut cli, matches) = parse(&["--report", "cycles"]);
+        config("granularity = \"symbol\"\nprofile = false\n")
+            .apply(&mut cli, &matches)
+            .expect("apply");
+        assert!(check_conflicts(&cli, &matches).is_ok());
+    }
+
+    #[test]
+    fn rejects_unknown_keys_and_values() {
+        assert!(toml::from_str::<Config>("rnak = \"hybrid\"\n").is_err());
+
+        let (mut cli, matches) = parse(&[]);
+        let err = config("rank = \"fast\"\n")
+            .apply(&mut cli, &matches)
+            .expect_err("unknown rank");
+        assert!(err.contains("`rank`"), "got: {err}");
+    }
+}
@@ -0,0 +1,176 @@
+use std::collections::HashMap;
+
+use lasso::Spur;
+use petgraph::algo::tarjan_scc;
+use petgraph::graph::Graph;
+use petgraph::visit::EdgeRef;
+use rustc_hash::FxHashSet;
+
+use crate::analysis::{OutputRow, dependencies};
+use crate::find_references::{Location, ReferenceScan};
+use crate::graph::build_file_graph;
+use crate::intern::resolve;
+use crate::options::EdgeMode;
+
+/// Files or definitions that all depend on each other, directly or through
+/// the other members: a strongly connected component of the dependency
+/// graph with more than one member.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Cycle<T> {
+    /// Members in path order (then line order, for definitions).
+    pub members: Vec<T>,
+    /// The dependencies between members, as `(dependent, dependency)` pairs
+    /// in the same order; breaking enough of them breaks the cycle.
+    pub edges: Vec<(T, T)>,
+}
+
+/// Cycles in the file graph used for ranking: a file depends on the files
+/// defining the symbols it references (per `edges`) and on the files it
+/// imports.
+pub(crate) fn file_cycles(scan: &ReferenceScan, edges: EdgeMode) -> Vec<Cycle<Spur>> {
+    let edges = match edges {
+        EdgeMode::References => &scan.edges,
+        EdgeMode::Calls => &scan.calls,
+    };
+    let mut grouped: HashMap<Location, Vec<Location>> = HashMap::new();
+    for edge in edges {
+        grouped.entry(edge.definition).or_default().push(edge.usage);
+    }
+    let (graph, _) = build_file_graph(&grouped, &scan.imports);
+    cycles(&graph, |path| resolve(*path))
+}
+
+/// Cycles between definitions: a definition depends on another when one of
+/// the other's references lies inside its declaration. Recursion (a
+/// definition referring to itself) is not reported.
+pub(crate) fn symbol_cycles(rows: &[OutputRow]) -> Vec<Cycle<Location>> {
+    let mut graph: Graph<Location, ()> = Graph::with_capacity(rows.len(), 0);
+    let indices: Vec<_> = rows
+        .iter()
+        .map(|row| graph.add_node(row.definition))
+        .collect();
+    for (dependent, dependencies) in dependencies(rows).into_iter().enumerate() {
+        for dependency in dependencies {
+            graph.add_edge(indices[dependent], indices[dependency], ());
+        }
+    }
+    cycles(&graph, Location::sort_key)
+}
+
+/// The strongly connected components of `graph` with at least two members,
+/// largest first, with members and edges ordered by `key`.
+fn cycles<T: Copy + PartialEq, E, K: Ord>(
+    graph: &Graph<T, E>,
+    key: impl Fn(&T) -> K,
+) -> Vec<Cycle<T>> {
+    let mut cycles: Vec<Cycle<T>> = tarjan_scc(graph)
+        .into_iter()
+        .filter(|component| component.len() > 1)
+        .map(|component| {
+            let members: FxHashSet<_> = component.iter().copied().collect();
+            let mut edges: Vec<(T, T)> = component
+                .iter()
+                .flat_map(|&node| graph.edges(node))
+                .filter(|edge| members.contains(&edge.target()))
+                .map(|edge| (graph[edge.source()], graph[edge.target()]))
+                .collect();
+            edges.sort_by(|a, b| (key(&a.0), key(&a.1)).cmp(&(key(&b.0), key(&b.1))));
+            edges.dedup();
+            let mut members: Vec<T> = component.into_iter().map(|node| graph[node]).collect();
+            members.sort_by_key(|member| key(member));
+            Cycle { members, edges }
+        })
+        .collect();
+    cycles.sort_by(|a, b| {
+        b.members
+            .len()
+            .cmp(&a.members.len())
+            .then_with(|| key(&a.members[0]).cmp(&key(&b.members[0])))
+    });
+    cycles
+}
+
+#[cfg(test)]
+mod tests {
+    use super::{file_cycles, symbol_cycles};
+    use crate::analysis::cruxlines_from_inputs;
+    use crate::find_references::find_references;
+    use crate::intern::resolve;
+    use crate::options::EdgeMode;
+    use std::path::PathBuf;
+
+    fn inputs(files: &[(&str, &str)]) -> Vec<(PathBuf, String)> {
+        files
+            .iter()
+            .map(|(path, source)| (PathBuf::from(path), source.to_string()))
+            .collect()
+    }
+
+    #[test]
+    fn reports_file_cycles_with_their_edges() {
+        let files = inputs(&[
+            (
+                "a.py",
+                "from b import beta\n\ndef alpha():\n    return beta()\n",
+            ),
+            (
+                "b.py",
+                "from c import gamma\n\ndef beta():\n    return gamma()\n",
+            ),
+            (
+                "c.py",
+                "from a import alpha\n\ndef gamma():\n    return alpha()\n",
+            ),
+            (
+                "d.py",
+                "from a import alpha\n\ndef delta():\n    return alpha()\n",
+            ),
+        ]);
+        let scan = find_references(files.into_iter().map(Ok)).expect("scan");
+
+        let cycles = file_cycles(&scan, EdgeMode::References);
+
+        assert_eq!(cycles.len(), 1);
+        let members: Vec<&str> = cycles[0]
+            .members
+            .iter()
+            .map(|path| resolve(*path))
+            .collect();
+        assert_eq!(members, vec!["a.py", "b.py", "c.py"]);
+        let edges: Vec<(&str, &str)> = cycles[0]
+            .edges
+            .iter()
+            .map(|(from, to)| (resolve(*from), resolve(*to)))
+            .collect();
+        assert_eq!(
+            edges,
+            vec![("a.py", "b.py"), ("b.py", "c.py"), ("c.py", "a.py")]
+        );
+    }
+
+    #[test]
+    fn reports_mutually_dependent_definitions() {
+        let files = inputs(&[
+            (
+                "even.py",
+                "from odd import is_odd\n\ndef is_even(n):\n    return n == 0 or is_odd(n - 1)\n",
+            ),
+            (
+                "odd.py",
+                "from even import is_even\n\ndef is_odd(n):\n    return n != 0 and is_even(n - 1)\n\ndef countdown(n):\n    return countdown(n - 1)\n",
+            ),
+        ]);
+        let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
+
+        let cycles = symbol_cycles(&rows);
+
+        assert_eq!(cycles.len(), 1, "recursion alone is not a cycle");
+        let members: Vec<&str> = cycles[0]
+            .members
+            .iter()
+            .map(|member| member.name_str())
+            .collect();
+        assert_eq!(members, vec!["is_even", "is_odd"]);
+        assert_eq!(cycles[0].edges.len(), 2);
+    }
+}
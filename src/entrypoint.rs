@@ -0,0 +1,72 @@
+use crate::analysis::OutputRow;
+use crate::languages::kind::Visibility;
+use crate::languages::{Ecosystem, SymbolKind};
+
+/// Entry points are only marked by default; ranking is unchanged until a
+/// boost is asked for.
+pub const DEFAULT_ENTRYPOINT_BOOST: f64 = 1.0;
+
+/// Which definitions of an ecosystem count as entry points: the places a
+/// reader would start from even when little refers to them.
+#[derive(Clone, Debug, PartialEq, Eq)]
+pub struct EntryPoints {
+    /// Names of functions a program or package starts from, e.g. `main`.
+    pub names: Vec<String>,
+    /// Count public or exported definitions.
+    pub public: bool,
+    /// Name prefixes of test functions, e.g. `test_`; empty to not count
+    /// tests.
+    pub test_prefixes: Vec<String>,
+}
+
+impl EntryPoints {
+    /// The built-in heuristics for `ecosystem`.
+    pub fn defaults(ecosystem: Ecosystem) -> Self {
+        let (names, test_prefixes): (&[&str], &[&str]) = match ecosystem {
+            Ecosystem::C => (&["main"], &["test_"]),
+            Ecosystem::Dotnet => (&["Main"], &[]),
+            Ecosystem::Go => (&["main", "init"], &["Test", "Benchmark", "Fuzz"]),
+            Ecosystem::Java => (&["main"], &["test"]),
+            Ecosystem::Php => (&[], &["test"]),
+            Ecosystem::Python => (&["main"], &["test_"]),
+            Ecosystem::JavaScript => (&["main"], &[]),
+            Ecosystem::Ruby => (&[], &["test_"]),
+            Ecosystem::Rust => (&["main"], &["test_"]),
+            Ecosystem::Shell => (&["main"], &[]),
+            Ecosystem::Swift => (&["main"], &["test"]),
+        };
+        Self {
+            names: names.iter().map(|name| name.to_string()).collect(),
+            public: true,
+            test_prefixes: test_prefixes.iter().map(|name| name.to_string()).collect(),
+        }
+    }
+
+    /// Entry-point names and test prefixes only apply to functions and
+    /// methods; `public` applies to every kind of definition.
+    pub(crate) fn matches(&self, row: &OutputRow) -> bool {
+        if self.public && row.visibility == Visibility::Public {
+            return true;
+        }
+        if !matches!(row.kind, SymbolKind::Function | SymbolKind::Method) {
+            return false;
+        }
+        let name = row.definition.name_str();
+        self.names.iter().any(|entry| entry == name)
+            || self
+                .test_prefixes
+                .iter()
+                .any(|prefix| name.starts_with(prefix.as_str()))
+    }
+}
+
+/// Marks the rows `rules` consider entry points and multiplies their rank by
+/// `boost`.
+pub(crate) fn boost_entry_points(rows: &mut [OutputRow], rules: &EntryPoints, boost: f64) {
+    for row in rows {
+        row.entry_point = rules.matches(row);
+        if row.entry_point {
+            row.rank *= boost;
+        }
+    }
+}
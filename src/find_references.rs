@@ -1,4 +1,5 @@
-use std::collections::HashMap;
+use std::borrow::Cow;
+use std::collections::{HashMap, HashSet};
 use std::path::{Path, PathBuf};
 
 use lasso::Spur;
@@ -9,6 +10,11 @@ use tree_sitter::{Node, Parser, Tree};
 
 use crate::cache::FileCache;
 use crate::intern::{intern, resolve};
+use crate::languages::SymbolKind;
+use crate::languages::go::GoModules;
+use crate::languages::javascript::TsConfigs;
+use crate::languages::kind::{DefinitionInfo, definition_info};
+use crate::languages::project_files::ProjectFiles;
 
 /// A source code location with interned path and name for efficiency.
 /// Use `path_str()` and `name_str()` to get string values.
@@ -33,6 +39,13 @@ impl Location {
         resolve(self.name)
     }
 
+    /// Ordering key based on string values rather than intern ids, which
+    /// depend on the order files were processed in.
+    #[inline]
+    pub fn sort_key(&self) -> (&'static str, usize, usize, &'static str) {
+        (self.path_str(), self.line, self.column, self.name_str())
+    }
+
     /// Get the path as a PathBuf (for compatibility)
     #[inline]
     pub fn path_buf(&self) -> PathBuf {
@@ -78,27 +91,125 @@ pub struct ReferenceEdge {
     pub ecosystem: crate::languages::Ecosystem,
 }
 
-pub struct ReferenceScan {
-    pub edges: Vec<ReferenceEdge>,
-    pub definition_lines: HashMap<Location, String>,
-}
-
 struct EcosystemSymbols {
     definitions: FxHashMap<Spur, Vec<Location>>,
     definition_positions: FxHashSet<(Spur, usize, usize)>,
+    declarations: Vec<Location>,
     references: Vec<Location>,
+    calls: Vec<Location>,
+    receivers: Vec<Location>,
     definition_lines: FxHashMap<Location, String>,
+    definition_info: FxHashMap<Location, DefinitionInfo>,
+    files: Vec<Spur>,
+    imports: Vec<(Spur, Vec<PathBuf>)>,
+    package_exports: FxHashMap<String, Vec<Spur>>,
+    package_imports: Vec<(Spur, String)>,
+    module_imports: Vec<(Spur, String)>,
+}
+
+/// A file-level dependency created by an import, include or require statement.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash)]
+pub struct ImportEdge {
+    pub importer: Spur,
+    pub imported: Spur,
+    pub ecosystem: crate::languages::Ecosystem,
+}
+
+pub struct ReferenceScan {
+    pub edges: Vec<ReferenceEdge>,
+    /// Edges from call sites to the functions, methods or types they call; a
+    /// subset of `edges` that ignores mere mentions of a name.
+    pub calls: Vec<ReferenceEdge>,
+    pub definition_lines: HashMap<Location, String>,
+    pub definition_info: HashMap<Location, DefinitionInfo>,
+    pub imports: Vec<ImportEdge>,
+    /// Source text of each analyzed file, as read for parsing.
+    pub sources: HashMap<Spur, String>,
+    /// Files in a supported language that were parsed or taken from the
+    /// cache.
+    pub parsed_files: usize,
+    /// How many of `parsed_files` came from the parse cache.
+    pub cache_hits: usize,
+    /// First and last lines of the test blocks of each file (Rust
+    /// `#[cfg(test)]` modules and `#[test]` functions).
+    pub test_ranges: HashMap<Spur, Vec<(usize, usize)>>,
+    /// Files that are tests as a whole by the naming conventions of their
+    /// language; filled in by the analysis, which knows the repo root.
+    pub test_files: HashSet<Spur>,
+    /// First and last lines of the syntax errors tree-sitter recovered from
+    /// in each file that has any.
+    pub parse_errors: HashMap<Spur, Vec<(usize, usize)>>,
+}
+
+impl ReferenceScan {
+    /// Whether `location` lies in a test file or a test block.
+    pub fn is_test(&self, location: &Location) -> bool {
+        self.test_files.contains(&location.path)
+            || self.test_ranges.get(&location.path).is_some_and(|ranges| {
+                ranges
+                    .iter()
+                    .any(|&(start, end)| (start..=end).contains(&location.line))
+            })
+    }
 }
 
 /// Results from processing a single file
-struct FileResult {
-    ecosystem: crate::languages::Ecosystem,
-    definitions: Vec<Location>,
-    references: Vec<Location>,
-    definition_lines: FxHashMap<Location, String>,
+pub(crate) struct FileResult {
+    pub ecosystem: crate::languages::Ecosystem,
+    pub definitions: Vec<Location>,
+    /// Forward declarations (e.g. C prototypes) and parts of C# partial types;
+    /// they stand in for the definition only when no definition with the
+    /// same name exists.
+    pub declarations: Vec<Location>,
+    pub references: Vec<Location>,
+    /// Callee names at call sites.
+    pub calls: Vec<Location>,
+    /// Receiver types of methods (Go) and extension functions (Kotlin), the
+    /// classes methods are defined in (Python, PHP) and the types members and
+    /// extensions belong to (Swift); they resolve to a type defined in the
+    /// same package when there is one, rather than to every type of that
+    /// name.
+    pub receivers: Vec<Location>,
+    pub definition_lines: FxHashMap<Location, String>,
+    pub definition_info: FxHashMap<Location, DefinitionInfo>,
+    /// Candidate paths for each import; the first candidate that matches an
+    /// analyzed file wins.
+    pub imports: Vec<Vec<PathBuf>>,
+    /// Fully-qualified names this file provides to package-aware imports
+    /// (Java and Kotlin `com.foo.Bar`, and `com.foo.*` when it is public; C#
+    /// `MyApp.Models.User` and `MyApp.Models.*`; PHP `MyApp\Models\User`;
+    /// the Swift module name). Go package paths depend on `go.mod` and are
+    /// added after parsing.
+    pub package_exports: Vec<String>,
+    /// Fully-qualified names imported by this file, resolved against the
+    /// `package_exports` of other files.
+    pub package_imports: Vec<String>,
+    /// Bare module specifiers (JavaScript/TypeScript `@/lib/util`), which
+    /// are mapped to files after parsing because they depend on tsconfig.
+    pub module_imports: Vec<String>,
+    /// First and last lines of test blocks within a non-test file (Rust
+    /// `#[cfg(test)]` modules and `#[test]` functions).
+    pub test_ranges: Vec<(usize, usize)>,
+    /// First and last lines of each `ERROR` or `MISSING` node in the tree.
+    pub parse_errors: Vec<(usize, usize)>,
 }
 
+/// [`find_references_in`] with project files read from the working tree.
+#[cfg(test)]
 pub fn find_references<I, P>(files: I) -> Result<ReferenceScan, crate::io::CruxlinesError>
+where
+    I: IntoIterator<Item = Result<(P, String), crate::io::CruxlinesError>>,
+    P: Into<PathBuf>,
+{
+    find_references_in(files, &ProjectFiles::Disk)
+}
+
+/// Finds definitions, references and imports in `files`, resolving imports
+/// with the `tsconfig.json` and `go.mod` files in `project_files`.
+pub(crate) fn find_references_in<I, P>(
+    files: I,
+    project_files: &ProjectFiles,
+) -> Result<ReferenceScan, crate::io::CruxlinesError>
 where
     I: IntoIterator<Item = Result<(P, String), crate::io::CruxlinesError>>,
     P: Into<PathBuf>,
@@ -111,64 +222,18 @@ where
         .collect();
 
     // Process files in parallel
-    let file_results: Vec<FileResult> = files
+    let file_results: Vec<(Spur, FileResult)> = files
         .par_iter()
-        .filter_map(|(path, source)| process_file(path, source))
+        .filter_map(|(path, source)| {
+            process_file(path, source).map(|result| (intern(&path.to_string_lossy()), result))
+        })
+        .collect();
+    let sources = files
+        .into_iter()
+        .map(|(path, source)| (intern(&path.to_string_lossy()), source))
         .collect();
 
-    // Merge results by ecosystem
-    let mut symbols_by_ecosystem: HashMap<crate::languages::Ecosystem, EcosystemSymbols> =
-        HashMap::new();
-
-    for result in file_results {
-        let entry = symbols_by_ecosystem
-            .entry(result.ecosystem)
-            .or_insert_with(|| EcosystemSymbols {
-                definitions: FxHashMap::default(),
-                definition_positions: FxHashSet::default(),
-                references: Vec::new(),
-                definition_lines: FxHashMap::default(),
-            });
-
-        for location in result.definitions {
-            record_definition(
-                location,
-                &mut entry.definitions,
-                &mut entry.definition_positions,
-            );
-        }
-        entry.references.extend(result.references);
-        entry.definition_lines.extend(result.definition_lines);
-    }
-
-    let mut edges = Vec::new();
-    let mut definition_lines = HashMap::new();
-    for (ecosystem, symbols) in &symbols_by_ecosystem {
-        let ecosystem_edges: Vec<ReferenceEdge> = symbols
-            .references
-            .par_iter()
-            .flat_map(|reference| {
-                make_edges(
-                    reference,
-                    *ecosystem,
-                    &symbols.definitions,
-                    &symbols.definition_positions,
-                )
-            })
-            .collect();
-        edges.extend(ecosystem_edges);
-
-        for (location, line) in &symbols.definition_lines {
-            definition_lines
-                .entry(*location)
-                .or_insert_with(|| line.clone());
-        }
-    }
-
-    Ok(ReferenceScan {
-        edges,
-        definition_lines,
-    })
+    Ok(merge_file_results(file_results, sources, 0, project_files))
 }
 
 /// Find references with caching support. Only reads and parses files that aren't cached.
@@ -177,23 +242,60 @@ pub fn find_references_cached(
     cache: &FileCache,
 ) -> Result<ReferenceScan, crate::io::CruxlinesError> {
     // Process files in parallel - check cache first, parse on miss
-    let file_results: Vec<FileResult> = paths
+    let processed: Vec<(Spur, FileResult, String, bool)> = paths
         .par_iter()
-        .filter_map(|path| process_file_cached(path, cache))
+        .filter_map(|path| {
+            process_file_cached(path, cache).map(|(result, source, cached)| {
+                (intern(&path.to_string_lossy()), result, source, cached)
+            })
+        })
         .collect();
+    let mut file_results = Vec::with_capacity(processed.len());
+    let mut sources = HashMap::with_capacity(processed.len());
+    let mut cache_hits = 0;
+    for (path, result, source, cached) in processed {
+        file_results.push((path, result));
+        sources.insert(path, source);
+        cache_hits += usize::from(cached);
+    }
+
+    Ok(merge_file_results(
+        file_results,
+        sources,
+        cache_hits,
+        &ProjectFiles::Disk,
+    ))
+}
 
-    // Rest is same as find_references
+fn merge_file_results(
+    file_results: Vec<(Spur, FileResult)>,
+    sources: HashMap<Spur, String>,
+    cache_hits: usize,
+    project_files: &ProjectFiles,
+) -> ReferenceScan {
+    let parsed_files = file_results.len();
+    let mut test_ranges = HashMap::new();
+    let mut parse_errors = HashMap::new();
     let mut symbols_by_ecosystem: HashMap<crate::languages::Ecosystem, EcosystemSymbols> =
         HashMap::new();
 
-    for result in file_results {
+    for (path, result) in file_results {
         let entry = symbols_by_ecosystem
             .entry(result.ecosystem)
             .or_insert_with(|| EcosystemSymbols {
                 definitions: FxHashMap::default(),
                 definition_positions: FxHashSet::default(),
+                declarations: Vec::new(),
                 references: Vec::new(),
+                calls: Vec::new(),
+                receivers: Vec::new(),
                 definition_lines: FxHashMap::default(),
+                definition_info: FxHashMap::default(),
+                files: Vec::new(),
+                imports: Vec::new(),
+                package_exports: FxHashMap::default(),
+                package_imports: Vec::new(),
+                module_imports: Vec::new(),
             });
 
         for location in result.definitions {
@@ -203,13 +305,72 @@ pub fn find_references_cached(
                 &mut entry.definition_positions,
             );
         }
+        entry.declarations.extend(result.declarations);
         entry.references.extend(result.references);
+        entry.calls.extend(result.calls);
+        entry.receivers.extend(result.receivers);
         entry.definition_lines.extend(result.definition_lines);
+        entry.definition_info.extend(result.definition_info);
+        entry.files.push(path);
+        entry.imports.extend(
+            result
+                .imports
+                .into_iter()
+                .map(|candidates| (path, candidates)),
+        );
+        for name in result.package_exports {
+            entry.package_exports.entry(name).or_default().push(path);
+        }
+        entry
+            .package_imports
+            .extend(result.package_imports.into_iter().map(|name| (path, name)));
+        entry.module_imports.extend(
+            result
+                .module_imports
+                .into_iter()
+                .map(|specifier| (path, specifier)),
+        );
+        if !result.test_ranges.is_empty() {
+            test_ranges.insert(path, result.test_ranges);
+        }
+        if !result.parse_errors.is_empty() {
+            parse_errors.insert(path, result.parse_errors);
+        }
+    }
+
+    let mut tsconfigs = TsConfigs::new(project_files);
+    let mut go_modules = GoModules::new(project_files);
+    for (ecosystem, symbols) in symbols_by_ecosystem.iter_mut() {
+        link_declarations(symbols);
+        resolve_module_imports(symbols, &mut tsconfigs);
+        if *ecosystem == crate::languages::Ecosystem::Go {
+            export_go_packages(symbols, &mut go_modules);
+        }
     }
 
     let mut edges = Vec::new();
+    let mut calls = Vec::new();
     let mut definition_lines = HashMap::new();
+    let mut definition_info = HashMap::new();
+    let mut imports = Vec::new();
     for (ecosystem, symbols) in &symbols_by_ecosystem {
+        let mut ecosystem_imports = resolve_imports(*ecosystem, &symbols.files, &symbols.imports);
+        ecosystem_imports.extend(resolve_package_imports(
+            *ecosystem,
+            &symbols.package_exports,
+            &symbols.package_imports,
+        ));
+        let mut imported: FxHashMap<Spur, FxHashSet<Spur>> = FxHashMap::default();
+        for import in &ecosystem_imports {
+            imported
+                .entry(import.importer)
+                .or_default()
+                .insert(import.imported);
+        }
+        if *ecosystem == crate::languages::Ecosystem::Go {
+            see_package_files(&symbols.files, &mut imported);
+        }
+
         let ecosystem_edges: Vec<ReferenceEdge> = symbols
             .references
             .par_iter()
@@ -219,50 +380,191 @@ pub fn find_references_cached(
                     *ecosystem,
                     &symbols.definitions,
                     &symbols.definition_positions,
+                    &imported,
                 )
             })
             .collect();
         edges.extend(ecosystem_edges);
+        calls.extend(
+            symbols
+                .calls
+                .par_iter()
+                .flat_map(|call| {
+                    make_edges(
+                        call,
+                        *ecosystem,
+                        &symbols.definitions,
+                        &symbols.definition_positions,
+                        &imported,
+                    )
+                })
+                .filter(|edge| is_callable(symbols.definition_info.get(&edge.definition)))
+                .collect::<Vec<_>>(),
+        );
+        edges.extend(
+            symbols
+                .receivers
+                .iter()
+                .flat_map(|receiver| receiver_edges(receiver, *ecosystem, &symbols.definitions)),
+        );
+        imports.extend(ecosystem_imports);
 
         for (location, line) in &symbols.definition_lines {
             definition_lines
                 .entry(*location)
                 .or_insert_with(|| line.clone());
         }
+        definition_info.extend(symbols.definition_info.iter().map(|(k, v)| (*k, *v)));
     }
 
-    Ok(ReferenceScan {
+    ReferenceScan {
         edges,
+        calls,
         definition_lines,
+        definition_info,
+        imports,
+        sources,
+        parsed_files,
+        cache_hits,
+        test_ranges,
+        test_files: HashSet::new(),
+        parse_errors,
+    }
+}
+
+/// Folds forward declarations into the definitions they declare, so a C
+/// prototype and its body are a single symbol. The declaration site is not
+/// counted as a reference. Declarations without a matching definition (e.g.
+/// headers of external libraries) become the definition themselves.
+///
+/// Among same-named declarations without a definition, the first by path
+/// becomes the definition and the rest fold into it; this is how the parts
+/// of a C# partial class become one symbol.
+fn link_declarations(symbols: &mut EcosystemSymbols) {
+    let mut declarations = std::mem::take(&mut symbols.declarations);
+    declarations.sort_by_key(|declaration| declaration.sort_key());
+    for declaration in declarations {
+        if symbols.definitions.contains_key(&declaration.name) {
+            symbols.definition_positions.insert((
+                declaration.path,
+                declaration.line,
+                declaration.column,
+            ));
+        } else {
+            record_definition(
+                declaration,
+                &mut symbols.definitions,
+                &mut symbols.definition_positions,
+            );
+        }
+    }
+}
+
+/// Whether a call can resolve to this definition. Types count because calling
+/// one constructs it (`User(...)` in Python or Kotlin).
+fn is_callable(info: Option<&DefinitionInfo>) -> bool {
+    info.is_none_or(|info| {
+        matches!(
+            info.kind,
+            SymbolKind::Function | SymbolKind::Method | SymbolKind::Type
+        )
     })
 }
 
-/// Process a file with cache support - returns cached result or parses fresh
-fn process_file_cached(path: &Path, cache: &FileCache) -> Option<FileResult> {
-    // Try cache first
-    if let Some(cached) = cache.get(path) {
-        return Some(FileResult {
-            ecosystem: cached.ecosystem,
-            definitions: cached.definitions,
-            references: cached.references,
-            definition_lines: cached.definition_lines,
-        });
+/// Links a method receiver to its type. Go methods can only be declared on
+/// types of their own package, so definitions from the receiver's directory
+/// win over same-named types elsewhere.
+fn receiver_edges(
+    receiver: &Location,
+    ecosystem: crate::languages::Ecosystem,
+    definitions: &FxHashMap<Spur, Vec<Location>>,
+) -> Vec<ReferenceEdge> {
+    let Some(defs) = definitions.get(&receiver.name) else {
+        return Vec::new();
+    };
+    let package = Path::new(receiver.path_str()).parent();
+    let local: Vec<&Location> = defs
+        .iter()
+        .filter(|def| Path::new(def.path_str()).parent() == package)
+        .collect();
+    let targets = if local.is_empty() {
+        defs.iter().collect()
+    } else {
+        local
+    };
+    targets
+        .into_iter()
+        .map(|def| ReferenceEdge {
+            definition: *def,
+            usage: *receiver,
+            ecosystem,
+        })
+        .collect()
+}
+
+/// Turns bare module specifiers into import candidates using the importer's
+/// tsconfig `paths`/`baseUrl`. Specifiers it cannot map are external
+/// packages and add no edge.
+fn resolve_module_imports(symbols: &mut EcosystemSymbols, tsconfigs: &mut TsConfigs) {
+    for (importer, specifier) in std::mem::take(&mut symbols.module_imports) {
+        if let Some(candidates) = tsconfigs.resolve(Path::new(resolve(importer)), &specifier) {
+            symbols.imports.push((importer, candidates));
+        }
+    }
+}
+
+/// Exports each Go file under the import path of its package, taken from the
+/// nearest `go.mod`, so imports of that path resolve to every file of the
+/// package.
+fn export_go_packages(symbols: &mut EcosystemSymbols, go_modules: &mut GoModules) {
+    for file in &symbols.files {
+        if let Some(package) = go_modules.package_path(Path::new(resolve(*file))) {
+            symbols
+                .package_exports
+                .entry(package)
+                .or_default()
+                .push(*file);
+        }
+    }
+}
+
+/// Puts the other files of a Go file's package (its directory) in scope, as
+/// Go code uses the package's definitions without importing them. This
+/// only narrows name resolution; it adds no import edges.
+fn see_package_files(files: &[Spur], imported: &mut FxHashMap<Spur, FxHashSet<Spur>>) {
+    let mut packages: FxHashMap<&Path, Vec<Spur>> = FxHashMap::default();
+    for file in files {
+        if let Some(dir) = Path::new(resolve(*file)).parent() {
+            packages.entry(dir).or_default().push(*file);
+        }
     }
+    for package in packages.values().filter(|package| package.len() > 1) {
+        for file in package {
+            imported
+                .entry(*file)
+                .or_default()
+                .extend(package.iter().filter(|other| *other != file));
+        }
+    }
+}
 
-    // Cache miss - read and parse file
+/// Process a file with cache support - returns cached result or parses fresh,
+/// along with the source that was read and whether it was a cache hit
+fn process_file_cached(path: &Path, cache: &FileCache) -> Option<(FileResult, String, bool)> {
     let source = std::fs::read_to_string(path).ok()?;
+
+    // Try cache first; entries are keyed on the file contents
+    if let Some(cached) = cache.get(path, &source) {
+        return Some((cached, source, true));
+    }
+
+    // Cache miss - parse file
     let result = process_file(path, &source)?;
 
     // Save to cache (ignore errors)
-    let _ = cache.set(
-        path,
-        result.ecosystem,
-        &result.definitions,
-        &result.references,
-        &result.definition_lines,
-    );
+    let _ = cache.set(path, &source, &result);
 
-    Some(result)
+    Some((result, source, false))
 }
 
 fn collect_definitions(
@@ -281,6 +583,11 @@ fn collect_definitions(
         };
 
     match language {
+        crate::languages::Language::Bash => {
+            crate::languages::bash::emit_definitions(path, source, tree, |loc| {
+                emit_def(loc, &mut definitions, &mut definition_lines);
+            });
+        }
         crate::languages::Language::C => {
             crate::languages::c::emit_definitions(path, source, tree, |loc| {
                 emit_def(loc, &mut definitions, &mut definition_lines);
@@ -328,11 +635,21 @@ fn collect_definitions(
                 emit_def(loc, &mut definitions, &mut definition_lines);
             });
         }
+        crate::languages::Language::Ruby => {
+            crate::languages::ruby::emit_definitions(path, source, tree, |loc| {
+                emit_def(loc, &mut definitions, &mut definition_lines);
+            });
+        }
         crate::languages::Language::Rust => {
             crate::languages::rust::emit_definitions(path, source, tree, |loc| {
                 emit_def(loc, &mut definitions, &mut definition_lines);
             });
         }
+        crate::languages::Language::Swift => {
+            crate::languages::swift::emit_definitions(path, source, tree, |loc| {
+                emit_def(loc, &mut definitions, &mut definition_lines);
+            });
+        }
     }
 
     (definitions, definition_lines)
@@ -340,14 +657,35 @@ fn collect_definitions(
 
 /// Process a single file: parse and extract definitions/references
 fn process_file(path: &Path, source: &str) -> Option<FileResult> {
-    let language = crate::languages::language_for_path(path)?;
+    let source = &*normalize_line_endings(source);
+    let language = crate::languages::language_for_source(path, source)?;
     let tree = parse_tree(&language, source)?;
     let ecosystem = crate::languages::ecosystem_for_language(language);
 
-    let (definitions, definition_lines) = collect_definitions(path, source, &tree, language);
+    let (definitions, mut definition_lines) = collect_definitions(path, source, &tree, language);
+    let declarations = collect_declarations(path, source, &tree, language);
+    for declaration in &declarations {
+        record_definition_line(declaration, source, &mut definition_lines);
+    }
+    let definition_info = definitions
+        .iter()
+        .chain(&declarations)
+        .map(|definition| {
+            let line = definition_lines.get(definition).map_or("", String::as_str);
+            (
+                *definition,
+                definition_info(language, source, &tree, definition, line),
+            )
+        })
+        .collect();
 
     let mut references = Vec::new();
     match language {
+        crate::languages::Language::Bash => {
+            crate::languages::bash::emit_references(path, source, &tree, |loc| {
+                references.push(loc);
+            });
+        }
         crate::languages::Language::C => {
             crate::languages::c::emit_references(path, source, &tree, |loc| {
                 references.push(loc);
@@ -395,21 +733,209 @@ fn process_file(path: &Path, source: &str) -> Option<FileResult> {
                 references.push(loc);
             });
         }
+        crate::languages::Language::Ruby => {
+            crate::languages::ruby::emit_references(path, source, &tree, |loc| {
+                references.push(loc);
+            });
+        }
         crate::languages::Language::Rust => {
             crate::languages::rust::emit_references(path, source, &tree, |loc| {
                 references.push(loc);
             });
         }
+        crate::languages::Language::Swift => {
+            crate::languages::swift::emit_references(path, source, &tree, |loc| {
+                references.push(loc);
+            });
+        }
+    }
+
+    let mut calls = Vec::new();
+    crate::languages::calls::emit_calls(path, source, &tree, |loc| {
+        calls.push(loc);
+    });
+
+    let mut receivers = Vec::new();
+    match language {
+        crate::languages::Language::Go => {
+            crate::languages::go::emit_receivers(path, source, &tree, |loc| {
+                receivers.push(loc);
+            });
+        }
+        crate::languages::Language::Kotlin => {
+            crate::languages::kotlin::emit_receivers(path, source, &tree, |loc| {
+                receivers.push(loc);
+            });
+        }
+        crate::languages::Language::Php => {
+            crate::languages::php::emit_receivers(path, source, &tree, |loc| {
+                receivers.push(loc);
+            });
+        }
+        crate::languages::Language::Python => {
+            crate::languages::python::emit_receivers(path, source, &tree, |loc| {
+                receivers.push(loc);
+            });
+        }
+        crate::languages::Language::Swift => {
+            crate::languages::swift::emit_receivers(path, source, &tree, |loc| {
+                receivers.push(loc);
+            });
+        }
+        _ => {}
+    }
+
+    let mut test_ranges = Vec::new();
+    if language == crate::languages::Language::Rust {
+        crate::languages::rust::emit_test_ranges(source, &tree, |start, end| {
+            test_ranges.push((start, end));
+        });
+    }
+
+    let imports = collect_imports(path, source, &tree, language);
+    let mut module_imports = Vec::new();
+    if matches!(
+        language,
+        crate::languages::Language::JavaScript
+            | crate::languages::Language::TypeScript
+            | crate::languages::Language::TypeScriptReact
+    ) {
+        crate::languages::javascript::emit_module_imports(source, &tree, |specifier| {
+            module_imports.push(specifier);
+        });
+    }
+    let mut package_exports = Vec::new();
+    let mut package_imports = Vec::new();
+    match language {
+        crate::languages::Language::Java => {
+            crate::languages::java::emit_package_exports(source, &tree, |name| {
+                package_exports.push(name);
+            });
+            crate::languages::java::emit_package_imports(source, &tree, |name| {
+                package_imports.push(name);
+            });
+        }
+        crate::languages::Language::Kotlin => {
+            crate::languages::kotlin::emit_package_exports(source, &tree, |name| {
+                package_exports.push(name);
+            });
+            crate::languages::kotlin::emit_package_imports(source, &tree, |name| {
+                package_imports.push(name);
+            });
+        }
+        crate::languages::Language::CSharp => {
+            crate::languages::csharp::emit_package_exports(source, &tree, |name| {
+                package_exports.push(name);
+            });
+            crate::languages::csharp::emit_package_imports(source, &tree, |name| {
+                package_imports.push(name);
+            });
+        }
+        crate::languages::Language::Php => {
+            crate::languages::php::emit_package_exports(source, &tree, |name| {
+                package_exports.push(name);
+            });
+            crate::languages::php::emit_package_imports(source, &tree, |name| {
+                package_imports.push(name);
+            });
+        }
+        crate::languages::Language::Go => {
+            crate::languages::go::emit_package_imports(source, &tree, |name| {
+                package_imports.push(name);
+            });
+        }
+        crate::languages::Language::Swift => {
+            crate::languages::swift::emit_package_exports(path, |name| {
+                package_exports.push(name);
+            });
+            crate::languages::swift::emit_package_imports(source, &tree, |name| {
+                package_imports.push(name);
+            });
+        }
+        _ => {}
     }
 
     Some(FileResult {
         ecosystem,
         definitions,
+        declarations,
         references,
+        calls,
+        receivers,
         definition_lines,
+        definition_info,
+        imports,
+        package_exports,
+        package_imports,
+        module_imports,
+        test_ranges,
+        parse_errors: collect_parse_errors(&tree),
     })
 }
 
+fn collect_declarations(
+    path: &Path,
+    source: &str,
+    tree: &Tree,
+    language: crate::languages::Language,
+) -> Vec<Location> {
+    let mut declarations = Vec::new();
+    match language {
+        crate::languages::Language::C => {
+            crate::languages::c::emit_declarations(path, source, tree, |loc| {
+                declarations.push(loc);
+            });
+        }
+        crate::languages::Language::CSharp => {
+            crate::languages::csharp::emit_declarations(path, source, tree, |loc| {
+                declarations.push(loc);
+            });
+        }
+        _ => {}
+    }
+    declarations
+}
+
+fn collect_imports(
+    path: &Path,
+    source: &str,
+    tree: &Tree,
+    language: crate::languages::Language,
+) -> Vec<Vec<PathBuf>> {
+    let mut imports = Vec::new();
+    match language {
+        crate::languages::Language::C | crate::languages::Language::Cpp => {
+            crate::languages::c::emit_imports(path, source, tree, |candidates| {
+                imports.push(candidates);
+            });
+        }
+        crate::languages::Language::JavaScript
+        | crate::languages::Language::TypeScript
+        | crate::languages::Language::TypeScriptReact => {
+            crate::languages::javascript::emit_imports(path, source, tree, |candidates| {
+                imports.push(candidates);
+            });
+        }
+        crate::languages::Language::Ruby => {
+            crate::languages::ruby::emit_imports(path, source, tree, |candidates| {
+                imports.push(candidates);
+            });
+        }
+        crate::languages::Language::Bash => {
+            crate::languages::bash::emit_imports(path, source, tree, |candidates| {
+                imports.push(candidates);
+            });
+        }
+        crate::languages::Language::Php => {
+            crate::languages::php::emit_imports(path, source, tree, |candidates| {
+                imports.push(candidates);
+            });
+        }
+        _ => {}
+    }
+    imports
+}
+
 fn parse_tree(language: &crate::languages::Language, source: &str) -> Option<Tree> {
     let mut parser = Parser::new();
     let ts_language = crate::languages::tree_sitter_language(*language);
@@ -417,6 +943,28 @@ fn parse_tree(language: &crate::languages::Language, source: &str) -> Option<Tre
     parser.parse(source, None)
 }
 
+/// The line spans of the `ERROR` and `MISSING` nodes of `tree`, outermost
+/// only, in source order.
+fn collect_parse_errors(tree: &Tree) -> Vec<(usize, usize)> {
+    let mut errors = Vec::new();
+    let mut stack = vec![tree.root_node()];
+    while let Some(node) = stack.pop() {
+        if node.is_error() || node.is_missing() {
+            errors.push((node.start_position().row + 1, node.end_position().row + 1));
+            continue;
+        }
+        if !node.has_error() {
+            continue;
+        }
+        for i in (0..node.child_count()).rev() {
+            if let Some(child) = node.child(i) {
+                stack.push(child);
+            }
+        }
+    }
+    errors
+}
+
 pub(crate) fn walk_tree(tree: &Tree, mut visit: impl FnMut(Node)) {
     let root = tree.root_node();
     let mut stack = vec![root];
@@ -454,7 +1002,7 @@ where
 }
 
 pub(crate) fn location_from_node(path: &Path, source: &str, node: Node) -> Option<Location> {
-    let (line, column) = position(node);
+    let (line, column) = position(node, source);
     let name = node.utf8_text(source.as_bytes()).ok()?;
     Some(Location {
         path: intern(&path.to_string_lossy()),
@@ -464,6 +1012,97 @@ pub(crate) fn location_from_node(path: &Path, source: &str, node: Node) -> Optio
     })
 }
 
+/// Resolves import candidates against the files analyzed in one ecosystem.
+///
+/// A candidate matches a file when the file path ends with it, so candidates
+/// can be full paths (relative imports) or load-path suffixes (`require "a/b"`).
+fn resolve_imports(
+    ecosystem: crate::languages::Ecosystem,
+    files: &[Spur],
+    imports: &[(Spur, Vec<PathBuf>)],
+) -> Vec<ImportEdge> {
+    let mut files_by_name: FxHashMap<&std::ffi::OsStr, Vec<Spur>> = FxHashMap::default();
+    for file in files {
+        if let Some(name) = Path::new(resolve(*file)).file_name() {
+            files_by_name.entry(name).or_default().push(*file);
+        }
+    }
+
+    let mut seen = FxHashSet::default();
+    let mut edges = Vec::new();
+    for (importer, candidates) in imports {
+        for candidate in candidates {
+            let candidate = normalize_path(candidate);
+            let Some(name) = candidate.file_name() else {
+                continue;
+            };
+            let matches: Vec<Spur> = files_by_name
+                .get(name)
+                .into_iter()
+                .flatten()
+                .copied()
+                .filter(|file| file != importer && Path::new(resolve(*file)).ends_with(&candidate))
+                .collect();
+            if matches.is_empty() {
+                continue;
+            }
+            for imported in matches {
+                if seen.insert((*importer, imported)) {
+                    edges.push(ImportEdge {
+                        importer: *importer,
+                        imported,
+                        ecosystem,
+                    });
+                }
+            }
+            break;
+        }
+    }
+    edges
+}
+
+/// Resolves fully-qualified imports (e.g. Java `com.foo.Bar` or `com.foo.*`)
+/// to the files that export those names, regardless of where they live.
+fn resolve_package_imports(
+    ecosystem: crate::languages::Ecosystem,
+    exports: &FxHashMap<String, Vec<Spur>>,
+    imports: &[(Spur, String)],
+) -> Vec<ImportEdge> {
+    let mut seen = FxHashSet::default();
+    let mut edges = Vec::new();
+    for (importer, name) in imports {
+        for imported in exports.get(name).into_iter().flatten() {
+            if imported != importer && seen.insert((*importer, *imported)) {
+                edges.push(ImportEdge {
+                    importer: *importer,
+                    imported: *imported,
+                    ecosystem,
+                });
+            }
+        }
+    }
+    edges
+}
+
+/// Lexically resolves `.` and `..` components without touching the filesystem.
+pub(crate) fn normalize_path(path: &Path) -> PathBuf {
+    let mut out = PathBuf::new();
+    for component in path.components() {
+        match component {
+            std::path::Component::CurDir => {}
+            std::path::Component::ParentDir => {
+                if out.file_name().is_some() {
+                    out.pop();
+                } else {
+                    out.push("..");
+                }
+            }
+            other => out.push(other),
+        }
+    }
+    out
+}
+
 fn record_definition(
     location: Location,
     definitions: &mut FxHashMap<Spur, Vec<Location>>,
@@ -485,12 +1124,14 @@ fn make_edges(
     ecosystem: crate::languages::Ecosystem,
     definitions: &FxHashMap<Spur, Vec<Location>>,
     definition_positions: &FxHashSet<(Spur, usize, usize)>,
+    imported: &FxHashMap<Spur, FxHashSet<Spur>>,
 ) -> Vec<ReferenceEdge> {
     if definition_positions.contains(&(location.path, location.line, location.column)) {
         return Vec::new();
     }
     if let Some(defs) = definitions.get(&location.name) {
-        defs.iter()
+        in_scope(location, defs, imported)
+            .into_iter()
             .map(|def| ReferenceEdge {
                 definition: *def,
                 usage: *location,
@@ -502,9 +1143,52 @@ fn make_edges(
     }
 }
 
-fn position(node: Node) -> (usize, usize) {
+/// Narrows same-named definitions to the ones a reference can see: those in
+/// its own file or in files it imports, so `Handler` used next to `import
+/// pkgA.Handler` does not also link to `pkgB.Handler`. Falls back to every
+/// definition when none is in scope, e.g. for a language without import
+/// resolution.
+fn in_scope<'a>(
+    reference: &Location,
+    definitions: &'a [Location],
+    imported: &FxHashMap<Spur, FxHashSet<Spur>>,
+) -> Vec<&'a Location> {
+    if definitions.len() > 1 {
+        let imports = imported.get(&reference.path);
+        let scoped: Vec<&Location> = definitions
+            .iter()
+            .filter(|def| {
+                def.path == reference.path || imports.is_some_and(|files| files.contains(&def.path))
+            })
+            .collect();
+        if !scoped.is_empty() {
+            return scoped;
+        }
+    }
+    definitions.iter().collect()
+}
+
+/// 1-based line and column of the start of `node`. Tree-sitter columns are
+/// byte offsets; the column here counts characters, as editors do, so text
+/// such as `"héllo"` earlier on the line does not shift it.
+fn position(node: Node, source: &str) -> (usize, usize) {
     let pos = node.start_position();
-    (pos.row + 1, pos.column + 1)
+    let line_start = node.start_byte() - pos.column;
+    let column = source
+        .get(line_start..node.start_byte())
+        .map_or(pos.column, |prefix| prefix.chars().count());
+    (pos.row + 1, column + 1)
+}
+
+/// Rewrites CRLF line endings to LF before parsing, so grammars and line
+/// lookups see the same text for a file saved on Windows as for its LF
+/// equivalent. Lines and columns do not change, as the `\r` ends the line.
+fn normalize_line_endings(source: &str) -> Cow<'_, str> {
+    if source.contains("\r\n") {
+        Cow::Owned(source.replace("\r\n", "\n"))
+    } else {
+        Cow::Borrowed(source)
+    }
 }
 
 fn record_definition_line(
@@ -526,9 +1210,28 @@ fn record_definition_line(
 
 #[cfg(test)]
 mod tests {
-    use super::walk_tree;
+    use super::{
+        collect_parse_errors, find_references, find_references_in, normalize_path, parse_tree,
+        walk_tree,
+    };
+    use crate::intern::resolve;
+    use crate::languages::project_files::ProjectFiles;
+    use std::path::{Path, PathBuf};
     use tree_sitter::Parser;
 
+    #[test]
+    fn collects_parse_errors_without_flagging_valid_code() {
+        let source = "def ok():\n    pass\n\ndef broken(:\n    pass\n";
+        let tree = parse_tree(&crate::languages::Language::Python, source).expect("parse");
+        let errors = collect_parse_errors(&tree);
+        assert!(!errors.is_empty());
+        assert!(errors.iter().all(|&(start, _)| start >= 4), "{errors:?}");
+
+        let tree = parse_tree(&crate::languages::Language::Python, "def ok():\n    pass\n")
+            .expect("parse");
+        assert!(collect_parse_errors(&tree).is_empty());
+    }
+
     #[test]
     fn walk_tree_visits_nodes() {
         let mut parser = Parser::new();
@@ -544,4 +1247,492 @@ mod tests {
         assert!(kinds.contains(&"module".to_string()));
         assert!(kinds.contains(&"identifier".to_string()));
     }
+
+    #[test]
+    fn resolves_ruby_require_relative_imports() {
+        let files = vec![
+            (
+                PathBuf::from("app/models/user.rb"),
+                "class User\nend\n".to_string(),
+            ),
+            (
+                PathBuf::from("app/main.rb"),
+                "require_relative \"models/user\"\nrequire \"json\"\n\nUser.new\n".to_string(),
+            ),
+        ];
+
+        let scan = find_references(files.into_iter().map(Ok)).expect("scan");
+        let imports: Vec<(&str, &str)> = scan
+            .imports
+            .iter()
+            .map(|import| (resolve(import.importer), resolve(import.imported)))
+            .collect();
+
+        assert_eq!(imports, vec![("app/main.rb", "app/models/user.rb")]);
+    }
+
+    #[test]
+    fn resolves_commonjs_require_calls() {
+        let files = vec![
+            (
+                PathBuf::from("app/lib/index.js"),
+                "exports.VERSION = \"1.0.0\";\n".to_string(),
+            ),
+            (
+                PathBuf::from("app/util.cjs"),
+                "module.exports = { format };\nfunction format() {}\n".to_string(),
+            ),
+            (
+                PathBuf::from("app/main.js"),
+                "const util = require(\"./util\");\nconst lib = require(\"./lib\");\nconst lodash = require(\"lodash\");\n"
+                    .to_string(),
+            ),
+        ];
+
+        let scan = find_references(files.into_iter().map(Ok)).expect("scan");
+        let mut imports: Vec<(&str, &str)> = scan
+            .imports
+            .iter()
+            .map(|import| (resolve(import.importer), resolve(import.imported)))
+            .collect();
+        imports.sort();
+
+        assert_eq!(
+            imports,
+            vec![
+                ("app/main.js", "app/lib/index.js"),
+                ("app/main.js", "app/util.cjs"),
+            ]
+        );
+    }
+
+    #[test]
+    fn normalizes_parent_and_current_dir_components() {
+        assert_eq!(
+            normalize_path(Path::new("app/models/../lib/./util.rb")),
+            PathBuf::from("app/lib/util.rb")
+        );
+        assert_eq!(
+            normalize_path(Path::new("../shared/x.rb")),
+            PathBuf::from("../shared/x.rb")
+        );
+    }
+
+    #[test]
+    fn resolves_c_quoted_includes_only() {
+        let files = vec![
+            (
+                PathBuf::from("src/stdio.h"),
+                "int puts(const char *s);\n".to_string(),
+            ),
+            (
+                PathBuf::from("include/api.h"),
+                "int api(void);\n".to_string(),
+            ),
+            (
+                PathBuf::from("src/local.h"),
+                "#include \"../include/api.h\"\n".to_string(),
+            ),
+            (
+                PathBuf::from("src/main.c"),
+                "#include <stdio.h>\n#include \"local.h\"\n#include \"api.h\"\n".to_string(),
+            ),
+        ];
+
+        let scan = find_references(files.into_iter().map(Ok)).expect("scan");
+        let mut imports: Vec<(&str, &str)> = scan
+            .imports
+            .iter()
+            .map(|import| (resolve(import.importer), resolve(import.imported)))
+            .collect();
+        imports.sort();
+
+        assert_eq!(
+            imports,
+            vec![
+                ("src/local.h", "include/api.h"),
+                ("src/main.c", "include/api.h"),
+                ("src/main.c", "src/local.h"),
+            ]
+        );
+    }
+
+    #[test]
+    fn resolves_java_imports_by_package_declaration() {
+        let files = vec![
+            (
+                PathBuf::from("src/shapes/Circle.java"),
+                "package com.acme.geometry;\npublic class Circle {}\n".to_string(),
+            ),
+            (
+                PathBuf::from("src/shapes/Square.java"),
+                "package com.acme.geometry;\npublic class Square {}\n".to_string(),
+            ),
+            (
+                PathBuf::from("src/shapes/Helper.java"),
+                "package com.acme.geometry;\nclass Helper {}\n".to_string(),
+            ),
+            (
+                PathBuf::from("src/app/Single.java"),
+                "package com.acme.app;\nimport com.acme.geometry.Circle;\nclass Single {}\n"
+                    .to_string(),
+            ),
+            (
+                PathBuf::from("src/app/Wildcard.java"),
+                "package com.acme.app;\nimport com.acme.geometry.*;\nclass Wildcard {}\n"
+                    .to_string(),
+            ),
+        ];
+
+        let scan = find_references(files.into_iter().map(Ok)).expect("scan");
+        let mut imports: Vec<(&str, &str)> = scan
+            .imports
+            .iter()
+            .map(|import| (resolve(import.importer), resolve(import.imported)))
+            .collect();
+        imports.sort();
+
+        assert_eq!(
+            imports,
+            vec![
+                ("src/app/Single.java", "src/shapes/Circle.java"),
+                ("src/app/Wildcard.java", "src/shapes/Circle.java"),
+                ("src/app/Wildcard.java", "src/shapes/Square.java"),
+            ]
+        );
+    }
+
+    #[test]
+    fn resolves_csharp_using_directives_by_namespace() {
+        let files = vec![
+            (
+                PathBuf::from("Models/User.cs"),
+                "namespace MyApp.Models;\npublic class User {}\n".to_string(),
+            ),
+            (
+                PathBuf::from("Models/Role.cs"),
+                "namespace MyApp { namespace Models { public enum Role {} } }\n".to_string(),
+            ),
+            (
+                PathBuf::from("Util/Strings.cs"),
+                "namespace MyApp.Util { public static class Strings {} }\n".to_string(),
+            ),
+            (
+                PathBuf::from("App/Program.cs"),
+                "using MyApp.Models;\nusing static MyApp.Util.Strings;\nnamespace MyApp.App { class Program {} }\n"
+                    .to_string(),
+            ),
+        ];
+
+        let scan = find_references(files.into_iter().map(Ok)).expect("scan");
+        let mut imports: Vec<(&str, &str)> = scan
+            .imports
+            .iter()
+            .map(|import| (resolve(import.importer), resolve(import.imported)))
+            .collect();
+        imports.sort();
+
+        assert_eq!(
+            imports,
+            vec![
+                ("App/Program.cs", "Models/Role.cs"),
+                ("App/Program.cs", "Models/User.cs"),
+                ("App/Program.cs", "Util/Strings.cs"),
+            ]
+        );
+    }
+
+    #[test]
+    fn resolves_kotlin_imports_by_package() {
+        let files = vec![
+            (
+                PathBuf::from("billing/Invoice.kt"),
+                "package com.acme.billing\nclass Invoice\n".to_string(),
+            ),
+            (
+                PathBuf::from("billing/Format.kt"),
+                "package com.acme.billing.format\nfun Invoice.describe() = \"\"\n".to_string(),
+            ),
+            (
+                PathBuf::from("billing/Internal.kt"),
+                "package com.acme.internal\nprivate class Ledger\n".to_string(),
+            ),
+            (
+                PathBuf::from("app/Checkout.kt"),
+                "package com.acme.app\nimport com.acme.billing.Invoice as Bill\nimport com.acme.billing.format.*\nimport com.acme.internal.*\n"
+                    .to_string(),
+            ),
+        ];
+
+        let scan = find_references(files.into_iter().map(Ok)).expect("scan");
+        let mut imports: Vec<(&str, &str)> = scan
+            .imports
+            .iter()
+            .map(|import| (resolve(import.importer), resolve(import.imported)))
+            .collect();
+        imports.sort();
+
+        assert_eq!(
+            imports,
+            vec![
+                ("app/Checkout.kt", "billing/Format.kt"),
+                ("app/Checkout.kt", "billing/Invoice.kt"),
+            ]
+        );
+    }
+
+    #[test]
+    fn resolves_php_use_and_require() {
+        let files = vec![
+            (
+                PathBuf::from("src/Models/User.php"),
+                "<?php\nnamespace App\\Models;\n\nclass User {}\n".to_string(),
+            ),
+            (
+                PathBuf::from("src/Models/Role.php"),
+                "<?php\nnamespace App\\Models {\n    enum Role {}\n}\n".to_string(),
+            ),
+            (
+                PathBuf::from("src/Support/str.php"),
+                "<?php\nnamespace App\\Support;\n\nfunction slug() {}\n".to_string(),
+            ),
+            (
+                PathBuf::from("src/bootstrap.php"),
+                "<?php\nfunction boot() {}\n".to_string(),
+            ),
+            (
+                PathBuf::from("src/Http/Controller.php"),
+                "<?php\nnamespace App\\Http;\n\nuse App\\Models\\{User, Role as Kind};\nuse function App\\Support\\slug;\n\nrequire_once __DIR__ . '/../bootstrap.php';\n"
+                    .to_string(),
+            ),
+        ];
+
+        let scan = find_references(files.into_iter().map(Ok)).expect("scan");
+        let mut imports: Vec<(&str, &str)> = scan
+            .imports
+            .iter()
+            .map(|import| (resolve(import.importer), resolve(import.imported)))
+            .collect();
+        imports.sort();
+
+        assert_eq!(
+            imports,
+            vec![
+                ("src/Http/Controller.php", "src/Models/Role.php"),
+                ("src/Http/Controller.php", "src/Models/User.php"),
+                ("src/Http/Controller.php", "src/Support/str.php"),
+                ("src/Http/Controller.php", "src/bootstrap.php"),
+            ]
+        );
+    }
+
+    #[test]
+    fn resolves_swift_imports_by_module() {
+        let files = vec![
+            (
+                PathBuf::from("Sources/Billing/Invoice.swift"),
+                "public struct Invoice {}\n".to_string(),
+            ),
+            (
+                PathBuf::from("Sources/Billing/Invoice+Formatting.swift"),
+                "extension Invoice {\n    func describe() {}\n}\n".to_string(),
+            ),
+            (
+                PathBuf::from("Sources/Ledger/Ledger.swift"),
+                "struct Ledger {}\n".to_string(),
+            ),
+            (
+                PathBuf::from("Tests/AppTests/CheckoutTests.swift"),
+                "import XCTest\n@testable import Billing\nimport struct Ledger.Ledger\n"
+                    .to_string(),
+            ),
+        ];
+
+        let scan = find_references(files.into_iter().map(Ok)).expect("scan");
+        let mut imports: Vec<(&str, &str)> = scan
+            .imports
+            .iter()
+            .map(|import| (resolve(import.importer), resolve(import.imported)))
+            .collect();
+        imports.sort();
+
+        assert_eq!(
+            imports,
+            vec![
+                (
+                    "Tests/AppTests/CheckoutTests.swift",
+                    "Sources/Billing/Invoice+Formatting.swift"
+                ),
+                (
+                    "Tests/AppTests/CheckoutTests.swift",
+                    "Sources/Billing/Invoice.swift"
+                ),
+                (
+                    "Tests/AppTests/CheckoutTests.swift",
+                    "Sources/Ledger/Ledger.swift"
+                ),
+            ]
+        );
+    }
+
+    #[test]
+    fn resolves_go_imports_by_module_path() {
+        let root = Path::new("src/languages/go/fixtures/shop");
+        let files = [
+            "cmd/server/main.go",
+            "internal/auth/token.go",
+            "internal/billing/invoice.go",
+            "internal/money/format.go",
+        ]
+        .map(|file| {
+            let path = root.join(file);
+            let source = std::fs::read_to_string(&path).expect("read fixture");
+            Ok((path, source))
+        });
+
+        let scan = find_references(files).expect("scan");
+        let mut imports: Vec<(&str, &str)> = scan
+            .imports
+            .iter()
+            .map(|import| (resolve(import.importer), resolve(import.imported)))
+            .collect();
+        imports.sort();
+
+        assert_eq!(
+            imports,
+            vec![
+                (
+                    "src/languages/go/fixtures/shop/cmd/server/main.go",
+                    "src/languages/go/fixtures/shop/internal/auth/token.go"
+                ),
+                (
+                    "src/languages/go/fixtures/shop/cmd/server/main.go",
+                    "src/languages/go/fixtures/shop/internal/money/format.go"
+                ),
+            ]
+        );
+    }
+
+    #[test]
+    fn reads_go_mod_from_the_given_project_files() {
+        let project_files = ProjectFiles::Snapshot(
+            [(
+                PathBuf::from("/snapshot/go.mod"),
+                "module example.com/shop\n".to_string(),
+            )]
+            .into_iter()
+            .collect(),
+        );
+        let files = vec![
+            (
+                PathBuf::from("/snapshot/auth/token.go"),
+                "package auth\n\nfunc Sign() {}\n".to_string(),
+            ),
+            (
+                PathBuf::from("/snapshot/main.go"),
+                "package main\n\nimport \"example.com/shop/auth\"\n\nfunc main() { auth.Sign() }\n"
+                    .to_string(),
+            ),
+        ];
+
+        let scan = find_references_in(files.into_iter().map(Ok), &project_files).expect("scan");
+        let imports: Vec<(&str, &str)> = scan
+            .imports
+            .iter()
+            .map(|import| (resolve(import.importer), resolve(import.imported)))
+            .collect();
+
+        assert_eq!(
+            imports,
+            vec![("/snapshot/main.go", "/snapshot/auth/token.go")]
+        );
+    }
+
+    #[test]
+    fn resolves_shell_source_commands() {
+        let dir = Path::new("src/languages/bash/fixtures");
+        let files = ["deploy.sh", "lib/common.sh", "release"].map(|name| {
+            let path = dir.join(name);
+            let source = std::fs::read_to_string(&path).expect("read fixture");
+            Ok((path, source))
+        });
+
+        let scan = find_references(files).expect("scan");
+        let mut imports: Vec<(&str, &str)> = scan
+            .imports
+            .iter()
+            .map(|import| (resolve(import.importer), resolve(import.imported)))
+            .collect();
+        imports.sort();
+
+        let common = "src/languages/bash/fixtures/lib/common.sh";
+        assert_eq!(
+            imports,
+            vec![
+                ("src/languages/bash/fixtures/deploy.sh", common),
+                ("src/languages/bash/fixtures/release", common),
+            ]
+        );
+    }
+
+    #[test]
+    fn resolves_typescript_path_aliases_from_tsconfig() {
+        let dir = Path::new("src/languages/javascript/fixtures/alias/src");
+        let files = ["app.ts", "lib/util.ts", "lib/greeting.ts"].map(|name| {
+            let path = dir.join(name);
+            let source = std::fs::read_to_string(&path).expect("read fixture");
+            Ok((path, source))
+        });
+
+        let scan = find_references(files).expect("scan");
+        let mut imports: Vec<(&str, &str)> = scan
+            .imports
+            .iter()
+            .map(|import| (resolve(import.importer), resolve(import.imported)))
+            .collect();
+        imports.sort();
+
+        let app = "src/languages/javascript/fixtures/alias/src/app.ts";
+        let util = "src/languages/javascript/fixtures/alias/src/lib/util.ts";
+        let greeting = "src/languages/javascript/fixtures/alias/src/lib/greeting.ts";
+        assert_eq!(
+            imports,
+            vec![(app, greeting), (app, util), (greeting, util)]
+        );
+    }
+
+    #[test]
+    fn reads_tsconfig_from_the_given_project_files() {
+        let tsconfig = "{ \"compilerOptions\": { \"paths\": { \"@/*\": [\"src/*\"] } } }";
+        let project_files = ProjectFiles::Snapshot(
+            [(
+                PathBuf::from("/snapshot/tsconfig.json"),
+                tsconfig.to_string(),
+            )]
+            .into_iter()
+            .collect(),
+        );
+        let files = vec![
+            (
+                PathBuf::from("/snapshot/src/util.ts"),
+                "export const x = 1;\n".to_string(),
+            ),
+            (
+                PathBuf::from("/snapshot/src/app.ts"),
+                "import { x } from \"@/util\";\n".to_string(),
+            ),
+        ];
+
+        let scan = find_references_in(files.into_iter().map(Ok), &project_files).expect("scan");
+        let imports: Vec<(&str, &str)> = scan
+            .imports
+            .iter()
+            .map(|import| (resolve(import.importer), resolve(import.imported)))
+            .collect();
+
+        assert_eq!(
+            imports,
+            vec![("/snapshot/src/app.ts", "/snapshot/src/util.ts")]
+        );
+    }
 }
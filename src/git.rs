@@ -0,0 +1,361 @@
+use std::io::{BufRead, BufReader, Read, Write};
+use std::path::{Path, PathBuf};
+use std::process::{Command, Stdio};
+use std::time::{Duration, SystemTime};
+
+use lasso::Spur;
+use rustc_hash::FxHashMap;
+
+use crate::intern::intern;
+use crate::io::CruxlinesError;
+
+/// git's well-known empty tree, used as the base when every commit is recent.
+const EMPTY_TREE: &str = "4b825dc642cb6eb9a060e54bf8d69288fbee4904";
+
+/// Line ranges (1-based, inclusive) changed per file, keyed by the same
+/// repo-root-joined path used for locations.
+#[derive(Debug, Default)]
+pub(crate) struct ChangedLines {
+    by_path: FxHashMap<Spur, Vec<(usize, usize)>>,
+}
+
+impl ChangedLines {
+    pub(crate) fn touches(&self, path: Spur, start: usize, end: usize) -> bool {
+        self.by_path.get(&path).is_some_and(|ranges| {
+            ranges
+                .iter()
+                .any(|(first, last)| *first <= end && start <= *last)
+        })
+    }
+}
+
+/// Lines changed by commits after `since` up to `head` (HEAD, or the
+/// `--git-ref` being analyzed). `since` is either a git ref (e.g. `main`,
+/// compared from its merge base with `head`) or a duration such as `2w`.
+pub(crate) fn changed_lines_since(
+    repo_root: &Path,
+    since: &str,
+    head: &str,
+) -> Result<ChangedLines, CruxlinesError> {
+    if git(repo_root, &["rev-parse", "--is-inside-work-tree"]).is_err() {
+        return Err(CruxlinesError::Git {
+            message: format!(
+                "--since needs a git repository, but {} is not one",
+                repo_root.display()
+            ),
+        });
+    }
+    let base = since_base(repo_root, since, head)?;
+    let diff = git(
+        repo_root,
+        &[
+            "-c",
+            "core.quotePath=false",
+            "diff",
+            "--unified=0",
+            "--no-color",
+            "--no-ext-diff",
+            "--no-prefix",
+            &base,
+            head,
+        ],
+    )?;
+    Ok(parse_unified_diff(repo_root, &diff))
+}
+
+fn since_base(repo_root: &Path, since: &str, head: &str) -> Result<String, CruxlinesError> {
+    let commit = format!("{since}^{{commit}}");
+    if git(repo_root, &["rev-parse", "--verify", "--quiet", &commit]).is_ok() {
+        let base = git(repo_root, &["merge-base", since, head])?;
+        return Ok(base.trim().to_string());
+    }
+    let Ok(duration) = humantime::parse_duration(since) else {
+        return Err(CruxlinesError::Git {
+            message: format!("--since `{since}` is neither a git ref nor a duration like `2w`"),
+        });
+    };
+    let cutoff = SystemTime::now()
+        .checked_sub(duration)
+        .unwrap_or(SystemTime::UNIX_EPOCH);
+    let before = format!("--before={}", humantime::format_rfc3339_seconds(cutoff));
+    let base = git(repo_root, &["rev-list", "-1", &before, head])?;
+    let base = base.trim();
+    if base.is_empty() {
+        Ok(EMPTY_TREE.to_string())
+    } else {
+        Ok(base.to_string())
+    }
+}
+
+/// Commits older than this many half-lives weigh less than a millionth of a
+/// fresh one and are not read.
+const MAX_HALF_LIVES: u32 = 20;
+
+/// Frecency with an exponential decay: each commit touching a file adds
+/// `0.5^(age / half_life)`, so a commit made now counts 1 and one made
+/// `half_life` ago counts 0.5. Keyed by repo-root-joined path.
+pub(crate) fn decayed_frecency(
+    repo_root: &Path,
+    half_life: Duration,
+) -> Result<FxHashMap<Spur, f64>, CruxlinesError> {
+    let now = SystemTime::now()
+        .duration_since(SystemTime::UNIX_EPOCH)
+        .unwrap_or_default();
+    let cutoff = now.saturating_sub(half_life.saturating_mul(MAX_HALF_LIVES));
+    let max_age = format!("--max-age={}", cutoff.as_secs());
+    let log = git(
+        repo_root,
+        &[
+            "-c",
+            "core.quotePath=false",
+            "log",
+            "--no-merges",
+            "--no-renames",
+            "--format=%x00%ct",
+            "--name-only",
+            &max_age,
+        ],
+    )?;
+    Ok(parse_decayed_log(repo_root, &log, now, half_life))
+}
+
+/// Scores a `git log --format=%x00%ct --name-only` listing: each commit is a
+/// NUL-prefixed commit time followed by the paths it touched.
+fn parse_decayed_log(
+    repo_root: &Path,
+    log: &str,
+    now: Duration,
+    half_life: Duration,
+) -> FxHashMap<Spur, f64> {
+    let half_life = half_life.as_secs_f64().max(1.0);
+    let mut scores: FxHashMap<Spur, f64> = FxHashMap::default();
+    let mut weight = 0.0;
+    for line in log.lines() {
+        if let Some(time) = line.strip_prefix('\0') {
+            let age = time
+                .trim()
+                .parse::<u64>()
+                .map(|time| now.as_secs().saturating_sub(time) as f64)
+                .unwrap_or(f64::INFINITY);
+            weight = 0.5f64.powf(age / half_life);
+        } else if !line.is_empty() {
+            let path = intern(&repo_root.join(line).to_string_lossy());
+            *scores.entry(path).or_default() += weight;
+        }
+    }
+    scores
+}
+
+/// The regular files and executables committed at `git_ref`, as
+/// repo-root-joined paths. Symlinks and submodules are skipped.
+pub(crate) fn tree_paths(repo_root: &Path, git_ref: &str) -> Result<Vec<PathBuf>, CruxlinesError> {
+    let tree = resolve_tree(repo_root, git_ref)?;
+    let listing = git(repo_root, &["ls-tree", "-r", "-z", &tree])?;
+    Ok(listing
+        .split('\0')
+        .filter_map(|entry| {
+            // `<mode> <type> <object>\t<path>`
+            let (meta, path) = entry.split_once('\t')?;
+            let mut fields = meta.split(' ');
+            let mode = fields.next()?;
+            let kind = fields.next()?;
+            (kind == "blob" && mode != "120000").then(|| repo_root.join(path))
+        })
+        .collect())
+}
+
+/// Reads `paths` (repo-root-joined, as returned by [`tree_paths`]) from the
+/// tree of `git_ref` with one `git cat-file --batch`. Files that are not
+/// UTF-8 are skipped, as when reading from disk.
+pub(crate) fn read_blobs(
+    repo_root: &Path,
+    git_ref: &str,
+    paths: Vec<PathBuf>,
+) -> Result<Vec<(PathBuf, String)>, CruxlinesError> {
+    let tree = resolve_tree(repo_root, git_ref)?;
+    let specs: Vec<String> = paths
+        .iter()
+        .map(|path| {
+            let relative = path.strip_prefix(repo_root).unwrap_or(path);
+            format!("{tree}:{}\n", relative.to_string_lossy().replace('\\', "/"))
+        })
+        .collect();
+    let failed = |err: std::io::Error| CruxlinesError::Git {
+        message: format!("failed to read files at `{git_ref}`: {err}"),
+    };
+    let mut child = Command::new("git")
+        .arg("-C")
+        .arg(repo_root)
+        .args(["cat-file", "--batch"])
+        .stdin(Stdio::piped())
+        .stdout(Stdio::piped())
+        .spawn()
+        .map_err(|err| CruxlinesError::Git {
+            message: format!("failed to run git: {err}"),
+        })?;
+    let mut stdin = child.stdin.take().expect("piped stdin");
+    // Written from another thread so a full stdout pipe cannot block git.
+    let writer = std::thread::spawn(move || {
+        for spec in specs {
+            stdin.write_all(spec.as_bytes())?;
+        }
+        Ok::<_, std::io::Error>(())
+    });
+    let mut stdout = BufReader::new(child.stdout.take().expect("piped stdout"));
+    let mut blobs = Vec::with_capacity(paths.len());
+    let mut header = String::new();
+    for path in paths {
+        header.clear();
+        stdout.read_line(&mut header).map_err(failed)?;
+        // `<object> blob <size>`, or `<spec> missing`.
+        let mut fields = header.split_whitespace();
+        let (Some(_), Some("blob"), Some(size)) = (fields.next(), fields.next(), fields.next())
+        else {
+            continue;
+        };
+        let Ok(size) = size.parse::<usize>() else {
+            continue;
+        };
+        let mut contents = vec![0; size + 1];
+        stdout.read_exact(&mut contents).map_err(failed)?;
+        contents.pop();
+        if let Ok(contents) = String::from_utf8(contents) {
+            blobs.push((path, contents));
+        }
+    }
+    drop(stdout);
+    writer.join().unwrap_or(Ok(())).map_err(failed)?;
+    let _ = child.wait();
+    Ok(blobs)
+}
+
+/// The tree object of `git_ref`, or an error naming the ref when it does not
+/// exist.
+fn resolve_tree(repo_root: &Path, git_ref: &str) -> Result<String, CruxlinesError> {
+    if git(repo_root, &["rev-parse", "--git-dir"]).is_err() {
+        return Err(CruxlinesError::Git {
+            message: format!(
+                "--git-ref needs a git repository, but {} is not one",
+                repo_root.display()
+            ),
+        });
+    }
+    let tree = format!("{git_ref}^{{tree}}");
+    match git(repo_root, &["rev-parse", "--verify", "--quiet", &tree]) {
+        Ok(tree) => Ok(tree.trim().to_string()),
+        Err(_) => Err(CruxlinesError::Git {
+            message: format!("--git-ref `{git_ref}` is not a commit or tree in this repository"),
+        }),
+    }
+}
+
+fn parse_unified_diff(repo_root: &Path, diff: &str) -> ChangedLines {
+    let mut changed = ChangedLines::default();
+    let mut current: Option<Spur> = None;
+    // `+++` only names a file in the header; inside hunks it is content.
+    let mut in_header = false;
+    for line in diff.lines() {
+        if line.starts_with("diff --git ") {
+            in_header = true;
+            current = None;
+            continue;
+        }
+        if in_header && let Some(path) = line.strip_prefix("+++ ") {
+            current =
+                (path != "/dev/null").then(|| intern(&repo_root.join(path).to_string_lossy()));
+            continue;
+        }
+        let Some(hunk) = line.strip_prefix("@@ ") else {
+            continue;
+        };
+        in_header = false;
+        if let Some(path) = current
+            && let Some(range) = hunk_new_range(hunk)
+        {
+            changed.by_path.entry(path).or_default().push(range);
+        }
+    }
+    changed
+}
+
+/// Parses the `+start,count` part of a hunk header. Pure deletions
+/// (`count == 0`) mark the line after which lines were removed.
+fn hunk_new_range(hunk: &str) -> Option<(usize, usize)> {
+    let new = hunk.split_whitespace().find(|part| part.starts_with('+'))?;
+    let new = &new[1..];
+    let (start, count) = match new.split_once(',') {
+        Some((start, count)) => (start.parse::<usize>().ok()?, count.parse::<usize>().ok()?),
+        None => (new.parse::<usize>().ok()?, 1),
+    };
+    if count == 0 {
+        let line = start.max(1);
+        return Some((line, line));
+    }
+    Some((start, start + count - 1))
+}
+
+fn git(repo_root: &Path, args: &[&str]) -> Result<String, CruxlinesError> {
+    let output = Command::new("git")
+        .arg("-C")
+        .arg(repo_root)
+        .args(args)
+        .output()
+        .map_err(|err| CruxlinesError::Git {
+            message: format!("failed to run git: {err}"),
+        })?;
+    if !output.status.success() {
+        return Err(CruxlinesError::Git {
+            message: format!(
+                "git {} failed: {}",
+                args.join(" "),
+                String::from_utf8_lossy(&output.stderr).trim()
+            ),
+        });
+    }
+    Ok(String::from_utf8_lossy(&output.stdout).into_owned())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::{hunk_new_range, parse_decayed_log, parse_unified_diff};
+    use crate::intern::intern;
+    use std::path::Path;
+    use std::time::Duration;
+
+    #[test]
+    fn parses_hunk_ranges() {
+        assert_eq!(hunk_new_range("-3,2 +3,4 @@ fn main() {"), Some((3, 6)));
+        assert_eq!(hunk_new_range("-10 +10 @@"), Some((10, 10)));
+        assert_eq!(hunk_new_range("-5,2 +4,0 @@"), Some((4, 4)));
+    }
+
+    #[test]
+    fn maps_hunks_to_repo_paths() {
+        let diff = "diff --git src/a.py src/a.py\n--- src/a.py\n+++ src/a.py\n@@ -1,0 +2,3 @@\n+x\n+++ not a header\n+z\ndiff --git gone.py gone.py\n--- gone.py\n+++ /dev/null\n@@ -1,2 +0,0 @@\n";
+        let changed = parse_unified_diff(Path::new("/repo"), diff);
+        let path = intern("/repo/src/a.py");
+        assert!(changed.touches(path, 1, 2));
+        assert!(changed.touches(path, 4, 9));
+        assert!(!changed.touches(path, 5, 9));
+        assert!(!changed.touches(intern("/repo/gone.py"), 1, 2));
+    }
+
+    #[test]
+    fn decays_commit_weight_by_half_life() {
+        let root = Path::new("/repo");
+        let day = Duration::from_secs(24 * 60 * 60);
+        let now = Duration::from_secs(100) + day * 10;
+        let log = format!(
+            "\0{}\n\nfresh.py\nboth.py\n\0{}\n\nold.py\nboth.py\n",
+            now.as_secs(),
+            (now - day * 2).as_secs()
+        );
+
+        let scores = parse_decayed_log(root, &log, now, day);
+
+        let score = |name: &str| scores[&intern(&root.join(name).to_string_lossy())];
+        assert_eq!(score("fresh.py"), 1.0);
+        assert_eq!(score("old.py"), 0.25);
+        assert_eq!(score("both.py"), 1.25);
+    }
+}
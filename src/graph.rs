@@ -1,55 +1,239 @@
-use std::collections::HashMap;
+use std::collections::{HashMap, VecDeque};
 
 use lasso::Spur;
 use petgraph::graph::{Graph, NodeIndex};
 use rustc_hash::{FxHashMap, FxHashSet};
 
-use crate::find_references::Location;
+use crate::analysis::{OutputRow, dependency_counts};
+use crate::find_references::{ImportEdge, Location};
+use crate::intern::resolve;
 
+/// Ranked definitions and the references between them, as returned by
+/// [`symbol_graph`](crate::symbol_graph).
+#[derive(Clone, Debug, Default, PartialEq)]
+pub struct SymbolGraph {
+    /// Definitions in rank order, with their rank.
+    pub nodes: Vec<(Location, f64)>,
+    /// `(dependent, dependency, references)`, with the first two indexing
+    /// `nodes`: the dependent's declaration contains `references` references
+    /// to the dependency. Ordered by dependent, then dependency.
+    pub edges: Vec<(usize, usize, usize)>,
+}
+
+impl SymbolGraph {
+    /// The graph between `rows`; references from outside them are ignored.
+    pub(crate) fn new(rows: &[OutputRow]) -> Self {
+        let edges = dependency_counts(rows)
+            .into_iter()
+            .enumerate()
+            .flat_map(|(dependent, counts)| {
+                counts
+                    .into_iter()
+                    .map(move |(dependency, references)| (dependent, dependency, references))
+            })
+            .collect();
+        Self {
+            nodes: rows.iter().map(|row| (row.definition, row.rank)).collect(),
+            edges,
+        }
+    }
+}
+
+/// Builds the file graph with nodes and edges inserted in path order, so
+/// PageRank results don't depend on the order files were parsed in.
+///
+/// Each edge's weight is the number of reference sites (usages and imports)
+/// in its source file that point at its target file.
 pub fn build_file_graph(
     grouped: &HashMap<Location, Vec<Location>>,
-) -> (Graph<Spur, ()>, FxHashMap<Spur, NodeIndex>) {
-    let mut graph: Graph<Spur, ()> = Graph::new();
-    let mut indices: FxHashMap<Spur, NodeIndex> = FxHashMap::default();
-    // Track existing edges to avoid duplicates
-    let mut existing_edges: FxHashSet<(NodeIndex, NodeIndex)> = FxHashSet::default();
+    imports: &[ImportEdge],
+) -> (Graph<Spur, usize>, FxHashMap<Spur, NodeIndex>) {
+    let mut paths: FxHashSet<Spur> = FxHashSet::default();
+    let mut weights: FxHashMap<(Spur, Spur), usize> = FxHashMap::default();
 
     for (definition, usages) in grouped {
-        let def_idx = node_index(&mut graph, &mut indices, definition.path);
+        paths.insert(definition.path);
         for usage in usages {
             if usage.path == definition.path {
                 continue;
             }
-            let use_idx = node_index(&mut graph, &mut indices, usage.path);
-            // Only add edge if it doesn't already exist
-            if existing_edges.insert((use_idx, def_idx)) {
-                graph.add_edge(use_idx, def_idx, ());
-            }
+            paths.insert(usage.path);
+            *weights.entry((usage.path, definition.path)).or_default() += 1;
         }
     }
+    for import in imports {
+        paths.insert(import.importer);
+        paths.insert(import.imported);
+        *weights
+            .entry((import.importer, import.imported))
+            .or_default() += 1;
+    }
+
+    let mut paths: Vec<Spur> = paths.into_iter().collect();
+    paths.sort_by_key(|path| resolve(*path));
+    let mut edges: Vec<((Spur, Spur), usize)> = weights.into_iter().collect();
+    edges.sort_by_key(|((from, to), _)| (resolve(*from), resolve(*to)));
+
+    let mut graph: Graph<Spur, usize> = Graph::with_capacity(paths.len(), edges.len());
+    let mut indices: FxHashMap<Spur, NodeIndex> = FxHashMap::default();
+    for path in paths {
+        indices.insert(path, graph.add_node(path));
+    }
+    for ((from, to), weight) in edges {
+        graph.add_edge(indices[&from], indices[&to], weight);
+    }
     (graph, indices)
 }
 
-fn node_index(
-    graph: &mut Graph<Spur, ()>,
-    indices: &mut FxHashMap<Spur, NodeIndex>,
-    path: Spur,
-) -> NodeIndex {
-    if let Some(index) = indices.get(&path) {
-        *index
-    } else {
-        let index = graph.add_node(path);
-        indices.insert(path, index);
-        index
+/// PageRank with the same formulation as
+/// `petgraph::algo::page_rank::parallel_page_rank`, but O(nodes + edges) per
+/// iteration and computed sequentially, so results are bit-for-bit
+/// reproducible regardless of the rayon thread count.
+///
+/// A node's link share is split between its out-edges in proportion to their
+/// weights rather than evenly; with all weights 1 the two are the same.
+pub fn page_rank(graph: &Graph<Spur, usize>, damping: f64, iterations: usize) -> Vec<f64> {
+    const TOLERANCE: f64 = 1e-6;
+
+    let node_count = graph.node_count();
+    if node_count == 0 {
+        return Vec::new();
+    }
+    let nb = node_count as f64;
+    let mut out_weight = vec![0.0_f64; node_count];
+    for edge in graph.raw_edges() {
+        out_weight[edge.source().index()] += edge.weight as f64;
+    }
+
+    let mut ranks = vec![1.0 / nb; node_count];
+    for _ in 0..iterations {
+        // Every node receives random jumps from nodes with out-edges and an
+        // even share of dangling nodes' rank...
+        let base: f64 = ranks
+            .iter()
+            .zip(&out_weight)
+            .map(|(rank, weight)| {
+                if *weight == 0.0 {
+                    damping * rank / nb
+                } else {
+                    (1.0 - damping) * rank / nb
+                }
+            })
+            .sum();
+        let mut next = vec![base; node_count];
+        // ...except that a linked node gets the damped link share instead of
+        // the random jump from its source.
+        for edge in graph.raw_edges() {
+            let source = edge.source().index();
+            let rank = ranks[source];
+            let share = edge.weight as f64 / out_weight[source];
+            next[edge.target().index()] += damping * rank * share - (1.0 - damping) * rank / nb;
+        }
+        let sum: f64 = next.iter().sum();
+        for rank in &mut next {
+            *rank /= sum;
+        }
+        let squared_norm: f64 = next
+            .iter()
+            .zip(&ranks)
+            .map(|(new, old)| (new - old) * (new - old))
+            .sum();
+        if squared_norm <= TOLERANCE {
+            return ranks;
+        }
+        ranks = next;
+    }
+    ranks
+}
+
+/// Which nodes are connected to `seeds`, over any number of edges followed
+/// in either direction; seeds count as connected.
+pub fn reachable(graph: &Graph<Spur, usize>, seeds: &[NodeIndex]) -> Vec<bool> {
+    let mut seen = vec![false; graph.node_count()];
+    let mut queue = VecDeque::new();
+    for seed in seeds {
+        if !seen[seed.index()] {
+            seen[seed.index()] = true;
+            queue.push_back(*seed);
+        }
+    }
+    while let Some(node) = queue.pop_front() {
+        for next in graph.neighbors_undirected(node) {
+            if !seen[next.index()] {
+                seen[next.index()] = true;
+                queue.push_back(next);
+            }
+        }
+    }
+    seen
+}
+
+/// PageRank whose random jumps all land on `seeds`, so a node's rank says
+/// how close it is to them. Edges are followed in both directions: a file is
+/// close to the seeds when it depends on them or they depend on it. Nodes
+/// that no walk from a seed reaches within `iterations` steps keep rank 0.
+pub fn personalized_page_rank(
+    graph: &Graph<Spur, usize>,
+    damping: f64,
+    iterations: usize,
+    seeds: &[NodeIndex],
+) -> Vec<f64> {
+    const TOLERANCE: f64 = 1e-6;
+
+    let node_count = graph.node_count();
+    if node_count == 0 || seeds.is_empty() {
+        return vec![0.0; node_count];
+    }
+    let mut teleport = vec![0.0_f64; node_count];
+    for seed in seeds {
+        teleport[seed.index()] += 1.0 / seeds.len() as f64;
+    }
+    let mut weight = vec![0.0_f64; node_count];
+    for edge in graph.raw_edges() {
+        weight[edge.source().index()] += edge.weight as f64;
+        weight[edge.target().index()] += edge.weight as f64;
+    }
+
+    let mut ranks = teleport.clone();
+    for _ in 0..iterations {
+        // The rank of nodes without edges jumps back to the seeds, along
+        // with the undamped share of everyone else's.
+        let stranded: f64 = ranks
+            .iter()
+            .zip(&weight)
+            .filter(|(_, weight)| **weight == 0.0)
+            .map(|(rank, _)| rank)
+            .sum();
+        let jump = 1.0 - damping + damping * stranded;
+        let mut next: Vec<f64> = teleport.iter().map(|share| jump * share).collect();
+        for edge in graph.raw_edges() {
+            let (source, target) = (edge.source().index(), edge.target().index());
+            let edge_weight = edge.weight as f64;
+            next[target] += damping * ranks[source] * edge_weight / weight[source];
+            next[source] += damping * ranks[target] * edge_weight / weight[target];
+        }
+        let squared_norm: f64 = next
+            .iter()
+            .zip(&ranks)
+            .map(|(new, old)| (new - old) * (new - old))
+            .sum();
+        ranks = next;
+        if squared_norm <= TOLERANCE {
+            break;
+        }
     }
+    ranks
 }
 
 #[cfg(test)]
 mod tests {
-    use super::build_file_graph;
-    use crate::find_references::Location;
+    use super::{SymbolGraph, build_file_graph, page_rank, personalized_page_rank, reachable};
+    use crate::analysis::cruxlines_from_inputs;
+    use crate::find_references::{ImportEdge, Location};
     use crate::intern::intern;
+    use crate::languages::Ecosystem;
     use std::collections::HashMap;
+    use std::path::PathBuf;
 
     #[test]
     fn builds_file_graph_with_cross_file_edges() {
@@ -68,9 +252,155 @@ mod tests {
         let mut grouped: HashMap<Location, Vec<Location>> = HashMap::new();
         grouped.insert(def, vec![usage]);
 
-        let (graph, indices) = build_file_graph(&grouped);
+        let (graph, indices) = build_file_graph(&grouped, &[]);
         let def_idx = indices.get(&def.path).expect("def node");
         let use_idx = indices.get(&usage.path).expect("use node");
         assert!(graph.contains_edge(*use_idx, *def_idx));
     }
+
+    #[test]
+    fn adds_import_edges_between_files() {
+        let import = ImportEdge {
+            importer: intern("main.rb"),
+            imported: intern("models.rb"),
+            ecosystem: Ecosystem::Ruby,
+        };
+
+        let (graph, indices) = build_file_graph(&HashMap::new(), &[import]);
+        let importer_idx = indices.get(&import.importer).expect("importer node");
+        let imported_idx = indices.get(&import.imported).expect("imported node");
+        assert!(graph.contains_edge(*importer_idx, *imported_idx));
+    }
+
+    #[test]
+    fn weights_edges_by_reference_count() {
+        let location = |path: &str, line: usize| Location {
+            path: intern(path),
+            line,
+            column: 1,
+            name: intern("foo"),
+        };
+        let mut grouped: HashMap<Location, Vec<Location>> = HashMap::new();
+        grouped.insert(
+            location("a.py", 1),
+            vec![
+                location("b.py", 2),
+                location("b.py", 3),
+                location("b.py", 4),
+                location("c.py", 1),
+                location("a.py", 5),
+            ],
+        );
+
+        let (graph, indices) = build_file_graph(&grouped, &[]);
+        let weight = |from: &str, to: &str| {
+            let edge = graph
+                .find_edge(indices[&intern(from)], indices[&intern(to)])
+                .expect("edge");
+            graph[edge]
+        };
+        assert_eq!(weight("b.py", "a.py"), 3);
+        assert_eq!(weight("c.py", "a.py"), 1);
+        assert_eq!(graph.edge_count(), 2, "same-file references add no edge");
+    }
+
+    #[test]
+    fn page_rank_follows_heavier_edges() {
+        let mut graph = petgraph::graph::Graph::new();
+        let nodes: Vec<_> = ["hub", "heavy", "light"]
+            .iter()
+            .map(|name| graph.add_node(intern(name)))
+            .collect();
+        graph.add_edge(nodes[0], nodes[1], 9);
+        graph.add_edge(nodes[0], nodes[2], 1);
+
+        let ranks = page_rank(&graph, 0.85, 5);
+        assert!(ranks[1] > ranks[2], "{ranks:?}");
+    }
+
+    #[test]
+    fn page_rank_matches_petgraph() {
+        let mut graph = petgraph::graph::Graph::new();
+        let nodes: Vec<_> = ["a", "b", "c", "d"]
+            .iter()
+            .map(|name| graph.add_node(intern(name)))
+            .collect();
+        graph.add_edge(nodes[0], nodes[1], 1);
+        graph.add_edge(nodes[0], nodes[2], 1);
+        graph.add_edge(nodes[1], nodes[2], 1);
+        graph.add_edge(nodes[2], nodes[0], 1);
+
+        let expected = petgraph::algo::page_rank::parallel_page_rank(&graph, 0.85_f64, 5, None);
+        let actual = page_rank(&graph, 0.85, 5);
+        for (expected, actual) in expected.iter().zip(&actual) {
+            assert!((expected - actual).abs() < 1e-12, "{expected} != {actual}");
+        }
+    }
+
+    #[test]
+    fn personalized_page_rank_stays_near_the_seeds() {
+        let mut graph = petgraph::graph::Graph::new();
+        let nodes: Vec<_> = ["seed", "dependency", "dependent", "far", "island"]
+            .iter()
+            .map(|name| graph.add_node(intern(name)))
+            .collect();
+        graph.add_edge(nodes[0], nodes[1], 1);
+        graph.add_edge(nodes[2], nodes[0], 1);
+        graph.add_edge(nodes[1], nodes[3], 1);
+
+        let ranks = personalized_page_rank(&graph, 0.85, 5, &[nodes[0]]);
+        assert!(ranks[1] > ranks[3], "{ranks:?}");
+        assert!(ranks[2] > 0.0, "dependents are close too: {ranks:?}");
+        assert_eq!(ranks[4], 0.0, "unconnected nodes get nothing");
+        assert!((ranks.iter().sum::<f64>() - 1.0).abs() < 1e-9);
+    }
+
+    #[test]
+    fn reachable_follows_edges_both_ways_over_any_distance() {
+        let mut graph = petgraph::graph::Graph::new();
+        let nodes: Vec<_> = (0..9)
+            .map(|index| graph.add_node(intern(&format!("file{index}"))))
+            .collect();
+        for pair in nodes[..8].windows(2) {
+            graph.add_edge(pair[1], pair[0], 1);
+        }
+
+        let reached = reachable(&graph, &[nodes[0]]);
+        assert!(reached[..8].iter().all(|reached| *reached), "{reached:?}");
+        assert!(!reached[8], "unconnected nodes are not reached");
+        assert!(reachable(&graph, &[]).iter().all(|reached| !reached));
+    }
+
+    #[test]
+    fn symbol_graph_counts_references_between_definitions() {
+        let rows = cruxlines_from_inputs(
+            vec![
+                (
+                    PathBuf::from("lib.py"),
+                    "def helper():\n    pass\n\ndef alpha():\n    helper()\n    helper()\n"
+                        .to_string(),
+                ),
+                (
+                    PathBuf::from("main.py"),
+                    "from lib import alpha\n\nalpha()\nalpha()\n".to_string(),
+                ),
+            ],
+            None,
+        )
+        .expect("analyze inputs");
+
+        let graph = SymbolGraph::new(&rows);
+        let index = |name: &str| {
+            graph
+                .nodes
+                .iter()
+                .position(|(definition, _)| definition.name_str() == name)
+                .expect(name)
+        };
+        assert_eq!(graph.edges, vec![(index("alpha"), index("helper"), 2)]);
+
+        let top = SymbolGraph::new(&rows[..1]);
+        assert_eq!(top.nodes.len(), 1);
+        assert!(top.edges.is_empty(), "edges to dropped nodes are left out");
+    }
 }
@@ -1,9 +1,10 @@
-use std::collections::HashSet;
-use std::path::PathBuf;
+use std::collections::{HashMap, HashSet};
+use std::path::{Path, PathBuf};
 
 use ignore::WalkBuilder;
+use ignore::gitignore::{Gitignore, GitignoreBuilder};
 
-use crate::Ecosystem;
+use crate::languages::{Ecosystem, Language, ecosystem_for_language, language_for_file};
 
 #[derive(Debug)]
 pub enum CruxlinesError {
@@ -11,11 +12,229 @@ pub enum CruxlinesError {
         path: PathBuf,
         source: std::io::Error,
     },
+    Git {
+        message: String,
+    },
+    Watch {
+        source: notify::Error,
+    },
+    InvalidGlob {
+        glob: String,
+        source: ignore::Error,
+    },
 }
 
-pub fn gather_paths(repo_root: &PathBuf, ecosystems: &HashSet<Ecosystem>) -> Vec<PathBuf> {
-    let builder = WalkBuilder::new(repo_root);
+impl std::fmt::Display for CruxlinesError {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            CruxlinesError::ReadFile { path, source } => {
+                write!(f, "failed to read {}: {source}", path.display())
+            }
+            CruxlinesError::Git { message } => f.write_str(message),
+            CruxlinesError::Watch { source } => write!(f, "failed to watch files: {source}"),
+            CruxlinesError::InvalidGlob { glob, source } => {
+                write!(f, "invalid glob `{glob}`: {source}")
+            }
+        }
+    }
+}
 
+impl std::error::Error for CruxlinesError {
+    fn source(&self) -> Option<&(dyn std::error::Error + 'static)> {
+        match self {
+            CruxlinesError::ReadFile { source, .. } => Some(source),
+            CruxlinesError::Git { .. } => None,
+            CruxlinesError::Watch { source } => Some(source),
+            CruxlinesError::InvalidGlob { source, .. } => Some(source),
+        }
+    }
+}
+
+/// Returns the closest ancestor of `start` (or `start` itself) containing `.git`.
+pub fn find_repo_root(start: &Path) -> Option<PathBuf> {
+    for ancestor in start.ancestors() {
+        if ancestor.join(".git").is_dir() {
+            return Some(ancestor.to_path_buf());
+        }
+    }
+    None
+}
+
+/// Extra ignore rules layered on top of `.gitignore`: `exclude` globs skip
+/// paths and `include` globs bring back paths that `.gitignore` or `exclude`
+/// would skip. Globs use `.gitignore` syntax, relative to `root`.
+#[derive(Clone)]
+pub(crate) struct PathFilter {
+    root: PathBuf,
+    exclude: Gitignore,
+    include: Gitignore,
+    /// Directories to walk, ignore rules aside, for `include` matches.
+    include_roots: Vec<PathBuf>,
+}
+
+impl PathFilter {
+    pub(crate) fn new(
+        root: &Path,
+        exclude: &[String],
+        include: &[String],
+    ) -> Result<Self, CruxlinesError> {
+        let mut include_roots: Vec<PathBuf> = include
+            .iter()
+            .map(|glob| root.join(literal_prefix(glob)))
+            .collect();
+        include_roots.sort();
+        include_roots.dedup();
+        Ok(Self {
+            root: root.to_path_buf(),
+            exclude: build_globs(root, exclude)?,
+            include: build_globs(root, include)?,
+            include_roots,
+        })
+    }
+
+    fn is_excluded(&self, path: &Path, is_dir: bool) -> bool {
+        path.starts_with(&self.root)
+            && self
+                .exclude
+                .matched_path_or_any_parents(path, is_dir)
+                .is_ignore()
+            && !self.is_included(path, is_dir)
+    }
+
+    fn is_included(&self, path: &Path, is_dir: bool) -> bool {
+        path.starts_with(&self.root)
+            && self
+                .include
+                .matched_path_or_any_parents(path, is_dir)
+                .is_ignore()
+    }
+}
+
+fn build_globs(root: &Path, globs: &[String]) -> Result<Gitignore, CruxlinesError> {
+    let mut builder = GitignoreBuilder::new(root);
+    for glob in globs {
+        builder
+            .add_line(None, glob)
+            .map_err(|source| CruxlinesError::InvalidGlob {
+                glob: glob.clone(),
+                source,
+            })?;
+    }
+    builder
+        .build()
+        .map_err(|source| CruxlinesError::InvalidGlob {
+            glob: globs.join(", "),
+            source,
+        })
+}
+
+/// The leading path components of `glob` that contain no wildcards, e.g.
+/// `vendor/acme` for `vendor/acme/**/*.go`. Only that path can hold matches of
+/// an anchored glob; globs without an inner `/` (such as `*.pb.go`) match at
+/// any depth, so they yield the root itself.
+fn literal_prefix(glob: &str) -> PathBuf {
+    let glob = glob.trim_end_matches('/');
+    if !glob.contains('/') {
+        return PathBuf::new();
+    }
+    glob.trim_start_matches('/')
+        .split('/')
+        .take_while(|part| !part.contains(['*', '?', '[', '\\']))
+        .collect()
+}
+
+/// Per-directory ignore files with `.gitignore` syntax that only cruxlines
+/// reads, for tracked files that are noise to it (generated code, vendored
+/// snapshots).
+pub(crate) const IGNORE_FILE_NAME: &str = ".cruxlinesignore";
+
+/// The rules of `.cruxlinesignore` files read from a git ref, for
+/// [`select_paths`], which has no walk to read them along the way.
+pub(crate) struct IgnoreFiles {
+    /// Each file's rules by the directory holding it, deepest first.
+    by_dir: Vec<(PathBuf, Gitignore)>,
+}
+
+impl IgnoreFiles {
+    /// Parses `files` (path and contents). Invalid lines are skipped, as the
+    /// walk in [`gather_paths`] does.
+    pub(crate) fn new(files: Vec<(PathBuf, String)>) -> Self {
+        let mut by_dir: Vec<(PathBuf, Gitignore)> = files
+            .into_iter()
+            .filter_map(|(path, text)| {
+                let dir = path.parent()?.to_path_buf();
+                let mut builder = GitignoreBuilder::new(&dir);
+                for line in text.lines() {
+                    let _ = builder.add_line(Some(path.clone()), line);
+                }
+                Some((dir, builder.build().ok()?))
+            })
+            .collect();
+        by_dir.sort_by_key(|(dir, _)| std::cmp::Reverse(dir.components().count()));
+        Self { by_dir }
+    }
+
+    /// Whether `path` is ignored by the nearest file with a rule for it, so
+    /// that nested files override their parents as with `.gitignore`.
+    fn is_ignored(&self, path: &Path) -> bool {
+        for (dir, rules) in &self.by_dir {
+            if !path.starts_with(dir) {
+                continue;
+            }
+            let matched = rules.matched_path_or_any_parents(path, false);
+            if matched.is_ignore() {
+                return true;
+            }
+            if matched.is_whitelist() {
+                return false;
+            }
+        }
+        false
+    }
+}
+
+/// Walks `roots` (files or directories), letting `ignore` decide which
+/// directories and files to skip, then applies `filter`. `.cruxlinesignore`
+/// files are read like `.gitignore` files, on top of them.
+///
+/// Ignore rules must be applied during the walk rather than by filtering paths
+/// afterwards, so that negations (`!path`) in nested `.gitignore` files work
+/// the same way they do in git. Excluded directories are pruned rather than
+/// walked.
+///
+/// Symlinks are skipped, as git stores them as links rather than following
+/// them, unless `follow_symlinks` is set. Loops are then not walked twice,
+/// and a file reached through several paths is kept once, under its path
+/// without symlinks when it has one.
+pub(crate) fn gather_paths(
+    roots: &[PathBuf],
+    ecosystems: &HashSet<Ecosystem>,
+    languages: &HashSet<Language>,
+    filter: &PathFilter,
+    follow_symlinks: bool,
+) -> Vec<PathBuf> {
+    let Some((first, rest)) = roots.split_first() else {
+        return Vec::new();
+    };
+    let mut builder = WalkBuilder::new(first);
+    for root in rest {
+        builder.add(root);
+    }
+    builder
+        .git_ignore(true)
+        .git_exclude(true)
+        .parents(true)
+        .add_custom_ignore_filename(IGNORE_FILE_NAME)
+        .follow_links(follow_symlinks);
+    let walk_filter = filter.clone();
+    builder.filter_entry(move |entry| {
+        let is_dir = entry
+            .file_type()
+            .is_some_and(|file_type| file_type.is_dir());
+        !walk_filter.is_excluded(entry.path(), is_dir)
+    });
+
+    let mut seen = HashSet::new();
     let mut paths = Vec::new();
     for entry in builder.build() {
         let entry = match entry {
@@ -30,14 +249,128 @@ pub fn gather_paths(repo_root: &PathBuf, ecosystems: &HashSet<Ecosystem>) -> Vec
             continue;
         }
         let path = entry.path();
-        let Some(ecosystem) = crate::ecosystem_for_path(path) else {
-            continue;
-        };
-        if !ecosystems.contains(&ecosystem) {
+        // Paths given as roots are yielded without going through the filter.
+        if filter.is_excluded(path, false) {
             continue;
         }
-        paths.push(path.to_path_buf());
+        push_path(path, ecosystems, languages, &mut seen, &mut paths);
+    }
+
+    // Includes bring back ignored paths under `roots`, never paths beyond
+    // them: with `--stdin-paths`, only the listed files.
+    for root in &filter.include_roots {
+        let mut builder = WalkBuilder::new(root);
+        builder
+            .standard_filters(false)
+            .follow_links(follow_symlinks)
+            .filter_entry(|entry| entry.file_name() != ".git");
+        for entry in builder.build().flatten() {
+            let path = entry.path();
+            if entry
+                .file_type()
+                .is_some_and(|file_type| file_type.is_file())
+                && filter.is_included(path, false)
+                && roots.iter().any(|root| path.starts_with(root))
+            {
+                push_path(path, ecosystems, languages, &mut seen, &mut paths);
+            }
+        }
     }
 
+    if follow_symlinks {
+        paths = dedup_canonical(paths, roots);
+    }
     paths
 }
+
+/// Keeps one path per file, in walk order: the first path without symlinks
+/// below its root if there is one (`releases/v3/app.go` rather than
+/// `current/app.go` for `current -> releases/v3`), else the first path seen.
+fn dedup_canonical(paths: Vec<PathBuf>, roots: &[PathBuf]) -> Vec<PathBuf> {
+    let is_direct = |path: &Path, canonical: &Path| {
+        roots
+            .iter()
+            .filter_map(|root| path.strip_prefix(root).ok())
+            .any(|relative| canonical.ends_with(relative))
+    };
+    let mut order: Vec<PathBuf> = Vec::new();
+    let mut chosen: HashMap<PathBuf, (usize, bool)> = HashMap::new();
+    for path in paths {
+        let canonical = std::fs::canonicalize(&path).unwrap_or_else(|_| path.clone());
+        let direct = is_direct(&path, &canonical);
+        match chosen.get_mut(&canonical) {
+            Some((index, chosen_direct)) => {
+                if direct && !*chosen_direct {
+                    order[*index] = path;
+                    *chosen_direct = true;
+                }
+            }
+            None => {
+                chosen.insert(canonical, (order.len(), direct));
+                order.push(path);
+            }
+        }
+    }
+    order
+}
+
+/// Keeps the `paths` (e.g. the files committed at a git ref) that lie under
+/// one of `roots` and that [`gather_paths`] would keep, `.gitignore` aside,
+/// with `ignore_files` in place of the `.cruxlinesignore` files on disk.
+pub(crate) fn select_paths(
+    paths: Vec<PathBuf>,
+    roots: &[PathBuf],
+    ecosystems: &HashSet<Ecosystem>,
+    languages: &HashSet<Language>,
+    filter: &PathFilter,
+    ignore_files: &IgnoreFiles,
+) -> Vec<PathBuf> {
+    let mut seen = HashSet::new();
+    let mut selected = Vec::new();
+    for path in paths {
+        let ignored = ignore_files.is_ignored(&path) && !filter.is_included(&path, false);
+        if roots.iter().any(|root| path.starts_with(root))
+            && !ignored
+            && !filter.is_excluded(&path, false)
+        {
+            push_path(&path, ecosystems, languages, &mut seen, &mut selected);
+        }
+    }
+    selected
+}
+
+fn push_path(
+    path: &Path,
+    ecosystems: &HashSet<Ecosystem>,
+    languages: &HashSet<Language>,
+    seen: &mut HashSet<PathBuf>,
+    paths: &mut Vec<PathBuf>,
+) {
+    let Some(language) = language_for_file(path) else {
+        return;
+    };
+    if languages.contains(&language)
+        && ecosystems.contains(&ecosystem_for_language(language))
+        && seen.insert(path.to_path_buf())
+    {
+        paths.push(path.to_path_buf());
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::literal_prefix;
+    use std::path::PathBuf;
+
+    #[test]
+    fn literal_prefix_stops_at_the_first_wildcard() {
+        assert_eq!(literal_prefix("vendor/**"), PathBuf::from("vendor"));
+        assert_eq!(
+            literal_prefix("/third_party/acme/*.go"),
+            PathBuf::from("third_party/acme")
+        );
+        assert_eq!(literal_prefix("**/gen/*.go"), PathBuf::new());
+        assert_eq!(literal_prefix("*.pb.go"), PathBuf::new());
+        assert_eq!(literal_prefix("vendor/"), PathBuf::new());
+    }
+}
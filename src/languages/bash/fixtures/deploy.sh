@@ -0,0 +1,11 @@
+#!/usr/bin/env bash
+set -euo pipefail
+
+source ./lib/common.sh
+
+deploy() {
+    require_command git
+    log_info "deploying $1"
+}
+
+deploy "${1:-staging}"
@@ -0,0 +1,14 @@
+#!/usr/bin/env bash
+
+LOG_PREFIX="[deploy]"
+
+log_info() {
+    echo "$LOG_PREFIX $*"
+}
+
+require_command() {
+    command -v "$1" >/dev/null || {
+        log_info "missing command: $1"
+        exit 1
+    }
+}
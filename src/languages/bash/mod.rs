@@ -0,0 +1,154 @@
+use std::path::{Path, PathBuf};
+
+use tree_sitter::Node;
+
+use crate::find_references::{Location, location_from_node, walk_tree};
+
+pub(crate) const EXTENSIONS: &[&str] = &["sh", "bash"];
+
+/// Interpreters in a `#!` line that mark an extensionless file as a shell
+/// script.
+const INTERPRETERS: &[&str] = &["sh", "bash", "dash", "ksh"];
+
+pub(crate) fn language() -> tree_sitter::Language {
+    tree_sitter_bash::LANGUAGE.into()
+}
+
+/// Whether `line` is a shebang for a shell, e.g. `#!/bin/sh` or
+/// `#!/usr/bin/env bash`.
+pub(crate) fn is_shell_shebang(line: &str) -> bool {
+    let Some(command) = line.strip_prefix("#!") else {
+        return false;
+    };
+    let mut words = command.split_whitespace();
+    let Some(mut interpreter) = words.next().map(interpreter_name) else {
+        return false;
+    };
+    if interpreter == "env" {
+        match words.find(|word| !word.starts_with('-')) {
+            Some(word) => interpreter = interpreter_name(word),
+            None => return false,
+        }
+    }
+    INTERPRETERS.contains(&interpreter)
+}
+
+fn interpreter_name(word: &str) -> &str {
+    word.rsplit('/').next().unwrap_or(word)
+}
+
+/// Emits functions, plus variables assigned at the top level of the script
+/// (including `export` and `readonly` ones).
+pub(crate) fn emit_definitions(
+    path: &Path,
+    source: &str,
+    tree: &tree_sitter::Tree,
+    mut emit: impl FnMut(Location),
+) {
+    walk_tree(tree, |node| {
+        let name = match node.kind() {
+            "function_definition" => node.child_by_field_name("name"),
+            "variable_assignment" if is_top_level(node) => node.child_by_field_name("name"),
+            _ => None,
+        };
+        if let Some(name) = name
+            && let Some(location) = location_from_node(path, source, name)
+        {
+            emit(location);
+        }
+    });
+}
+
+/// Emits command names (`greet "$USER"`) and expanded variables (`$NAME`,
+/// `${NAME}`).
+pub(crate) fn emit_references(
+    path: &Path,
+    source: &str,
+    tree: &tree_sitter::Tree,
+    mut emit: impl FnMut(Location),
+) {
+    walk_tree(tree, |node| {
+        if matches!(node.kind(), "command_name" | "variable_name")
+            && let Some(location) = location_from_node(path, source, node)
+        {
+            emit(location);
+        }
+    });
+}
+
+/// Emits candidate paths for `source file.sh` and `. file.sh`.
+///
+/// Paths are matched relative to the script and, since the shell resolves
+/// them against the working directory, by suffix. A path built from a
+/// variable such as `"$DIR/lib/common.sh"` is matched by the part after it.
+pub(crate) fn emit_imports(
+    path: &Path,
+    source: &str,
+    tree: &tree_sitter::Tree,
+    mut emit: impl FnMut(Vec<PathBuf>),
+) {
+    let dir = path.parent().unwrap_or_else(|| Path::new(""));
+    walk_tree(tree, |node| {
+        if node.kind() != "command" {
+            return;
+        }
+        let Some(command) = node
+            .child_by_field_name("name")
+            .and_then(|name| name.utf8_text(source.as_bytes()).ok())
+        else {
+            return;
+        };
+        if !matches!(command, "source" | ".") {
+            return;
+        }
+        let Some(target) = node
+            .child_by_field_name("argument")
+            .and_then(|argument| literal_path(argument, source))
+        else {
+            return;
+        };
+        let target = PathBuf::from(target);
+        if target.is_absolute() {
+            emit(vec![target]);
+        } else {
+            emit(vec![dir.join(&target), target]);
+        }
+    });
+}
+
+/// The literal part of a sourced path: the whole argument without quotes, or
+/// what follows the last expansion in it.
+fn literal_path<'a>(argument: Node, source: &'a str) -> Option<&'a str> {
+    let text = argument.utf8_text(source.as_bytes()).ok()?;
+    let text = text.trim_matches(|c| c == '"' || c == '\'');
+    let text = match text.rfind('$') {
+        Some(index) => {
+            let (_, rest) = text[index..].split_once('/')?;
+            rest
+        }
+        None => text,
+    };
+    (!text.is_empty()).then_some(text)
+}
+
+fn is_top_level(node: Node) -> bool {
+    let mut parent = node.parent();
+    if parent.is_some_and(|parent| parent.kind() == "declaration_command") {
+        parent = parent.and_then(|parent| parent.parent());
+    }
+    parent.is_some_and(|parent| parent.kind() == "program")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::is_shell_shebang;
+
+    #[test]
+    fn recognizes_shell_shebangs() {
+        assert!(is_shell_shebang("#!/bin/sh"));
+        assert!(is_shell_shebang("#!/usr/bin/env bash"));
+        assert!(is_shell_shebang("#!/usr/bin/env -S bash -e"));
+        assert!(!is_shell_shebang("#!/usr/bin/env python3"));
+        assert!(!is_shell_shebang("echo hi"));
+    }
+}
@@ -0,0 +1,6 @@
+#include <stdlib.h>
+#include "geometry.h"
+
+int report(struct Rectangle rect) {
+    return area(rect) + perimeter(rect);
+}
@@ -0,0 +1,9 @@
+#include "geometry.h"
+
+int area(struct Rectangle rect) {
+    return rect.width * rect.height;
+}
+
+int perimeter(struct Rectangle rect) {
+    return 2 * (rect.width + rect.height);
+}
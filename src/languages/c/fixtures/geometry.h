@@ -0,0 +1,9 @@
+#ifndef GEOMETRY_H
+#define GEOMETRY_H
+
+#include "types.h"
+
+int area(struct Rectangle rect);
+int perimeter(struct Rectangle rect);
+
+#endif
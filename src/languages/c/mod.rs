@@ -1,8 +1,9 @@
-use std::path::Path;
+use std::path::{Path, PathBuf};
 
 use tree_sitter::Node;
 
 use crate::find_references::{Location, location_from_node, walk_tree};
+use crate::languages::kind::Visibility;
 
 pub(crate) const EXTENSIONS: &[&str] = &["c", "h"];
 pub(crate) const REFERENCE_KINDS: &[&str] = &["identifier", "type_identifier", "field_identifier"];
@@ -51,7 +52,7 @@ pub(crate) fn emit_definitions(
         }
         "declaration" => {
             // Global variable declarations (can have multiple declarators like `int a, b, c;`)
-            if is_top_level(node) && !is_function_declaration(node) {
+            if is_top_level(node) && !is_function_declaration(node) && !is_extern(node) {
                 let mut cursor = node.walk();
                 for child in node.children_by_field_name("declarator", &mut cursor) {
                     if let Some(name) = find_identifier_in_declarator(child) {
@@ -66,6 +67,59 @@ pub(crate) fn emit_definitions(
     });
 }
 
+/// Emits function prototypes and `extern` variables. They name the same
+/// symbol as a definition elsewhere, typically in the matching `.c` file.
+pub(crate) fn emit_declarations(
+    path: &Path,
+    source: &str,
+    tree: &tree_sitter::Tree,
+    mut emit: impl FnMut(Location),
+) {
+    walk_tree(tree, |node| {
+        if node.kind() != "declaration"
+            || !is_top_level(node)
+            || !(is_function_declaration(node) || is_extern(node))
+        {
+            return;
+        }
+        let mut cursor = node.walk();
+        for child in node.children_by_field_name("declarator", &mut cursor) {
+            if let Some(name) = find_identifier_in_declarator(child)
+                && let Some(location) = location_from_node(path, source, name)
+            {
+                emit(location);
+            }
+        }
+    });
+}
+
+/// Emits candidate paths for `#include "file.h"`. Angle-bracket includes
+/// refer to system headers and are ignored.
+pub(crate) fn emit_imports(
+    path: &Path,
+    source: &str,
+    tree: &tree_sitter::Tree,
+    mut emit: impl FnMut(Vec<PathBuf>),
+) {
+    let dir = path.parent().unwrap_or_else(|| Path::new(""));
+    walk_tree(tree, |node| {
+        if node.kind() != "preproc_include" {
+            return;
+        }
+        let Some(target) = node
+            .child_by_field_name("path")
+            .filter(|target| target.kind() == "string_literal")
+            .and_then(|target| target.utf8_text(source.as_bytes()).ok())
+        else {
+            return;
+        };
+        let target = PathBuf::from(target.trim_matches('"'));
+        // Quoted includes search the including file's directory first, then
+        // the include path, which we approximate with a suffix match.
+        emit(vec![dir.join(&target), target]);
+    });
+}
+
 pub(crate) fn emit_references(
     path: &Path,
     source: &str,
@@ -81,11 +135,40 @@ pub(crate) fn emit_references(
     });
 }
 
+/// C and C++ definitions are visible to other files unless declared
+/// `static` at file scope (`static` class members are still public).
+pub(crate) fn visibility(declaration: Node, source: &str) -> Visibility {
+    let in_class = declaration
+        .parent()
+        .is_some_and(|parent| parent.kind() == "field_declaration_list");
+    let mut cursor = declaration.walk();
+    let file_static = !in_class
+        && declaration.children(&mut cursor).any(|child| {
+            child.kind() == "storage_class_specifier"
+                && child.utf8_text(source.as_bytes()) == Ok("static")
+        });
+    if file_static {
+        Visibility::Private
+    } else {
+        Visibility::Public
+    }
+}
+
 fn is_top_level(node: Node) -> bool {
     node.parent()
         .is_some_and(|parent| parent.kind() == "translation_unit")
 }
 
+fn is_extern(node: Node) -> bool {
+    let mut cursor = node.walk();
+    node.children(&mut cursor).any(|child| {
+        child.kind() == "storage_class_specifier"
+            && child
+                .child(0)
+                .is_some_and(|keyword| keyword.kind() == "extern")
+    })
+}
+
 fn is_top_level_type_specifier(node: Node) -> bool {
     // Type specifiers can be inside a type_definition or declaration at top level
     let Some(parent) = node.parent() else {
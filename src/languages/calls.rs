@@ -0,0 +1,111 @@
+use std::path::Path;
+
+use tree_sitter::{Node, Tree};
+
+use crate::find_references::{Location, location_from_node, walk_tree};
+
+/// Call nodes across the supported grammars.
+const CALL_KINDS: &[&str] = &[
+    "call",
+    "call_expression",
+    "method_invocation",
+    "invocation_expression",
+    "function_call_expression",
+    "member_call_expression",
+    "nullsafe_member_call_expression",
+    "scoped_call_expression",
+];
+
+/// Fields naming the callee of a call node, in order of preference.
+const CALLEE_FIELDS: &[&str] = &["function", "method", "name"];
+
+/// Fields naming the member in a callee like `obj.run` or `mod::run`.
+const MEMBER_FIELDS: &[&str] = &["attribute", "property", "field", "name", "function"];
+
+const NAME_KINDS: &[&str] = &[
+    "identifier",
+    "field_identifier",
+    "property_identifier",
+    "simple_identifier",
+    "type_identifier",
+    "constant",
+    "name",
+];
+
+/// Emits the name of the called function at each call site, e.g. `run` for
+/// `run()`, `obj.run()` and `mod::run()`.
+pub(crate) fn emit_calls(path: &Path, source: &str, tree: &Tree, mut emit: impl FnMut(Location)) {
+    walk_tree(tree, |node| {
+        if CALL_KINDS.contains(&node.kind())
+            && let Some(callee) = callee_name(node)
+            && let Some(location) = location_from_node(path, source, callee)
+        {
+            emit(location);
+        }
+    });
+}
+
+fn callee_name(call: Node) -> Option<Node> {
+    let mut current = CALLEE_FIELDS
+        .iter()
+        .find_map(|field| call.child_by_field_name(field))
+        // Kotlin calls have no fields; the callee comes first.
+        .or_else(|| call.named_child(0))?;
+    // Bounded so odd shapes such as `f()()()` cannot loop for long.
+    for _ in 0..8 {
+        if NAME_KINDS.contains(&current.kind()) {
+            return Some(current);
+        }
+        current = MEMBER_FIELDS
+            .iter()
+            .find_map(|field| current.child_by_field_name(field))
+            .or_else(|| current.named_child(current.named_child_count().checked_sub(1)?))?;
+    }
+    None
+}
+
+#[cfg(test)]
+mod tests {
+    use super::emit_calls;
+    use crate::languages::{Language, tree_sitter_language};
+    use std::path::Path;
+    use tree_sitter::Parser;
+
+    fn callees(language: Language, source: &str) -> Vec<String> {
+        let mut parser = Parser::new();
+        parser
+            .set_language(&tree_sitter_language(language))
+            .expect("set language");
+        let tree = parser.parse(source, None).expect("parse");
+        let mut names = Vec::new();
+        emit_calls(Path::new("test"), source, &tree, |location| {
+            names.push(location.name_str().to_string());
+        });
+        names.sort();
+        names
+    }
+
+    #[test]
+    fn finds_python_callees() {
+        let source = "import util\n\nrun()\nutil.helper(1)\nx = limit\n";
+        assert_eq!(callees(Language::Python, source), vec!["helper", "run"]);
+    }
+
+    #[test]
+    fn finds_rust_callees() {
+        let source = "fn main() {\n    run();\n    util::helper();\n    value.method();\n    let x = LIMIT;\n}\n";
+        assert_eq!(
+            callees(Language::Rust, source),
+            vec!["helper", "method", "run"]
+        );
+    }
+
+    #[test]
+    fn finds_go_and_java_callees() {
+        let go = "package main\n\nfunc main() {\n\trun()\n\tutil.Helper()\n}\n";
+        assert_eq!(callees(Language::Go, go), vec!["Helper", "run"]);
+
+        let java = "class A {\n    void f() {\n        run();\n        util.helper();\n    }\n}\n";
+        assert_eq!(callees(Language::Java, java), vec!["helper", "run"]);
+    }
+}
@@ -0,0 +1,9 @@
+namespace Acme.Billing;
+
+public partial class Invoice
+{
+    public decimal Total()
+    {
+        return Items.Sum(item => item.Subtotal());
+    }
+}
@@ -0,0 +1,8 @@
+namespace Acme.Billing;
+
+public partial class Invoice
+{
+    public string Number { get; set; }
+
+    public List<LineItem> Items { get; } = new List<LineItem>();
+}
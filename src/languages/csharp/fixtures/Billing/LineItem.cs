@@ -0,0 +1,10 @@
+namespace Acme.Billing
+{
+    public record LineItem(string Description, decimal Price, int Quantity)
+    {
+        public decimal Subtotal()
+        {
+            return Price * Quantity;
+        }
+    }
+}
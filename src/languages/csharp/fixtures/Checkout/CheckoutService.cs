@@ -0,0 +1,12 @@
+using Acme.Billing;
+
+namespace Acme.Checkout
+{
+    public class CheckoutService
+    {
+        public decimal Charge(Invoice invoice)
+        {
+            return invoice.Total();
+        }
+    }
+}
@@ -3,36 +3,75 @@ use std::path::Path;
 use tree_sitter::Node;
 
 use crate::find_references::{Location, location_from_node, walk_tree};
+use crate::languages::kind::Visibility;
 
 pub(crate) const EXTENSIONS: &[&str] = &["cs"];
 pub(crate) const REFERENCE_KINDS: &[&str] = &["identifier", "generic_name"];
 
+const TYPE_KINDS: &[&str] = &[
+    "class_declaration",
+    "interface_declaration",
+    "struct_declaration",
+    "enum_declaration",
+    "record_declaration",
+    "record_struct_declaration",
+    "delegate_declaration",
+];
+
+const MEMBER_KINDS: &[&str] = &["method_declaration", "property_declaration"];
+
+const NAMESPACE_KINDS: &[&str] = &["namespace_declaration", "file_scoped_namespace_declaration"];
+
 pub(crate) fn language() -> tree_sitter::Language {
     tree_sitter_c_sharp::LANGUAGE.into()
 }
 
+/// Emits top-level types and the methods and properties declared in them.
+/// Parts of partial types are emitted by [`emit_declarations`] instead.
 pub(crate) fn emit_definitions(
     path: &Path,
     source: &str,
     tree: &tree_sitter::Tree,
     mut emit: impl FnMut(Location),
 ) {
-    walk_tree(tree, |node| match node.kind() {
-        "class_declaration"
-        | "interface_declaration"
-        | "struct_declaration"
-        | "enum_declaration"
-        | "record_declaration"
-        | "record_struct_declaration"
-        | "delegate_declaration" => {
-            if is_top_level(node)
-                && let Some(name) = node.child_by_field_name("name")
+    walk_tree(tree, |node| {
+        if !TYPE_KINDS.contains(&node.kind()) || !is_top_level(node) {
+            return;
+        }
+        if !is_partial(node, source)
+            && let Some(name) = node.child_by_field_name("name")
+            && let Some(location) = location_from_node(path, source, name)
+        {
+            emit(location);
+        }
+        for member in body_members(node) {
+            if MEMBER_KINDS.contains(&member.kind())
+                && let Some(name) = member.child_by_field_name("name")
                 && let Some(location) = location_from_node(path, source, name)
             {
                 emit(location);
             }
         }
-        _ => {}
+    });
+}
+
+/// Emits each part of a `partial` type. All parts fold into a single
+/// definition, so a class split across files is one symbol.
+pub(crate) fn emit_declarations(
+    path: &Path,
+    source: &str,
+    tree: &tree_sitter::Tree,
+    mut emit: impl FnMut(Location),
+) {
+    walk_tree(tree, |node| {
+        if TYPE_KINDS.contains(&node.kind())
+            && is_top_level(node)
+            && is_partial(node, source)
+            && let Some(name) = node.child_by_field_name("name")
+            && let Some(location) = location_from_node(path, source, name)
+        {
+            emit(location);
+        }
     });
 }
 
@@ -51,6 +90,159 @@ pub(crate) fn emit_references(
     });
 }
 
+/// Emits the namespace-qualified names other files can import from this one:
+/// `MyApp.Models.User` for each top-level type, and `MyApp.Models.*` for its
+/// namespace. Block-scoped namespaces nest, so `namespace A { namespace B
+/// { ... } }` yields `A.B`.
+pub(crate) fn emit_package_exports(
+    source: &str,
+    tree: &tree_sitter::Tree,
+    mut emit: impl FnMut(String),
+) {
+    let file_scoped = file_scoped_namespace(tree, source);
+    walk_tree(tree, |node| {
+        if !TYPE_KINDS.contains(&node.kind()) || !is_top_level(node) {
+            return;
+        }
+        let Some(name) = node
+            .child_by_field_name("name")
+            .and_then(|name| name.utf8_text(source.as_bytes()).ok())
+        else {
+            return;
+        };
+        match enclosing_namespace(node, source).or_else(|| file_scoped.clone()) {
+            Some(namespace) => {
+                emit(format!("{namespace}.{name}"));
+                emit(format!("{namespace}.*"));
+            }
+            None => emit(name.to_string()),
+        }
+    });
+}
+
+/// Emits the names imported by `using` directives, matching the format of
+/// [`emit_package_exports`]: `using A.B;` imports `A.B.*`, while
+/// `using static A.B.C;` and aliases name a single type.
+pub(crate) fn emit_package_imports(
+    source: &str,
+    tree: &tree_sitter::Tree,
+    mut emit: impl FnMut(String),
+) {
+    walk_tree(tree, |node| {
+        if node.kind() != "using_directive" {
+            return;
+        }
+        let mut is_static = false;
+        let mut is_alias = false;
+        let mut target = None;
+        let mut cursor = node.walk();
+        for child in node.children(&mut cursor) {
+            match child.kind() {
+                "static" => is_static = true,
+                "=" => {
+                    is_alias = true;
+                    target = None;
+                }
+                "identifier" | "qualified_name" | "generic_name" => {
+                    target = dotted_text(child, source);
+                }
+                _ => {}
+            }
+        }
+        let Some(target) = target else {
+            return;
+        };
+        if is_static {
+            emit(target);
+        } else if is_alias {
+            // The alias may name a type or a whole namespace.
+            emit(format!("{target}.*"));
+            emit(target);
+        } else {
+            emit(format!("{target}.*"));
+        }
+    });
+}
+
+/// Declarations marked `public`, and interface members, which are public
+/// without it. Fields keep their modifiers on the `field_declaration`.
+pub(crate) fn visibility(declaration: Node, source: &str) -> Visibility {
+    let mut node = declaration;
+    while matches!(node.kind(), "variable_declarator" | "variable_declaration")
+        && let Some(parent) = node.parent()
+    {
+        node = parent;
+    }
+    let in_interface = node
+        .parent()
+        .and_then(|body| body.parent())
+        .is_some_and(|owner| owner.kind() == "interface_declaration");
+    if in_interface || has_modifier(node, source, "public") {
+        Visibility::Public
+    } else {
+        Visibility::Private
+    }
+}
+
+/// Named members of a type body.
+fn body_members(node: Node) -> Vec<Node> {
+    let Some(body) = node.child_by_field_name("body") else {
+        return Vec::new();
+    };
+    let mut cursor = body.walk();
+    body.named_children(&mut cursor).collect()
+}
+
+fn is_partial(node: Node, source: &str) -> bool {
+    has_modifier(node, source, "partial")
+}
+
+fn has_modifier(node: Node, source: &str, modifier: &str) -> bool {
+    let mut cursor = node.walk();
+    node.children(&mut cursor).any(|child| {
+        child.kind() == "modifier" && child.utf8_text(source.as_bytes()) == Ok(modifier)
+    })
+}
+
+/// Joined names of the block-scoped (or file-scoped) namespaces around
+/// `node`, outermost first.
+fn enclosing_namespace(node: Node, source: &str) -> Option<String> {
+    let mut names = Vec::new();
+    let mut current = node.parent();
+    while let Some(parent) = current {
+        if NAMESPACE_KINDS.contains(&parent.kind())
+            && let Some(name) = parent
+                .child_by_field_name("name")
+                .and_then(|name| dotted_text(name, source))
+        {
+            names.push(name);
+        }
+        current = parent.parent();
+    }
+    if names.is_empty() {
+        return None;
+    }
+    names.reverse();
+    Some(names.join("."))
+}
+
+/// The name of a `namespace Foo;` declaration, which applies to the
+/// declarations that follow it in the file.
+fn file_scoped_namespace(tree: &tree_sitter::Tree, source: &str) -> Option<String> {
+    let root = tree.root_node();
+    let mut cursor = root.walk();
+    let namespace = root
+        .named_children(&mut cursor)
+        .find(|node| node.kind() == "file_scoped_namespace_declaration")?;
+    dotted_text(namespace.child_by_field_name("name")?, source)
+}
+
+fn dotted_text(node: Node, source: &str) -> Option<String> {
+    let text = node.utf8_text(source.as_bytes()).ok()?;
+    let text = text.split('<').next().unwrap_or(text);
+    Some(text.chars().filter(|c| !c.is_whitespace()).collect())
+}
+
 fn is_top_level(node: Node) -> bool {
     // In C#, top-level types can be:
     // 1. Direct children of compilation_unit
@@ -68,18 +260,14 @@ fn is_top_level(node: Node) -> bool {
     }
 
     // Inside a namespace (either block or file-scoped)
-    if parent_kind == "namespace_declaration" || parent_kind == "file_scoped_namespace_declaration"
-    {
+    if NAMESPACE_KINDS.contains(&parent_kind) {
         return true;
     }
 
     // Inside a declaration_list which is inside a namespace
     if parent_kind == "declaration_list" {
         if let Some(grandparent) = parent.parent() {
-            let gp_kind = grandparent.kind();
-            if gp_kind == "namespace_declaration"
-                || gp_kind == "file_scoped_namespace_declaration"
-            {
+            if NAMESPACE_KINDS.contains(&grandparent.kind()) {
                 return true;
             }
         }
@@ -0,0 +1,6 @@
+package greet
+
+// Greet welcomes someone, e.g. "Grüße, Zoë".
+func Greet(name string) string {
+	return "Grüße, " + name
+}
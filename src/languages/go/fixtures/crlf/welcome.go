@@ -0,0 +1,5 @@
+package greet
+
+func Welcome() string {
+	greeting := "café"; return Greet(greeting)
+}
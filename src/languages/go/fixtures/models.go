@@ -12,3 +12,11 @@ func NewUser(name string) *User {
 const DefaultAge = 18
 
 var GlobalCounter int
+
+func (u *User) Rename(name string) {
+	u.Name = name
+}
+
+func (u User) IsAdult() bool {
+	return u.Age >= DefaultAge
+}
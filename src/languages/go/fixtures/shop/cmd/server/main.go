@@ -0,0 +1,14 @@
+package main
+
+import (
+	"fmt"
+
+	authz "example.com/shop/internal/auth"
+	. "example.com/shop/internal/money"
+)
+
+func main() {
+	if authz.Validate("Bearer demo") {
+		fmt.Println(Format(1250))
+	}
+}
@@ -0,0 +1,8 @@
+package auth
+
+import "strings"
+
+// Validate reports whether a bearer token is well formed.
+func Validate(token string) bool {
+	return strings.HasPrefix(token, "Bearer ")
+}
@@ -0,0 +1,6 @@
+package billing
+
+// Validate reports whether an invoice total is billable.
+func Validate(total int) bool {
+	return total > 0
+}
@@ -0,0 +1,8 @@
+package money
+
+import "fmt"
+
+// Format renders an amount in cents as dollars.
+func Format(cents int) string {
+	return fmt.Sprintf("$%d.%02d", cents/100, cents%100)
+}
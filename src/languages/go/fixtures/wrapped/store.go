@@ -0,0 +1,27 @@
+package wrapped
+
+type Store struct {
+	items map[string]string
+}
+
+func NewStore(
+	items map[string]string,
+) *Store {
+	return &Store{items: items}
+}
+
+func (
+	s *Store,
+) Lookup(
+	key string,
+	fallback string,
+) string {
+	if value, ok := s.items[key]; ok {
+		return value
+	}
+	return fallback
+}
+
+func Describe(key string) string {
+	return NewStore(nil).Lookup(key, "missing")
+}
@@ -0,0 +1,98 @@
+use std::path::{Path, PathBuf};
+use std::rc::Rc;
+
+use rustc_hash::FxHashMap;
+
+use crate::languages::project_files::ProjectFiles;
+
+/// The module a `go.mod` declares, and the directory it is rooted at.
+#[derive(Debug)]
+struct GoModule {
+    path: String,
+    root: PathBuf,
+}
+
+/// Nearest-`go.mod` lookup, memoized per directory.
+pub(crate) struct GoModules<'a> {
+    files: &'a ProjectFiles,
+    by_dir: FxHashMap<PathBuf, Option<Rc<GoModule>>>,
+}
+
+impl<'a> GoModules<'a> {
+    /// Looks `go.mod` files up in `files`, which holds the same version of
+    /// the project as the sources being resolved.
+    pub(crate) fn new(files: &'a ProjectFiles) -> Self {
+        Self {
+            files,
+            by_dir: FxHashMap::default(),
+        }
+    }
+
+    /// The import path of the package a file belongs to: the module path
+    /// joined with the file's directory below the module root
+    /// (`example.com/shop/internal/auth` for `internal/auth/token.go`).
+    /// Returns `None` for files outside any module.
+    pub(crate) fn package_path(&mut self, file: &Path) -> Option<String> {
+        let dir = file.parent()?;
+        let module = self.nearest(dir)?;
+        let relative = dir.strip_prefix(&module.root).ok()?;
+        let mut package = module.path.clone();
+        for component in relative.components() {
+            package.push('/');
+            package.push_str(component.as_os_str().to_str()?);
+        }
+        Some(package)
+    }
+
+    fn nearest(&mut self, dir: &Path) -> Option<Rc<GoModule>> {
+        if let Some(module) = self.by_dir.get(dir) {
+            return module.clone();
+        }
+        let path = dir.join("go.mod");
+        let module = match self.files.read(&path) {
+            Some(text) => load(&path, &text).map(Rc::new),
+            None => dir.parent().and_then(|parent| self.nearest(parent)),
+        };
+        self.by_dir.insert(dir.to_path_buf(), module.clone());
+        module
+    }
+}
+
+fn load(path: &Path, text: &str) -> Option<GoModule> {
+    Some(GoModule {
+        path: module_path(text)?,
+        root: path.parent().unwrap_or_else(|| Path::new("")).to_path_buf(),
+    })
+}
+
+/// The path of the `module` directive, which may be quoted and followed by a
+/// comment.
+fn module_path(text: &str) -> Option<String> {
+    text.lines().find_map(|line| {
+        let line = line.split("//").next().unwrap_or("").trim();
+        let path = line.strip_prefix("module")?;
+        if !path.starts_with(char::is_whitespace) {
+            return None;
+        }
+        let path = path.trim().trim_matches(|c| c == '"' || c == '`');
+        (!path.is_empty()).then(|| path.to_string())
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::module_path;
+
+    #[test]
+    fn reads_the_module_directive() {
+        assert_eq!(
+            module_path("// shop\nmodule example.com/shop // main module\n\ngo 1.22\n"),
+            Some("example.com/shop".to_string())
+        );
+        assert_eq!(
+            module_path("module \"example.com/quoted\"\n"),
+            Some("example.com/quoted".to_string())
+        );
+        assert_eq!(module_path("modules x\ngo 1.22\n"), None);
+    }
+}
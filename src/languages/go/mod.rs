@@ -3,6 +3,11 @@ use std::path::Path;
 use tree_sitter::Node;
 
 use crate::find_references::{Location, location_from_node, walk_tree};
+use crate::languages::kind::Visibility;
+
+mod gomod;
+
+pub(crate) use gomod::GoModules;
 
 pub(crate) const EXTENSIONS: &[&str] = &["go"];
 pub(crate) const REFERENCE_KINDS: &[&str] = &["identifier", "type_identifier", "field_identifier"];
@@ -45,7 +50,10 @@ pub(crate) fn emit_references(
     mut emit: impl FnMut(Location),
 ) {
     walk_tree(tree, |node| {
+        // Receivers are emitted by `emit_receivers`; the receiver name is a
+        // local binding, not a reference.
         if REFERENCE_KINDS.contains(&node.kind())
+            && !in_receiver(node)
             && let Some(location) = location_from_node(path, source, node)
         {
             emit(location);
@@ -53,6 +61,92 @@ pub(crate) fn emit_references(
     });
 }
 
+/// Emits the receiver type of each top-level method, e.g. `User` for both
+/// `func (u *User) Rename()` and `func (u User) Name()`.
+pub(crate) fn emit_receivers(
+    path: &Path,
+    source: &str,
+    tree: &tree_sitter::Tree,
+    mut emit: impl FnMut(Location),
+) {
+    walk_tree(tree, |node| {
+        if node.kind() == "method_declaration"
+            && is_top_level(node)
+            && let Some(receiver) = node.child_by_field_name("receiver")
+            && let Some(type_name) = receiver_type_name(receiver)
+            && let Some(location) = location_from_node(path, source, type_name)
+        {
+            emit(location);
+        }
+    });
+}
+
+/// Emits the path of each import spec: `example.com/shop/internal/auth`
+/// for plain, aliased (`a "…"`), dot (`. "…"`) and blank (`_ "…"`) imports
+/// alike. Which files a path refers to depends on `go.mod`, so imports are
+/// matched against package paths from [`GoModules`] after parsing; standard
+/// library and third-party imports match no file.
+pub(crate) fn emit_package_imports(
+    source: &str,
+    tree: &tree_sitter::Tree,
+    mut emit: impl FnMut(String),
+) {
+    walk_tree(tree, |node| {
+        if node.kind() == "import_spec"
+            && let Some(path) = node.child_by_field_name("path")
+            && let Ok(text) = path.utf8_text(source.as_bytes())
+        {
+            let path = text.trim_matches(|c| c == '"' || c == '`');
+            if !path.is_empty() {
+                emit(path.to_string());
+            }
+        }
+    });
+}
+
+/// Capitalized names are exported from their package.
+pub(crate) fn visibility(name: &str) -> Visibility {
+    if name.starts_with(char::is_uppercase) {
+        Visibility::Public
+    } else {
+        Visibility::Private
+    }
+}
+
+/// Finds the named type in a receiver list, stripping pointers, parentheses
+/// and type arguments (`*List[T]` yields `List`).
+fn receiver_type_name(receiver: Node) -> Option<Node> {
+    let mut cursor = receiver.walk();
+    let parameter = receiver
+        .named_children(&mut cursor)
+        .find(|child| child.kind() == "parameter_declaration")?;
+    let mut current = parameter.child_by_field_name("type")?;
+    loop {
+        match current.kind() {
+            "type_identifier" => return Some(current),
+            "pointer_type" | "parenthesized_type" => current = current.named_child(0)?,
+            "generic_type" => current = current.child_by_field_name("type")?,
+            _ => return None,
+        }
+    }
+}
+
+fn in_receiver(node: Node) -> bool {
+    let mut current = node.parent();
+    while let Some(parent) = current {
+        if parent.kind() == "parameter_list" {
+            return parent.parent().is_some_and(|method| {
+                method.kind() == "method_declaration"
+                    && method
+                        .child_by_field_name("receiver")
+                        .is_some_and(|receiver| receiver.id() == parent.id())
+            });
+        }
+        current = parent.parent();
+    }
+    false
+}
+
 fn is_top_level(node: Node) -> bool {
     node.parent()
         .map(|parent| parent.kind() == "source_file")
@@ -0,0 +1,22 @@
+package com.acme.model;
+
+import com.acme.service.*;
+
+public class Account {
+    public enum Status {
+        OPEN,
+        CLOSED
+    }
+
+    private Status status = Status.OPEN;
+    private long balance;
+
+    public void deposit(long amount) {
+        balance += amount;
+    }
+
+    public void close(AccountService service) {
+        service.archive(this);
+        status = Status.CLOSED;
+    }
+}
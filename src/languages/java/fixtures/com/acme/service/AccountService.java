@@ -0,0 +1,16 @@
+package com.acme.service;
+
+import com.acme.model.Account;
+
+public class AccountService {
+    public Account open() {
+        Account account = new Account();
+        account.deposit(100);
+        return account;
+    }
+
+    public void archive(Account account) {
+        Account.Status status = Account.Status.CLOSED;
+        System.out.println(status);
+    }
+}
@@ -1,36 +1,52 @@
 use std::path::Path;
 
+use rustc_hash::FxHashMap;
 use tree_sitter::Node;
 
 use crate::find_references::{Location, location_from_node, walk_tree};
+use crate::intern::intern;
+use crate::languages::kind::Visibility;
 
 pub(crate) const EXTENSIONS: &[&str] = &["java"];
 pub(crate) const REFERENCE_KINDS: &[&str] = &["identifier", "type_identifier"];
 
+const TYPE_KINDS: &[&str] = &[
+    "class_declaration",
+    "interface_declaration",
+    "enum_declaration",
+    "record_declaration",
+    "annotation_type_declaration",
+];
+
 pub(crate) fn language() -> tree_sitter::Language {
     tree_sitter_java::LANGUAGE.into()
 }
 
+/// Emits top-level types, their nested types (named `Outer.Inner`) and the
+/// methods declared in any of them.
 pub(crate) fn emit_definitions(
     path: &Path,
     source: &str,
     tree: &tree_sitter::Tree,
     mut emit: impl FnMut(Location),
 ) {
-    walk_tree(tree, |node| match node.kind() {
-        "class_declaration"
-        | "interface_declaration"
-        | "enum_declaration"
-        | "record_declaration"
-        | "annotation_type_declaration" => {
-            if is_top_level(node)
-                && let Some(name) = node.child_by_field_name("name")
+    visit_types(tree, source, |node, qualified_name| {
+        if let Some(name) = node.child_by_field_name("name")
+            && let Some(location) = location_from_node(path, source, name)
+        {
+            emit(Location {
+                name: intern(qualified_name),
+                ..location
+            });
+        }
+        for member in body_members(node) {
+            if member.kind() == "method_declaration"
+                && let Some(name) = member.child_by_field_name("name")
                 && let Some(location) = location_from_node(path, source, name)
             {
                 emit(location);
             }
         }
-        _ => {}
     });
 }
 
@@ -40,17 +56,214 @@ pub(crate) fn emit_references(
     tree: &tree_sitter::Tree,
     mut emit: impl FnMut(Location),
 ) {
+    // Nested types are defined as `Outer.Inner`; bare `Inner` inside the same
+    // file refers to that definition.
+    let mut nested: FxHashMap<String, String> = FxHashMap::default();
+    visit_types(tree, source, |_, qualified_name| {
+        if let Some((_, simple)) = qualified_name.rsplit_once('.') {
+            nested
+                .entry(simple.to_string())
+                .or_insert_with(|| qualified_name.to_string());
+        }
+    });
+
     walk_tree(tree, |node| {
-        if REFERENCE_KINDS.contains(&node.kind())
+        if node.kind() == "scoped_type_identifier"
             && let Some(location) = location_from_node(path, source, node)
         {
-            emit(location);
+            let name: String = location
+                .name_str()
+                .chars()
+                .filter(|c| !c.is_whitespace())
+                .collect();
+            emit(Location {
+                name: intern(&name),
+                ..location
+            });
+        } else if REFERENCE_KINDS.contains(&node.kind())
+            && let Some(location) = location_from_node(path, source, node)
+        {
+            let qualified = node
+                .parent()
+                .is_none_or(|parent| parent.kind() != "scoped_type_identifier");
+            match nested.get(location.name_str()).filter(|_| qualified) {
+                Some(qualified_name) => emit(Location {
+                    name: intern(qualified_name),
+                    ..location
+                }),
+                None => emit(location),
+            }
         }
     });
 }
 
-fn is_top_level(node: Node) -> bool {
-    node.parent()
-        .map(|parent| parent.kind() == "program")
-        .unwrap_or(false)
+/// Emits the fully-qualified names other files can import from this one:
+/// `com.foo.Bar` for each type, and `com.foo.*` (or `com.foo.Bar.*` for
+/// nested types) when the type is public.
+pub(crate) fn emit_package_exports(
+    source: &str,
+    tree: &tree_sitter::Tree,
+    mut emit: impl FnMut(String),
+) {
+    let package = package_name(tree, source);
+    let qualify = |name: &str| match &package {
+        Some(package) => format!("{package}.{name}"),
+        None => name.to_string(),
+    };
+    visit_types(tree, source, |node, qualified_name| {
+        emit(qualify(qualified_name));
+        if is_public(node) {
+            let parent = match qualified_name.rsplit_once('.') {
+                Some((outer, _)) => Some(qualify(outer)),
+                None => package.clone(),
+            };
+            if let Some(parent) = parent {
+                emit(format!("{parent}.*"));
+            }
+        }
+    });
+}
+
+/// Emits the names imported by `import` statements, matching the format of
+/// [`emit_package_exports`]. Static imports name the enclosing type.
+pub(crate) fn emit_package_imports(
+    source: &str,
+    tree: &tree_sitter::Tree,
+    mut emit: impl FnMut(String),
+) {
+    let root = tree.root_node();
+    let mut cursor = root.walk();
+    for node in root.named_children(&mut cursor) {
+        if node.kind() != "import_declaration" {
+            continue;
+        }
+        let mut is_static = false;
+        let mut is_wildcard = false;
+        let mut name = None;
+        let mut children = node.walk();
+        for child in node.children(&mut children) {
+            match child.kind() {
+                "static" => is_static = true,
+                "asterisk" => is_wildcard = true,
+                "scoped_identifier" | "identifier" => name = dotted_text(child, source),
+                _ => {}
+            }
+        }
+        let Some(name) = name else {
+            continue;
+        };
+        match (is_static, is_wildcard) {
+            (false, false) => emit(name),
+            (false, true) => emit(format!("{name}.*")),
+            (true, true) => emit(name),
+            (true, false) => {
+                if let Some((owner, _)) = name.rsplit_once('.') {
+                    emit(owner.to_string());
+                }
+            }
+        }
+    }
+}
+
+/// Public declarations; fields keep their modifiers on the enclosing
+/// `field_declaration`.
+pub(crate) fn visibility(declaration: Node) -> Visibility {
+    let node = match declaration.kind() {
+        "variable_declarator" => declaration.parent().unwrap_or(declaration),
+        _ => declaration,
+    };
+    if is_public(node) {
+        Visibility::Public
+    } else {
+        Visibility::Private
+    }
+}
+
+/// Calls `visit` with every type declaration that is top-level or nested in
+/// other type bodies, along with its `Outer.Inner` name.
+fn visit_types<'tree>(
+    tree: &'tree tree_sitter::Tree,
+    source: &str,
+    mut visit: impl FnMut(Node<'tree>, &str),
+) {
+    let root = tree.root_node();
+    let mut stack: Vec<(Node, Option<String>)> = Vec::new();
+    let mut cursor = root.walk();
+    for node in root.named_children(&mut cursor) {
+        stack.push((node, None));
+    }
+    while let Some((node, outer)) = stack.pop() {
+        if !TYPE_KINDS.contains(&node.kind()) {
+            continue;
+        }
+        let Some(name) = node
+            .child_by_field_name("name")
+            .and_then(|name| name.utf8_text(source.as_bytes()).ok())
+        else {
+            continue;
+        };
+        let qualified_name = match outer {
+            Some(outer) => format!("{outer}.{name}"),
+            None => name.to_string(),
+        };
+        visit(node, &qualified_name);
+        for member in body_members(node) {
+            stack.push((member, Some(qualified_name.clone())));
+        }
+    }
+}
+
+/// Named members of a type body, including those after an enum's constants.
+fn body_members(node: Node) -> Vec<Node> {
+    let Some(body) = node.child_by_field_name("body") else {
+        return Vec::new();
+    };
+    let mut members = Vec::new();
+    let mut cursor = body.walk();
+    for member in body.named_children(&mut cursor) {
+        if member.kind() == "enum_body_declarations" {
+            let mut inner = member.walk();
+            members.extend(member.named_children(&mut inner));
+        } else {
+            members.push(member);
+        }
+    }
+    members
+}
+
+fn package_name(tree: &tree_sitter::Tree, source: &str) -> Option<String> {
+    let root = tree.root_node();
+    let mut cursor = root.walk();
+    let package = root
+        .named_children(&mut cursor)
+        .find(|node| node.kind() == "package_declaration")?;
+    let mut children = package.walk();
+    let name = package
+        .named_children(&mut children)
+        .find(|child| matches!(child.kind(), "scoped_identifier" | "identifier"))?;
+    dotted_text(name, source)
+}
+
+fn dotted_text(node: Node, source: &str) -> Option<String> {
+    let text = node.utf8_text(source.as_bytes()).ok()?;
+    Some(text.chars().filter(|c| !c.is_whitespace()).collect())
+}
+
+/// Public types, and members of interfaces, which are implicitly public.
+fn is_public(node: Node) -> bool {
+    if node
+        .parent()
+        .is_some_and(|body| body.kind() == "interface_body")
+    {
+        return true;
+    }
+    let mut cursor = node.walk();
+    node.children(&mut cursor)
+        .filter(|child| child.kind() == "modifiers")
+        .any(|modifiers| {
+            let mut inner = modifiers.walk();
+            modifiers
+                .children(&mut inner)
+                .any(|modifier| modifier.kind() == "public")
+        })
 }
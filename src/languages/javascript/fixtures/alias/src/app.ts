@@ -0,0 +1,5 @@
+import { useState } from "react";
+import { formatName } from "@/lib/util";
+import { greet } from "@/lib/greeting";
+
+console.log(greet(formatName(" Ada ")), useState);
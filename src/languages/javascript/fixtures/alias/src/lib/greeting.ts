@@ -0,0 +1,5 @@
+import { formatName } from "./util";
+
+export function greet(name: string): string {
+    return `Hello, ${formatName(name)}`;
+}
@@ -0,0 +1,8 @@
+const { formatName } = require("./util");
+const util = require("./util.js");
+const lib = require("./lib");
+const lodash = require("lodash");
+
+const user = { first: "Ada", last: "Lovelace" };
+console.log(formatName(user), util.slugify("Hello World"), lib.VERSION);
+console.log(lodash.noop);
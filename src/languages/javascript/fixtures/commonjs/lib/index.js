@@ -0,0 +1,3 @@
+const VERSION = "1.0.0";
+
+exports.VERSION = VERSION;
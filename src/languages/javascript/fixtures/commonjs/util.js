@@ -0,0 +1,12 @@
+function formatName(user) {
+  return `${user.first} ${user.last}`;
+}
+
+function capitalize(text) {
+  return text.charAt(0).toUpperCase() + text.slice(1);
+}
+
+module.exports = { formatName };
+module.exports.slugify = function (text) {
+  return capitalize(text).toLowerCase().replace(/\s+/g, "-");
+};
@@ -0,0 +1,19 @@
+export function fetchUser(
+  id: string,
+  options?: RequestInit,
+): Promise<Response> {
+  return fetch(`/users/${id}`, options);
+}
+
+export const formatUser = (
+  name: string,
+  email: string,
+): string => `${name} <${email}>`;
+
+export async function
+  retry<T>(
+    task: () => Promise<T>,
+    attempts = 3,
+  ): Promise<T> {
+  return attempts > 1 ? task().catch(() => retry(task, attempts - 1)) : task();
+}
@@ -0,0 +1,6 @@
+import { fetchUser, formatUser, retry } from "./api";
+
+export async function showUser(id: string): Promise<string> {
+  await retry(() => fetchUser(id));
+  return formatUser(id, `${id}@example.com`);
+}
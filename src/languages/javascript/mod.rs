@@ -1,14 +1,23 @@
-use std::path::Path;
+use std::ffi::OsString;
+use std::path::{Path, PathBuf};
 
 use tree_sitter::Node;
 
 use crate::find_references::{Location, collect_identifier_nodes, location_from_node, walk_tree};
+use crate::languages::kind::Visibility;
 
-pub(crate) const EXTENSIONS: &[&str] = &["js", "jsx"];
+mod tsconfig;
+
+pub(crate) use tsconfig::TsConfigs;
+
+pub(crate) const EXTENSIONS: &[&str] = &["js", "jsx", "mjs", "cjs"];
 pub(crate) const TYPESCRIPT_EXTENSIONS: &[&str] = &["ts"];
 pub(crate) const TSX_EXTENSIONS: &[&str] = &["tsx"];
 pub(crate) const REFERENCE_KINDS: &[&str] = &["identifier", "jsx_identifier", "type_identifier"];
 
+/// Extensions tried, in order, for an import without one.
+const RESOLVE_EXTENSIONS: &[&str] = &["ts", "tsx", "d.ts", "js", "jsx", "mjs", "cjs"];
+
 pub(crate) fn language() -> tree_sitter::Language {
     tree_sitter_javascript::LANGUAGE.into()
 }
@@ -27,13 +36,14 @@ pub(crate) fn emit_definitions(
     tree: &tree_sitter::Tree,
     mut emit: impl FnMut(Location),
 ) {
+    let exports = CommonJsExports::new(tree.root_node(), source);
     walk_tree(tree, |node| match node.kind() {
         "function_declaration"
         | "class_declaration"
         | "interface_declaration"
         | "type_alias_declaration"
         | "enum_declaration" => {
-            if is_exported(node)
+            if (is_exported(node) || exports.exports_declaration(node, source))
                 && let Some(name) = node.child_by_field_name("name")
                 && let Some(location) = location_from_node(path, source, name)
             {
@@ -49,10 +59,20 @@ pub(crate) fn emit_definitions(
                         emit(location);
                     }
                 });
+            } else if exports.exports_declaration(node, source)
+                && let Some(name) = node.child_by_field_name("name")
+                && let Some(location) = location_from_node(path, source, name)
+            {
+                emit(location);
             }
         }
         _ => {}
     });
+    for property in exports.properties {
+        if let Some(location) = location_from_node(path, source, property) {
+            emit(location);
+        }
+    }
 }
 
 pub(crate) fn emit_references(
@@ -61,15 +81,170 @@ pub(crate) fn emit_references(
     tree: &tree_sitter::Tree,
     mut emit: impl FnMut(Location),
 ) {
+    let modules = required_names(source, tree);
     walk_tree(tree, |node| {
-        if REFERENCE_KINDS.contains(&node.kind())
-            && let Some(location) = location_from_node(path, source, node)
-        {
+        let is_reference = REFERENCE_KINDS.contains(&node.kind())
+            || (node.kind() == "property_identifier" && is_module_member(node, source, &modules));
+        if is_reference && let Some(location) = location_from_node(path, source, node) {
             emit(location);
         }
     });
 }
 
+/// Names bound to a whole module by `const util = require("./util")`.
+fn required_names<'a>(source: &'a str, tree: &tree_sitter::Tree) -> Vec<&'a str> {
+    let mut names = Vec::new();
+    walk_tree(tree, |node| {
+        if node.kind() == "variable_declarator"
+            && let Some(name) = node.child_by_field_name("name")
+            && name.kind() == "identifier"
+            && node
+                .child_by_field_name("value")
+                .is_some_and(|value| is_require_call(value, source))
+            && let Ok(name) = name.utf8_text(source.as_bytes())
+        {
+            names.push(name);
+        }
+    });
+    names
+}
+
+/// Whether `property` is accessed on a module bound by `require`, like
+/// `format` in `util.format(...)`.
+fn is_module_member(property: Node, source: &str, modules: &[&str]) -> bool {
+    property
+        .parent()
+        .filter(|member| member.kind() == "member_expression")
+        .and_then(|member| member.child_by_field_name("object"))
+        .filter(|object| object.kind() == "identifier")
+        .and_then(|object| object.utf8_text(source.as_bytes()).ok())
+        .is_some_and(|object| modules.contains(&object))
+}
+
+fn is_require_call(node: Node, source: &str) -> bool {
+    node.kind() == "call_expression"
+        && node
+            .child_by_field_name("function")
+            .is_some_and(|function| function.utf8_text(source.as_bytes()).ok() == Some("require"))
+}
+
+/// What a file exports through CommonJS, read from its top-level
+/// `module.exports` and `exports` assignments.
+#[derive(Default)]
+struct CommonJsExports<'tree> {
+    /// Top-level declarations exported by name: `module.exports = { a, b: c }`,
+    /// `module.exports = a` or `exports.a = a`.
+    names: Vec<&'tree str>,
+    /// Property names of other `exports.a = ...` and `module.exports.a = ...`
+    /// assignments, which define `a` themselves.
+    properties: Vec<Node<'tree>>,
+}
+
+impl<'tree> CommonJsExports<'tree> {
+    fn new(root: Node<'tree>, source: &'tree str) -> Self {
+        let text = |node: Node| node.utf8_text(source.as_bytes()).unwrap_or("");
+        let mut exports = Self::default();
+        let mut cursor = root.walk();
+        for statement in root.named_children(&mut cursor) {
+            let Some(assignment) = statement
+                .named_child(0)
+                .filter(|_| statement.kind() == "expression_statement")
+                .filter(|expression| expression.kind() == "assignment_expression")
+            else {
+                continue;
+            };
+            let (Some(left), Some(right)) = (
+                assignment.child_by_field_name("left"),
+                assignment.child_by_field_name("right"),
+            ) else {
+                continue;
+            };
+            if text(left) == "module.exports" {
+                exports.add_exported_value(right, source);
+            } else if left.kind() == "member_expression"
+                && left
+                    .child_by_field_name("object")
+                    .is_some_and(|object| matches!(text(object), "exports" | "module.exports"))
+                && let Some(property) = left.child_by_field_name("property")
+            {
+                if right.kind() == "identifier" && text(right) == text(property) {
+                    exports.names.push(text(right));
+                } else {
+                    exports.properties.push(property);
+                }
+            }
+        }
+        exports
+    }
+
+    fn add_exported_value(&mut self, value: Node<'tree>, source: &'tree str) {
+        let text = |node: Node<'tree>| node.utf8_text(source.as_bytes()).unwrap_or("");
+        match value.kind() {
+            "identifier" => self.names.push(text(value)),
+            "object" => {
+                let mut cursor = value.walk();
+                for entry in value.named_children(&mut cursor) {
+                    match entry.kind() {
+                        "shorthand_property_identifier" => self.names.push(text(entry)),
+                        "pair" => {
+                            if let Some(local) = entry
+                                .child_by_field_name("value")
+                                .filter(|local| local.kind() == "identifier")
+                            {
+                                self.names.push(text(local));
+                            }
+                        }
+                        _ => {}
+                    }
+                }
+            }
+            _ => {}
+        }
+    }
+
+    /// Whether `declaration` is a top-level declaration exported by name.
+    fn exports_declaration(&self, declaration: Node, source: &str) -> bool {
+        let statement = if declaration.kind() == "variable_declarator" {
+            declaration.parent()
+        } else {
+            Some(declaration)
+        };
+        statement
+            .and_then(|statement| statement.parent())
+            .is_some_and(|parent| parent.kind() == "program")
+            && declaration
+                .child_by_field_name("name")
+                .and_then(|name| name.utf8_text(source.as_bytes()).ok())
+                .is_some_and(|name| self.names.contains(&name))
+    }
+
+    /// Whether `assignment` is one of the `exports.a = ...` assignments.
+    fn exports_assignment(&self, assignment: Node) -> bool {
+        self.properties
+            .iter()
+            .any(|property| property.parent().and_then(|left| left.parent()) == Some(assignment))
+    }
+}
+
+/// Exported declarations (by `export` or through CommonJS `module.exports`
+/// and `exports`), and members of exported classes unless they are
+/// `private`, `protected` or `#private`.
+pub(crate) fn visibility(declaration: Node, source: &str) -> Visibility {
+    let mut cursor = declaration.walk();
+    let hidden = declaration
+        .children(&mut cursor)
+        .any(|child| match child.kind() {
+            "accessibility_modifier" => child.utf8_text(source.as_bytes()) != Ok("public"),
+            "private_property_identifier" => true,
+            _ => false,
+        });
+    if !hidden && (is_exported(declaration) || is_commonjs_export(declaration, source)) {
+        Visibility::Public
+    } else {
+        Visibility::Private
+    }
+}
+
 fn is_exported(node: Node) -> bool {
     let mut current = node;
     while let Some(parent) = current.parent() {
@@ -84,3 +259,101 @@ fn is_exported(node: Node) -> bool {
     }
     false
 }
+
+fn is_commonjs_export(declaration: Node, source: &str) -> bool {
+    let mut root = declaration;
+    while let Some(parent) = root.parent() {
+        root = parent;
+    }
+    let exports = CommonJsExports::new(root, source);
+    exports.exports_declaration(declaration, source) || exports.exports_assignment(declaration)
+}
+
+/// Emits candidate files for relative imports (`./utils`, `../lib/api.js`).
+pub(crate) fn emit_imports(
+    path: &Path,
+    source: &str,
+    tree: &tree_sitter::Tree,
+    mut emit: impl FnMut(Vec<PathBuf>),
+) {
+    let dir = path.parent().unwrap_or_else(|| Path::new(""));
+    for specifier in import_specifiers(source, tree) {
+        if is_relative(&specifier) {
+            emit(module_candidates(&dir.join(specifier)));
+        }
+    }
+}
+
+/// Emits bare specifiers (`@/lib/util`, `react`). What they point to depends
+/// on `tsconfig.json`, so they are resolved with [`TsConfigs`] after parsing.
+pub(crate) fn emit_module_imports(
+    source: &str,
+    tree: &tree_sitter::Tree,
+    mut emit: impl FnMut(String),
+) {
+    for specifier in import_specifiers(source, tree) {
+        if !is_relative(&specifier) && !specifier.starts_with('/') {
+            emit(specifier);
+        }
+    }
+}
+
+/// Files an import of `target` may refer to: the path itself, then the path
+/// with each known extension, then an index file in that directory.
+pub(crate) fn module_candidates(target: &Path) -> Vec<PathBuf> {
+    let mut candidates = Vec::new();
+    if target
+        .extension()
+        .and_then(|ext| ext.to_str())
+        .is_some_and(|ext| RESOLVE_EXTENSIONS.contains(&ext))
+    {
+        candidates.push(target.to_path_buf());
+    }
+    for ext in RESOLVE_EXTENSIONS {
+        let mut with_extension = OsString::from(target.as_os_str());
+        with_extension.push(format!(".{ext}"));
+        candidates.push(PathBuf::from(with_extension));
+    }
+    for ext in RESOLVE_EXTENSIONS {
+        candidates.push(target.join(format!("index.{ext}")));
+    }
+    candidates
+}
+
+fn is_relative(specifier: &str) -> bool {
+    specifier == "."
+        || specifier == ".."
+        || specifier.starts_with("./")
+        || specifier.starts_with("../")
+}
+
+/// Module specifiers of `import`/`export ... from` statements and of
+/// `require("...")` / `import("...")` calls with a string literal.
+fn import_specifiers(source: &str, tree: &tree_sitter::Tree) -> Vec<String> {
+    let mut specifiers = Vec::new();
+    walk_tree(tree, |node| {
+        let string = match node.kind() {
+            "import_statement" | "export_statement" => node.child_by_field_name("source"),
+            "call_expression" => {
+                let is_import = is_require_call(node, source)
+                    || node
+                        .child_by_field_name("function")
+                        .is_some_and(|function| function.kind() == "import");
+                node.child_by_field_name("arguments")
+                    .and_then(|arguments| arguments.named_child(0))
+                    .filter(|argument| is_import && argument.kind() == "string")
+            }
+            _ => None,
+        };
+        if let Some(specifier) = string.and_then(|string| string_fragment(string, source)) {
+            specifiers.push(specifier.to_string());
+        }
+    });
+    specifiers
+}
+
+fn string_fragment<'a>(string: Node, source: &'a str) -> Option<&'a str> {
+    let text = string.utf8_text(source.as_bytes()).ok()?;
+    let text = text.strip_prefix(['"', '\''])?.strip_suffix(['"', '\''])?;
+    Some(text)
+}
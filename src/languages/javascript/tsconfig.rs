@@ -0,0 +1,228 @@
+use std::collections::BTreeMap;
+use std::path::{Path, PathBuf};
+use std::rc::Rc;
+
+use rustc_hash::FxHashMap;
+use serde::Deserialize;
+
+use super::module_candidates;
+use crate::languages::project_files::ProjectFiles;
+
+/// The parts of `tsconfig.json` that affect module resolution.
+#[derive(Debug)]
+struct TsConfig {
+    base_url: Option<PathBuf>,
+    /// Directory `paths` targets are relative to: `baseUrl` if set, else the
+    /// directory holding the tsconfig.
+    paths_root: PathBuf,
+    paths: BTreeMap<String, Vec<String>>,
+}
+
+#[derive(Deserialize)]
+struct RawTsConfig {
+    #[serde(rename = "compilerOptions", default)]
+    compiler_options: RawCompilerOptions,
+}
+
+#[derive(Default, Deserialize)]
+struct RawCompilerOptions {
+    #[serde(rename = "baseUrl")]
+    base_url: Option<String>,
+    #[serde(default)]
+    paths: BTreeMap<String, Vec<String>>,
+}
+
+/// Nearest-`tsconfig.json` lookup, memoized per directory.
+pub(crate) struct TsConfigs<'a> {
+    files: &'a ProjectFiles,
+    by_dir: FxHashMap<PathBuf, Option<Rc<TsConfig>>>,
+}
+
+impl<'a> TsConfigs<'a> {
+    /// Looks tsconfig files up in `files`, which holds the same version of
+    /// the project as the sources being resolved.
+    pub(crate) fn new(files: &'a ProjectFiles) -> Self {
+        Self {
+            files,
+            by_dir: FxHashMap::default(),
+        }
+    }
+
+    /// Rewrites a bare specifier such as `@/lib/util` into candidate files
+    /// using the `paths` and `baseUrl` of the importer's nearest tsconfig.
+    /// Returns `None` for imports it cannot map (e.g. npm packages).
+    pub(crate) fn resolve(&mut self, importer: &Path, specifier: &str) -> Option<Vec<PathBuf>> {
+        let config = self.nearest(importer.parent()?)?;
+        if let Some((captured, targets)) = match_paths(&config.paths, specifier) {
+            let candidates = targets
+                .iter()
+                .flat_map(|target| {
+                    module_candidates(&config.paths_root.join(target.replacen('*', captured, 1)))
+                })
+                .collect();
+            return Some(candidates);
+        }
+        let base_url = config.base_url.as_ref()?;
+        Some(module_candidates(&base_url.join(specifier)))
+    }
+
+    fn nearest(&mut self, dir: &Path) -> Option<Rc<TsConfig>> {
+        if let Some(config) = self.by_dir.get(dir) {
+            return config.clone();
+        }
+        let path = dir.join("tsconfig.json");
+        let config = match self.files.read(&path) {
+            Some(text) => load(&path, &text).map(Rc::new),
+            None => dir.parent().and_then(|parent| self.nearest(parent)),
+        };
+        self.by_dir.insert(dir.to_path_buf(), config.clone());
+        config
+    }
+}
+
+fn load(path: &Path, text: &str) -> Option<TsConfig> {
+    let raw: RawTsConfig = serde_json::from_str(&strip_jsonc(text)).ok()?;
+    let dir = path.parent().unwrap_or_else(|| Path::new(""));
+    let base_url = raw
+        .compiler_options
+        .base_url
+        .map(|base_url| dir.join(base_url));
+    Some(TsConfig {
+        paths_root: base_url.clone().unwrap_or_else(|| dir.to_path_buf()),
+        base_url,
+        paths: raw.compiler_options.paths,
+    })
+}
+
+/// Picks the `paths` entry TypeScript would use: an exact match, otherwise
+/// the wildcard pattern with the longest prefix. Returns the text matched by
+/// `*` along with the targets.
+fn match_paths<'a, 'b>(
+    paths: &'a BTreeMap<String, Vec<String>>,
+    specifier: &'b str,
+) -> Option<(&'b str, &'a [String])> {
+    if let Some(targets) = paths.get(specifier) {
+        return Some(("", targets));
+    }
+    paths
+        .iter()
+        .filter_map(|(pattern, targets)| {
+            let (prefix, suffix) = pattern.split_once('*')?;
+            let captured = specifier.strip_prefix(prefix)?.strip_suffix(suffix)?;
+            Some((prefix.len(), captured, targets.as_slice()))
+        })
+        .max_by_key(|(prefix_len, _, _)| *prefix_len)
+        .map(|(_, captured, targets)| (captured, targets))
+}
+
+/// tsconfig files are JSON with comments and trailing commas; strips both so
+/// `serde_json` can read them.
+fn strip_jsonc(text: &str) -> String {
+    strip_trailing_commas(&strip_comments(text))
+}
+
+fn strip_comments(text: &str) -> String {
+    let mut out = String::with_capacity(text.len());
+    let mut chars = text.chars().peekable();
+    let mut in_string = false;
+    while let Some(c) = chars.next() {
+        if in_string {
+            out.push(c);
+            if c == '\\' {
+                out.extend(chars.next());
+            } else if c == '"' {
+                in_string = false;
+            }
+            continue;
+        }
+        match (c, chars.peek()) {
+            ('/', Some('/')) => {
+                for skipped in chars.by_ref() {
+                    if skipped == '\n' {
+                        out.push('\n');
+                        break;
+                    }
+                }
+            }
+            ('/', Some('*')) => {
+                chars.next();
+                let mut previous = ' ';
+                for skipped in chars.by_ref() {
+                    if previous == '*' && skipped == '/' {
+                        break;
+                    }
+                    previous = skipped;
+                }
+            }
+            _ => {
+                in_string = c == '"';
+                out.push(c);
+            }
+        }
+    }
+    out
+}
+
+fn strip_trailing_commas(text: &str) -> String {
+    let mut out = String::with_capacity(text.len());
+    let mut chars = text.chars();
+    let mut in_string = false;
+    while let Some(c) = chars.next() {
+        if in_string {
+            out.push(c);
+            if c == '\\' {
+                out.extend(chars.next());
+            } else if c == '"' {
+                in_string = false;
+            }
+            continue;
+        }
+        in_string = c == '"';
+        let trailing = c == ','
+            && matches!(
+                chars.clone().find(|next| !next.is_whitespace()),
+                Some('}' | ']')
+            );
+        if !trailing {
+            out.push(c);
+        }
+    }
+    out
+}
+
+#[cfg(test)]
+mod tests {
+    use super::{match_paths, strip_jsonc};
+    use std::collections::BTreeMap;
+
+    #[test]
+    fn strips_comments_and_trailing_commas() {
+        let text =
+            "{\n  // line\n  \"a\": \"//not a comment\", /* block */\n  \"b\": [1, 2,],\n}\n";
+        let value: serde_json::Value = serde_json::from_str(&strip_jsonc(text)).expect("json");
+        assert_eq!(value["a"], "//not a comment");
+        assert_eq!(value["b"], serde_json::json!([1, 2]));
+    }
+
+    #[test]
+    fn prefers_exact_then_longest_wildcard_prefix() {
+        let paths = BTreeMap::from([
+            ("@/*".to_string(), vec!["src/*".to_string()]),
+            ("@/lib/*".to_string(), vec!["lib/*".to_string()]),
+            ("config".to_string(), vec!["src/config.ts".to_string()]),
+        ]);
+        assert_eq!(
+            match_paths(&paths, "@/lib/util"),
+            Some(("util", &["lib/*".to_string()][..]))
+        );
+        assert_eq!(
+            match_paths(&paths, "@/app"),
+            Some(("app", &["src/*".to_string()][..]))
+        );
+        assert_eq!(
+            match_paths(&paths, "config"),
+            Some(("", &["src/config.ts".to_string()][..]))
+        );
+        assert_eq!(match_paths(&paths, "react"), None);
+    }
+}
@@ -0,0 +1,523 @@
+use serde::{Deserialize, Serialize};
+use tree_sitter::{Node, Point, Tree};
+
+use crate::find_references::Location;
+use crate::languages::Language;
+
+/// Language-independent kind of a definition.
+#[derive(Copy, Clone, Debug, PartialEq, Eq, Hash, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum SymbolKind {
+    Function,
+    Method,
+    Type,
+    Module,
+    Constant,
+    Variable,
+    Other,
+}
+
+impl SymbolKind {
+    pub const ALL: &[SymbolKind] = &[
+        SymbolKind::Function,
+        SymbolKind::Method,
+        SymbolKind::Type,
+        SymbolKind::Module,
+        SymbolKind::Constant,
+        SymbolKind::Variable,
+        SymbolKind::Other,
+    ];
+
+    pub fn as_str(&self) -> &'static str {
+        match self {
+            SymbolKind::Function => "function",
+            SymbolKind::Method => "method",
+            SymbolKind::Type => "type",
+            SymbolKind::Module => "module",
+            SymbolKind::Constant => "constant",
+            SymbolKind::Variable => "variable",
+            SymbolKind::Other => "other",
+        }
+    }
+}
+
+/// Whether a definition is part of its module's public API.
+#[derive(Copy, Clone, Debug, Default, PartialEq, Eq, Hash, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Visibility {
+    /// Exported or public, e.g. `pub` in Rust, a capitalized name in Go or
+    /// `export` in JavaScript.
+    Public,
+    Private,
+    /// The language has no visibility rules cruxlines reads (Ruby, shell).
+    #[default]
+    Unknown,
+}
+
+impl Visibility {
+    pub fn as_str(&self) -> &'static str {
+        match self {
+            Visibility::Public => "public",
+            Visibility::Private => "private",
+            Visibility::Unknown => "unknown",
+        }
+    }
+}
+
+const FUNCTION_KINDS: &[&str] = &[
+    "function_definition",
+    "function_declaration",
+    "function_declarator",
+    "function_item",
+    "function_signature_item",
+    "function_signature",
+    "generator_function_declaration",
+    "preproc_function_def",
+    "method",
+];
+
+const METHOD_KINDS: &[&str] = &[
+    "method_declaration",
+    "method_definition",
+    "singleton_method",
+    "constructor_declaration",
+    "abstract_method_signature",
+    "method_signature",
+    "protocol_function_declaration",
+];
+
+const TYPE_KINDS: &[&str] = &[
+    "class",
+    "class_definition",
+    "class_declaration",
+    "abstract_class_declaration",
+    "class_specifier",
+    "struct_specifier",
+    "union_specifier",
+    "enum_specifier",
+    "type_definition",
+    "struct_item",
+    "enum_item",
+    "union_item",
+    "trait_item",
+    "type_item",
+    "type_spec",
+    "type_alias",
+    "type_alias_declaration",
+    "interface_declaration",
+    "enum_declaration",
+    "record_declaration",
+    "struct_declaration",
+    "delegate_declaration",
+    "annotation_type_declaration",
+    "object_declaration",
+    "trait_declaration",
+    "protocol_declaration",
+    "typealias_declaration",
+];
+
+const MODULE_KINDS: &[&str] = &[
+    "module",
+    "mod_item",
+    "internal_module",
+    "namespace_definition",
+    "namespace_declaration",
+    "file_scoped_namespace_declaration",
+];
+
+const CONSTANT_KINDS: &[&str] = &[
+    "const_item",
+    "static_item",
+    "const_spec",
+    "const_declaration",
+    "enumerator",
+    "preproc_def",
+];
+
+const VARIABLE_KINDS: &[&str] = &[
+    "assignment",
+    "assignment_expression",
+    "variable_assignment",
+    "variable_declarator",
+    "var_spec",
+    "init_declarator",
+    "declaration",
+    "field_declaration",
+    "property_declaration",
+    "protocol_property_declaration",
+];
+
+/// Bodies whose function members are methods rather than free functions.
+const MEMBER_CONTAINER_KINDS: &[&str] = &[
+    "class",
+    "class_body",
+    "class_definition",
+    "class_declaration",
+    "class_specifier",
+    "field_declaration_list",
+    "impl_item",
+    "trait_item",
+    "interface_declaration",
+    "object_declaration",
+    "record_declaration",
+    "struct_declaration",
+    "trait_declaration",
+    "singleton_class",
+    "enum_class_body",
+    "protocol_body",
+];
+
+/// Per-definition facts derived from the syntax tree.
+#[derive(Copy, Clone, Debug, PartialEq, Eq, Serialize, Deserialize)]
+pub(crate) struct DefinitionInfo {
+    pub kind: SymbolKind,
+    /// Last line (1-based) of the declaration, e.g. the end of a function body.
+    pub end_line: usize,
+    pub visibility: Visibility,
+}
+
+/// Classifies the definition at `location` by walking up from its name node
+/// to the nearest declaration node. `line` is the text of the definition's
+/// line, which maps the character column of `location` back to the byte
+/// column tree-sitter expects.
+pub(crate) fn definition_info(
+    language: Language,
+    source: &str,
+    tree: &Tree,
+    location: &Location,
+    line: &str,
+) -> DefinitionInfo {
+    let column = location.column.saturating_sub(1);
+    let point = Point {
+        row: location.line.saturating_sub(1),
+        column: line
+            .char_indices()
+            .nth(column)
+            .map_or(column, |(offset, _)| offset),
+    };
+    let name_node = tree
+        .root_node()
+        .named_descendant_for_point_range(point, point);
+    let mut current = name_node;
+    while let Some(node) = current {
+        // The root node is never a declaration (Python's root is `module`).
+        if node.parent().is_none() {
+            break;
+        }
+        if let Some(kind) = classify(node, location) {
+            let declaration = declaration_node(node);
+            return DefinitionInfo {
+                kind,
+                end_line: declaration.end_position().row + 1,
+                visibility: visibility(language, declaration, source, location.name_str()),
+            };
+        }
+        current = node.parent();
+    }
+    DefinitionInfo {
+        kind: SymbolKind::Other,
+        end_line: location.line,
+        visibility: name_node.map_or(Visibility::Unknown, |node| {
+            visibility(language, node, source, location.name_str())
+        }),
+    }
+}
+
+/// Reads the visibility of `declaration` (the node holding the definition's
+/// modifiers) with the rules of `language`.
+fn visibility(language: Language, declaration: Node, source: &str, name: &str) -> Visibility {
+    use crate::languages::{c, csharp, go, java, javascript, kotlin, php, python, rust, swift};
+    match language {
+        Language::C | Language::Cpp => c::visibility(declaration, source),
+        Language::CSharp => csharp::visibility(declaration, source),
+        Language::Go => go::visibility(name),
+        Language::Java => java::visibility(declaration),
+        Language::Kotlin => kotlin::visibility(declaration, source),
+        Language::Php => php::visibility(declaration, source),
+        Language::Python => python::visibility(name),
+        Language::JavaScript | Language::TypeScript | Language::TypeScriptReact => {
+            javascript::visibility(declaration, source)
+        }
+        Language::Rust => rust::visibility(declaration, source),
+        Language::Swift => swift::visibility(declaration, source),
+        Language::Bash | Language::Ruby => Visibility::Unknown,
+    }
+}
+
+/// C declarators only cover the name and parameters; the declaration that
+/// owns them also covers the body.
+fn declaration_node(node: Node) -> Node {
+    if node.kind() != "function_declarator" {
+        return node;
+    }
+    let mut current = node.parent();
+    while let Some(parent) = current {
+        if matches!(
+            parent.kind(),
+            "function_definition" | "declaration" | "field_declaration"
+        ) {
+            return parent;
+        }
+        current = parent.parent();
+    }
+    node
+}
+
+fn classify(node: Node, location: &Location) -> Option<SymbolKind> {
+    let kind = node.kind();
+    if METHOD_KINDS.contains(&kind) {
+        return Some(SymbolKind::Method);
+    }
+    if FUNCTION_KINDS.contains(&kind) {
+        if has_member_container(node) {
+            return Some(SymbolKind::Method);
+        }
+        return Some(SymbolKind::Function);
+    }
+    if TYPE_KINDS.contains(&kind) {
+        return Some(SymbolKind::Type);
+    }
+    if MODULE_KINDS.contains(&kind) {
+        return Some(SymbolKind::Module);
+    }
+    if CONSTANT_KINDS.contains(&kind) {
+        return Some(SymbolKind::Constant);
+    }
+    if VARIABLE_KINDS.contains(&kind) {
+        return Some(variable_kind(node, location));
+    }
+    None
+}
+
+fn variable_kind(node: Node, location: &Location) -> SymbolKind {
+    // `exports.format = function () {}` in CommonJS.
+    if node.kind() == "assignment_expression"
+        && node
+            .child_by_field_name("right")
+            .is_some_and(|value| matches!(value.kind(), "arrow_function" | "function_expression"))
+    {
+        return SymbolKind::Function;
+    }
+    if node.kind() == "variable_declarator" {
+        if node
+            .child_by_field_name("value")
+            .is_some_and(|value| matches!(value.kind(), "arrow_function" | "function_expression"))
+        {
+            return SymbolKind::Function;
+        }
+        // `const x = ...` in JavaScript/TypeScript.
+        if node
+            .parent()
+            .and_then(|declaration| declaration.child(0))
+            .is_some_and(|keyword| keyword.kind() == "const")
+        {
+            return SymbolKind::Constant;
+        }
+    }
+    // Ruby constants are assignments to a capitalized name.
+    if node.kind() == "assignment"
+        && node
+            .child_by_field_name("left")
+            .is_some_and(|left| matches!(left.kind(), "constant" | "scope_resolution"))
+    {
+        return SymbolKind::Constant;
+    }
+    if is_screaming_case(location.name_str()) {
+        return SymbolKind::Constant;
+    }
+    SymbolKind::Variable
+}
+
+fn has_member_container(node: Node) -> bool {
+    let mut current = node.parent();
+    while let Some(parent) = current {
+        if MEMBER_CONTAINER_KINDS.contains(&parent.kind()) {
+            return true;
+        }
+        current = parent.parent();
+    }
+    false
+}
+
+fn is_screaming_case(name: &str) -> bool {
+    name.chars().any(|c| c.is_ascii_uppercase())
+        && name
+            .chars()
+            .all(|c| c.is_ascii_uppercase() || c.is_ascii_digit() || c == '_')
+}
+
+#[cfg(test)]
+mod tests {
+    use super::{DefinitionInfo, SymbolKind, Visibility, definition_info};
+    use crate::find_references::Location;
+    use crate::intern::intern;
+    use crate::languages::{Language, tree_sitter_language};
+    use tree_sitter::Parser;
+
+    fn info_at(language: Language, source: &str, line: usize, column: usize) -> DefinitionInfo {
+        let mut parser = Parser::new();
+        parser
+            .set_language(&tree_sitter_language(language))
+            .expect("set language");
+        let tree = parser.parse(source, None).expect("parse");
+        let row = source.lines().nth(line - 1).expect("line");
+        let end = row[column - 1..]
+            .find(|c: char| !(c.is_alphanumeric() || c == '_'))
+            .map(|offset| column - 1 + offset)
+            .unwrap_or(row.len());
+        let location = Location {
+            path: intern("test"),
+            line,
+            column,
+            name: intern(&row[column - 1..end]),
+        };
+        definition_info(language, source, &tree, &location, row)
+    }
+
+    fn kind_at(language: Language, source: &str, line: usize, column: usize) -> SymbolKind {
+        info_at(language, source, line, column).kind
+    }
+
+    fn visibility_at(language: Language, source: &str, line: usize, column: usize) -> Visibility {
+        info_at(language, source, line, column).visibility
+    }
+
+    #[test]
+    fn classifies_python_definitions() {
+        let source = "class User:\n    def name(self):\n        pass\n\ndef add():\n    pass\n\nLIMIT = 3\ncount = 1\n";
+        assert_eq!(kind_at(Language::Python, source, 1, 7), SymbolKind::Type);
+        assert_eq!(kind_at(Language::Python, source, 2, 9), SymbolKind::Method);
+        assert_eq!(
+            kind_at(Language::Python, source, 5, 5),
+            SymbolKind::Function
+        );
+        assert_eq!(
+            kind_at(Language::Python, source, 8, 1),
+            SymbolKind::Constant
+        );
+        assert_eq!(
+            kind_at(Language::Python, source, 9, 1),
+            SymbolKind::Variable
+        );
+    }
+
+    #[test]
+    fn classifies_javascript_declarators() {
+        let source =
+            "export const add = (a, b) => a + b;\nexport const limit = 3;\nexport let count = 1;\n";
+        assert_eq!(
+            kind_at(Language::JavaScript, source, 1, 14),
+            SymbolKind::Function
+        );
+        assert_eq!(
+            kind_at(Language::JavaScript, source, 2, 14),
+            SymbolKind::Constant
+        );
+        assert_eq!(
+            kind_at(Language::JavaScript, source, 3, 12),
+            SymbolKind::Variable
+        );
+    }
+
+    #[test]
+    fn classifies_commonjs_exports() {
+        let source = "function format() {}\nfunction helper() {}\nmodule.exports = { format };\nmodule.exports.slugify = (text) => text;\n";
+        assert_eq!(
+            kind_at(Language::JavaScript, source, 4, 16),
+            SymbolKind::Function
+        );
+        assert_eq!(
+            visibility_at(Language::JavaScript, source, 1, 10),
+            Visibility::Public
+        );
+        assert_eq!(
+            visibility_at(Language::JavaScript, source, 2, 10),
+            Visibility::Private
+        );
+        assert_eq!(
+            visibility_at(Language::JavaScript, source, 4, 16),
+            Visibility::Public
+        );
+    }
+
+    #[test]
+    fn classifies_rust_items() {
+        let source = "pub struct Config;\nimpl Config {\n    pub fn load() {}\n}\npub fn run() {}\npub mod util {}\n";
+        assert_eq!(kind_at(Language::Rust, source, 1, 12), SymbolKind::Type);
+        assert_eq!(kind_at(Language::Rust, source, 3, 12), SymbolKind::Method);
+        assert_eq!(kind_at(Language::Rust, source, 5, 8), SymbolKind::Function);
+        assert_eq!(kind_at(Language::Rust, source, 6, 9), SymbolKind::Module);
+    }
+
+    #[test]
+    fn records_end_line_of_declaration() {
+        let python = "def add(a, b):\n    total = a + b\n    return total\n";
+        assert_eq!(info_at(Language::Python, python, 1, 5).end_line, 3);
+
+        let c = "int add(int a, int b) {\n    return a + b;\n}\n";
+        assert_eq!(info_at(Language::C, c, 1, 5).end_line, 3);
+    }
+
+    #[test]
+    fn reads_visibility_per_language() {
+        let rust = "pub fn run() {}\nfn helper() {}\npub(crate) fn inner() {}\n";
+        assert_eq!(
+            visibility_at(Language::Rust, rust, 1, 8),
+            Visibility::Public
+        );
+        assert_eq!(
+            visibility_at(Language::Rust, rust, 2, 4),
+            Visibility::Private
+        );
+        assert_eq!(
+            visibility_at(Language::Rust, rust, 3, 15),
+            Visibility::Private
+        );
+
+        let go = "package api\n\nfunc Serve() {}\n\nfunc parse() {}\n";
+        assert_eq!(visibility_at(Language::Go, go, 3, 6), Visibility::Public);
+        assert_eq!(visibility_at(Language::Go, go, 5, 6), Visibility::Private);
+
+        let typescript = "export function handler() {}\nfunction helper() {}\nexport class Api {\n  private token() {}\n}\n";
+        assert_eq!(
+            visibility_at(Language::TypeScript, typescript, 1, 17),
+            Visibility::Public
+        );
+        assert_eq!(
+            visibility_at(Language::TypeScript, typescript, 2, 10),
+            Visibility::Private
+        );
+        assert_eq!(
+            visibility_at(Language::TypeScript, typescript, 4, 11),
+            Visibility::Private
+        );
+
+        let java = "public class Api {\n    public void serve() {}\n    void helper() {}\n}\n";
+        assert_eq!(
+            visibility_at(Language::Java, java, 1, 14),
+            Visibility::Public
+        );
+        assert_eq!(
+            visibility_at(Language::Java, java, 2, 17),
+            Visibility::Public
+        );
+        assert_eq!(
+            visibility_at(Language::Java, java, 3, 10),
+            Visibility::Private
+        );
+
+        let python = "def serve():\n    pass\n\ndef _helper():\n    pass\n";
+        assert_eq!(
+            visibility_at(Language::Python, python, 1, 5),
+            Visibility::Public
+        );
+        assert_eq!(
+            visibility_at(Language::Python, python, 4, 5),
+            Visibility::Private
+        );
+
+        let c = "int serve(void) { return 0; }\nstatic int helper(void) { return 1; }\n";
+        assert_eq!(visibility_at(Language::C, c, 1, 5), Visibility::Public);
+        assert_eq!(visibility_at(Language::C, c, 2, 12), Visibility::Private);
+    }
+}
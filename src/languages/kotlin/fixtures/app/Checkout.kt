@@ -0,0 +1,9 @@
+package com.acme.app
+
+import com.acme.billing.Invoice
+import com.acme.billing.format.describe
+
+fun checkout(amount: Int): String {
+    val invoice = Invoice.create(amount)
+    return invoice.describe() + " at " + Invoice.TAX_RATE
+}
@@ -0,0 +1,7 @@
+package com.acme.billing.format
+
+import com.acme.billing.Invoice
+
+fun Invoice.describe(): String {
+    return "Invoice of $amount"
+}
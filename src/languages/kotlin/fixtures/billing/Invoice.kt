@@ -0,0 +1,13 @@
+package com.acme.billing
+
+class Invoice(val amount: Int) {
+    fun total(): Double = amount * (1 + TAX_RATE)
+
+    companion object {
+        const val TAX_RATE = 0.2
+
+        fun create(amount: Int): Invoice {
+            return Invoice(amount)
+        }
+    }
+}
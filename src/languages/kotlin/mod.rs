@@ -1,12 +1,23 @@
 use std::path::Path;
 
+use rustc_hash::FxHashSet;
 use tree_sitter::Node;
 
 use crate::find_references::{Location, location_from_node, walk_tree};
+use crate::intern::intern;
+use crate::languages::kind::Visibility;
 
 pub(crate) const EXTENSIONS: &[&str] = &["kt", "kts"];
 pub(crate) const REFERENCE_KINDS: &[&str] = &["simple_identifier", "identifier", "type_identifier"];
 
+/// Nodes that name a type in an extension function's receiver.
+const RECEIVER_TYPE_KINDS: &[&str] = &[
+    "receiver_type",
+    "user_type",
+    "nullable_type",
+    "parenthesized_type",
+];
+
 pub(crate) fn language() -> tree_sitter::Language {
     tree_sitter_kotlin_ng::LANGUAGE.into()
 }
@@ -24,12 +35,24 @@ pub(crate) fn emit_definitions(
         | "property_declaration"
         | "type_alias" => {
             if is_top_level(node)
-                && let Some(name) = node.child_by_field_name("name")
+                && let Some(name) = declaration_name(node)
                 && let Some(location) = location_from_node(path, source, name)
             {
                 emit(location);
             }
         }
+        "companion_object" => {
+            let Some(class_name) = companion_owner(node, source) else {
+                return;
+            };
+            for member in companion_members(node) {
+                if let Some(name) = declaration_name(member)
+                    && let Some(location) = location_from_node(path, source, name)
+                {
+                    emit(qualify(location, class_name));
+                }
+            }
+        }
         _ => {}
     });
 }
@@ -40,15 +63,244 @@ pub(crate) fn emit_references(
     tree: &tree_sitter::Tree,
     mut emit: impl FnMut(Location),
 ) {
+    // Receiver types are emitted by `emit_receivers`.
+    let mut receivers = FxHashSet::default();
+    walk_tree(tree, |node| {
+        if let Some(type_name) = extension_receiver(node) {
+            receivers.insert(type_name.id());
+        }
+    });
     walk_tree(tree, |node| {
         if REFERENCE_KINDS.contains(&node.kind())
+            && !receivers.contains(&node.id())
             && let Some(location) = location_from_node(path, source, node)
         {
             emit(location);
         }
+        // `Invoice.create` also refers to the companion member `create` of
+        // `Invoice`, which is defined as `Invoice.create`.
+        if node.kind() == "navigation_expression"
+            && let Some((owner, member)) = qualified_member(node, source)
+            && let Some(location) = location_from_node(path, source, member)
+        {
+            emit(qualify(location, owner));
+        }
+    });
+}
+
+/// Emits the receiver type of each top-level extension function, e.g.
+/// `Invoice` for `fun Invoice.describe()`, so the function links to the type
+/// it extends.
+pub(crate) fn emit_receivers(
+    path: &Path,
+    source: &str,
+    tree: &tree_sitter::Tree,
+    mut emit: impl FnMut(Location),
+) {
+    walk_tree(tree, |node| {
+        if let Some(type_name) = extension_receiver(node)
+            && let Some(location) = location_from_node(path, source, type_name)
+        {
+            emit(location);
+        }
     });
 }
 
+/// Emits the fully-qualified names other files can import from this one, in
+/// the format of the Java module so the two languages resolve each other:
+/// `com.foo.Bar` for each top-level declaration (functions and properties
+/// included), and `com.foo.*` when one of them is not private.
+pub(crate) fn emit_package_exports(
+    source: &str,
+    tree: &tree_sitter::Tree,
+    mut emit: impl FnMut(String),
+) {
+    let package = package_name(tree, source);
+    let root = tree.root_node();
+    let mut cursor = root.walk();
+    let mut any_visible = false;
+    for node in root.named_children(&mut cursor) {
+        let Some(name) =
+            declaration_name(node).and_then(|name| name.utf8_text(source.as_bytes()).ok())
+        else {
+            continue;
+        };
+        emit(match &package {
+            Some(package) => format!("{package}.{name}"),
+            None => name.to_string(),
+        });
+        any_visible |= visibility(node, source) == Visibility::Public;
+    }
+    if any_visible && let Some(package) = package {
+        emit(format!("{package}.*"));
+    }
+}
+
+/// Emits the names imported by `import` directives, matching
+/// [`emit_package_exports`]: `com.foo.Bar` (aliases dropped) or `com.foo.*`.
+pub(crate) fn emit_package_imports(
+    source: &str,
+    tree: &tree_sitter::Tree,
+    mut emit: impl FnMut(String),
+) {
+    walk_tree(tree, |node| {
+        if !matches!(node.kind(), "import" | "import_header") {
+            return;
+        }
+        let Ok(text) = node.utf8_text(source.as_bytes()) else {
+            return;
+        };
+        let Some(name) = text.trim().strip_prefix("import") else {
+            return;
+        };
+        let name = name.split(" as ").next().unwrap_or(name);
+        let name: String = name
+            .chars()
+            .filter(|c| !c.is_whitespace() && *c != ';')
+            .collect();
+        if !name.is_empty() {
+            emit(name);
+        }
+    });
+}
+
+/// Kotlin declarations are public unless marked `private`, `protected` or
+/// `internal`.
+pub(crate) fn visibility(declaration: Node, source: &str) -> Visibility {
+    let mut cursor = declaration.walk();
+    let hidden = declaration
+        .children(&mut cursor)
+        .filter(|child| child.kind() == "modifiers")
+        .any(|modifiers| {
+            let mut inner = modifiers.walk();
+            modifiers.children(&mut inner).any(|modifier| {
+                modifier.kind() == "visibility_modifier"
+                    && modifier.utf8_text(source.as_bytes()) != Ok("public")
+            })
+        });
+    if hidden {
+        Visibility::Private
+    } else {
+        Visibility::Public
+    }
+}
+
+/// The name node of a declaration; properties keep theirs in a
+/// `variable_declaration`.
+fn declaration_name(node: Node) -> Option<Node> {
+    if !matches!(
+        node.kind(),
+        "class_declaration"
+            | "object_declaration"
+            | "function_declaration"
+            | "property_declaration"
+            | "type_alias"
+    ) {
+        return None;
+    }
+    node.child_by_field_name("name").or_else(|| {
+        let mut cursor = node.walk();
+        let variable = node
+            .named_children(&mut cursor)
+            .find(|child| child.kind() == "variable_declaration")?;
+        let mut inner = variable.walk();
+        variable
+            .named_children(&mut inner)
+            .find(|child| REFERENCE_KINDS.contains(&child.kind()))
+    })
+}
+
+/// Renames `location` to `owner.name`, the namespaced name of a companion
+/// object member.
+fn qualify(location: Location, owner: &str) -> Location {
+    Location {
+        name: intern(&format!("{owner}.{}", location.name_str())),
+        ..location
+    }
+}
+
+/// The name of the top-level class a companion object belongs to.
+fn companion_owner<'a>(companion: Node, source: &'a str) -> Option<&'a str> {
+    let class = companion.parent()?.parent()?;
+    if class.kind() != "class_declaration" || !is_top_level(class) {
+        return None;
+    }
+    declaration_name(class)?.utf8_text(source.as_bytes()).ok()
+}
+
+/// Functions and properties declared in a companion object's body.
+fn companion_members(companion: Node) -> Vec<Node> {
+    let mut cursor = companion.walk();
+    let Some(body) = companion
+        .named_children(&mut cursor)
+        .find(|child| child.kind() == "class_body")
+    else {
+        return Vec::new();
+    };
+    let mut cursor = body.walk();
+    body.named_children(&mut cursor)
+        .filter(|member| {
+            matches!(
+                member.kind(),
+                "function_declaration" | "property_declaration"
+            )
+        })
+        .collect()
+}
+
+/// Splits `Owner.member` into the owner's name and the member node, when the
+/// owner is a plain identifier (as for companion members).
+fn qualified_member<'a>(node: Node<'a>, source: &'a str) -> Option<(&'a str, Node<'a>)> {
+    let owner = node.named_child(0)?;
+    if !REFERENCE_KINDS.contains(&owner.kind()) {
+        return None;
+    }
+    let mut suffix = node.named_child(node.named_child_count().checked_sub(1)?)?;
+    if suffix.id() == owner.id() {
+        return None;
+    }
+    while !REFERENCE_KINDS.contains(&suffix.kind()) {
+        suffix = suffix.named_child(suffix.named_child_count().checked_sub(1)?)?;
+    }
+    Some((owner.utf8_text(source.as_bytes()).ok()?, suffix))
+}
+
+/// The type a top-level extension function extends: the first type name
+/// written before the function's name (`Map` for
+/// `fun <K, V> Map<K, V>.keysSorted()`).
+fn extension_receiver(function: Node) -> Option<Node> {
+    if function.kind() != "function_declaration" || !is_top_level(function) {
+        return None;
+    }
+    let name = function.child_by_field_name("name")?;
+    let mut cursor = function.walk();
+    let receiver = function
+        .named_children(&mut cursor)
+        .take_while(|child| child.id() != name.id())
+        .find(|child| RECEIVER_TYPE_KINDS.contains(&child.kind()))?;
+    let mut current = receiver;
+    while !REFERENCE_KINDS.contains(&current.kind()) {
+        current = current.named_child(0)?;
+    }
+    Some(current)
+}
+
+fn package_name(tree: &tree_sitter::Tree, source: &str) -> Option<String> {
+    let root = tree.root_node();
+    let mut cursor = root.walk();
+    let header = root
+        .named_children(&mut cursor)
+        .find(|child| child.kind() == "package_header")?;
+    let text = header.utf8_text(source.as_bytes()).ok()?;
+    let name: String = text
+        .trim()
+        .strip_prefix("package")?
+        .chars()
+        .filter(|c| !c.is_whitespace() && *c != ';')
+        .collect();
+    (!name.is_empty()).then_some(name)
+}
+
 fn is_top_level(node: Node) -> bool {
     node.parent()
         .map(|parent| parent.kind() == "source_file")
@@ -2,19 +2,29 @@ use std::path::Path;
 
 use serde::{Deserialize, Serialize};
 
+pub(crate) mod bash;
 pub(crate) mod c;
+pub(crate) mod calls;
 pub(crate) mod cpp;
 pub(crate) mod csharp;
 pub(crate) mod go;
 pub(crate) mod java;
 pub(crate) mod javascript;
+pub(crate) mod kind;
 pub(crate) mod kotlin;
 pub(crate) mod php;
+pub(crate) mod project_files;
 pub(crate) mod python;
+pub(crate) mod ruby;
 pub(crate) mod rust;
+pub(crate) mod swift;
+pub(crate) mod test_code;
+
+pub use kind::{SymbolKind, Visibility};
 
 #[derive(Copy, Clone, Debug, PartialEq, Eq, Hash)]
 pub enum Language {
+    Bash,
     C,
     Cpp,
     CSharp,
@@ -26,7 +36,9 @@ pub enum Language {
     JavaScript,
     TypeScript,
     TypeScriptReact,
+    Ruby,
     Rust,
+    Swift,
 }
 
 #[derive(Copy, Clone, Debug, PartialEq, Eq, Hash, Serialize, Deserialize)]
@@ -38,11 +50,78 @@ pub enum Ecosystem {
     Php,
     Python,
     JavaScript,
+    Ruby,
     Rust,
+    Shell,
+    Swift,
+}
+
+impl Language {
+    pub const ALL: &[Language] = &[
+        Language::Bash,
+        Language::C,
+        Language::Cpp,
+        Language::CSharp,
+        Language::Go,
+        Language::Java,
+        Language::Kotlin,
+        Language::Php,
+        Language::Python,
+        Language::JavaScript,
+        Language::TypeScript,
+        Language::TypeScriptReact,
+        Language::Ruby,
+        Language::Rust,
+        Language::Swift,
+    ];
+
+    /// The name `--languages` accepts for this language; `.ts` and `.tsx`
+    /// files are both `typescript`.
+    pub fn name(self) -> &'static str {
+        match self {
+            Language::Bash => "bash",
+            Language::C => "c",
+            Language::Cpp => "cpp",
+            Language::CSharp => "csharp",
+            Language::Go => "go",
+            Language::Java => "java",
+            Language::Kotlin => "kotlin",
+            Language::Php => "php",
+            Language::Python => "python",
+            Language::JavaScript => "javascript",
+            Language::TypeScript | Language::TypeScriptReact => "typescript",
+            Language::Ruby => "ruby",
+            Language::Rust => "rust",
+            Language::Swift => "swift",
+        }
+    }
+}
+
+impl Ecosystem {
+    pub const ALL: &[Ecosystem] = &[
+        Ecosystem::C,
+        Ecosystem::Dotnet,
+        Ecosystem::Go,
+        Ecosystem::Java,
+        Ecosystem::Php,
+        Ecosystem::Python,
+        Ecosystem::JavaScript,
+        Ecosystem::Ruby,
+        Ecosystem::Rust,
+        Ecosystem::Shell,
+        Ecosystem::Swift,
+    ];
 }
 
 pub(crate) fn language_for_path(path: &Path) -> Option<Language> {
+    let file_name = path.file_name().and_then(|name| name.to_str())?;
+    if ruby::FILE_NAMES.contains(&file_name) {
+        return Some(Language::Ruby);
+    }
     let ext = path.extension().and_then(|ext| ext.to_str())?;
+    if bash::EXTENSIONS.contains(&ext) {
+        return Some(Language::Bash);
+    }
     if c::EXTENSIONS.contains(&ext) {
         return Some(Language::C);
     }
@@ -76,14 +155,50 @@ pub(crate) fn language_for_path(path: &Path) -> Option<Language> {
     if javascript::TSX_EXTENSIONS.contains(&ext) {
         return Some(Language::TypeScriptReact);
     }
+    if ruby::EXTENSIONS.contains(&ext) {
+        return Some(Language::Ruby);
+    }
     if rust::EXTENSIONS.contains(&ext) {
         return Some(Language::Rust);
     }
+    if swift::EXTENSIONS.contains(&ext) {
+        return Some(Language::Swift);
+    }
     None
 }
 
+/// Like [`language_for_path`], but also recognizes extensionless shell
+/// scripts by their `#!` line, read from disk.
+pub(crate) fn language_for_file(path: &Path) -> Option<Language> {
+    language_for_path(path).or_else(|| {
+        if path.extension().is_some() {
+            return None;
+        }
+        let mut head = [0u8; 128];
+        let mut file = std::fs::File::open(path).ok()?;
+        let len = std::io::Read::read(&mut file, &mut head).ok()?;
+        shebang_language(&String::from_utf8_lossy(&head[..len]))
+    })
+}
+
+/// Like [`language_for_file`], for a file whose contents are already read.
+pub(crate) fn language_for_source(path: &Path, source: &str) -> Option<Language> {
+    language_for_path(path).or_else(|| {
+        if path.extension().is_some() {
+            return None;
+        }
+        shebang_language(source)
+    })
+}
+
+fn shebang_language(head: &str) -> Option<Language> {
+    let first_line = head.lines().next()?;
+    bash::is_shell_shebang(first_line).then_some(Language::Bash)
+}
+
 pub(crate) fn ecosystem_for_language(language: Language) -> Ecosystem {
     match language {
+        Language::Bash => Ecosystem::Shell,
         Language::C | Language::Cpp => Ecosystem::C,
         Language::CSharp => Ecosystem::Dotnet,
         Language::Go => Ecosystem::Go,
@@ -93,12 +208,15 @@ pub(crate) fn ecosystem_for_language(language: Language) -> Ecosystem {
         Language::JavaScript | Language::TypeScript | Language::TypeScriptReact => {
             Ecosystem::JavaScript
         }
+        Language::Ruby => Ecosystem::Ruby,
         Language::Rust => Ecosystem::Rust,
+        Language::Swift => Ecosystem::Swift,
     }
 }
 
 pub(crate) fn tree_sitter_language(language: Language) -> tree_sitter::Language {
     match language {
+        Language::Bash => bash::language(),
         Language::C => c::language(),
         Language::Cpp => cpp::language(),
         Language::CSharp => csharp::language(),
@@ -110,13 +228,30 @@ pub(crate) fn tree_sitter_language(language: Language) -> tree_sitter::Language
         Language::JavaScript => javascript::language(),
         Language::TypeScript => javascript::language_typescript(),
         Language::TypeScriptReact => javascript::language_tsx(),
+        Language::Ruby => ruby::language(),
         Language::Rust => rust::language(),
+        Language::Swift => swift::language(),
     }
 }
 
+/// Hash of the grammar shapes compiled into this binary. Grammar upgrades
+/// change node kinds or parse tables, which invalidates cached parse results.
+pub(crate) fn grammar_fingerprint() -> u64 {
+    use std::hash::{Hash, Hasher};
+    let mut hasher = rustc_hash::FxHasher::default();
+    for language in Language::ALL {
+        let grammar = tree_sitter_language(*language);
+        grammar.abi_version().hash(&mut hasher);
+        grammar.node_kind_count().hash(&mut hasher);
+        grammar.field_count().hash(&mut hasher);
+        grammar.parse_state_count().hash(&mut hasher);
+    }
+    hasher.finish()
+}
+
 #[cfg(test)]
 mod tests {
-    use super::{Language, language_for_path};
+    use super::{Language, language_for_path, language_for_source};
     use std::path::PathBuf;
 
     #[test]
@@ -191,6 +326,56 @@ mod tests {
         assert_eq!(lang, Some(Language::Php));
     }
 
+    #[test]
+    fn recognizes_ruby_extension() {
+        let lang = language_for_path(&PathBuf::from("file.rb"));
+        assert_eq!(lang, Some(Language::Ruby));
+    }
+
+    #[test]
+    fn recognizes_rake_extension() {
+        let lang = language_for_path(&PathBuf::from("tasks/db.rake"));
+        assert_eq!(lang, Some(Language::Ruby));
+    }
+
+    #[test]
+    fn recognizes_rakefile() {
+        let lang = language_for_path(&PathBuf::from("project/Rakefile"));
+        assert_eq!(lang, Some(Language::Ruby));
+    }
+
+    #[test]
+    fn recognizes_swift_extension() {
+        let lang = language_for_path(&PathBuf::from("Sources/App/main.swift"));
+        assert_eq!(lang, Some(Language::Swift));
+    }
+
+    #[test]
+    fn recognizes_shell_extensions() {
+        assert_eq!(
+            language_for_path(&PathBuf::from("deploy.sh")),
+            Some(Language::Bash)
+        );
+        assert_eq!(
+            language_for_path(&PathBuf::from("env.bash")),
+            Some(Language::Bash)
+        );
+    }
+
+    #[test]
+    fn recognizes_extensionless_shell_scripts_by_shebang() {
+        let path = PathBuf::from("bin/deploy");
+        assert_eq!(
+            language_for_source(&path, "#!/usr/bin/env bash\necho hi\n"),
+            Some(Language::Bash)
+        );
+        assert_eq!(language_for_source(&path, "#!/usr/bin/env python3\n"), None);
+        assert_eq!(
+            language_for_source(&PathBuf::from("notes.txt"), "#!/bin/sh\n"),
+            None
+        );
+    }
+
     #[test]
     fn ignores_unknown_extensions() {
         let lang = language_for_path(&PathBuf::from("file.txt"));
@@ -0,0 +1,23 @@
+<?php
+
+namespace App\Billing;
+
+trait HasTotals
+{
+    public function total(): int
+    {
+        return array_sum($this->lines);
+    }
+}
+
+class Invoice
+{
+    use HasTotals;
+
+    private array $lines = [];
+
+    public function addLine(int $amount): void
+    {
+        $this->lines[] = $amount;
+    }
+}
@@ -0,0 +1,17 @@
+<?php
+
+namespace App\Http;
+
+use App\Billing\Invoice;
+
+require_once __DIR__ . '/../helpers.php';
+
+class InvoiceController
+{
+    public function show(): string
+    {
+        $invoice = new Invoice();
+        $invoice->addLine(42);
+        return format_amount($invoice->total());
+    }
+}
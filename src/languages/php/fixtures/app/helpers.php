@@ -0,0 +1,6 @@
+<?php
+
+function format_amount(int $amount): string
+{
+    return number_format($amount / 100, 2);
+}
@@ -1,12 +1,29 @@
-use std::path::Path;
+use std::path::{Path, PathBuf};
 
 use tree_sitter::Node;
 
 use crate::find_references::{Location, location_from_node, walk_tree};
+use crate::intern::intern;
+use crate::languages::kind::Visibility;
 
 pub(crate) const EXTENSIONS: &[&str] = &["php"];
 pub(crate) const REFERENCE_KINDS: &[&str] = &["name", "qualified_name"];
 
+const TYPE_KINDS: &[&str] = &[
+    "class_declaration",
+    "interface_declaration",
+    "trait_declaration",
+    "enum_declaration",
+];
+
+/// `require`, `require_once`, `include` and `include_once`.
+const INCLUDE_KINDS: &[&str] = &[
+    "require_expression",
+    "require_once_expression",
+    "include_expression",
+    "include_once_expression",
+];
+
 pub(crate) fn language() -> tree_sitter::Language {
     tree_sitter_php::LANGUAGE_PHP.into()
 }
@@ -29,6 +46,14 @@ pub(crate) fn emit_definitions(
                 emit(location);
             }
         }
+        "method_declaration" => {
+            if owner_type(node).is_some()
+                && let Some(name) = node.child_by_field_name("name")
+                && let Some(location) = location_from_node(path, source, name)
+            {
+                emit(location);
+            }
+        }
         "function_definition" => {
             if is_top_level(node)
                 && let Some(name) = node.child_by_field_name("name")
@@ -80,6 +105,192 @@ pub(crate) fn emit_references(
     });
 }
 
+/// Emits the type each method belongs to, placed at the method's name (e.g.
+/// `User` at `getName` in `class User`), so methods link to their type.
+pub(crate) fn emit_receivers(
+    path: &Path,
+    source: &str,
+    tree: &tree_sitter::Tree,
+    mut emit: impl FnMut(Location),
+) {
+    walk_tree(tree, |node| {
+        if node.kind() == "method_declaration"
+            && let Some(owner) = owner_type(node)
+                .and_then(|owner| owner.child_by_field_name("name"))
+                .and_then(|name| name.utf8_text(source.as_bytes()).ok())
+            && let Some(name) = node.child_by_field_name("name")
+            && let Some(location) = location_from_node(path, source, name)
+        {
+            emit(Location {
+                name: intern(owner),
+                ..location
+            });
+        }
+    });
+}
+
+/// Emits the fully-qualified name of each top-level class, interface, trait,
+/// enum and function (`MyApp\Models\User`), as imported by `use`.
+pub(crate) fn emit_package_exports(
+    source: &str,
+    tree: &tree_sitter::Tree,
+    mut emit: impl FnMut(String),
+) {
+    walk_tree(tree, |node| {
+        if (!TYPE_KINDS.contains(&node.kind()) && node.kind() != "function_definition")
+            || !is_top_level(node)
+        {
+            return;
+        }
+        let Some(name) = node
+            .child_by_field_name("name")
+            .and_then(|name| name.utf8_text(source.as_bytes()).ok())
+        else {
+            return;
+        };
+        match enclosing_namespace(node, source) {
+            Some(namespace) => emit(format!("{namespace}\\{name}")),
+            None => emit(name.to_string()),
+        }
+    });
+}
+
+/// Emits the names imported by top-level `use` declarations, in the format
+/// of [`emit_package_exports`]: `use A\B;`, `use A\B as C;`, `use function
+/// A\f;` and the grouped `use A\{B, C};`. `use Trait;` inside a class body is
+/// a plain reference instead.
+pub(crate) fn emit_package_imports(
+    source: &str,
+    tree: &tree_sitter::Tree,
+    mut emit: impl FnMut(String),
+) {
+    walk_tree(tree, |node| {
+        if node.kind() != "namespace_use_declaration" {
+            return;
+        }
+        let Ok(text) = node.utf8_text(source.as_bytes()) else {
+            return;
+        };
+        let text = text.trim().trim_start_matches("use").trim_end_matches(';');
+        let text = text
+            .trim_start()
+            .strip_prefix("function ")
+            .or_else(|| text.trim_start().strip_prefix("const "))
+            .unwrap_or(text);
+        let (prefix, names) = match text.split_once('{') {
+            Some((prefix, group)) => (prefix.trim(), group.trim_end_matches('}')),
+            None => ("", text),
+        };
+        for name in names.split(',') {
+            let name = name.split(" as ").next().unwrap_or(name).trim();
+            let name = format!("{prefix}{name}");
+            let name = name.trim_start_matches('\\');
+            if !name.is_empty() {
+                emit(name.to_string());
+            }
+        }
+    });
+}
+
+/// Emits the files named by `require`/`include` (and their `_once` forms)
+/// with a string literal, as in `require 'lib.php'` or `require_once
+/// __DIR__ . '/lib/helpers.php'`, where the part after `__DIR__` is matched.
+pub(crate) fn emit_imports(
+    path: &Path,
+    source: &str,
+    tree: &tree_sitter::Tree,
+    mut emit: impl FnMut(Vec<PathBuf>),
+) {
+    let dir = path.parent().unwrap_or_else(|| Path::new(""));
+    walk_tree(tree, |node| {
+        if !INCLUDE_KINDS.contains(&node.kind()) {
+            return;
+        }
+        let Some(target) = last_string(node)
+            .and_then(|string| string.utf8_text(source.as_bytes()).ok())
+            .map(|text| text.trim_matches(|c| c == '"' || c == '\''))
+            .filter(|text| !text.is_empty() && !text.contains('$'))
+        else {
+            return;
+        };
+        let target = PathBuf::from(target.trim_start_matches('/'));
+        emit(vec![dir.join(&target), target]);
+    });
+}
+
+/// PHP members are public unless marked `private` or `protected`; functions
+/// and classes are always public.
+pub(crate) fn visibility(declaration: Node, source: &str) -> Visibility {
+    let mut cursor = declaration.walk();
+    let hidden = declaration.children(&mut cursor).any(|child| {
+        child.kind() == "visibility_modifier" && child.utf8_text(source.as_bytes()) != Ok("public")
+    });
+    if hidden {
+        Visibility::Private
+    } else {
+        Visibility::Public
+    }
+}
+
+/// The top-level class, interface, trait or enum whose body declares `member`.
+fn owner_type(member: Node) -> Option<Node> {
+    let body = member.parent()?;
+    if !matches!(body.kind(), "declaration_list" | "enum_declaration_list") {
+        return None;
+    }
+    let owner = body.parent()?;
+    (TYPE_KINDS.contains(&owner.kind()) && is_top_level(owner)).then_some(owner)
+}
+
+/// The namespace a top-level declaration is in: that of the enclosing
+/// `namespace A\B { ... }` block, or of the last `namespace A\B;` statement
+/// before it.
+fn enclosing_namespace(node: Node, source: &str) -> Option<String> {
+    let mut current = node;
+    while let Some(parent) = current.parent() {
+        if parent.kind() == "namespace_definition" {
+            return namespace_name(parent, source);
+        }
+        if parent.kind() == "program" {
+            break;
+        }
+        current = parent;
+    }
+    // `current` is now the statement of `program` that holds `node`.
+    let mut sibling = current.prev_named_sibling();
+    while let Some(candidate) = sibling {
+        if candidate.kind() == "namespace_definition" {
+            return namespace_name(candidate, source);
+        }
+        sibling = candidate.prev_named_sibling();
+    }
+    None
+}
+
+fn namespace_name(namespace: Node, source: &str) -> Option<String> {
+    namespace
+        .child_by_field_name("name")
+        .and_then(|name| name.utf8_text(source.as_bytes()).ok())
+        .map(|name| name.trim_start_matches('\\').to_string())
+}
+
+/// The last string literal in `node`, e.g. `'/lib.php'` in `__DIR__ .
+/// '/lib.php'`.
+fn last_string(node: Node) -> Option<Node> {
+    let mut found = None;
+    let mut stack = vec![node];
+    while let Some(node) = stack.pop() {
+        if matches!(node.kind(), "string" | "encapsed_string") {
+            if found.is_none_or(|found: Node| node.start_byte() > found.start_byte()) {
+                found = Some(node);
+            }
+            continue;
+        }
+        let mut cursor = node.walk();
+        stack.extend(node.named_children(&mut cursor));
+    }
+    found
+}
 
 fn is_top_level(node: Node) -> bool {
     // In PHP, top-level items can be:
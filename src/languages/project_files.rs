@@ -0,0 +1,35 @@
+use std::path::{Path, PathBuf};
+
+use rustc_hash::FxHashMap;
+
+/// Names of the project files that steer import resolution, which have to
+/// come from the same place as the sources they apply to.
+pub(crate) const FILE_NAMES: &[&str] = &["tsconfig.json", "go.mod"];
+
+/// Where project files such as `tsconfig.json` and `go.mod` are read from.
+#[derive(Debug, Default)]
+pub(crate) enum ProjectFiles {
+    /// The working tree.
+    #[default]
+    Disk,
+    /// Files read from a git ref, by path; any other path does not exist.
+    Snapshot(FxHashMap<PathBuf, String>),
+}
+
+impl ProjectFiles {
+    /// The contents of `path`, or `None` when it does not exist or cannot
+    /// be read.
+    pub(crate) fn read(&self, path: &Path) -> Option<String> {
+        match self {
+            ProjectFiles::Disk => std::fs::read_to_string(path).ok(),
+            ProjectFiles::Snapshot(files) => files.get(path).cloned(),
+        }
+    }
+}
+
+/// Whether `path` is named like one of the [`FILE_NAMES`].
+pub(crate) fn is_project_file(path: &Path) -> bool {
+    path.file_name()
+        .and_then(|name| name.to_str())
+        .is_some_and(|name| FILE_NAMES.contains(&name))
+}
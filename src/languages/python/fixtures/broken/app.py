@@ -0,0 +1,6 @@
+from models import User
+from views import broken, render
+
+render("ada")
+broken()
+User("grace")
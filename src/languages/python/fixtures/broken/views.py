@@ -0,0 +1,9 @@
+from models import User
+
+
+def render(name):
+    return User(name)
+
+
+def broken(:
+    pass
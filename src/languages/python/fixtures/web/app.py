@@ -0,0 +1,19 @@
+from services import UserService, route
+
+
+service = UserService()
+
+
+@route("/users/{user_id}")
+def get_user(user_id: int) -> dict:
+    user = service.find(user_id)
+    return {"name": UserService.normalize(user["name"])}
+
+
+@route("/health")
+def health() -> dict:
+    return {"ok": True}
+
+
+if __name__ == "__main__":
+    print(get_user(1), health())
@@ -0,0 +1,28 @@
+import functools
+
+
+def route(path: str):
+    def decorator(handler):
+        @functools.wraps(handler)
+        def wrapper(*args, **kwargs):
+            return handler(*args, **kwargs)
+
+        wrapper.path = path
+        return wrapper
+
+    return decorator
+
+
+class UserService:
+    def __init__(self) -> None:
+        self.users = {1: {"name": " ada "}}
+
+    def find(self, user_id: int) -> dict:
+        def lookup(key: int) -> dict:
+            return self.users[key]
+
+        return lookup(user_id)
+
+    @staticmethod
+    def normalize(name: str) -> str:
+        return name.strip().title()
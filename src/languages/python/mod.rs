@@ -3,6 +3,8 @@ use std::path::Path;
 use tree_sitter::Node;
 
 use crate::find_references::{Location, collect_identifier_nodes, location_from_node, walk_tree};
+use crate::intern::intern;
+use crate::languages::kind::Visibility;
 
 pub(crate) const EXTENSIONS: &[&str] = &["py"];
 pub(crate) const REFERENCE_KINDS: &[&str] = &["identifier"];
@@ -19,7 +21,8 @@ pub(crate) fn emit_definitions(
 ) {
     walk_tree(tree, |node| match node.kind() {
         "function_definition" | "class_definition" => {
-            if is_top_level(node)
+            let is_method = node.kind() == "function_definition" && enclosing_class(node).is_some();
+            if (is_top_level(node) || is_method)
                 && let Some(name) = node.child_by_field_name("name")
                 && let Some(location) = location_from_node(path, source, name)
             {
@@ -56,6 +59,57 @@ pub(crate) fn emit_references(
     });
 }
 
+/// Emits the class of each method, placed at the method's name (e.g. `User`
+/// at `rename` for `def rename(self)` in `class User`), so that methods link
+/// to the class they belong to.
+pub(crate) fn emit_receivers(
+    path: &Path,
+    source: &str,
+    tree: &tree_sitter::Tree,
+    mut emit: impl FnMut(Location),
+) {
+    walk_tree(tree, |node| {
+        if node.kind() == "function_definition"
+            && let Some(class) = enclosing_class(node)
+            && let Some(class_name) = class
+                .child_by_field_name("name")
+                .and_then(|name| name.utf8_text(source.as_bytes()).ok())
+            && let Some(name) = node.child_by_field_name("name")
+            && let Some(location) = location_from_node(path, source, name)
+        {
+            emit(Location {
+                name: intern(class_name),
+                ..location
+            });
+        }
+    });
+}
+
+/// Names with a leading underscore are private by convention; dunder names
+/// such as `__init__` are not.
+pub(crate) fn visibility(name: &str) -> Visibility {
+    let dunder = name.len() > 4 && name.starts_with("__") && name.ends_with("__");
+    if name.starts_with('_') && !dunder {
+        Visibility::Private
+    } else {
+        Visibility::Public
+    }
+}
+
+/// The top-level class whose body holds `function`, possibly decorated.
+/// Functions nested in functions have none and are not definitions.
+fn enclosing_class(function: Node) -> Option<Node> {
+    let mut parent = function.parent()?;
+    if parent.kind() == "decorated_definition" {
+        parent = parent.parent()?;
+    }
+    if parent.kind() != "block" {
+        return None;
+    }
+    let class = parent.parent()?;
+    (class.kind() == "class_definition" && is_top_level(class)).then_some(class)
+}
+
 fn is_top_level(node: Node) -> bool {
     let Some(parent) = node.parent() else {
         return false;
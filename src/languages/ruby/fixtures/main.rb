@@ -0,0 +1,13 @@
+require_relative "models"
+require_relative "utils"
+
+def main
+  user = Shop::User.new("Alice")
+  order = Shop::Order.new(user)
+  puts user.display_name
+  puts Utils.add(1, 2)
+  puts Shop::DEFAULT_STATUS
+  order
+end
+
+main
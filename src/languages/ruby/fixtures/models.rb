@@ -0,0 +1,21 @@
+module Shop
+  DEFAULT_STATUS = :active
+
+  class User
+    attr_reader :name
+
+    def initialize(name)
+      @name = name
+    end
+
+    def display_name
+      "User #{name}"
+    end
+  end
+end
+
+class Shop::Order
+  def initialize(user)
+    @user = user
+  end
+end
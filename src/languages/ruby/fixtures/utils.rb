@@ -0,0 +1,9 @@
+module Utils
+  def self.add(a, b)
+    a + b
+  end
+
+  def self.multiply(a, b)
+    a * b
+  end
+end
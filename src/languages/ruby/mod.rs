@@ -0,0 +1,143 @@
+use std::path::{Path, PathBuf};
+
+use tree_sitter::Node;
+
+use crate::find_references::{Location, location_from_node, walk_tree};
+
+pub(crate) const EXTENSIONS: &[&str] = &["rb", "rake"];
+pub(crate) const FILE_NAMES: &[&str] = &["Rakefile"];
+pub(crate) const REFERENCE_KINDS: &[&str] = &["identifier", "constant"];
+
+pub(crate) fn language() -> tree_sitter::Language {
+    tree_sitter_ruby::LANGUAGE.into()
+}
+
+pub(crate) fn emit_definitions(
+    path: &Path,
+    source: &str,
+    tree: &tree_sitter::Tree,
+    mut emit: impl FnMut(Location),
+) {
+    walk_tree(tree, |node| match node.kind() {
+        "class" | "module" => {
+            // `class Foo::Bar` defines `Bar` inside the `Foo` namespace
+            if is_namespace_level(node)
+                && let Some(name) = node.child_by_field_name("name")
+                && let Some(location) = location_from_node(path, source, constant_name(name))
+            {
+                emit(location);
+            }
+        }
+        "method" | "singleton_method" => {
+            if is_namespace_level(node)
+                && let Some(name) = node.child_by_field_name("name")
+                && let Some(location) = location_from_node(path, source, name)
+            {
+                emit(location);
+            }
+        }
+        "assignment" => {
+            if is_namespace_level(node)
+                && let Some(left) = node.child_by_field_name("left")
+                && matches!(left.kind(), "constant" | "scope_resolution")
+                && let Some(location) = location_from_node(path, source, constant_name(left))
+            {
+                emit(location);
+            }
+        }
+        _ => {}
+    });
+}
+
+pub(crate) fn emit_references(
+    path: &Path,
+    source: &str,
+    tree: &tree_sitter::Tree,
+    mut emit: impl FnMut(Location),
+) {
+    walk_tree(tree, |node| {
+        if REFERENCE_KINDS.contains(&node.kind())
+            && let Some(location) = location_from_node(path, source, node)
+        {
+            emit(location);
+        }
+    });
+}
+
+/// Emits candidate paths for `require`, `require_relative` and `load` calls
+/// with a plain string argument.
+pub(crate) fn emit_imports(
+    path: &Path,
+    source: &str,
+    tree: &tree_sitter::Tree,
+    mut emit: impl FnMut(Vec<PathBuf>),
+) {
+    let dir = path.parent().unwrap_or_else(|| Path::new(""));
+    walk_tree(tree, |node| {
+        if node.kind() != "call" || node.child_by_field_name("receiver").is_some() {
+            return;
+        }
+        let Some(method) = node
+            .child_by_field_name("method")
+            .and_then(|method| method.utf8_text(source.as_bytes()).ok())
+        else {
+            return;
+        };
+        if !matches!(method, "require" | "require_relative" | "load") {
+            return;
+        }
+        let Some(target) = node
+            .child_by_field_name("arguments")
+            .and_then(|arguments| arguments.named_child(0))
+            .and_then(|argument| string_literal(argument, source))
+        else {
+            return;
+        };
+        let mut target = PathBuf::from(target);
+        if target.extension().is_none() {
+            target.set_extension("rb");
+        }
+        if method == "require_relative" {
+            emit(vec![dir.join(target)]);
+        } else {
+            // `require` resolves against the load path, so match by suffix
+            emit(vec![target]);
+        }
+    });
+}
+
+fn string_literal<'a>(node: Node, source: &'a str) -> Option<&'a str> {
+    if node.kind() != "string" || node.named_child_count() != 1 {
+        return None;
+    }
+    let content = node.named_child(0)?;
+    if content.kind() != "string_content" {
+        return None;
+    }
+    content.utf8_text(source.as_bytes()).ok()
+}
+
+fn constant_name(node: Node) -> Node {
+    if node.kind() == "scope_resolution"
+        && let Some(name) = node.child_by_field_name("name")
+    {
+        return name;
+    }
+    node
+}
+
+fn is_namespace_level(node: Node) -> bool {
+    // Definitions count when they sit at file level or directly inside
+    // class/module bodies, but not inside methods or blocks.
+    let Some(parent) = node.parent() else {
+        return false;
+    };
+    match parent.kind() {
+        "program" => true,
+        "class" | "module" => is_namespace_level(parent),
+        "body_statement" => parent.parent().is_some_and(|owner| {
+            matches!(owner.kind(), "class" | "module") && is_namespace_level(owner)
+        }),
+        _ => false,
+    }
+}
@@ -3,6 +3,7 @@ use std::path::Path;
 use tree_sitter::Node;
 
 use crate::find_references::{Location, location_from_node, walk_tree};
+use crate::languages::kind::Visibility;
 
 pub(crate) const EXTENSIONS: &[&str] = &["rs"];
 pub(crate) const REFERENCE_KINDS: &[&str] = &["identifier", "type_identifier"];
@@ -11,6 +12,8 @@ pub(crate) fn language() -> tree_sitter::Language {
     tree_sitter_rust::LANGUAGE.into()
 }
 
+/// Emits top-level items, plus the items of top-level `#[cfg(test)]`
+/// modules so that tests and their helpers can be ranked with `--tests`.
 pub(crate) fn emit_definitions(
     path: &Path,
     source: &str,
@@ -20,7 +23,7 @@ pub(crate) fn emit_definitions(
     walk_tree(tree, |node| match node.kind() {
         "function_item" | "struct_item" | "enum_item" | "const_item" | "static_item"
         | "type_item" | "trait_item" => {
-            if is_top_level(node)
+            if (is_top_level(node) || in_test_module(node, source))
                 && let Some(name) = node.child_by_field_name("name")
                 && let Some(location) = location_from_node(path, source, name)
             {
@@ -46,6 +49,86 @@ pub(crate) fn emit_references(
     });
 }
 
+/// Emits the line ranges of top-level items marked `#[cfg(test)]` (usually
+/// `mod tests`) or `#[test]`, attributes included.
+pub(crate) fn emit_test_ranges(
+    source: &str,
+    tree: &tree_sitter::Tree,
+    mut emit: impl FnMut(usize, usize),
+) {
+    let root = tree.root_node();
+    let mut cursor = root.walk();
+    let mut test_start = None;
+    for item in root.named_children(&mut cursor) {
+        match item.kind() {
+            "attribute_item" => {
+                if is_test_attribute(item, source) {
+                    test_start.get_or_insert(item.start_position().row + 1);
+                }
+            }
+            "line_comment" | "block_comment" => {}
+            _ => {
+                if let Some(start) = test_start.take() {
+                    emit(start, item.end_position().row + 1);
+                }
+            }
+        }
+    }
+}
+
+/// Items marked plain `pub`; `pub(crate)` and friends stay inside the crate.
+pub(crate) fn visibility(declaration: Node, source: &str) -> Visibility {
+    let mut cursor = declaration.walk();
+    let public = declaration.children(&mut cursor).any(|child| {
+        child.kind() == "visibility_modifier" && child.utf8_text(source.as_bytes()) == Ok("pub")
+    });
+    if public {
+        Visibility::Public
+    } else {
+        Visibility::Private
+    }
+}
+
+/// Whether `node` is an item directly inside a top-level `#[cfg(test)]`
+/// module.
+fn in_test_module(node: Node, source: &str) -> bool {
+    node.parent()
+        .filter(|body| body.kind() == "declaration_list")
+        .and_then(|body| body.parent())
+        .is_some_and(|module| {
+            module.kind() == "mod_item"
+                && is_top_level(module)
+                && has_test_attribute(module, source)
+        })
+}
+
+/// Whether one of the attributes right before `item` marks it as test code.
+fn has_test_attribute(item: Node, source: &str) -> bool {
+    let mut current = item.prev_named_sibling();
+    while let Some(sibling) = current {
+        match sibling.kind() {
+            "attribute_item" if is_test_attribute(sibling, source) => return true,
+            "attribute_item" | "line_comment" | "block_comment" => {}
+            _ => return false,
+        }
+        current = sibling.prev_named_sibling();
+    }
+    false
+}
+
+/// `#[test]`, `#[tokio::test]` and `#[cfg(test)]`, including `cfg(test)`
+/// inside `all(...)`.
+fn is_test_attribute(attribute: Node, source: &str) -> bool {
+    let Ok(text) = attribute.utf8_text(source.as_bytes()) else {
+        return false;
+    };
+    let text: String = text.chars().filter(|c| !c.is_whitespace()).collect();
+    text == "#[test]"
+        || text.ends_with("::test]")
+        || text.contains("cfg(test)")
+        || text.contains("(test,")
+}
+
 fn is_top_level(node: Node) -> bool {
     node.parent()
         .map(|parent| parent.kind() == "source_file")
@@ -0,0 +1,6 @@
+import Billing
+
+func checkout() -> String {
+    let invoice = Invoice(total: 42)
+    return invoice.describe()
+}
@@ -0,0 +1,5 @@
+extension Invoice {
+    public func describe() -> String {
+        return "Invoice of \(total)"
+    }
+}
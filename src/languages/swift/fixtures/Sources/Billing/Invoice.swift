@@ -0,0 +1,11 @@
+public protocol Billable {
+    var total: Int { get }
+}
+
+public struct Invoice: Billable {
+    public let total: Int
+
+    public init(total: Int) {
+        self.total = total
+    }
+}
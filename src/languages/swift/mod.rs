@@ -0,0 +1,239 @@
+use std::path::Path;
+
+use tree_sitter::Node;
+
+use crate::find_references::{Location, location_from_node, walk_tree};
+use crate::intern::intern;
+use crate::languages::kind::Visibility;
+
+pub(crate) const EXTENSIONS: &[&str] = &["swift"];
+pub(crate) const REFERENCE_KINDS: &[&str] = &["simple_identifier", "type_identifier"];
+
+/// Declarations inside type and extension bodies that are definitions.
+const MEMBER_KINDS: &[&str] = &[
+    "function_declaration",
+    "property_declaration",
+    "protocol_function_declaration",
+    "protocol_property_declaration",
+];
+
+pub(crate) fn language() -> tree_sitter::Language {
+    tree_sitter_swift::LANGUAGE.into()
+}
+
+/// Emits top-level classes, structs, enums, actors, protocols, type aliases,
+/// functions and properties, plus the members of top-level types and of
+/// extensions. An extension itself is not a definition: its members belong
+/// to the type it extends (see [`emit_receivers`]).
+pub(crate) fn emit_definitions(
+    path: &Path,
+    source: &str,
+    tree: &tree_sitter::Tree,
+    mut emit: impl FnMut(Location),
+) {
+    walk_tree(tree, |node| match node.kind() {
+        "class_declaration"
+        | "protocol_declaration"
+        | "typealias_declaration"
+        | "function_declaration"
+        | "property_declaration" => {
+            if is_top_level(node)
+                && !is_extension(node, source)
+                && let Some(name) = declaration_name(node)
+                && let Some(location) = location_from_node(path, source, name)
+            {
+                emit(location);
+            }
+        }
+        _ => {}
+    });
+    for (_, member) in top_level_members(tree, source) {
+        if let Some(name) = declaration_name(member)
+            && let Some(location) = location_from_node(path, source, name)
+        {
+            emit(location);
+        }
+    }
+}
+
+pub(crate) fn emit_references(
+    path: &Path,
+    source: &str,
+    tree: &tree_sitter::Tree,
+    mut emit: impl FnMut(Location),
+) {
+    walk_tree(tree, |node| {
+        if REFERENCE_KINDS.contains(&node.kind())
+            && let Some(location) = location_from_node(path, source, node)
+        {
+            emit(location);
+        }
+    });
+}
+
+/// Emits the owning type of each member, placed at the member's name (e.g.
+/// `Invoice` at `total` for `func total()` in `extension Invoice`), so that
+/// members link to their type even when an extension in another file
+/// declares them.
+pub(crate) fn emit_receivers(
+    path: &Path,
+    source: &str,
+    tree: &tree_sitter::Tree,
+    mut emit: impl FnMut(Location),
+) {
+    for (owner, member) in top_level_members(tree, source) {
+        if let Some(name) = declaration_name(member)
+            && let Some(location) = location_from_node(path, source, name)
+        {
+            emit(Location {
+                name: intern(owner),
+                ..location
+            });
+        }
+    }
+}
+
+/// Emits the module a file belongs to, so `import Billing` links to every
+/// file of that module. Swift has no per-file imports; the module is the
+/// Swift Package Manager target, i.e. the directory right below the last
+/// `Sources` or `Tests` directory (`Sources/Billing/Invoice.swift`). Files
+/// outside such a layout belong to no module.
+pub(crate) fn emit_package_exports(path: &Path, mut emit: impl FnMut(String)) {
+    let components: Vec<&str> = path
+        .components()
+        .filter_map(|component| component.as_os_str().to_str())
+        .collect();
+    let Some(index) = components
+        .iter()
+        .rposition(|component| matches!(*component, "Sources" | "Tests"))
+    else {
+        return;
+    };
+    // The target directory, not a file directly inside `Sources`.
+    if index + 2 < components.len() {
+        emit(components[index + 1].to_string());
+    }
+}
+
+/// Emits the module of each `import` declaration: `Billing` for `import
+/// Billing`, `import struct Billing.Invoice` and `@testable import Billing`.
+pub(crate) fn emit_package_imports(
+    source: &str,
+    tree: &tree_sitter::Tree,
+    mut emit: impl FnMut(String),
+) {
+    walk_tree(tree, |node| {
+        if node.kind() != "import_declaration" {
+            return;
+        }
+        let Ok(text) = node.utf8_text(source.as_bytes()) else {
+            return;
+        };
+        let mut words = text
+            .split_whitespace()
+            .skip_while(|word| *word != "import")
+            .skip(1);
+        let Some(mut path) = words.next() else {
+            return;
+        };
+        // `import struct Billing.Invoice` imports a single declaration.
+        if matches!(
+            path,
+            "typealias" | "struct" | "class" | "enum" | "protocol" | "let" | "var" | "func"
+        ) && let Some(next) = words.next()
+        {
+            path = next;
+        }
+        if let Some(module) = path.split('.').next().filter(|module| !module.is_empty()) {
+            emit(module.to_string());
+        }
+    });
+}
+
+/// `public` and `open` declarations are visible outside their module; the
+/// default `internal`, `fileprivate` and `private` ones are not.
+pub(crate) fn visibility(declaration: Node, source: &str) -> Visibility {
+    let mut cursor = declaration.walk();
+    let exported = declaration
+        .children(&mut cursor)
+        .filter(|child| child.kind() == "modifiers")
+        .filter_map(|modifiers| modifiers.utf8_text(source.as_bytes()).ok())
+        .flat_map(|text| text.split(|c: char| !c.is_alphanumeric()))
+        .any(|word| matches!(word, "public" | "open"));
+    if exported {
+        Visibility::Public
+    } else {
+        Visibility::Private
+    }
+}
+
+/// Members of top-level types and extensions, with the name of the type they
+/// belong to.
+fn top_level_members<'tree>(
+    tree: &'tree tree_sitter::Tree,
+    source: &'tree str,
+) -> Vec<(&'tree str, Node<'tree>)> {
+    let root = tree.root_node();
+    let mut cursor = root.walk();
+    let mut members = Vec::new();
+    for declaration in root.named_children(&mut cursor) {
+        if !matches!(
+            declaration.kind(),
+            "class_declaration" | "protocol_declaration"
+        ) {
+            continue;
+        }
+        let Some(owner) =
+            declaration_name(declaration).and_then(|name| name.utf8_text(source.as_bytes()).ok())
+        else {
+            continue;
+        };
+        let Some(body) = declaration.child_by_field_name("body") else {
+            continue;
+        };
+        let mut body_cursor = body.walk();
+        members.extend(
+            body.named_children(&mut body_cursor)
+                .filter(|member| MEMBER_KINDS.contains(&member.kind()))
+                .map(|member| (owner, member)),
+        );
+    }
+    members
+}
+
+/// The name node of a declaration: the type name of an extension
+/// (`Invoice` for `extension Invoice: Codable`), and the first bound
+/// identifier of a property (`total` for `let total = 0`).
+fn declaration_name(declaration: Node) -> Option<Node> {
+    let name = declaration.child_by_field_name("name")?;
+    match name.kind() {
+        "simple_identifier" | "type_identifier" => Some(name),
+        _ => first_descendant(name, &["simple_identifier", "type_identifier"]),
+    }
+}
+
+fn first_descendant<'tree>(node: Node<'tree>, kinds: &[&str]) -> Option<Node<'tree>> {
+    if kinds.contains(&node.kind()) {
+        return Some(node);
+    }
+    let mut cursor = node.walk();
+    let children: Vec<Node<'tree>> = node.named_children(&mut cursor).collect();
+    children
+        .into_iter()
+        .find_map(|child| first_descendant(child, kinds))
+}
+
+/// Extensions parse as `class_declaration` with an `extension` keyword.
+fn is_extension(declaration: Node, source: &str) -> bool {
+    declaration.kind() == "class_declaration"
+        && declaration
+            .child_by_field_name("declaration_kind")
+            .and_then(|kind| kind.utf8_text(source.as_bytes()).ok())
+            == Some("extension")
+}
+
+fn is_top_level(node: Node) -> bool {
+    node.parent()
+        .map(|parent| parent.kind() == "source_file")
+        .unwrap_or(false)
+}
@@ -0,0 +1,84 @@
+use std::path::Path;
+
+use crate::languages::Language;
+
+/// Whether `path` (relative to the repo root) is a test file by the naming
+/// conventions of `language`, e.g. `auth_test.go`, `test_auth.py`,
+/// `auth.test.ts`, `auth_spec.rb` or `AuthTest.java`, or lies in a test
+/// directory such as Rust's `tests/` or JavaScript's `__tests__/`.
+pub(crate) fn is_test_file(path: &Path, language: Language) -> bool {
+    let Some(name) = path.file_name().and_then(|name| name.to_str()) else {
+        return false;
+    };
+    let stem = name.split('.').next().unwrap_or(name);
+    let dirs: Vec<&str> = path
+        .parent()
+        .into_iter()
+        .flat_map(Path::components)
+        .filter_map(|component| component.as_os_str().to_str())
+        .collect();
+    let in_dir = |names: &[&str]| dirs.iter().any(|dir| names.contains(dir));
+    let prefixed_or_suffixed = stem.starts_with("test_") || stem.ends_with("_test");
+    match language {
+        Language::Bash | Language::C | Language::Cpp => {
+            prefixed_or_suffixed || in_dir(&["test", "tests"])
+        }
+        Language::CSharp => {
+            stem.ends_with("Test")
+                || stem.ends_with("Tests")
+                || dirs
+                    .iter()
+                    .any(|dir| dir.ends_with(".Test") || dir.ends_with(".Tests"))
+        }
+        Language::Go => stem.ends_with("_test"),
+        Language::Java | Language::Kotlin => {
+            stem.ends_with("Test")
+                || stem.ends_with("Tests")
+                || stem.ends_with("IT")
+                || dirs.windows(2).any(|pair| pair == ["src", "test"])
+        }
+        Language::Php => stem.ends_with("Test") || in_dir(&["tests"]),
+        Language::Python => prefixed_or_suffixed || stem == "conftest" || in_dir(&["tests"]),
+        Language::JavaScript | Language::TypeScript | Language::TypeScriptReact => {
+            name.contains(".test.") || name.contains(".spec.") || in_dir(&["__tests__"])
+        }
+        Language::Ruby => {
+            stem.ends_with("_spec") || prefixed_or_suffixed || in_dir(&["spec", "test"])
+        }
+        Language::Rust => in_dir(&["tests"]),
+        Language::Swift => stem.ends_with("Tests") || stem.ends_with("Test") || in_dir(&["Tests"]),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::is_test_file;
+    use crate::languages::Language;
+    use std::path::Path;
+
+    #[test]
+    fn classifies_test_files_by_language() {
+        let cases = [
+            ("auth/session_test.go", Language::Go, true),
+            ("auth/session.go", Language::Go, false),
+            ("testdata/session.go", Language::Go, false),
+            ("pkg/test_session.py", Language::Python, true),
+            ("tests/helpers.py", Language::Python, true),
+            ("pkg/conftest.py", Language::Python, true),
+            ("pkg/testing.py", Language::Python, false),
+            ("src/session.test.ts", Language::TypeScript, true),
+            ("src/__tests__/session.js", Language::JavaScript, true),
+            ("src/session.ts", Language::TypeScript, false),
+            ("tests/cli.rs", Language::Rust, true),
+            ("src/tests.rs", Language::Rust, false),
+            ("spec/session_spec.rb", Language::Ruby, true),
+            ("src/test/java/SessionTest.java", Language::Java, true),
+            ("src/main/java/Session.java", Language::Java, false),
+            ("App.Tests/SessionTests.cs", Language::CSharp, true),
+            ("Tests/AppTests/SessionTests.swift", Language::Swift, true),
+        ];
+        for (path, language, expected) in cases {
+            assert_eq!(is_test_file(Path::new(path), language), expected, "{path}");
+        }
+    }
+}
@@ -1,18 +1,39 @@
 mod analysis;
 mod cache;
+mod cycles;
+mod entrypoint;
 mod find_references;
+mod git;
 mod graph;
 pub mod intern;
 mod io;
 mod languages;
+mod options;
+mod profile;
+mod query;
+mod snippet;
+mod watch;
 
-pub use analysis::{OutputRow, cruxlines, cruxlines_from_inputs};
+pub use analysis::{
+    CruxLine, FileRank, OutputRow, analyze, analyze_profiled, cruxlines, cruxlines_from_inputs,
+    cruxlines_from_inputs_with_options, file_cycles, list_files, rank_by_file,
+    rank_by_file_profiled, symbol_cycles, symbol_graph,
+};
+pub use cycles::Cycle;
 pub use find_references::Location;
-pub use io::CruxlinesError;
-pub use languages::Ecosystem;
+pub use graph::SymbolGraph;
+pub use io::{CruxlinesError, find_repo_root};
+pub use languages::{Ecosystem, Language, SymbolKind, Visibility};
 pub use lasso::Spur;
+pub use options::{
+    DEFAULT_ENTRYPOINT_BOOST, DEFAULT_PAGERANK_DAMPING, DEFAULT_QUERY_WEIGHT, EdgeMode,
+    EntryPoints, FileScore, Options, RankMode, TestMode,
+};
+pub use profile::{Phase, Profile};
+pub use snippet::Snippet;
+pub use watch::watch;
 
 #[doc(hidden)]
 pub fn ecosystem_for_path(path: &std::path::Path) -> Option<Ecosystem> {
-    languages::language_for_path(path).map(languages::ecosystem_for_language)
+    languages::language_for_file(path).map(languages::ecosystem_for_language)
 }
@@ -1,40 +1,32 @@
-use std::path::PathBuf;
+use std::fmt;
+use std::io::{self, BufRead, Write};
+use std::path::{Path, PathBuf};
 use std::process;
 
-use clap::{Parser, ValueEnum};
-
-use cruxlines::{CruxlinesError, Ecosystem, OutputRow, cruxlines};
-
-#[derive(Debug, Parser)]
-struct Cli {
-    #[arg(short = 'e', long = "ecosystem", value_enum)]
-    ecosystems: Vec<EcosystemArg>,
-    #[arg(short = 'm', long = "metadata")]
-    metadata: bool,
-}
-
-#[derive(Copy, Clone, Debug, ValueEnum)]
-enum EcosystemArg {
-    #[value(name = "c", alias = "cpp", alias = "cxx")]
-    C,
-    #[value(name = "dotnet", alias = "csharp", alias = "cs")]
-    Dotnet,
-    #[value(name = "go")]
-    Go,
-    #[value(name = "java", alias = "jvm")]
-    Java,
-    #[value(name = "php")]
-    Php,
-    #[value(name = "python", alias = "py")]
-    Python,
-    #[value(name = "javascript", alias = "js", alias = "ts", alias = "tsx")]
-    JavaScript,
-    #[value(name = "rust", alias = "rs")]
-    Rust,
-}
+use clap::parser::ValueSource;
+use clap::{CommandFactory, FromArgMatches};
+use serde::Serialize;
+
+use cruxlines::{
+    OutputRow, Phase, Profile, Snippet, analyze_profiled, ecosystem_for_path, file_cycles,
+    find_repo_root, list_files, rank_by_file_profiled, symbol_cycles, symbol_graph, watch,
+};
+
+use crate::cli::{Cli, CycleLevelArg, GranularityArg, JsonRow, OutputFormat, ReportArg};
+use crate::config::apply_config;
+use crate::output::Output;
+use crate::report::{DotGraph, JsonCycle, JsonFile, JsonFileRank};
+use crate::sarif::SarifLog;
+
+mod cli;
+mod config;
+mod output;
+mod report;
+mod sarif;
 
 fn main() {
-    let cli = Cli::parse();
+    let matches = Cli::command().get_matches();
+    let mut cli = Cli::from_arg_matches(&matches).unwrap_or_else(|err| err.exit());
     let cwd = match std::env::current_dir() {
         Ok(cwd) => cwd,
         Err(err) => {
@@ -42,16 +34,106 @@ fn main() {
             process::exit(1);
         }
     };
+    if let Err(err) = apply_config(&mut cli, &matches, &cwd) {
+        eprintln!("cruxlines: {err}");
+        process::exit(1);
+    }
     let Some(repo_root) = find_repo_root(&cwd) else {
         eprintln!("cruxlines: current dir is not inside a git repository");
         process::exit(1);
     };
-    let ecosystems = selected_ecosystems(&cli.ecosystems);
 
-    let output_rows = match cruxlines(&repo_root, &ecosystems) {
-        Ok(rows) => rows,
+    // With --git-ref the focus file only has to exist at that ref.
+    if let Some(focus) = &cli.focus
+        && cli.git_ref.is_none()
+        && !cwd.join(focus).is_file()
+    {
+        eprintln!("cruxlines: --focus {}: no such file", focus.display());
+        process::exit(2);
+    }
+
+    // Watch refreshes are always JSON lines; text is only the default.
+    let format_given = matches.value_source("format") == Some(ValueSource::CommandLine);
+    if cli.watch
+        && !matches!(cli.format, OutputFormat::Json | OutputFormat::Jsonl)
+        && (format_given || cli.format != OutputFormat::Text)
+    {
+        eprintln!("cruxlines: --watch prints JSON lines; use --format json or jsonl");
+        process::exit(2);
+    }
+
+    // Ranking, file ranks, cycles and file lists all need every result before
+    // the first can be printed; only `--watch` refreshes come out one by one.
+    if cli.format == OutputFormat::Jsonl && !cli.watch {
+        eprintln!(
+            "cruxlines: --format jsonl only streams --watch refreshes; other modes need the \
+             whole result before printing, use --format json"
+        );
+        process::exit(2);
+    }
+
+    let roots = if cli.stdin_paths {
+        read_stdin_paths(&cwd)
+    } else {
+        vec![repo_root.clone()]
+    };
+
+    if cli.watch {
+        // Each refresh replaces the `--output` file as a whole.
+        let result = watch(&roots, &cli.options(), |rows| match rows {
+            Ok(rows) => {
+                let mut out = Output::new(cli.output.as_deref());
+                let written = print_json_line(&mut out, &rows, &repo_root);
+                if let Err(err) = written.and_then(|()| out.finish()) {
+                    eprintln!("cruxlines: failed to write output: {err}");
+                }
+            }
+            Err(err) => eprintln!("cruxlines: {err}"),
+        });
+        if let Err(err) = result {
+            eprintln!("cruxlines: {err}");
+            process::exit(1);
+        }
+        return;
+    }
+
+    let mut out = Output::new(cli.output.as_deref());
+    if cli.list_files {
+        let written = print_files(&mut out, &cli, &roots, &repo_root);
+        finish(out, written);
+        return;
+    }
+
+    match cli.report {
+        Some(ReportArg::Cycles) => {
+            let written = report_cycles(&mut out, &cli, &roots, &repo_root);
+            finish(out, written);
+            return;
+        }
+        Some(ReportArg::Graph) => {
+            let written = report_graph(&mut out, &cli, &roots, &repo_root);
+            finish(out, written);
+            return;
+        }
+        None => {}
+    }
+    if cli.format == OutputFormat::Dot {
+        eprintln!("cruxlines: --format dot needs --report graph");
+        process::exit(2);
+    }
+    if cli.granularity == GranularityArg::File {
+        let (written, profile) = print_file_ranks(&mut out, &cli, &roots, &repo_root);
+        finish(out, written);
+        if cli.profile {
+            print_profile(&profile);
+        }
+        return;
+    }
+
+    let (output_rows, profile) = match analyze_profiled(&roots, &cli.options()) {
+        Ok(result) => result,
         Err(err) => {
-            report_error(err);
+            eprintln!("cruxlines: {err}");
             process::exit(1);
         }
     };
@@ -66,15 +148,282 @@ fn main() {
         std::thread::sleep(std::time::Duration::from_millis(pause_ms));
     }
 
-    for row in &output_rows {
-        print_row(row, &repo_root, cli.metadata);
+    let written = if cli.count {
+        writeln!(out, "{}", output_rows.len())
+    } else {
+        match cli.format {
+            OutputFormat::Text => output_rows
+                .iter()
+                .try_for_each(|row| print_row(&mut out, row, &repo_root, cli.metadata)),
+            OutputFormat::Json => print_json(&mut out, &output_rows, &repo_root),
+            OutputFormat::Sarif => print_sarif(&mut out, &output_rows, &repo_root),
+            OutputFormat::Jsonl | OutputFormat::Dot => unreachable!("rejected above"),
+        }
+    };
+    finish(out, written);
+
+    if cli.profile {
+        print_profile(&profile);
+    }
+}
+
+/// Finishes `out` once `written` succeeded. Stops quietly when the reader
+/// goes away (e.g. `| head`).
+fn finish(out: Output, written: io::Result<()>) {
+    match written.and_then(|()| out.finish()) {
+        Ok(()) => {}
+        Err(err) if err.kind() == io::ErrorKind::BrokenPipe => {}
+        Err(err) => {
+            eprintln!("cruxlines: failed to write output: {err}");
+            process::exit(1);
+        }
+    }
+}
+
+/// Prints one `<phase> <time> <key>=<count>...` line per phase to stderr, so that
+/// stdout stays parseable.
+fn print_profile(profile: &Profile) {
+    eprintln!("cruxlines: profile");
+    for (phase, elapsed) in &profile.phases {
+        let counts = match phase {
+            Phase::Walk => format!("files={}", profile.files_walked),
+            Phase::Parse => format!(
+                "files={} cached={} errors={}",
+                profile.files_parsed, profile.cache_hits, profile.parse_errors
+            ),
+            Phase::History => String::new(),
+            Phase::Graph => format!("nodes={} edges={}", profile.nodes, profile.edges),
+            Phase::Rank => format!("definitions={}", profile.definitions),
+        };
+        let line = format!(
+            "  {:<8} {:>10}  {counts}",
+            phase.name(),
+            format!("{elapsed:.1?}")
+        );
+        eprintln!("{}", line.trim_end());
+    }
+    eprintln!(
+        "  {:<8} {:>10}",
+        "total",
+        format!("{:.1?}", profile.total())
+    );
+}
+
+/// Prints the dependency cycles at `--cycle-level`, as text, a JSON array or
+/// one JSON object per line.
+fn report_cycles(
+    out: &mut Output,
+    cli: &Cli,
+    roots: &[PathBuf],
+    repo_root: &Path,
+) -> io::Result<()> {
+    if matches!(cli.format, OutputFormat::Sarif | OutputFormat::Dot) {
+        eprintln!("cruxlines: --report cycles supports --format text or json");
+        process::exit(2);
+    }
+    let options = cli.options();
+    let cycles = match cli.cycle_level {
+        CycleLevelArg::File => file_cycles(roots, &options).map(|cycles| {
+            cycles
+                .iter()
+                .map(|cycle| JsonCycle::from_files(cycle, repo_root))
+                .collect::<Vec<_>>()
+        }),
+        CycleLevelArg::Symbol => symbol_cycles(roots, &options).map(|cycles| {
+            cycles
+                .iter()
+                .map(|cycle| JsonCycle::from_symbols(cycle, repo_root))
+                .collect()
+        }),
+    };
+    let cycles = match cycles {
+        Ok(cycles) => cycles,
+        Err(err) => {
+            eprintln!("cruxlines: {err}");
+            process::exit(1);
+        }
+    };
+    write_records(out, cli.format, &cycles)
+}
+
+/// Prints the graph between the ranked definitions, or the `--graph-top`
+/// of them, as Graphviz DOT.
+fn report_graph(
+    out: &mut Output,
+    cli: &Cli,
+    roots: &[PathBuf],
+    repo_root: &Path,
+) -> io::Result<()> {
+    if cli.format != OutputFormat::Dot {
+        eprintln!("cruxlines: --report graph supports --format dot");
+        process::exit(2);
+    }
+    match symbol_graph(roots, &cli.options(), cli.graph_top) {
+        Ok(graph) => write!(
+            out,
+            "{}",
+            DotGraph::new(&graph, repo_root, cli.graph_weights)
+        ),
+        Err(err) => {
+            eprintln!("cruxlines: {err}");
+            process::exit(1);
+        }
+    }
+}
+
+/// Prints the files a run would analyze, one `file: language` line each in
+/// path order, or as JSON.
+fn print_files(out: &mut Output, cli: &Cli, roots: &[PathBuf], repo_root: &Path) -> io::Result<()> {
+    if matches!(cli.format, OutputFormat::Sarif | OutputFormat::Dot) {
+        eprintln!("cruxlines: --list-files supports --format text or json");
+        process::exit(2);
+    }
+    let files: Vec<JsonFile> = match list_files(roots, &cli.options()) {
+        Ok(files) => files
+            .iter()
+            .map(|(path, language)| JsonFile::new(path, *language, repo_root))
+            .collect(),
+        Err(err) => {
+            eprintln!("cruxlines: {err}");
+            process::exit(1);
+        }
+    };
+    write_records(out, cli.format, &files)
+}
+
+/// Prints the files ranked by their definitions, one `file: score=...` line
+/// each, as JSON, or only their number with `--count`, and returns the
+/// profile of the run for `--profile`.
+fn print_file_ranks(
+    out: &mut Output,
+    cli: &Cli,
+    roots: &[PathBuf],
+    repo_root: &Path,
+) -> (io::Result<()>, Profile) {
+    if cli.format == OutputFormat::Sarif {
+        eprintln!("cruxlines: --granularity file supports --format text or json");
+        process::exit(2);
+    }
+    let (files, profile) =
+        match rank_by_file_profiled(roots, &cli.options(), cli.file_score.file_score()) {
+            Ok(result) => result,
+            Err(err) => {
+                eprintln!("cruxlines: {err}");
+                process::exit(1);
+            }
+        };
+    let files: Vec<JsonFileRank> = files
+        .iter()
+        .map(|file| JsonFileRank::new(file, repo_root))
+        .collect();
+    let written = if cli.count {
+        writeln!(out, "{}", files.len())
+    } else {
+        write_records(out, cli.format, &files)
+    };
+    (written, profile)
+}
+
+/// Writes `records` one `Display` per line or as a JSON array. Callers
+/// reject the other formats.
+fn write_records<T: Serialize + fmt::Display>(
+    out: &mut Output,
+    format: OutputFormat,
+    records: &[T],
+) -> io::Result<()> {
+    match format {
+        OutputFormat::Text => records
+            .iter()
+            .try_for_each(|record| writeln!(out, "{record}")),
+        OutputFormat::Json => match serde_json::to_string_pretty(records) {
+            Ok(json) => writeln!(out, "{json}"),
+            Err(err) => {
+                eprintln!("cruxlines: failed to encode json: {err}");
+                process::exit(1);
+            }
+        },
+        OutputFormat::Jsonl | OutputFormat::Sarif | OutputFormat::Dot => {
+            unreachable!("rejected by the caller")
+        }
+    }
+}
+
+/// Reads one path per line from stdin, relative to `cwd`. Paths that do not
+/// exist or are not in a supported language are skipped with a warning.
+fn read_stdin_paths(cwd: &Path) -> Vec<PathBuf> {
+    let mut paths = Vec::new();
+    for line in std::io::stdin().lock().lines() {
+        let line = match line {
+            Ok(line) => line,
+            Err(err) => {
+                eprintln!("cruxlines: failed to read paths from stdin: {err}");
+                process::exit(1);
+            }
+        };
+        let line = line.trim();
+        if line.is_empty() {
+            continue;
+        }
+        let path = cwd.join(line);
+        if !path.is_file() {
+            eprintln!("cruxlines: skipping {line}: no such file");
+        } else if ecosystem_for_path(&path).is_none() {
+            eprintln!("cruxlines: skipping {line}: unsupported language");
+        } else {
+            paths.push(path);
+        }
+    }
+    paths
+}
+
+fn json_rows(rows: &[OutputRow], repo_root: &Path) -> Vec<JsonRow> {
+    rows.iter()
+        .map(|row| JsonRow::new(row, display_path(row.definition.path_str(), repo_root)))
+        .collect()
+}
+
+fn print_json(out: &mut Output, rows: &[OutputRow], repo_root: &Path) -> io::Result<()> {
+    match serde_json::to_string_pretty(&json_rows(rows, repo_root)) {
+        Ok(json) => writeln!(out, "{json}"),
+        Err(err) => {
+            eprintln!("cruxlines: failed to encode json: {err}");
+            process::exit(1);
+        }
+    }
+}
+
+fn print_sarif(out: &mut Output, rows: &[OutputRow], repo_root: &Path) -> io::Result<()> {
+    match serde_json::to_string_pretty(&SarifLog::new(json_rows(rows, repo_root))) {
+        Ok(json) => writeln!(out, "{json}"),
+        Err(err) => {
+            eprintln!("cruxlines: failed to encode sarif: {err}");
+            process::exit(1);
+        }
     }
 }
 
-fn print_row(row: &OutputRow, repo_root: &std::path::Path, include_metadata: bool) {
+/// Prints `rows` as a single-line JSON document, so watch mode consumers can
+/// split refreshes on newlines.
+fn print_json_line(out: &mut Output, rows: &[OutputRow], repo_root: &Path) -> io::Result<()> {
+    match serde_json::to_string(&json_rows(rows, repo_root)) {
+        Ok(json) => writeln!(out, "{json}"),
+        Err(err) => {
+            eprintln!("cruxlines: failed to encode json: {err}");
+            Ok(())
+        }
+    }
+}
+
+fn print_row(
+    out: &mut Output,
+    row: &OutputRow,
+    repo_root: &Path,
+    include_metadata: bool,
+) -> io::Result<()> {
     let line_text = row.definition_line.as_str();
     if include_metadata {
-        println!(
+        writeln!(
+            out,
             "{}:{}:{}: rank={:.6} local={:.6} file={:.6} name={} | {}",
             display_path(row.definition.path_str(), repo_root),
             row.definition.line,
@@ -84,68 +433,36 @@ fn print_row(row: &OutputRow, repo_root: &std::path::Path, include_metadata: boo
             row.file_rank,
             row.definition.name_str(),
             line_text
-        );
+        )?;
     } else {
-        println!(
+        writeln!(
+            out,
             "{}:{}:{}: {}",
             display_path(row.definition.path_str(), repo_root),
             row.definition.line,
             row.definition.column,
             line_text
-        );
+        )?;
     }
-}
-
-fn display_path(path: &str, repo_root: &std::path::Path) -> String {
-    let path = std::path::Path::new(path);
-    match path.strip_prefix(repo_root) {
-        Ok(rel) => rel.display().to_string(),
-        Err(_) => path.display().to_string(),
+    if let Some(snippet) = &row.snippet {
+        print_snippet(out, snippet)?;
     }
+    Ok(())
 }
 
-fn report_error(err: CruxlinesError) {
-    match err {
-        CruxlinesError::ReadFile { path, source } => {
-            eprintln!("cruxlines: failed to read {}: {source}", path.display());
-        }
+/// Prints a snippet below its crux line as `  <line> | <source>`.
+fn print_snippet(out: &mut Output, snippet: &Snippet) -> io::Result<()> {
+    let width = snippet.end_line().to_string().len();
+    for (offset, line) in snippet.lines.iter().enumerate() {
+        writeln!(out, "  {:>width$} | {line}", snippet.start_line + offset)?;
     }
+    Ok(())
 }
 
-fn selected_ecosystems(values: &[EcosystemArg]) -> std::collections::HashSet<Ecosystem> {
-    let mut ecosystems = std::collections::HashSet::new();
-    if values.is_empty() {
-        ecosystems.insert(Ecosystem::C);
-        ecosystems.insert(Ecosystem::Dotnet);
-        ecosystems.insert(Ecosystem::Go);
-        ecosystems.insert(Ecosystem::Java);
-        ecosystems.insert(Ecosystem::Php);
-        ecosystems.insert(Ecosystem::Python);
-        ecosystems.insert(Ecosystem::JavaScript);
-        ecosystems.insert(Ecosystem::Rust);
-        return ecosystems;
-    }
-    for value in values {
-        let ecosystem = match value {
-            EcosystemArg::C => Ecosystem::C,
-            EcosystemArg::Dotnet => Ecosystem::Dotnet,
-            EcosystemArg::Go => Ecosystem::Go,
-            EcosystemArg::Java => Ecosystem::Java,
-            EcosystemArg::Php => Ecosystem::Php,
-            EcosystemArg::Python => Ecosystem::Python,
-            EcosystemArg::JavaScript => Ecosystem::JavaScript,
-            EcosystemArg::Rust => Ecosystem::Rust,
-        };
-        ecosystems.insert(ecosystem);
-    }
-    ecosystems
-}
-
-fn find_repo_root(start: &std::path::Path) -> Option<PathBuf> {
-    for ancestor in start.ancestors() {
-        if ancestor.join(".git").is_dir() {
-            return Some(ancestor.to_path_buf());
-        }
+fn display_path(path: &str, repo_root: &Path) -> String {
+    let path = Path::new(path);
+    match path.strip_prefix(repo_root) {
+        Ok(rel) => rel.display().to_string(),
+        Err(_) => path.display().to_string(),
     }
-    None
 }
@@ -0,0 +1,176 @@
+use std::collections::{HashMap, HashSet};
+use std::path::PathBuf;
+use std::time::Duration;
+
+pub use crate::entrypoint::{DEFAULT_ENTRYPOINT_BOOST, EntryPoints};
+use crate::languages::{Ecosystem, Language, SymbolKind};
+pub use crate::query::DEFAULT_QUERY_WEIGHT;
+
+/// How definitions are scored.
+#[derive(Copy, Clone, Debug, Default, PartialEq, Eq)]
+pub enum RankMode {
+    /// References are weighted by the PageRank and git frecency of the file
+    /// they come from.
+    #[default]
+    Frecency,
+    /// References are weighted by file PageRank only, ignoring git history.
+    PageRank,
+    /// Normalized PageRank score multiplied by the normalized frecency of the
+    /// definition's file.
+    Hybrid,
+}
+
+/// Which usages count as edges between definitions.
+#[derive(Copy, Clone, Debug, Default, PartialEq, Eq)]
+pub enum EdgeMode {
+    /// Every name-matched reference, including types and plain mentions.
+    #[default]
+    References,
+    /// Only call sites, resolved to the function, method or type they call.
+    Calls,
+}
+
+/// How test code takes part in ranking. Test files are recognized by the
+/// naming conventions of each language (`*_test.go`, `test_*.py`,
+/// `*.test.ts`, Rust's `tests/`, ...), and Rust `#[cfg(test)]` modules and
+/// `#[test]` functions count as test code too.
+#[derive(Copy, Clone, Debug, Default, PartialEq, Eq)]
+pub enum TestMode {
+    /// Rank test code like any other code.
+    Include,
+    /// Leave test code out: its definitions are not ranked and its
+    /// references and imports do not count.
+    #[default]
+    Exclude,
+    /// Rank only test definitions, each scored by the summed rank of the
+    /// non-test definitions it references, so the tests exercising the most
+    /// central code come first.
+    Only,
+}
+
+/// How [`rank_by_file`](crate::rank_by_file) turns the ranks of a file's
+/// definitions into the file's score.
+#[derive(Copy, Clone, Debug, Default, PartialEq, Eq)]
+pub enum FileScore {
+    /// The sum of the ranks, favoring files with many central definitions.
+    #[default]
+    Sum,
+    /// The highest rank, favoring files holding the single most central
+    /// definitions.
+    Max,
+}
+
+pub const DEFAULT_PAGERANK_DAMPING: f64 = 0.85;
+
+/// Tuning knobs for an analysis run; mirrors the CLI flags.
+#[derive(Clone, Debug)]
+pub struct Options {
+    /// Ecosystems to analyze; files of other languages are skipped.
+    pub ecosystems: HashSet<Ecosystem>,
+    /// Languages to analyze within `ecosystems`; files of other languages
+    /// are skipped during the walk, without being read.
+    pub languages: HashSet<Language>,
+    /// Kinds of definitions to return; others are dropped after ranking, so
+    /// they neither change the scores nor count towards `limit`.
+    pub kinds: HashSet<SymbolKind>,
+    /// Globs (`.gitignore` syntax, relative to the repo root) of paths to
+    /// skip on top of `.gitignore`.
+    pub exclude: Vec<String>,
+    /// Globs of paths to analyze even if `.gitignore` or `exclude` skips
+    /// them.
+    pub include: Vec<String>,
+    /// Walk into symlinked directories and read symlinked files, which are
+    /// skipped by default as git does; each file is still analyzed once.
+    pub follow_symlinks: bool,
+    /// Leave out the definitions of files with syntax errors, rather than
+    /// only down-weighting the definitions an error overlaps.
+    pub strict_parse: bool,
+    /// Maximum number of crux lines to return.
+    pub limit: Option<usize>,
+    /// Drop crux lines whose rank divided by the highest rank of the run is
+    /// below this, in `[0, 1]`; applied before `max_per_file` and `limit`.
+    pub min_score: Option<f64>,
+    /// Maximum number of crux lines from any one file, applied before `limit`.
+    pub max_per_file: Option<usize>,
+    /// Follow each crux line with the definitions it depends on, up to this
+    /// many hops away; 0 disables the expansion.
+    pub depth: usize,
+    /// Attach a snippet to each crux line: its declaration plus this many
+    /// lines before and after.
+    pub context: Option<usize>,
+    pub rank: RankMode,
+    pub edges: EdgeMode,
+    pub tests: TestMode,
+    /// PageRank damping factor, in `(0, 1)`.
+    pub pagerank_damping: f64,
+    /// Reuse parse results from the on-disk cache for unchanged files.
+    pub use_cache: bool,
+    /// Number of parser threads; `None` uses one per logical CPU.
+    pub threads: Option<usize>,
+    /// Boost definitions changed since this git ref (compared from its merge
+    /// base with HEAD) or duration (e.g. `2w`).
+    pub since: Option<String>,
+    /// How fast git frecency decays: a commit this long ago counts half as
+    /// much as one made now. Must be non-zero. `None` keeps `frecenfile`'s
+    /// own weighting.
+    pub frecency_half_life: Option<Duration>,
+    /// Analyze the files committed at this git ref (e.g. `origin/main`),
+    /// read from the object store, instead of the working tree. `since` then
+    /// compares against this ref rather than HEAD.
+    pub git_ref: Option<String>,
+    /// Rank by proximity to this file instead of globally: file ranks come
+    /// from a personalized PageRank seeded at it, following dependencies in
+    /// both directions, and definitions in files it does not reach, through
+    /// any number of files, are left out. A focus file without cross-file
+    /// edges yields only its own definitions. Relative paths are resolved
+    /// against the current directory.
+    pub focus: Option<PathBuf>,
+    /// Boost definitions whose name, definition line or path share terms
+    /// with this text (e.g. `user authentication`).
+    pub query: Option<String>,
+    /// How strongly `query` matches boost the rank: the best match is
+    /// multiplied by `1 + query_weight`.
+    pub query_weight: f64,
+    /// Rank multiplier for entry points (see [`EntryPoints`]); the default
+    /// of 1 only marks them.
+    pub entrypoint_boost: f64,
+    /// Entry-point heuristics per ecosystem; ecosystems without an entry
+    /// have no entry points.
+    pub entrypoints: HashMap<Ecosystem, EntryPoints>,
+}
+
+impl Default for Options {
+    fn default() -> Self {
+        Self {
+            ecosystems: Ecosystem::ALL.iter().copied().collect(),
+            languages: Language::ALL.iter().copied().collect(),
+            kinds: SymbolKind::ALL.iter().copied().collect(),
+            exclude: Vec::new(),
+            include: Vec::new(),
+            follow_symlinks: false,
+            strict_parse: false,
+            limit: None,
+            min_score: None,
+            max_per_file: None,
+            depth: 0,
+            context: None,
+            rank: RankMode::default(),
+            edges: EdgeMode::default(),
+            tests: TestMode::default(),
+            pagerank_damping: DEFAULT_PAGERANK_DAMPING,
+            use_cache: true,
+            threads: None,
+            since: None,
+            frecency_half_life: None,
+            git_ref: None,
+            focus: None,
+            query: None,
+            query_weight: DEFAULT_QUERY_WEIGHT,
+            entrypoint_boost: DEFAULT_ENTRYPOINT_BOOST,
+            entrypoints: Ecosystem::ALL
+                .iter()
+                .map(|ecosystem| (*ecosystem, EntryPoints::defaults(*ecosystem)))
+                .collect(),
+        }
+    }
+}
@@ -0,0 +1,102 @@
+use std::ffi::OsString;
+use std::fs;
+use std::io::{self, Write};
+use std::path::{Path, PathBuf};
+
+/// Where a run's result goes: stdout, or a buffer that [`Output::finish`]
+/// writes to the `--output` file in one step.
+pub(crate) enum Output {
+    Stdout(io::StdoutLock<'static>),
+    File { path: PathBuf, buffer: Vec<u8> },
+}
+
+impl Output {
+    pub(crate) fn new(path: Option<&Path>) -> Self {
+        match path {
+            Some(path) => Output::File {
+                path: path.to_path_buf(),
+                buffer: Vec::new(),
+            },
+            None => Output::Stdout(io::stdout().lock()),
+        }
+    }
+
+    /// Flushes stdout, or writes the buffered result to the output file.
+    pub(crate) fn finish(self) -> io::Result<()> {
+        match self {
+            Output::Stdout(mut stdout) => stdout.flush(),
+            Output::File { path, buffer } => write_atomically(&path, &buffer)
+                .map_err(|err| io::Error::new(err.kind(), format!("{}: {err}", path.display()))),
+        }
+    }
+}
+
+impl Write for Output {
+    fn write(&mut self, bytes: &[u8]) -> io::Result<usize> {
+        match self {
+            Output::Stdout(stdout) => stdout.write(bytes),
+            Output::File { buffer, .. } => buffer.write(bytes),
+        }
+    }
+
+    fn flush(&mut self) -> io::Result<()> {
+        match self {
+            Output::Stdout(stdout) => stdout.flush(),
+            Output::File { .. } => Ok(()),
+        }
+    }
+}
+
+/// Writes `contents` to a temporary file next to `path` and renames it over
+/// `path`, creating missing parent directories first. Readers see either the
+/// old file or the complete new one, never a truncated one.
+fn write_atomically(path: &Path, contents: &[u8]) -> io::Result<()> {
+    let Some(name) = path.file_name() else {
+        return Err(io::Error::new(
+            io::ErrorKind::InvalidInput,
+            "not a file path",
+        ));
+    };
+    let dir = match path.parent() {
+        Some(dir) if !dir.as_os_str().is_empty() => dir,
+        _ => Path::new("."),
+    };
+    fs::create_dir_all(dir)?;
+    let mut temp_name = OsString::from(".");
+    temp_name.push(name);
+    temp_name.push(format!(".{}.tmp", std::process::id()));
+    let temp = dir.join(temp_name);
+    let written = fs::File::create(&temp)
+        .and_then(|mut file| {
+            file.write_all(contents)?;
+            file.sync_all()
+        })
+        .and_then(|()| fs::rename(&temp, path));
+    if written.is_err() {
+        let _ = fs::remove_file(&temp);
+    }
+    written
+}
+
+#[cfg(test)]
+mod tests {
+    use super::write_atomically;
+    use std::fs;
+
+    #[test]
+    fn replaces_the_file_and_creates_parent_directories() {
+        let dir = std::env::temp_dir().join(format!("cruxlines-output-{}", std::process::id()));
+        let path = dir.join("reports/cruxlines.json");
+
+        write_atomically(&path, b"[1]\n").expect("first write");
+        write_atomically(&path, b"[2]\n").expect("second write");
+
+        assert_eq!(fs::read_to_string(&path).expect("read output"), "[2]\n");
+        let leftovers: Vec<_> = fs::read_dir(path.parent().unwrap())
+            .expect("read dir")
+            .map(|entry| entry.expect("entry").file_name())
+            .collect();
+        assert_eq!(leftovers, vec!["cruxlines.json"]);
+        let _ = fs::remove_dir_all(&dir);
+    }
+}
@@ -0,0 +1,91 @@
+use std::time::{Duration, Instant};
+
+/// A stage of an analysis run, in the order they run.
+#[derive(Copy, Clone, Debug, PartialEq, Eq)]
+pub enum Phase {
+    /// Walking the roots (or listing a git tree) and filtering paths.
+    Walk,
+    /// Reading and parsing files (or fetching cached results) and resolving
+    /// references and imports.
+    Parse,
+    /// Reading git history for frecency and `since`, beyond the part that
+    /// overlaps with parsing.
+    History,
+    /// Building the file graph.
+    Graph,
+    /// PageRank, scoring, boosts, filters and snippets.
+    Rank,
+}
+
+impl Phase {
+    pub fn name(self) -> &'static str {
+        match self {
+            Phase::Walk => "walk",
+            Phase::Parse => "parse",
+            Phase::History => "history",
+            Phase::Graph => "graph",
+            Phase::Rank => "rank",
+        }
+    }
+}
+
+/// Where the time of an [`analyze_profiled`](crate::analyze_profiled) run
+/// went, with the sizes of what each phase worked on.
+#[derive(Clone, Debug, Default)]
+pub struct Profile {
+    /// Wall-clock time per phase, in the order each phase first ran; phases
+    /// that run once per ecosystem are summed.
+    pub phases: Vec<(Phase, Duration)>,
+    /// Files found by the walk.
+    pub files_walked: usize,
+    /// Files in a supported language that were read, parsed or taken from
+    /// the cache.
+    pub files_parsed: usize,
+    /// How many of `files_parsed` came from the parse cache.
+    pub cache_hits: usize,
+    /// How many of `files_parsed` have syntax errors.
+    pub parse_errors: usize,
+    /// Files in the file graph, over all ecosystems.
+    pub nodes: usize,
+    /// File-to-file edges in the file graph, over all ecosystems.
+    pub edges: usize,
+    /// Ranked definitions, before `kinds`, `min_score` and the limits.
+    pub definitions: usize,
+}
+
+impl Profile {
+    /// Runs `run`, adding its wall-clock time to `phase`.
+    pub(crate) fn time<T>(&mut self, phase: Phase, run: impl FnOnce() -> T) -> T {
+        let start = Instant::now();
+        let result = run();
+        let elapsed = start.elapsed();
+        match self.phases.iter_mut().find(|(seen, _)| *seen == phase) {
+            Some((_, total)) => *total += elapsed,
+            None => self.phases.push((phase, elapsed)),
+        }
+        result
+    }
+
+    /// Time spent in all phases.
+    pub fn total(&self) -> Duration {
+        self.phases.iter().map(|(_, elapsed)| *elapsed).sum()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::{Phase, Profile};
+
+    #[test]
+    fn sums_repeated_phases_in_first_run_order() {
+        let mut profile = Profile::default();
+        profile.time(Phase::Graph, || ());
+        profile.time(Phase::Rank, || ());
+        let value = profile.time(Phase::Graph, || 7);
+
+        assert_eq!(value, 7);
+        let phases: Vec<Phase> = profile.phases.iter().map(|(phase, _)| *phase).collect();
+        assert_eq!(phases, vec![Phase::Graph, Phase::Rank]);
+        assert_eq!(profile.total(), profile.phases[0].1 + profile.phases[1].1);
+    }
+}
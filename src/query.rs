@@ -0,0 +1,115 @@
+use rustc_hash::{FxHashMap, FxHashSet};
+
+use crate::analysis::OutputRow;
+
+pub const DEFAULT_QUERY_WEIGHT: f64 = 10.0;
+
+/// Multiplies each row's rank by `1 + weight * relevance`, where relevance is
+/// how well the row's symbol name, definition line and file path match
+/// `query`, scaled so the best-matching row has relevance 1.
+///
+/// Each overlapping term counts its inverse document frequency over the
+/// rows, so terms that appear in nearly every row (e.g. a shared path
+/// prefix) barely count.
+pub(crate) fn boost_query(rows: &mut [OutputRow], query: &str, weight: f64) {
+    let terms: FxHashSet<String> = tokenize(query).collect();
+    if terms.is_empty() || rows.is_empty() {
+        return;
+    }
+
+    let documents: Vec<FxHashSet<String>> = rows
+        .iter()
+        .map(|row| {
+            tokenize(row.definition.name_str())
+                .chain(tokenize(&row.definition_line))
+                .chain(tokenize(row.definition.path_str()))
+                .filter(|term| terms.contains(term))
+                .collect()
+        })
+        .collect();
+
+    let mut document_frequency: FxHashMap<&str, usize> = FxHashMap::default();
+    for document in &documents {
+        for term in document {
+            *document_frequency.entry(term).or_default() += 1;
+        }
+    }
+    let count = documents.len() as f64;
+    let idf = |term: &str| {
+        let frequency = document_frequency.get(term).copied().unwrap_or(0) as f64;
+        ((count + 1.0) / (frequency + 1.0)).ln()
+    };
+
+    let scores: Vec<f64> = documents
+        .iter()
+        .map(|document| document.iter().map(|term| idf(term)).sum())
+        .collect();
+    let max_score = scores.iter().copied().fold(0.0, f64::max);
+    if max_score <= 0.0 {
+        return;
+    }
+    for (row, score) in rows.iter_mut().zip(scores) {
+        row.rank *= 1.0 + weight * score / max_score;
+    }
+}
+
+/// Splits text into lowercase terms at non-alphanumeric characters and at
+/// camelCase boundaries: `validateUserLogin` and `validate_user_login` both
+/// yield `validate`, `user`, `login`, and `HTTPServer` yields `http`,
+/// `server`.
+pub(crate) fn tokenize(text: &str) -> impl Iterator<Item = String> + '_ {
+    text.split(|c: char| !c.is_alphanumeric())
+        .flat_map(split_camel_case)
+        .map(|word| word.to_lowercase())
+}
+
+fn split_camel_case(word: &str) -> Vec<&str> {
+    let chars: Vec<(usize, char)> = word.char_indices().collect();
+    let mut parts = Vec::new();
+    let mut start = 0;
+    for i in 1..chars.len() {
+        let (index, c) = chars[i];
+        let previous = chars[i - 1].1;
+        let next_is_lower = chars
+            .get(i + 1)
+            .is_some_and(|(_, next)| next.is_lowercase());
+        let boundary = c.is_uppercase()
+            && (previous.is_lowercase()
+                || previous.is_ascii_digit()
+                || (previous.is_uppercase() && next_is_lower));
+        if boundary {
+            parts.push(&word[start..index]);
+            start = index;
+        }
+    }
+    if start < word.len() {
+        parts.push(&word[start..]);
+    }
+    parts
+}
+
+#[cfg(test)]
+mod tests {
+    use super::tokenize;
+
+    fn terms(text: &str) -> Vec<String> {
+        tokenize(text).collect()
+    }
+
+    #[test]
+    fn splits_camel_and_snake_case() {
+        assert_eq!(
+            terms("validateUserLogin"),
+            vec!["validate", "user", "login"]
+        );
+        assert_eq!(
+            terms("validate_user_login"),
+            vec!["validate", "user", "login"]
+        );
+        assert_eq!(terms("HTTPServer"), vec!["http", "server"]);
+        assert_eq!(
+            terms("src/auth/LoginForm.tsx"),
+            vec!["src", "auth", "login", "form", "tsx"]
+        );
+    }
+}
@@ -0,0 +1,206 @@
+use std::fmt;
+use std::path::Path;
+
+use serde::Serialize;
+
+use cruxlines::{Cycle, FileRank, Language, Location, Spur, SymbolGraph};
+
+use crate::display_path;
+
+/// One dependency cycle in `--report cycles --format json` output.
+///
+/// Members of a file cycle only have a `file`; members of a symbol cycle
+/// also have the `line`, `column` and `symbol` of the definition. Each edge
+/// goes from a member to a member it depends on.
+#[derive(Debug, Serialize)]
+pub(crate) struct JsonCycle {
+    pub(crate) members: Vec<JsonCycleMember>,
+    pub(crate) edges: Vec<JsonCycleEdge>,
+}
+
+#[derive(Clone, Debug, Serialize)]
+pub(crate) struct JsonCycleMember {
+    pub(crate) file: String,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub(crate) line: Option<usize>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub(crate) column: Option<usize>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub(crate) symbol: Option<String>,
+}
+
+#[derive(Debug, Serialize)]
+pub(crate) struct JsonCycleEdge {
+    pub(crate) from: JsonCycleMember,
+    pub(crate) to: JsonCycleMember,
+}
+
+impl JsonCycle {
+    fn new<T>(cycle: &Cycle<T>, member: impl Fn(&T) -> JsonCycleMember) -> Self {
+        Self {
+            members: cycle.members.iter().map(&member).collect(),
+            edges: cycle
+                .edges
+                .iter()
+                .map(|(from, to)| JsonCycleEdge {
+                    from: member(from),
+                    to: member(to),
+                })
+                .collect(),
+        }
+    }
+
+    pub(crate) fn from_files(cycle: &Cycle<Spur>, repo_root: &Path) -> Self {
+        Self::new(cycle, |path| JsonCycleMember {
+            file: display_path(cruxlines::intern::resolve(*path), repo_root),
+            line: None,
+            column: None,
+            symbol: None,
+        })
+    }
+
+    pub(crate) fn from_symbols(cycle: &Cycle<Location>, repo_root: &Path) -> Self {
+        Self::new(cycle, |definition| JsonCycleMember {
+            file: display_path(definition.path_str(), repo_root),
+            line: Some(definition.line),
+            column: Some(definition.column),
+            symbol: Some(definition.name_str().to_string()),
+        })
+    }
+}
+
+/// Prints the cycle as `cycle of <n> files:` (or `symbols:`) followed by one
+/// indented `<member> -> <dependency>` line per edge.
+impl fmt::Display for JsonCycle {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        let unit = match self.members.first() {
+            Some(member) if member.symbol.is_some() => "symbols",
+            _ => "files",
+        };
+        write!(f, "cycle of {} {unit}:", self.members.len())?;
+        for edge in &self.edges {
+            write!(f, "\n  {} -> {}", edge.from, edge.to)?;
+        }
+        Ok(())
+    }
+}
+
+/// `file` for files, `file:line:column: symbol` for definitions.
+impl fmt::Display for JsonCycleMember {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "{}", self.file)?;
+        if let (Some(line), Some(column), Some(symbol)) = (self.line, self.column, &self.symbol) {
+            write!(f, ":{line}:{column}: {symbol}")?;
+        }
+        Ok(())
+    }
+}
+
+/// `--report graph --format dot` output: one node per definition, labeled
+/// `file::symbol`, and one edge from each definition to each definition it
+/// references.
+#[derive(Debug)]
+pub(crate) struct DotGraph {
+    labels: Vec<String>,
+    edges: Vec<(usize, usize, usize)>,
+    weights: bool,
+}
+
+impl DotGraph {
+    pub(crate) fn new(graph: &SymbolGraph, repo_root: &Path, weights: bool) -> Self {
+        Self {
+            labels: graph
+                .nodes
+                .iter()
+                .map(|(definition, _)| {
+                    format!(
+                        "{}::{}",
+                        display_path(definition.path_str(), repo_root),
+                        definition.name_str()
+                    )
+                })
+                .collect(),
+            edges: graph.edges.clone(),
+            weights,
+        }
+    }
+}
+
+/// Nodes are `n<rank order>`, so the same run always prints the same graph;
+/// with `weights`, edges are labeled with their reference count.
+impl fmt::Display for DotGraph {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        writeln!(f, "digraph cruxlines {{")?;
+        writeln!(f, "  node [shape=box];")?;
+        for (index, label) in self.labels.iter().enumerate() {
+            writeln!(f, "  n{index} [label=\"{}\"];", escape_dot(label))?;
+        }
+        for (from, to, references) in &self.edges {
+            if self.weights {
+                writeln!(f, "  n{from} -> n{to} [label=\"{references}\"];")?;
+            } else {
+                writeln!(f, "  n{from} -> n{to};")?;
+            }
+        }
+        writeln!(f, "}}")
+    }
+}
+
+/// Escapes `text` for a double-quoted DOT string.
+fn escape_dot(text: &str) -> String {
+    text.replace('\\', "\\\\").replace('"', "\\\"")
+}
+
+/// One ranked file in `--granularity file --format json` output. `score`
+/// is the sum or the highest of the scores of the file's `definitions`,
+/// per `--file-score`.
+#[derive(Debug, Serialize)]
+pub(crate) struct JsonFileRank {
+    pub(crate) file: String,
+    pub(crate) score: f64,
+    pub(crate) definitions: usize,
+}
+
+impl JsonFileRank {
+    pub(crate) fn new(file: &FileRank, repo_root: &Path) -> Self {
+        Self {
+            file: display_path(file.path_str(), repo_root),
+            score: file.score,
+            definitions: file.definitions,
+        }
+    }
+}
+
+/// `file: score=<score> definitions=<n>`.
+impl fmt::Display for JsonFileRank {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(
+            f,
+            "{}: score={:.6} definitions={}",
+            self.file, self.score, self.definitions
+        )
+    }
+}
+
+/// One file in `--list-files --format json` output.
+#[derive(Debug, Serialize)]
+pub(crate) struct JsonFile {
+    pub(crate) file: String,
+    pub(crate) language: &'static str,
+}
+
+impl JsonFile {
+    pub(crate) fn new(path: &Path, language: Language, repo_root: &Path) -> Self {
+        Self {
+            file: display_path(&path.to_string_lossy(), repo_root),
+            language: language.name(),
+        }
+    }
+}
+
+/// `file: language`, like the `file:line:column: text` of crux lines.
+impl fmt::Display for JsonFile {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "{}: {}", self.file, self.language)
+    }
+}
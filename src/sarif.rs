@@ -0,0 +1,150 @@
+use serde::Serialize;
+
+use crate::cli::JsonRow;
+
+const SARIF_VERSION: &str = "2.1.0";
+const SARIF_SCHEMA: &str = "https://json.schemastore.org/sarif-2.1.0.json";
+const RULE_ID: &str = "crux-line";
+
+/// A SARIF 2.1.0 log with one run, as ingested by GitHub code scanning.
+///
+/// Only the parts of the format cruxlines fills in are modeled; each crux
+/// line is a `note` result whose properties carry the same fields as the
+/// `--format json` row.
+#[derive(Debug, Serialize)]
+pub(crate) struct SarifLog {
+    #[serde(rename = "$schema")]
+    schema: &'static str,
+    version: &'static str,
+    runs: Vec<Run>,
+}
+
+#[derive(Debug, Serialize)]
+#[serde(rename_all = "camelCase")]
+struct Run {
+    tool: Tool,
+    results: Vec<SarifResult>,
+    /// How `startColumn` counts: cruxlines columns count characters (code
+    /// points), not the UTF-16 code units some SARIF consumers default to.
+    column_kind: &'static str,
+}
+
+#[derive(Debug, Serialize)]
+struct Tool {
+    driver: Driver,
+}
+
+#[derive(Debug, Serialize)]
+#[serde(rename_all = "camelCase")]
+struct Driver {
+    name: &'static str,
+    version: &'static str,
+    information_uri: &'static str,
+    rules: Vec<Rule>,
+}
+
+#[derive(Debug, Serialize)]
+#[serde(rename_all = "camelCase")]
+struct Rule {
+    id: &'static str,
+    short_description: Message,
+}
+
+#[derive(Debug, Serialize)]
+struct Message {
+    text: String,
+}
+
+#[derive(Debug, Serialize)]
+#[serde(rename_all = "camelCase")]
+struct SarifResult {
+    rule_id: &'static str,
+    level: &'static str,
+    message: Message,
+    locations: Vec<ResultLocation>,
+    properties: JsonRow,
+}
+
+#[derive(Debug, Serialize)]
+#[serde(rename_all = "camelCase")]
+struct ResultLocation {
+    physical_location: PhysicalLocation,
+}
+
+#[derive(Debug, Serialize)]
+#[serde(rename_all = "camelCase")]
+struct PhysicalLocation {
+    artifact_location: ArtifactLocation,
+    region: Region,
+}
+
+#[derive(Debug, Serialize)]
+#[serde(rename_all = "camelCase")]
+struct ArtifactLocation {
+    uri: String,
+    uri_base_id: &'static str,
+}
+
+#[derive(Debug, Serialize)]
+#[serde(rename_all = "camelCase")]
+struct Region {
+    start_line: usize,
+    start_column: usize,
+}
+
+impl SarifLog {
+    /// Wraps rows already converted for JSON output; `file` paths are
+    /// relative to the repo root, which SARIF calls `%SRCROOT%`.
+    pub(crate) fn new(rows: Vec<JsonRow>) -> Self {
+        let results = rows
+            .into_iter()
+            .map(|row| SarifResult {
+                rule_id: RULE_ID,
+                level: "note",
+                message: Message {
+                    text: format!(
+                        "`{}` is a crux line ({}, score {:.6})",
+                        row.symbol,
+                        row.kind.as_str(),
+                        row.score
+                    ),
+                },
+                locations: vec![ResultLocation {
+                    physical_location: PhysicalLocation {
+                        artifact_location: ArtifactLocation {
+                            uri: row.file.replace('\\', "/"),
+                            uri_base_id: "%SRCROOT%",
+                        },
+                        region: Region {
+                            start_line: row.line,
+                            start_column: row.column,
+                        },
+                    },
+                }],
+                properties: row,
+            })
+            .collect();
+        Self {
+            schema: SARIF_SCHEMA,
+            version: SARIF_VERSION,
+            runs: vec![Run {
+                tool: Tool {
+                    driver: Driver {
+                        name: env!("CARGO_PKG_NAME"),
+                        version: env!("CARGO_PKG_VERSION"),
+                        information_uri: env!("CARGO_PKG_REPOSITORY"),
+                        rules: vec![Rule {
+                            id: RULE_ID,
+                            short_description: Message {
+                                text: "Definition that much of the code base depends on"
+                                    .to_string(),
+                            },
+                        }],
+                    },
+                },
+                results,
+                column_kind: "unicodeCodePoints",
+            }],
+        }
+    }
+}
@@ -0,0 +1,101 @@
+use std::collections::HashMap;
+
+use lasso::Spur;
+
+use crate::analysis::OutputRow;
+
+/// Longest definition body included in a snippet; longer bodies are cut off
+/// after this many lines, without trailing context.
+pub(crate) const MAX_SNIPPET_BODY_LINES: usize = 40;
+
+/// Source lines around a crux line.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Snippet {
+    /// 1-based line number of the first line in `lines`.
+    pub start_line: usize,
+    pub lines: Vec<String>,
+}
+
+impl Snippet {
+    /// 1-based line number of the last line in `lines`.
+    pub fn end_line(&self) -> usize {
+        self.start_line + self.lines.len().saturating_sub(1)
+    }
+}
+
+/// Sets each row's snippet to its declaration (capped at
+/// [`MAX_SNIPPET_BODY_LINES`]) plus `context` lines before and after, taken
+/// from the sources read during the analysis.
+pub(crate) fn attach_snippets(
+    rows: &mut [OutputRow],
+    sources: &HashMap<Spur, String>,
+    context: usize,
+) {
+    let mut file_lines: HashMap<Spur, Vec<&str>> = HashMap::new();
+    for row in rows {
+        let Some(source) = sources.get(&row.definition.path) else {
+            continue;
+        };
+        let lines = file_lines
+            .entry(row.definition.path)
+            .or_insert_with(|| source.lines().collect());
+        row.snippet = snippet(lines, row.definition.line, row.end_line, context);
+    }
+}
+
+fn snippet(lines: &[&str], line: usize, end_line: usize, context: usize) -> Option<Snippet> {
+    if line == 0 || line > lines.len() {
+        return None;
+    }
+    let body_end = end_line.max(line).min(line + MAX_SNIPPET_BODY_LINES - 1);
+    let last = if body_end < end_line {
+        body_end
+    } else {
+        body_end.saturating_add(context)
+    };
+    let first = line.saturating_sub(context).max(1);
+    let last = last.min(lines.len());
+    Some(Snippet {
+        start_line: first,
+        lines: lines[first - 1..last]
+            .iter()
+            .map(|line| line.to_string())
+            .collect(),
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::{MAX_SNIPPET_BODY_LINES, snippet};
+
+    #[test]
+    fn clamps_context_to_file_bounds() {
+        let lines = ["def add():", "    return 1"];
+        let snippet = snippet(&lines, 1, 2, 5).expect("snippet");
+        assert_eq!(snippet.start_line, 1);
+        assert_eq!(snippet.lines, vec!["def add():", "    return 1"]);
+        assert_eq!(snippet.end_line(), 2);
+    }
+
+    #[test]
+    fn includes_context_around_the_declaration() {
+        let lines = ["a", "b", "c", "d", "e", "f"];
+        let snippet = snippet(&lines, 3, 4, 1).expect("snippet");
+        assert_eq!(snippet.start_line, 2);
+        assert_eq!(snippet.lines, vec!["b", "c", "d", "e"]);
+    }
+
+    #[test]
+    fn caps_long_bodies() {
+        let lines: Vec<String> = (1..=100).map(|n| n.to_string()).collect();
+        let lines: Vec<&str> = lines.iter().map(String::as_str).collect();
+        let snippet = snippet(&lines, 10, 90, 2).expect("snippet");
+        assert_eq!(snippet.start_line, 8);
+        assert_eq!(snippet.end_line(), 10 + MAX_SNIPPET_BODY_LINES - 1);
+    }
+
+    #[test]
+    fn skips_lines_past_the_end_of_the_file() {
+        assert_eq!(snippet(&["a"], 3, 3, 1), None);
+    }
+}
@@ -0,0 +1,112 @@
+use std::collections::HashSet;
+use std::path::{Path, PathBuf};
+use std::sync::mpsc;
+use std::time::Duration;
+
+use notify::{Event, RecursiveMode, Watcher};
+
+use crate::analysis::{CruxLine, absolute_paths, analyze_files, path_filter};
+use crate::io::{CruxlinesError, IGNORE_FILE_NAME, find_repo_root, gather_paths};
+use crate::languages::project_files::is_project_file;
+use crate::options::Options;
+use crate::profile::Profile;
+
+/// How long the tree must stay quiet before a burst of changes (e.g. a
+/// formatter rewriting many files) triggers a single refresh.
+const DEBOUNCE: Duration = Duration::from_millis(200);
+
+/// Analyzes `paths` and calls `on_update` with the result, then again after
+/// every batch of file changes until the watcher shuts down.
+///
+/// Only changes to files that an analysis would read, or to the ignore and
+/// project files that steer it, trigger a refresh, so gitignored files and
+/// editor temp files are ignored. Unchanged files are served from the parse
+/// cache when `options.use_cache` is set.
+pub fn watch(
+    paths: &[PathBuf],
+    options: &Options,
+    mut on_update: impl FnMut(Result<Vec<CruxLine>, CruxlinesError>),
+) -> Result<(), CruxlinesError> {
+    if options.git_ref.is_some() {
+        return Err(CruxlinesError::Git {
+            message: "--git-ref cannot be watched; watch mode reads the working tree".to_string(),
+        });
+    }
+    let roots = absolute_paths(paths);
+    let repo_root = roots.first().and_then(|root| find_repo_root(root));
+    let filter = path_filter(&roots, repo_root.as_deref(), options)?;
+
+    let (sender, receiver) = mpsc::channel();
+    let mut watcher =
+        notify::recommended_watcher(sender).map_err(|source| CruxlinesError::Watch { source })?;
+    for root in &roots {
+        watcher
+            .watch(root, RecursiveMode::Recursive)
+            .map_err(|source| CruxlinesError::Watch { source })?;
+    }
+
+    let mut files = gather_paths(
+        &roots,
+        &options.ecosystems,
+        &options.languages,
+        &filter,
+        options.follow_symlinks,
+    );
+    on_update(analyze_files(
+        files.clone(),
+        repo_root.clone(),
+        options,
+        &mut Profile::default(),
+    ));
+
+    while let Ok(event) = receiver.recv() {
+        let mut changed = HashSet::new();
+        collect_changed(event, &mut changed);
+        while let Ok(event) = receiver.recv_timeout(DEBOUNCE) {
+            collect_changed(event, &mut changed);
+        }
+
+        // Checking both walks catches deleted files as well as new ones.
+        let current = gather_paths(
+            &roots,
+            &options.ecosystems,
+            &options.languages,
+            &filter,
+            options.follow_symlinks,
+        );
+        let relevant = files != current
+            || changed.iter().any(|path| steers_analysis(path))
+            || files
+                .iter()
+                .chain(&current)
+                .any(|path| changed.contains(path));
+        files = current;
+        if relevant {
+            on_update(analyze_files(
+                files.clone(),
+                repo_root.clone(),
+                options,
+                &mut Profile::default(),
+            ));
+        }
+    }
+    Ok(())
+}
+
+/// Whether `path` changes the analysis without being analyzed: ignore files
+/// decide which files are walked, project files such as `tsconfig.json` how
+/// their imports resolve.
+fn steers_analysis(path: &Path) -> bool {
+    is_project_file(path)
+        || path
+            .file_name()
+            .is_some_and(|name| name == ".gitignore" || name == IGNORE_FILE_NAME)
+}
+
+fn collect_changed(event: notify::Result<Event>, changed: &mut HashSet<PathBuf>) {
+    if let Ok(event) = event
+        && !event.kind.is_access()
+    {
+        changed.extend(event.paths);
+    }
+}
@@ -154,6 +154,136 @@ fn library_cruxlines_scans_repo_root() {
     let _ = std::fs::remove_dir_all(&dir);
 }
 
+#[test]
+fn library_analyze_accepts_files_and_directories() {
+    let dir = temp_dir_path("cruxlines-lib-analyze");
+    std::fs::create_dir_all(dir.join("pkg")).expect("create temp dir");
+    git_init(&dir);
+    std::fs::write(
+        dir.join("pkg/lib.py"),
+        "def add():\n    return 1\n\ndef sub():\n    return 2\n",
+    )
+    .expect("write lib");
+    std::fs::write(
+        dir.join("main.py"),
+        "from pkg.lib import add, sub\n\nadd()\nadd()\nsub()\n",
+    )
+    .expect("write main");
+    std::fs::write(dir.join("other.js"), "export function unused() {}\n").expect("write js");
+    git_commit(&dir, "init", "2001-01-01T00:00:00Z");
+
+    let options = cruxlines::Options {
+        ecosystems: [cruxlines::Ecosystem::Python].into(),
+        ..cruxlines::Options::default()
+    };
+    let paths = [dir.join("pkg"), dir.join("main.py"), dir.join("other.js")];
+    let rows = cruxlines::analyze(&paths, &options).expect("analyze");
+    let names: Vec<&str> = rows.iter().map(|row| row.definition.name_str()).collect();
+    assert!(names.contains(&"add"), "expected add, got: {names:?}");
+    assert!(
+        !names.contains(&"unused"),
+        "expected js filtered, got: {names:?}"
+    );
+
+    let limited = cruxlines::analyze(
+        &paths,
+        &cruxlines::Options {
+            limit: Some(1),
+            ..options
+        },
+    )
+    .expect("analyze");
+    assert_eq!(limited.len(), 1);
+    assert_eq!(limited[0].definition, rows[0].definition);
+
+    let _ = std::fs::remove_dir_all(&dir);
+}
+
+#[cfg(unix)]
+#[test]
+fn library_walks_symlink_loops_once() {
+    let dir = temp_dir_path("cruxlines-symlinks");
+    std::fs::create_dir_all(dir.join("releases/v3")).expect("create temp dir");
+    git_init(&dir);
+    std::fs::write(
+        dir.join("releases/v3/app.py"),
+        "def serve():\n    pass\n\nserve()\n",
+    )
+    .expect("write app");
+    std::os::unix::fs::symlink("releases/v3", dir.join("current")).expect("link current");
+    std::os::unix::fs::symlink("../..", dir.join("releases/v3/root")).expect("link root");
+
+    for follow_symlinks in [false, true] {
+        let options = cruxlines::Options {
+            ecosystems: [cruxlines::Ecosystem::Python].into(),
+            follow_symlinks,
+            ..cruxlines::Options::default()
+        };
+        let paths = [dir.clone()];
+        let (sender, receiver) = std::sync::mpsc::channel();
+        std::thread::spawn(move || {
+            let _ = sender.send(cruxlines::analyze(&paths, &options));
+        });
+        let rows = receiver
+            .recv_timeout(std::time::Duration::from_secs(60))
+            .expect("analysis terminates")
+            .expect("analyze");
+
+        let serve: Vec<_> = rows
+            .iter()
+            .filter(|row| row.definition.name_str() == "serve")
+            .collect();
+        assert_eq!(serve.len(), 1, "follow_symlinks={follow_symlinks}");
+        assert!(
+            serve[0]
+                .definition
+                .path_str()
+                .ends_with("releases/v3/app.py"),
+            "got: {}",
+            serve[0].definition.path_str()
+        );
+        assert_eq!(
+            serve[0].references.len(),
+            1,
+            "follow_symlinks={follow_symlinks}"
+        );
+    }
+
+    let _ = std::fs::remove_dir_all(&dir);
+}
+
+#[test]
+fn cli_limits_output_rows() {
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--ecosystem", "python", "--limit", "2"])
+        .current_dir(repo_root());
+    let output = cmd.assert().success().get_output().stdout.clone();
+    let output = String::from_utf8(output).expect("utf8 output");
+    assert_eq!(
+        output.lines().count(),
+        2,
+        "expected two rows, got: {output}"
+    );
+}
+
+#[test]
+fn cli_caps_rows_per_file() {
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--ecosystem", "python", "--max-per-file", "1"])
+        .current_dir(repo_root());
+    let output = cmd.assert().success().get_output().stdout.clone();
+    let output = String::from_utf8(output).expect("utf8 output");
+    let mut paths = std::collections::HashSet::new();
+    for line in output.lines() {
+        let path = line.split(':').next().expect("path");
+        assert!(
+            paths.insert(path),
+            "expected one row per file, got: {output}"
+        );
+    }
+    assert!(!paths.is_empty());
+}
+
 #[test]
 fn cli_outputs_non_uniform_pagerank_scores() {
     let output = run_cli_output_with_metadata();
@@ -209,177 +339,1360 @@ fn cli_hides_references_without_flag() {
 }
 
 #[test]
-fn cli_filters_by_ecosystem() {
-    let mut cmd = cargo_bin_cmd!("cruxlines");
-    cmd.args(["--ecosystem", "python"]).current_dir(repo_root());
-    let output = cmd.assert().success().get_output().stdout.clone();
-    let output = String::from_utf8(output).expect("utf8 output");
+fn cli_filters_by_ecosystem() {
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--ecosystem", "python"]).current_dir(repo_root());
+    let output = cmd.assert().success().get_output().stdout.clone();
+    let output = String::from_utf8(output).expect("utf8 output");
+    assert!(
+        output.contains("src/languages/python/fixtures"),
+        "expected python fixtures in output, got: {output}"
+    );
+    assert!(
+        !output.contains("src/languages/javascript/fixtures"),
+        "expected javascript fixtures to be filtered out, got: {output}"
+    );
+}
+
+#[test]
+fn cli_supports_ecosystem_short_flag() {
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["-e", "python"]).current_dir(repo_root());
+    let output = cmd.assert().success().get_output().stdout.clone();
+    let output = String::from_utf8(output).expect("utf8 output");
+    assert!(
+        output.contains("src/languages/python/fixtures"),
+        "expected python fixtures in output, got: {output}"
+    );
+    assert!(
+        !output.contains("src/languages/javascript/fixtures"),
+        "expected javascript fixtures to be filtered out, got: {output}"
+    );
+}
+
+#[test]
+fn cli_accepts_ecosystem_aliases() {
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--ecosystem", "py"]).current_dir(repo_root());
+    let output = cmd.assert().success().get_output().stdout.clone();
+    let output = String::from_utf8(output).expect("utf8 output");
+    assert!(
+        output.contains("src/languages/python/fixtures"),
+        "expected python fixtures in output, got: {output}"
+    );
+    assert!(
+        !output.contains("src/languages/javascript/fixtures"),
+        "expected javascript fixtures to be filtered out, got: {output}"
+    );
+}
+
+#[test]
+fn cli_filters_by_language() {
+    let run = |args: &[&str]| {
+        let mut cmd = cargo_bin_cmd!("cruxlines");
+        cmd.args(args).current_dir(repo_root());
+        let output = cmd.assert().success().get_output().stdout.clone();
+        String::from_utf8(output).expect("utf8 output")
+    };
+
+    let output = run(&["--languages", "kotlin,go"]);
+    assert!(
+        output.contains("src/languages/kotlin/fixtures"),
+        "expected kotlin fixtures in output, got: {output}"
+    );
+    assert!(
+        output.contains("src/languages/go/fixtures"),
+        "expected go fixtures in output, got: {output}"
+    );
+    assert!(
+        !output.contains("src/languages/java/fixtures"),
+        "expected java fixtures to be filtered out, got: {output}"
+    );
+
+    let output = run(&["--ecosystem", "js", "--exclude-languages", "typescript"]);
+    assert!(
+        output.contains(".js:"),
+        "expected javascript files in output, got: {output}"
+    );
+    assert!(
+        !output.contains(".ts:") && !output.contains(".tsx:"),
+        "expected typescript files to be filtered out, got: {output}"
+    );
+
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--languages", "go,cobol"])
+        .current_dir(repo_root());
+    cmd.assert()
+        .failure()
+        .stderr(contains("'cobol'").and(contains("kotlin")));
+}
+
+#[test]
+fn cli_filters_by_kind() {
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--kinds", "function,method", "--format", "json"])
+        .current_dir(repo_root());
+    let output = cmd.assert().success().get_output().stdout.clone();
+    let json: serde_json::Value = serde_json::from_slice(&output).expect("valid json");
+    let rows = json.as_array().expect("json array");
+    assert!(!rows.is_empty(), "expected some functions");
+    assert!(
+        rows.iter()
+            .all(|row| row["kind"] == "function" || row["kind"] == "method"),
+        "expected only functions and methods, got: {json}"
+    );
+
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.arg("--help");
+    cmd.assert()
+        .success()
+        .stdout(contains("--kinds").and(contains("constant")));
+}
+
+#[test]
+fn cli_outputs_paths_relative_to_repo_root() {
+    let dir = temp_dir_path("cruxlines-relpath");
+    std::fs::create_dir_all(&dir).expect("create temp dir");
+    git_init(&dir);
+    std::fs::write(dir.join("main.py"), "def add():\n    return 1\n\nadd()\n").expect("write main");
+    git_commit(&dir, "init", "2001-01-01T00:00:00Z");
+
+    let subdir = dir.join("sub");
+    std::fs::create_dir_all(&subdir).expect("create subdir");
+
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--ecosystem", "py"]).current_dir(&subdir);
+    let output = cmd.assert().success().get_output().stdout.clone();
+    let output = String::from_utf8(output).expect("utf8 output");
+    assert!(
+        output.contains("main.py:1:5:"),
+        "expected output paths relative to repo root, got: {output}"
+    );
+    assert!(
+        !output.contains(&dir.display().to_string()),
+        "expected output paths to avoid absolute repo root, got: {output}"
+    );
+
+    let _ = std::fs::remove_dir_all(&dir);
+}
+
+#[test]
+fn cli_outputs_json_rows() {
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--ecosystem", "python", "--format", "json"])
+        .current_dir(repo_root());
+    let output = cmd.assert().success().get_output().stdout.clone();
+    let rows: serde_json::Value = serde_json::from_slice(&output).expect("valid json");
+    let rows = rows.as_array().expect("json array");
+    assert!(!rows.is_empty(), "expected json rows");
+
+    let add = rows
+        .iter()
+        .find(|row| {
+            row["symbol"] == "add"
+                && row["file"]
+                    .as_str()
+                    .is_some_and(|file| file.ends_with("python/fixtures/utils.py"))
+        })
+        .expect("add row");
+    assert_eq!(add["kind"], "function");
+    assert!(add["line"].as_u64().is_some_and(|line| line > 0));
+    assert!(add["column"].as_u64().is_some_and(|column| column > 0));
+    assert!(add["score"].as_f64().is_some_and(|score| score > 0.0));
+
+    let scores: Vec<f64> = rows
+        .iter()
+        .map(|row| row["score"].as_f64().expect("score"))
+        .collect();
+    assert!(
+        scores.windows(2).all(|pair| pair[0] >= pair[1]),
+        "expected json rows in rank order, got: {scores:?}"
+    );
+}
+
+#[test]
+fn cli_rejects_json_lines_outside_watch() {
+    for args in [
+        &["--format", "jsonl"][..],
+        &["--format", "ndjson", "--granularity", "file"],
+        &["--format", "jsonl", "--report", "cycles"],
+        &["--format", "jsonl", "--list-files"],
+    ] {
+        let mut cmd = cargo_bin_cmd!("cruxlines");
+        cmd.args(args).current_dir(repo_root());
+        cmd.assert()
+            .code(2)
+            .stdout("")
+            .stderr(contains("--format jsonl only streams --watch refreshes"));
+    }
+}
+
+/// Checks `value` against the SARIF 2.1.0 schema vendored under `tests/`.
+fn assert_valid_sarif(value: &serde_json::Value) {
+    let schema = std::fs::read_to_string(repo_root().join("tests/sarif-schema-2.1.0.json"))
+        .expect("read sarif schema");
+    let schema: serde_json::Value = serde_json::from_str(&schema).expect("valid schema json");
+    let validator = jsonschema::validator_for(&schema).expect("valid sarif schema");
+    let errors: Vec<String> = validator
+        .iter_errors(value)
+        .map(|err| err.to_string())
+        .collect();
+    assert!(errors.is_empty(), "invalid sarif: {errors:?}");
+}
+
+#[test]
+fn cli_outputs_sarif_log() {
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--ecosystem", "python", "--format", "sarif", "--limit", "5"])
+        .current_dir(repo_root());
+    let output = cmd.assert().success().get_output().stdout.clone();
+    let log: serde_json::Value = serde_json::from_slice(&output).expect("valid json");
+    assert_valid_sarif(&log);
+
+    let results = log["runs"][0]["results"].as_array().expect("results");
+    assert!(
+        !results.is_empty() && results.len() <= 5,
+        "expected up to 5 results, got {}",
+        results.len()
+    );
+    let first = &results[0];
+    assert_eq!(first["level"], "note");
+    assert!(
+        first["properties"]["score"]
+            .as_f64()
+            .is_some_and(|score| score > 0.0)
+    );
+    assert_eq!(
+        first["locations"][0]["physicalLocation"]["artifactLocation"]["uri"],
+        first["properties"]["file"]
+    );
+    assert_eq!(
+        first["locations"][0]["physicalLocation"]["region"]["startLine"],
+        first["properties"]["line"]
+    );
+    assert_eq!(
+        first["ruleId"],
+        log["runs"][0]["tool"]["driver"]["rules"][0]["id"]
+    );
+    assert_eq!(log["runs"][0]["columnKind"], "unicodeCodePoints");
+}
+
+#[test]
+fn cli_outputs_snippets_with_context() {
+    let dir = temp_dir_path("cruxlines-context");
+    std::fs::create_dir_all(&dir).expect("create temp dir");
+    git_init(&dir);
+    std::fs::write(
+        dir.join("lib.py"),
+        "# helpers\ndef add(a, b):\n    return a + b\n",
+    )
+    .expect("write lib");
+    std::fs::write(dir.join("main.py"), "from lib import add\n\nadd(1, 2)\n").expect("write main");
+
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--format", "json", "--context", "5"])
+        .current_dir(&dir);
+    let output = cmd.assert().success().get_output().stdout.clone();
+    let rows: serde_json::Value = serde_json::from_slice(&output).expect("valid json");
+    let add = rows
+        .as_array()
+        .expect("json array")
+        .iter()
+        .find(|row| row["symbol"] == "add")
+        .expect("add row");
+    assert_eq!(add["snippet"]["start_line"], 1);
+    assert_eq!(add["snippet"]["end_line"], 3);
+    assert_eq!(
+        add["snippet"]["text"],
+        "# helpers\ndef add(a, b):\n    return a + b"
+    );
+
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--context", "0"]).current_dir(&dir);
+    cmd.assert().success().stdout(contains(
+        "lib.py:2:5: def add(a, b):\n  2 | def add(a, b):\n  3 |     return a + b\n",
+    ));
+
+    let _ = std::fs::remove_dir_all(&dir);
+}
+
+#[test]
+fn cli_accepts_rank_modes() {
+    for mode in ["frecency", "pagerank", "hybrid"] {
+        let mut cmd = cargo_bin_cmd!("cruxlines");
+        cmd.args(["--ecosystem", "python", "--rank", mode])
+            .current_dir(repo_root());
+        let output = cmd.assert().success().get_output().stdout.clone();
+        let output = String::from_utf8(output).expect("utf8 output");
+        assert!(
+            output.contains("def add(a: int, b: int) -> int:"),
+            "expected add definition with --rank {mode}, got: {output}"
+        );
+    }
+}
+
+#[test]
+fn cli_accepts_edge_modes() {
+    for mode in ["refs", "calls"] {
+        let mut cmd = cargo_bin_cmd!("cruxlines");
+        cmd.args(["--ecosystem", "python", "--edges", mode])
+            .current_dir(repo_root());
+        let output = cmd.assert().success().get_output().stdout.clone();
+        let output = String::from_utf8(output).expect("utf8 output");
+        assert!(
+            output.contains("def add(a: int, b: int) -> int:"),
+            "expected add definition with --edges {mode}, got: {output}"
+        );
+    }
+}
+
+#[test]
+fn cli_rejects_out_of_range_pagerank_damping() {
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--rank", "pagerank", "--pagerank-damping", "1.5"])
+        .current_dir(repo_root());
+    cmd.assert()
+        .failure()
+        .stderr(contains("damping must be between 0 and 1"));
+}
+
+#[test]
+fn cli_rejects_out_of_range_min_score() {
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--min-score", "1.5"]).current_dir(repo_root());
+    cmd.assert()
+        .failure()
+        .stderr(contains("min score must be between 0 and 1"));
+}
+
+#[test]
+fn cli_rejects_negative_query_weight() {
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--query", "add", "--query-weight", "-1"])
+        .current_dir(repo_root());
+    cmd.assert()
+        .failure()
+        .stderr(contains("query weight must be 0 or more"));
+}
+
+#[test]
+fn cli_validates_frecency_half_life() {
+    for (value, message) in [
+        ("0s", "half-life must be greater than 0"),
+        ("-3d", "is not a duration"),
+    ] {
+        let mut cmd = cargo_bin_cmd!("cruxlines");
+        cmd.arg(format!("--frecency-half-life={value}"))
+            .current_dir(repo_root());
+        cmd.assert().failure().stderr(contains(message));
+    }
+
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--frecency-half-life", "3d", "-n", "1"])
+        .current_dir(repo_root());
+    cmd.assert().success();
+}
+
+#[test]
+fn cli_rejects_invalid_exclude_glob() {
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--exclude", "vendor/[a"])
+        .current_dir(repo_root());
+    cmd.assert()
+        .failure()
+        .stderr(contains("invalid glob `vendor/[a`"));
+}
+
+#[test]
+fn cli_query_boosts_matching_definitions() {
+    let dir = temp_dir_path("cruxlines-query");
+    std::fs::create_dir_all(&dir).expect("create temp dir");
+    git_init(&dir);
+    std::fs::write(
+        dir.join("lib.py"),
+        "def parse_config():\n    return 1\n\ndef validateUserLogin():\n    return 2\n",
+    )
+    .expect("write lib");
+    std::fs::write(
+        dir.join("main.py"),
+        "from lib import parse_config, validateUserLogin\n\nparse_config()\nparse_config()\nvalidateUserLogin()\n",
+    )
+    .expect("write main");
+
+    let first = |args: &[&str]| -> Option<String> {
+        let mut cmd = cargo_bin_cmd!("cruxlines");
+        cmd.args(args).current_dir(&dir);
+        let output = cmd.assert().success().get_output().stdout.clone();
+        String::from_utf8(output)
+            .expect("utf8 output")
+            .lines()
+            .find_map(name_from_line)
+            .map(str::to_string)
+    };
+
+    assert_eq!(first(&["--metadata"]).as_deref(), Some("parse_config"));
+    assert_eq!(
+        first(&["--metadata", "--query", "user authentication login"]).as_deref(),
+        Some("validateUserLogin")
+    );
+
+    let _ = std::fs::remove_dir_all(&dir);
+}
+
+#[test]
+fn cli_outputs_empty_json_array_without_rows() {
+    let dir = temp_dir_path("cruxlines-json-empty");
+    std::fs::create_dir_all(&dir).expect("create temp dir");
+    std::fs::create_dir_all(dir.join(".git")).expect("create git dir");
+
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--format", "json"]).current_dir(&dir);
+    let output = cmd.assert().success().get_output().stdout.clone();
+    let rows: serde_json::Value = serde_json::from_slice(&output).expect("valid json");
+    assert_eq!(rows, serde_json::json!([]));
+
+    let _ = std::fs::remove_dir_all(&dir);
+}
+
+#[test]
+fn cli_counts_crux_lines() {
+    let dir = temp_dir_path("cruxlines-count");
+    std::fs::create_dir_all(&dir).expect("create temp dir");
+    git_init(&dir);
+
+    let count = |args: &[&str]| {
+        let mut cmd = cargo_bin_cmd!("cruxlines");
+        cmd.arg("--count").args(args).current_dir(&dir);
+        let output = cmd.assert().success().get_output().stdout.clone();
+        String::from_utf8(output).expect("utf8 output")
+    };
+
+    assert_eq!(count(&[]), "0\n", "an empty result is not an error");
+
+    std::fs::write(
+        dir.join("lib.py"),
+        "def alpha():\n    pass\n\ndef beta():\n    pass\n",
+    )
+    .expect("write lib");
+    std::fs::write(
+        dir.join("main.py"),
+        "from lib import alpha, beta\n\nalpha()\nbeta()\n",
+    )
+    .expect("write main");
+    assert_eq!(count(&[]), "2\n");
+    assert_eq!(count(&["-n", "1"]), "1\n");
+
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--count", "--watch"]).current_dir(&dir);
+    cmd.assert().code(2);
+
+    let _ = std::fs::remove_dir_all(&dir);
+}
+
+#[test]
+fn cli_profiles_phases_to_stderr() {
+    let dir = temp_dir_path("cruxlines-profile");
+    std::fs::create_dir_all(&dir).expect("create temp dir");
+    git_init(&dir);
+    std::fs::write(dir.join("lib.py"), "def alpha():\n    pass\n").expect("write lib");
+    std::fs::write(dir.join("main.py"), "from lib import alpha\n\nalpha()\n").expect("write main");
+
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--profile", "--no-cache", "--format", "json"])
+        .current_dir(&dir);
+    let assert = cmd.assert().success();
+    let output = assert.get_output();
+    let rows: serde_json::Value = serde_json::from_slice(&output.stdout).expect("valid json");
+    assert_eq!(rows.as_array().map(Vec::len), Some(1));
+    let stderr = String::from_utf8(output.stderr.clone()).expect("utf8 stderr");
+    for expected in [
+        "cruxlines: profile",
+        "walk",
+        "files=2 cached=0",
+        "nodes=2 edges=1",
+        "definitions=1",
+        "total",
+    ] {
+        assert!(
+            stderr.contains(expected),
+            "missing {expected:?} in {stderr}"
+        );
+    }
+
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--profile", "--list-files"]).current_dir(&dir);
+    cmd.assert().code(2);
+
+    let _ = std::fs::remove_dir_all(&dir);
+}
+
+#[test]
+fn cli_focuses_on_one_file() {
+    let dir = temp_dir_path("cruxlines-focus");
+    std::fs::create_dir_all(dir.join("auth")).expect("create temp dir");
+    git_init(&dir);
+    std::fs::write(dir.join("auth/tokens.py"), "def sign():\n    pass\n").expect("write tokens");
+    std::fs::write(
+        dir.join("auth/session.py"),
+        "from tokens import sign\n\ndef login():\n    return sign()\n",
+    )
+    .expect("write session");
+    std::fs::write(dir.join("billing.py"), "def total():\n    pass\n").expect("write billing");
+    std::fs::write(
+        dir.join("report.py"),
+        "from billing import total\n\ntotal()\ntotal()\n",
+    )
+    .expect("write report");
+
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--focus", "auth/session.py", "--no-cache"])
+        .current_dir(&dir);
+    let output = cmd.assert().success().get_output().stdout.clone();
+    let output = String::from_utf8(output).expect("utf8 output");
+    assert!(
+        output.contains("auth/tokens.py:1:5: def sign():"),
+        "{output}"
+    );
+    assert!(!output.contains("billing.py"), "{output}");
+
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--focus", "auth/missing.py"]).current_dir(&dir);
+    cmd.assert()
+        .code(2)
+        .stderr(contains("--focus auth/missing.py: no such file"));
+
+    let _ = std::fs::remove_dir_all(&dir);
+}
+
+#[test]
+fn cli_ranks_tests_only_with_tests_only() {
+    let dir = temp_dir_path("cruxlines-tests-only");
+    std::fs::create_dir_all(&dir).expect("create temp dir");
+    git_init(&dir);
+    std::fs::write(dir.join("tokens.go"), "package auth\n\nfunc Sign() {}\n")
+        .expect("write tokens");
+    std::fs::write(
+        dir.join("session.go"),
+        "package auth\n\nfunc Login() {\n\tSign()\n}\n",
+    )
+    .expect("write session");
+    std::fs::write(
+        dir.join("tokens_test.go"),
+        "package auth\n\nfunc TestSign() {\n\tSign()\n}\n",
+    )
+    .expect("write test");
+
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--no-cache"]).current_dir(&dir);
+    let output = cmd.assert().success().get_output().stdout.clone();
+    let output = String::from_utf8(output).expect("utf8 output");
+    assert!(output.contains("tokens.go:3:6: func Sign() {}"), "{output}");
+    assert!(!output.contains("tokens_test.go"), "{output}");
+
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--tests", "only", "--no-cache"])
+        .current_dir(&dir);
+    let output = cmd.assert().success().get_output().stdout.clone();
+    let output = String::from_utf8(output).expect("utf8 output");
+    assert_eq!(
+        output.trim(),
+        "tokens_test.go:3:6: func TestSign() {",
+        "{output}"
+    );
+
+    let _ = std::fs::remove_dir_all(&dir);
+}
+
+#[test]
+fn cli_skips_unknown_extension_inputs() {
+    let dir = temp_dir_path("cruxlines-ignore-ext");
+    std::fs::create_dir_all(&dir).expect("create temp dir");
+    std::fs::create_dir_all(dir.join(".git")).expect("create git dir");
+    std::fs::write(
+        dir.join("main.py"),
+        "def add(a, b):\n    return a + b\n\nadd(1, 2)\n",
+    )
+    .expect("write main");
+    std::fs::write(dir.join("ignore.txt"), "not source").expect("write temp file");
+
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.current_dir(&dir);
+    let output = cmd.assert().success().get_output().stdout.clone();
+    let output = String::from_utf8(output).expect("utf8 output");
+    assert!(
+        output.contains("main.py"),
+        "expected output to include main.py, got: {output}"
+    );
+    assert!(
+        !output.contains("ignore.txt"),
+        "expected ignore.txt to be skipped, got: {output}"
+    );
+
+    let _ = std::fs::remove_file(dir.join("ignore.txt"));
+    let _ = std::fs::remove_file(dir.join("main.py"));
+    let _ = std::fs::remove_dir(dir.join(".git"));
+    let _ = std::fs::remove_dir(&dir);
+}
+
+#[test]
+fn cli_skips_non_utf8_inputs() {
+    let dir = temp_dir_path("cruxlines-binary");
+    std::fs::create_dir_all(&dir).expect("create temp dir");
+    std::fs::create_dir_all(dir.join(".git")).expect("create git dir");
+    std::fs::write(
+        dir.join("main.py"),
+        "def add(a, b):\n    return a + b\n\nadd(1, 2)\n",
+    )
+    .expect("write main");
+    std::fs::write(dir.join("binary.py"), [0xff, 0xfe, 0xfd]).expect("write temp file");
+
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.current_dir(&dir);
+    let output = cmd.assert().success().get_output().stdout.clone();
+    let output = String::from_utf8(output).expect("utf8 output");
+    assert!(
+        output.contains("main.py"),
+        "expected output to include main.py, got: {output}"
+    );
+    assert!(
+        !output.contains("binary.py"),
+        "expected binary.py to be skipped, got: {output}"
+    );
+
+    let _ = std::fs::remove_file(dir.join("binary.py"));
+    let _ = std::fs::remove_file(dir.join("main.py"));
+    let _ = std::fs::remove_dir(dir.join(".git"));
+    let _ = std::fs::remove_dir(&dir);
+}
+
+#[test]
+fn cli_skips_gitignored_when_scanning_directory() {
+    let dir = temp_dir_path("cruxlines-ignore-dir");
+    std::fs::create_dir_all(&dir).expect("create temp dir");
+    std::fs::create_dir_all(dir.join(".git")).expect("create git dir");
+    std::fs::write(dir.join(".gitignore"), "ignored.py\n").expect("write gitignore");
+    std::fs::write(dir.join("utils.py"), "def add(a, b):\n    return a + b\n")
+        .expect("write utils");
+    std::fs::write(
+        dir.join("main.py"),
+        "from utils import add\nfrom ignored import ignored\n\nprint(add(1, 2))\nprint(ignored())\n",
+    )
+    .expect("write main");
+    std::fs::write(dir.join("ignored.py"), "def ignored():\n    return 0\n")
+        .expect("write ignored");
+
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.current_dir(&dir);
+    let output = cmd.assert().success().get_output().stdout.clone();
+    let output = String::from_utf8(output).expect("utf8 output");
+    assert!(
+        output.contains("utils.py"),
+        "expected output to include utils.py, got: {output}"
+    );
+    assert!(
+        !output.contains("ignored.py"),
+        "expected ignored.py to be skipped when scanning dir, got: {output}"
+    );
+
+    let _ = std::fs::remove_file(dir.join("ignored.py"));
+    let _ = std::fs::remove_file(dir.join("main.py"));
+    let _ = std::fs::remove_file(dir.join("utils.py"));
+    let _ = std::fs::remove_file(dir.join(".gitignore"));
+    let _ = std::fs::remove_dir(dir.join(".git"));
+    let _ = std::fs::remove_dir(&dir);
+}
+
+#[test]
+fn library_includes_files_reincluded_by_gitignore_negation() {
+    let dir = temp_dir_path("cruxlines-ignore-negation");
+    copy_fixture(&repo_root().join("tests/fixtures/gitignore_negation"), &dir);
+    git_init(&dir);
+
+    let ecosystems = std::collections::HashSet::from([cruxlines::Ecosystem::Rust]);
+    let rows = cruxlines::cruxlines(&dir, &ecosystems).expect("cruxlines");
+    let names: Vec<&str> = rows.iter().map(|row| row.definition.name_str()).collect();
+    assert!(
+        names.contains(&"Schema"),
+        "expected re-included build/generated/schema.rs to be scanned, got: {names:?}"
+    );
+    assert!(
+        !names.contains(&"Stale"),
+        "expected build/generated/stale.rs to stay ignored, got: {names:?}"
+    );
+    assert!(
+        !names.contains(&"Output"),
+        "expected build/output.rs to stay ignored, got: {names:?}"
+    );
+
+    let _ = std::fs::remove_dir_all(&dir);
+}
+
+#[test]
+fn library_skips_tracked_files_listed_in_cruxlinesignore() {
+    let dir = temp_dir_path("cruxlines-cruxlinesignore");
+    copy_fixture(&repo_root().join("tests/fixtures/cruxlinesignore"), &dir);
+    git_init(&dir);
+    git_commit(&dir, "init", "2001-01-01T00:00:00Z");
+    let tracked = git_command(&dir)
+        .args(["ls-files"])
+        .output()
+        .expect("git ls-files");
+    let tracked = String::from_utf8(tracked.stdout).expect("utf8 output");
+    assert!(
+        tracked.contains("src/api.pb.rs"),
+        "expected git to track it, got: {tracked}"
+    );
+
+    let ecosystems = std::collections::HashSet::from([cruxlines::Ecosystem::Rust]);
+    let rows = cruxlines::cruxlines(&dir, &ecosystems).expect("cruxlines");
+    let names: Vec<&str> = rows.iter().map(|row| row.definition.name_str()).collect();
+    assert!(
+        !names.contains(&"Request"),
+        "expected src/api.pb.rs to be ignored, got: {names:?}"
+    );
+    assert!(
+        !names.contains(&"Snapshot"),
+        "expected vendor/snapshot.rs to be ignored by the nested file, got: {names:?}"
+    );
+    assert!(
+        names.contains(&"Archive"),
+        "expected the nested file to leave src/snapshot.rs alone, got: {names:?}"
+    );
+    assert!(names.contains(&"Client"), "got: {names:?}");
+
+    let _ = std::fs::remove_dir_all(&dir);
+}
+
+#[test]
+fn cli_applies_cruxlinesignore_files_from_the_git_ref() {
+    let dir = temp_dir_path("cruxlines-git-ref-cruxlinesignore");
+    copy_fixture(&repo_root().join("tests/fixtures/cruxlinesignore"), &dir);
+    git_init(&dir);
+    git_commit(&dir, "init", "2001-01-01T00:00:00Z");
+    let status = git_command(&dir)
+        .args(["branch", "snapshot"])
+        .status()
+        .expect("git branch");
+    assert!(status.success(), "git branch failed");
+
+    // Only the ref still has the ignore files.
+    std::fs::remove_file(dir.join(".cruxlinesignore")).expect("remove root ignore file");
+    std::fs::remove_file(dir.join("vendor/.cruxlinesignore")).expect("remove nested ignore file");
+
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--git-ref", "snapshot", "--list-files"])
+        .current_dir(&dir);
+    let output = cmd.assert().success().get_output().stdout.clone();
+    let output = String::from_utf8(output).expect("utf8 output");
+    assert_eq!(
+        output,
+        "src/main.rs: rust\nsrc/snapshot.rs: rust\nvendor/client.rs: rust\n"
+    );
+
+    let _ = std::fs::remove_dir_all(&dir);
+}
+
+#[test]
+fn cli_since_boosts_definitions_changed_after_ref() {
+    let dir = temp_dir_path("cruxlines-since");
+    std::fs::create_dir_all(&dir).expect("create temp dir");
+    git_init(&dir);
+    std::fs::write(
+        dir.join("lib.py"),
+        "def alpha():\n    return 1\n\ndef beta():\n    return 2\n",
+    )
+    .expect("write lib");
+    std::fs::write(
+        dir.join("main.py"),
+        "from lib import alpha, beta\n\nalpha()\nalpha()\nbeta()\n",
+    )
+    .expect("write main");
+    git_commit(&dir, "init", "2001-01-01T00:00:00Z");
+    std::fs::write(
+        dir.join("lib.py"),
+        "def alpha():\n    return 1\n\ndef beta():\n    return 3\n",
+    )
+    .expect("update lib");
+    git_commit(&dir, "change beta", "2001-01-02T00:00:00Z");
+
+    let names = |args: &[&str]| -> Vec<String> {
+        let mut cmd = cargo_bin_cmd!("cruxlines");
+        cmd.args(args).current_dir(&dir);
+        let output = cmd.assert().success().get_output().stdout.clone();
+        String::from_utf8(output)
+            .expect("utf8 output")
+            .lines()
+            .filter_map(name_from_line)
+            .map(str::to_string)
+            .collect()
+    };
+    let position = |names: &[String], name: &str| names.iter().position(|n| n == name);
+
+    let baseline = names(&["--metadata"]);
+    assert!(
+        position(&baseline, "alpha") < position(&baseline, "beta"),
+        "expected alpha first without --since, got: {baseline:?}"
+    );
+    let boosted = names(&["--metadata", "--since", "HEAD~1"]);
+    assert!(
+        position(&boosted, "beta") < position(&boosted, "alpha"),
+        "expected changed beta first with --since, got: {boosted:?}"
+    );
+
+    let _ = std::fs::remove_dir_all(&dir);
+}
+
+#[test]
+fn cli_since_rejects_unknown_refs() {
+    let dir = temp_dir_path("cruxlines-since-bad-ref");
+    std::fs::create_dir_all(&dir).expect("create temp dir");
+    git_init(&dir);
+    std::fs::write(dir.join("main.py"), "def add():\n    return 1\n\nadd()\n").expect("write main");
+    git_commit(&dir, "init", "2001-01-01T00:00:00Z");
+
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--since", "no-such-branch"]).current_dir(&dir);
+    cmd.assert()
+        .failure()
+        .stderr(contains("neither a git ref nor a duration"));
+
+    let _ = std::fs::remove_dir_all(&dir);
+}
+
+#[test]
+fn cli_since_requires_git_repository() {
+    let dir = temp_dir_path("cruxlines-since-no-git");
+    std::fs::create_dir_all(dir.join(".git")).expect("create fake git dir");
+    std::fs::write(dir.join("main.py"), "def add():\n    return 1\n\nadd()\n").expect("write main");
+
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--since", "2w"]).current_dir(&dir);
+    cmd.assert()
+        .failure()
+        .stderr(contains("needs a git repository"));
+
+    let _ = std::fs::remove_dir_all(&dir);
+}
+
+#[test]
+fn cli_watch_rejects_formats_other_than_json() {
+    for format in ["text", "sarif", "dot"] {
+        let mut cmd = cargo_bin_cmd!("cruxlines");
+        cmd.args(["--watch", "--format", format])
+            .current_dir(repo_root());
+        cmd.assert()
+            .code(2)
+            .stderr(contains("--watch prints JSON lines"));
+    }
+}
+
+#[test]
+fn cli_watch_reemits_json_lines_on_change() {
+    use std::io::BufRead;
+
+    let dir = temp_dir_path("cruxlines-watch");
+    std::fs::create_dir_all(&dir).expect("create temp dir");
+    git_init(&dir);
+    std::fs::write(dir.join(".gitignore"), "ignored.py\n").expect("write gitignore");
+    std::fs::write(dir.join("defs.py"), "def alpha():\n    return 1\n").expect("write defs");
+    std::fs::write(dir.join("main.py"), "from defs import alpha\n\nalpha()\n").expect("write main");
+    git_commit(&dir, "init", "2001-01-01T00:00:00Z");
+
+    let exe = assert_cmd::cargo::cargo_bin!("cruxlines");
+    let mut child = std::process::Command::new(exe)
+        .args(["--watch", "--no-cache"])
+        .current_dir(&dir)
+        .stdout(Stdio::piped())
+        .spawn()
+        .expect("spawn cruxlines");
+    let stdout = child.stdout.take().expect("stdout");
+    let (sender, receiver) = std::sync::mpsc::channel();
+    std::thread::spawn(move || {
+        for line in std::io::BufReader::new(stdout).lines() {
+            let Ok(line) = line else { break };
+            if sender.send(line).is_err() {
+                break;
+            }
+        }
+    });
+    let next_names = || -> Vec<String> {
+        let line = receiver
+            .recv_timeout(std::time::Duration::from_secs(10))
+            .expect("timeout waiting for watch output");
+        let rows: serde_json::Value = serde_json::from_str(&line).expect("one json document");
+        rows.as_array()
+            .expect("json array")
+            .iter()
+            .map(|row| row["symbol"].as_str().expect("symbol").to_string())
+            .collect()
+    };
+
+    let initial = next_names();
+    assert!(initial.contains(&"alpha".to_string()), "got: {initial:?}");
+
+    std::fs::write(dir.join("ignored.py"), "def ignored():\n    pass\n").expect("write ignored");
+    std::fs::write(dir.join("notes.txt"), "scratch\n").expect("write notes");
+    std::thread::sleep(std::time::Duration::from_millis(500));
     assert!(
-        output.contains("src/languages/python/fixtures"),
-        "expected python fixtures in output, got: {output}"
+        receiver.try_recv().is_err(),
+        "expected ignored and unsupported files not to trigger a refresh"
     );
+
+    std::fs::write(
+        dir.join("main.py"),
+        "from defs import alpha, beta\n\nalpha()\nbeta()\n",
+    )
+    .expect("update main");
+    std::fs::write(
+        dir.join("defs.py"),
+        "def alpha():\n    return 1\n\ndef beta():\n    return 2\n",
+    )
+    .expect("update defs");
+    // The two writes may land in separate refreshes; wait for the one that
+    // sees both.
+    let refreshed = (0..3)
+        .map(|_| next_names())
+        .find(|names| names.contains(&"beta".to_string()));
+    assert!(refreshed.is_some(), "expected a refresh that includes beta");
+
+    // Un-ignoring a file changes what is walked.
+    std::fs::write(dir.join(".gitignore"), "").expect("clear gitignore");
+    let refreshed = next_names();
     assert!(
-        !output.contains("src/languages/javascript/fixtures"),
-        "expected javascript fixtures to be filtered out, got: {output}"
+        refreshed.contains(&"ignored".to_string()),
+        "expected a .gitignore change to trigger a refresh, got: {refreshed:?}"
     );
+
+    let _ = child.kill();
+    let _ = child.wait();
+    let _ = std::fs::remove_dir_all(&dir);
 }
 
 #[test]
-fn cli_supports_ecosystem_short_flag() {
+fn cli_reads_paths_from_stdin() {
+    let dir = temp_dir_path("cruxlines-stdin-paths");
+    std::fs::create_dir_all(&dir).expect("create temp dir");
+    git_init(&dir);
+    std::fs::write(dir.join("defs.py"), "def alpha():\n    return 1\n").expect("write defs");
+    std::fs::write(dir.join("main.py"), "from defs import alpha\n\nalpha()\n").expect("write main");
+    std::fs::write(
+        dir.join("other.py"),
+        "def omega():\n    return 1\n\nomega()\n",
+    )
+    .expect("write other");
+    std::fs::write(dir.join("notes.txt"), "alpha\n").expect("write notes");
+    git_commit(&dir, "init", "2001-01-01T00:00:00Z");
+
     let mut cmd = cargo_bin_cmd!("cruxlines");
-    cmd.args(["-e", "python"]).current_dir(repo_root());
-    let output = cmd.assert().success().get_output().stdout.clone();
-    let output = String::from_utf8(output).expect("utf8 output");
-    assert!(
-        output.contains("src/languages/python/fixtures"),
-        "expected python fixtures in output, got: {output}"
-    );
+    cmd.args(["--stdin-paths", "--metadata"])
+        .current_dir(&dir)
+        .write_stdin("defs.py\nmain.py\nmissing.py\nnotes.txt\n");
+    let assert = cmd
+        .assert()
+        .success()
+        .stderr(contains("skipping missing.py").and(contains("skipping notes.txt")));
+    let output = String::from_utf8(assert.get_output().stdout.clone()).expect("utf8 output");
+    let names: Vec<&str> = output.lines().filter_map(name_from_line).collect();
+    assert!(names.contains(&"alpha"), "expected alpha, got: {output}");
     assert!(
-        !output.contains("src/languages/javascript/fixtures"),
-        "expected javascript fixtures to be filtered out, got: {output}"
+        !names.contains(&"omega"),
+        "expected files not listed on stdin to be skipped, got: {output}"
     );
+
+    let _ = std::fs::remove_dir_all(&dir);
 }
 
 #[test]
-fn cli_accepts_ecosystem_aliases() {
-    let mut cmd = cargo_bin_cmd!("cruxlines");
-    cmd.args(["--ecosystem", "py"]).current_dir(repo_root());
-    let output = cmd.assert().success().get_output().stdout.clone();
-    let output = String::from_utf8(output).expect("utf8 output");
+fn cli_excludes_and_includes_globs() {
+    let dir = temp_dir_path("cruxlines-exclude");
+    std::fs::create_dir_all(dir.join("vendor/acme")).expect("create vendor dir");
+    std::fs::create_dir_all(dir.join("build")).expect("create build dir");
+    git_init(&dir);
+    std::fs::write(dir.join(".gitignore"), "build/\n").expect("write gitignore");
+    std::fs::write(dir.join("defs.py"), "def alpha():\n    return 1\n").expect("write defs");
+    std::fs::write(
+        dir.join("vendor/acme/lib.py"),
+        "def vendored():\n    return 1\n",
+    )
+    .expect("write vendored");
+    std::fs::write(
+        dir.join("schema_generated.py"),
+        "def generated():\n    return 1\n",
+    )
+    .expect("write generated");
+    std::fs::write(dir.join("build/out.py"), "def built():\n    return 1\n").expect("write build");
+    std::fs::write(
+        dir.join("main.py"),
+        "from defs import alpha\nfrom lib import vendored\nfrom schema_generated import generated\nfrom out import built\n\nalpha()\nvendored()\ngenerated()\nbuilt()\n",
+    )
+    .expect("write main");
+
+    let names = |args: &[&str], stdin: Option<&str>| -> Vec<String> {
+        let mut cmd = cargo_bin_cmd!("cruxlines");
+        cmd.arg("--metadata").args(args).current_dir(&dir);
+        if let Some(stdin) = stdin {
+            cmd.write_stdin(stdin);
+        }
+        let output = cmd.assert().success().get_output().stdout.clone();
+        String::from_utf8(output)
+            .expect("utf8 output")
+            .lines()
+            .filter_map(name_from_line)
+            .map(str::to_string)
+            .collect()
+    };
+
+    let walked = names(
+        &[
+            "--exclude",
+            "vendor/**",
+            "--exclude",
+            "*_generated.py",
+            "--include",
+            "build/**",
+        ],
+        None,
+    );
+    assert!(walked.contains(&"alpha".to_string()), "got: {walked:?}");
     assert!(
-        output.contains("src/languages/python/fixtures"),
-        "expected python fixtures in output, got: {output}"
+        !walked.contains(&"vendored".to_string()),
+        "expected vendor/** to be excluded, got: {walked:?}"
     );
     assert!(
-        !output.contains("src/languages/javascript/fixtures"),
-        "expected javascript fixtures to be filtered out, got: {output}"
+        !walked.contains(&"generated".to_string()),
+        "expected *_generated.py to be excluded, got: {walked:?}"
+    );
+    assert!(
+        walked.contains(&"built".to_string()),
+        "expected --include to bring back a gitignored file, got: {walked:?}"
+    );
+
+    let listed = names(
+        &["--stdin-paths", "--exclude", "vendor/**"],
+        Some("main.py\nvendor/acme/lib.py\n"),
+    );
+    assert!(
+        !listed.contains(&"vendored".to_string()),
+        "expected --exclude to apply to --stdin-paths, got: {listed:?}"
+    );
+    let listed = names(
+        &["--stdin-paths", "--include", "build/**"],
+        Some("main.py\ndefs.py\n"),
+    );
+    assert!(listed.contains(&"alpha".to_string()), "got: {listed:?}");
+    assert!(
+        !listed.contains(&"built".to_string()),
+        "expected --include to add no files beyond --stdin-paths, got: {listed:?}"
     );
+
+    let _ = std::fs::remove_dir_all(&dir);
 }
 
 #[test]
-fn cli_outputs_paths_relative_to_repo_root() {
-    let dir = temp_dir_path("cruxlines-relpath");
+fn cli_reports_dependency_cycles() {
+    let dir = temp_dir_path("cruxlines-cycles");
     std::fs::create_dir_all(&dir).expect("create temp dir");
     git_init(&dir);
-    std::fs::write(dir.join("main.py"), "def add():\n    return 1\n\nadd()\n").expect("write main");
-    git_commit(&dir, "init", "2001-01-01T00:00:00Z");
+    std::fs::write(
+        dir.join("even.py"),
+        "from odd import is_odd\n\ndef is_even(n):\n    return n == 0 or is_odd(n - 1)\n",
+    )
+    .expect("write even");
+    std::fs::write(
+        dir.join("odd.py"),
+        "from even import is_even\n\ndef is_odd(n):\n    return n != 0 and is_even(n - 1)\n",
+    )
+    .expect("write odd");
+    std::fs::write(
+        dir.join("main.py"),
+        "from even import is_even\n\nprint(is_even(4))\n",
+    )
+    .expect("write main");
 
-    let subdir = dir.join("sub");
-    std::fs::create_dir_all(&subdir).expect("create subdir");
+    let run = |args: &[&str]| {
+        let mut cmd = cargo_bin_cmd!("cruxlines");
+        cmd.args(["--report", "cycles"])
+            .args(args)
+            .current_dir(&dir);
+        let output = cmd.assert().success().get_output().stdout.clone();
+        String::from_utf8(output).expect("utf8 output")
+    };
+
+    let text = run(&[]);
+    assert!(text.contains("cycle of 2 files:"), "got: {text}");
+    assert!(text.contains("  even.py -> odd.py"), "got: {text}");
+    assert!(text.contains("  odd.py -> even.py"), "got: {text}");
+    assert!(!text.contains("main.py"), "got: {text}");
+
+    let json: serde_json::Value =
+        serde_json::from_str(&run(&["--cycle-level", "symbol", "--format", "json"]))
+            .expect("valid json");
+    let cycles = json.as_array().expect("json array");
+    assert_eq!(cycles.len(), 1, "got: {json}");
+    let symbols: Vec<&str> = cycles[0]["members"]
+        .as_array()
+        .expect("members")
+        .iter()
+        .map(|member| member["symbol"].as_str().expect("symbol"))
+        .collect();
+    assert_eq!(symbols, vec!["is_even", "is_odd"]);
+    let edge = &cycles[0]["edges"][0];
+    assert_eq!(edge["from"]["file"], "even.py");
+    assert_eq!(edge["from"]["line"], 3);
+    assert_eq!(edge["to"]["symbol"], "is_odd");
 
     let mut cmd = cargo_bin_cmd!("cruxlines");
-    cmd.args(["--ecosystem", "py"]).current_dir(&subdir);
-    let output = cmd.assert().success().get_output().stdout.clone();
-    let output = String::from_utf8(output).expect("utf8 output");
-    assert!(
-        output.contains("main.py:1:5:"),
-        "expected output paths relative to repo root, got: {output}"
-    );
-    assert!(
-        !output.contains(&dir.display().to_string()),
-        "expected output paths to avoid absolute repo root, got: {output}"
-    );
+    cmd.args(["--report", "cycles", "--format", "sarif"])
+        .current_dir(&dir);
+    cmd.assert()
+        .failure()
+        .stderr(contains("--report cycles supports"));
 
     let _ = std::fs::remove_dir_all(&dir);
 }
 
 #[test]
-fn cli_skips_unknown_extension_inputs() {
-    let dir = temp_dir_path("cruxlines-ignore-ext");
+fn cli_reports_the_symbol_graph_as_dot() {
+    let dir = temp_dir_path("cruxlines-graph");
     std::fs::create_dir_all(&dir).expect("create temp dir");
-    std::fs::create_dir_all(dir.join(".git")).expect("create git dir");
+    git_init(&dir);
+    std::fs::write(
+        dir.join("lib.py"),
+        "def helper():\n    pass\n\ndef alpha():\n    helper()\n    helper()\n",
+    )
+    .expect("write lib");
     std::fs::write(
         dir.join("main.py"),
-        "def add(a, b):\n    return a + b\n\nadd(1, 2)\n",
+        "from lib import alpha\n\nalpha()\nalpha()\n",
     )
     .expect("write main");
-    std::fs::write(dir.join("ignore.txt"), "not source").expect("write temp file");
 
-    let mut cmd = cargo_bin_cmd!("cruxlines");
-    cmd.current_dir(&dir);
-    let output = cmd.assert().success().get_output().stdout.clone();
-    let output = String::from_utf8(output).expect("utf8 output");
+    let run = |args: &[&str]| {
+        let mut cmd = cargo_bin_cmd!("cruxlines");
+        cmd.args(["--report", "graph", "--format", "dot", "--no-cache"])
+            .args(args)
+            .current_dir(&dir);
+        let output = cmd.assert().success().get_output().stdout.clone();
+        String::from_utf8(output).expect("utf8 output")
+    };
+    let node = |dot: &str, label: &str| -> String {
+        let suffix = format!(" [label=\"{label}\"];");
+        dot.lines()
+            .find_map(|line| line.trim().strip_suffix(suffix.as_str()))
+            .unwrap_or_else(|| panic!("no {label} node in: {dot}"))
+            .to_string()
+    };
+
+    let dot = run(&["--graph-weights"]);
+    assert!(dot.starts_with("digraph cruxlines {"), "got: {dot}");
+    let alpha = node(&dot, "lib.py::alpha");
+    let helper = node(&dot, "lib.py::helper");
     assert!(
-        output.contains("main.py"),
-        "expected output to include main.py, got: {output}"
+        dot.contains(&format!("  {alpha} -> {helper} [label=\"2\"];")),
+        "got: {dot}"
     );
-    assert!(
-        !output.contains("ignore.txt"),
-        "expected ignore.txt to be skipped, got: {output}"
+
+    let top = run(&["--graph-top", "1"]);
+    assert_eq!(top.matches("[label=").count(), 1, "got: {top}");
+    assert!(!top.contains("->"), "got: {top}");
+
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--report", "graph"]).current_dir(&dir);
+    cmd.assert()
+        .failure()
+        .stderr(contains("--report graph supports --format dot"));
+
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--format", "dot"]).current_dir(&dir);
+    cmd.assert()
+        .failure()
+        .stderr(contains("--format dot needs --report graph"));
+
+    let _ = std::fs::remove_dir_all(&dir);
+}
+
+#[test]
+fn cli_lists_files_without_analyzing() {
+    let dir = temp_dir_path("cruxlines-list-files");
+    std::fs::create_dir_all(dir.join("build")).expect("create build dir");
+    std::fs::create_dir_all(dir.join("vendor")).expect("create vendor dir");
+    git_init(&dir);
+    std::fs::write(dir.join(".gitignore"), "build/\n").expect("write gitignore");
+    std::fs::write(dir.join("main.py"), "def main():\n    pass\n").expect("write main");
+    std::fs::write(dir.join("util.go"), "package util\n").expect("write util");
+    std::fs::write(dir.join("notes.txt"), "not code\n").expect("write notes");
+    std::fs::write(dir.join("build/out.py"), "x = 1\n").expect("write build");
+    std::fs::write(dir.join("vendor/lib.py"), "y = 1\n").expect("write vendor");
+
+    let run = |args: &[&str]| {
+        let mut cmd = cargo_bin_cmd!("cruxlines");
+        cmd.args(args).current_dir(&dir);
+        let output = cmd.assert().success().get_output().stdout.clone();
+        String::from_utf8(output).expect("utf8 output")
+    };
+
+    assert_eq!(
+        run(&["--list-files"]),
+        "main.py: python\nutil.go: go\nvendor/lib.py: python\n"
+    );
+    assert_eq!(
+        run(&[
+            "--list-files",
+            "--exclude",
+            "vendor/**",
+            "--languages",
+            "python"
+        ]),
+        "main.py: python\n"
+    );
+    assert_eq!(
+        run(&["--dry-run", "--include", "build/**", "-e", "go"]),
+        "util.go: go\n"
     );
 
-    let _ = std::fs::remove_file(dir.join("ignore.txt"));
-    let _ = std::fs::remove_file(dir.join("main.py"));
-    let _ = std::fs::remove_dir(dir.join(".git"));
-    let _ = std::fs::remove_dir(&dir);
+    let json: serde_json::Value = serde_json::from_str(&run(&[
+        "--list-files",
+        "--include",
+        "build/**",
+        "--format",
+        "json",
+    ]))
+    .expect("valid json");
+    assert_eq!(json[0]["file"], "build/out.py", "got: {json}");
+    assert_eq!(json[0]["language"], "python", "got: {json}");
+
+    let _ = std::fs::remove_dir_all(&dir);
 }
 
 #[test]
-fn cli_skips_non_utf8_inputs() {
-    let dir = temp_dir_path("cruxlines-binary");
+fn cli_analyzes_a_git_ref_without_checking_it_out() {
+    let dir = temp_dir_path("cruxlines-git-ref");
     std::fs::create_dir_all(&dir).expect("create temp dir");
-    std::fs::create_dir_all(dir.join(".git")).expect("create git dir");
+    git_init(&dir);
+    std::fs::write(dir.join("defs.py"), "def committed():\n    return 1\n").expect("write defs");
     std::fs::write(
         dir.join("main.py"),
-        "def add(a, b):\n    return a + b\n\nadd(1, 2)\n",
+        "from defs import committed\n\ncommitted()\n",
     )
     .expect("write main");
-    std::fs::write(dir.join("binary.py"), [0xff, 0xfe, 0xfd]).expect("write temp file");
+    git_commit(&dir, "init", "2001-01-01T00:00:00Z");
+    let status = git_command(&dir)
+        .args(["branch", "snapshot"])
+        .status()
+        .expect("git branch");
+    assert!(status.success(), "git branch failed");
 
-    let mut cmd = cargo_bin_cmd!("cruxlines");
-    cmd.current_dir(&dir);
-    let output = cmd.assert().success().get_output().stdout.clone();
-    let output = String::from_utf8(output).expect("utf8 output");
+    // The working tree moves on; the ref keeps the committed files.
+    std::fs::remove_file(dir.join("defs.py")).expect("remove defs");
+    std::fs::write(
+        dir.join("main.py"),
+        "def uncommitted():\n    return 1\n\nuncommitted()\n",
+    )
+    .expect("rewrite main");
+
+    let run = |args: &[&str]| {
+        let mut cmd = cargo_bin_cmd!("cruxlines");
+        cmd.args(args).current_dir(&dir);
+        let output = cmd.assert().success().get_output().stdout.clone();
+        String::from_utf8(output).expect("utf8 output")
+    };
+    let output = run(&["--git-ref", "snapshot"]);
     assert!(
-        output.contains("main.py"),
-        "expected output to include main.py, got: {output}"
+        output.contains("defs.py:1:5: def committed():"),
+        "expected the committed definition, got: {output}"
     );
-    assert!(
-        !output.contains("binary.py"),
-        "expected binary.py to be skipped, got: {output}"
+    assert!(!output.contains("uncommitted"), "got: {output}");
+    assert_eq!(
+        run(&["--git-ref", "snapshot", "--list-files"]),
+        "defs.py: python\nmain.py: python\n"
     );
 
-    let _ = std::fs::remove_file(dir.join("binary.py"));
-    let _ = std::fs::remove_file(dir.join("main.py"));
-    let _ = std::fs::remove_dir(dir.join(".git"));
-    let _ = std::fs::remove_dir(&dir);
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--git-ref", "no-such-ref"]).current_dir(&dir);
+    cmd.assert()
+        .failure()
+        .stderr(contains("--git-ref `no-such-ref` is not a commit or tree"));
+
+    let _ = std::fs::remove_dir_all(&dir);
 }
 
 #[test]
-fn cli_skips_gitignored_when_scanning_directory() {
-    let dir = temp_dir_path("cruxlines-ignore-dir");
-    std::fs::create_dir_all(&dir).expect("create temp dir");
-    std::fs::create_dir_all(dir.join(".git")).expect("create git dir");
-    std::fs::write(dir.join(".gitignore"), "ignored.py\n").expect("write gitignore");
-    std::fs::write(dir.join("utils.py"), "def add(a, b):\n    return a + b\n")
-        .expect("write utils");
+fn cli_reads_tsconfig_from_the_git_ref() {
+    let dir = temp_dir_path("cruxlines-git-ref-tsconfig");
+    std::fs::create_dir_all(dir.join("src")).expect("create temp dir");
+    git_init(&dir);
+    std::fs::write(
+        dir.join("tsconfig.json"),
+        "{ \"compilerOptions\": { \"baseUrl\": \".\", \"paths\": { \"@/*\": [\"src/*\"] } } }\n",
+    )
+    .expect("write tsconfig");
+    // The two files only import each other, one of them through the alias.
+    std::fs::write(dir.join("src/a.ts"), "import \"@/b\";\n").expect("write a");
+    std::fs::write(dir.join("src/b.ts"), "import \"./a\";\n").expect("write b");
+    git_commit(&dir, "init", "2001-01-01T00:00:00Z");
+    let status = git_command(&dir)
+        .args(["branch", "snapshot"])
+        .status()
+        .expect("git branch");
+    assert!(status.success(), "git branch failed");
+    std::fs::remove_file(dir.join("tsconfig.json")).expect("remove tsconfig");
+
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--git-ref", "snapshot", "--report", "cycles", "--no-cache"])
+        .current_dir(&dir);
+    cmd.assert()
+        .success()
+        .stdout(contains("cycle of 2 files:"))
+        .stdout(contains("src/a.ts"))
+        .stdout(contains("src/b.ts"));
+
+    let _ = std::fs::remove_dir_all(&dir);
+}
+
+#[test]
+fn cli_reads_defaults_from_config_file() {
+    let dir = temp_dir_path("cruxlines-config");
+    std::fs::create_dir_all(dir.join("sub")).expect("create temp dir");
+    git_init(&dir);
+    std::fs::write(
+        dir.join("defs.py"),
+        "def alpha():\n    return 1\n\ndef beta():\n    return 2\n",
+    )
+    .expect("write defs");
     std::fs::write(
         dir.join("main.py"),
-        "from utils import add\nfrom ignored import ignored\n\nprint(add(1, 2))\nprint(ignored())\n",
+        "from defs import alpha, beta\n\nalpha()\nbeta()\n",
     )
     .expect("write main");
-    std::fs::write(dir.join("ignored.py"), "def ignored():\n    return 0\n")
-        .expect("write ignored");
+    std::fs::write(dir.join("cruxlines.toml"), "limit = 1\n").expect("write config");
+    git_commit(&dir, "init", "2001-01-01T00:00:00Z");
 
-    let mut cmd = cargo_bin_cmd!("cruxlines");
-    cmd.current_dir(&dir);
-    let output = cmd.assert().success().get_output().stdout.clone();
-    let output = String::from_utf8(output).expect("utf8 output");
-    assert!(
-        output.contains("utils.py"),
-        "expected output to include utils.py, got: {output}"
-    );
-    assert!(
-        !output.contains("ignored.py"),
-        "expected ignored.py to be skipped when scanning dir, got: {output}"
+    let row_count = |args: &[&str]| {
+        let mut cmd = cargo_bin_cmd!("cruxlines");
+        cmd.args(args).current_dir(dir.join("sub"));
+        let output = cmd.assert().success().get_output().stdout.clone();
+        String::from_utf8(output)
+            .expect("utf8 output")
+            .lines()
+            .count()
+    };
+    assert_eq!(row_count(&[]), 1, "expected limit from cruxlines.toml");
+    assert_eq!(row_count(&["--limit", "2"]), 2, "expected flag to win");
+    assert_eq!(
+        row_count(&["--no-config"]),
+        2,
+        "expected config to be skipped"
     );
 
-    let _ = std::fs::remove_file(dir.join("ignored.py"));
-    let _ = std::fs::remove_file(dir.join("main.py"));
-    let _ = std::fs::remove_file(dir.join("utils.py"));
-    let _ = std::fs::remove_file(dir.join(".gitignore"));
-    let _ = std::fs::remove_dir(dir.join(".git"));
-    let _ = std::fs::remove_dir(&dir);
+    std::fs::write(dir.join("typo.toml"), "limt = 1\n").expect("write typo config");
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--config", "../typo.toml"])
+        .current_dir(dir.join("sub"))
+        .assert()
+        .failure()
+        .stderr(contains("limt"));
+
+    let _ = std::fs::remove_dir_all(&dir);
 }
 
 #[test]
@@ -450,6 +1763,94 @@ def helper_alpha():\n{alpha_calls}    anchor()\n\n# touch {day}\n"
     let _ = std::fs::remove_dir_all(&dir);
 }
 
+#[test]
+fn cli_writes_output_to_a_file() {
+    let dir = temp_dir_path("cruxlines-output");
+    std::fs::create_dir_all(&dir).expect("create temp dir");
+    git_init(&dir);
+    std::fs::write(dir.join("lib.py"), "def helper():\n    pass\n").expect("write lib");
+    std::fs::write(dir.join("main.py"), "from lib import helper\n\nhelper()\n")
+        .expect("write main");
+
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args([
+        "--format",
+        "json",
+        "--no-cache",
+        "--profile",
+        "--output",
+        "reports/crux.json",
+    ])
+    .current_dir(&dir);
+    cmd.assert()
+        .success()
+        .stdout("")
+        .stderr(contains("cruxlines: profile"));
+
+    let report = dir.join("reports");
+    let json = std::fs::read_to_string(report.join("crux.json")).expect("read output");
+    assert!(json.contains("\"symbol\": \"helper\""), "got: {json}");
+    let files: Vec<_> = std::fs::read_dir(&report)
+        .expect("read reports dir")
+        .map(|entry| entry.expect("entry").file_name())
+        .collect();
+    assert_eq!(files, vec!["crux.json"]);
+
+    let _ = std::fs::remove_dir_all(&dir);
+}
+
+#[test]
+fn cli_ranks_files_with_granularity_file() {
+    let dir = temp_dir_path("cruxlines-granularity");
+    std::fs::create_dir_all(&dir).expect("create temp dir");
+    git_init(&dir);
+    std::fs::write(
+        dir.join("many.py"),
+        "def alpha():\n    pass\n\ndef beta():\n    pass\n\ndef gamma():\n    pass\n",
+    )
+    .expect("write many");
+    std::fs::write(dir.join("one.py"), "def delta():\n    pass\n").expect("write one");
+    std::fs::write(
+        dir.join("main.py"),
+        "from many import alpha, beta, gamma\nfrom one import delta\n\nalpha()\nbeta()\ngamma()\ndelta()\ndelta()\n",
+    )
+    .expect("write main");
+
+    let run = |args: &[&str]| -> Vec<serde_json::Value> {
+        let mut cmd = cargo_bin_cmd!("cruxlines");
+        cmd.args(["--granularity", "file", "--format", "json", "--no-cache"])
+            .args(args)
+            .current_dir(&dir);
+        let output = cmd.assert().success().get_output().stdout.clone();
+        serde_json::from_slice(&output).expect("json output")
+    };
+    let files = |rows: &[serde_json::Value]| -> Vec<String> {
+        rows.iter()
+            .map(|row| row["file"].as_str().expect("file").to_string())
+            .collect()
+    };
+
+    let summed = run(&[]);
+    assert_eq!(files(&summed), vec!["many.py", "one.py"]);
+    assert_eq!(summed[0]["definitions"], 3);
+    assert!(summed[0]["score"].as_f64().expect("score") > 0.0);
+    assert_eq!(
+        files(&run(&["--file-score", "max"])),
+        vec!["one.py", "many.py"]
+    );
+    assert_eq!(files(&run(&["--limit", "1"])), vec!["many.py"]);
+
+    let mut cmd = cargo_bin_cmd!("cruxlines");
+    cmd.args(["--granularity", "file", "--no-cache"])
+        .current_dir(&dir);
+    cmd.assert()
+        .success()
+        .stdout(contains("many.py: score="))
+        .stdout(contains("definitions=3"));
+
+    let _ = std::fs::remove_dir_all(&dir);
+}
+
 fn repo_root() -> std::path::PathBuf {
     std::path::PathBuf::from(env!("CARGO_MANIFEST_DIR"))
 }
@@ -498,6 +1899,27 @@ fn name_from_line(line: &str) -> Option<&str> {
     None
 }
 
+/// Copies a fixture tree, renaming `gitignore` files to `.gitignore` so the
+/// fixture's ignore rules don't apply to this repository.
+fn copy_fixture(from: &std::path::Path, to: &std::path::Path) {
+    std::fs::create_dir_all(to).expect("create fixture dir");
+    for entry in std::fs::read_dir(from).expect("read fixture dir") {
+        let entry = entry.expect("fixture entry");
+        let path = entry.path();
+        let name = entry.file_name();
+        let target = if name == "gitignore" || name == "cruxlinesignore" {
+            to.join(format!(".{}", name.to_string_lossy()))
+        } else {
+            to.join(&name)
+        };
+        if path.is_dir() {
+            copy_fixture(&path, &target);
+        } else {
+            std::fs::copy(&path, &target).expect("copy fixture file");
+        }
+    }
+}
+
 fn git_init(dir: &std::path::Path) {
     let status = git_command(dir).arg("init").status().expect("git init");
     assert!(status.success(), "git init failed");
@@ -1,7 +1,10 @@
 use std::fs;
 use std::path::{Path, PathBuf};
 
-use cruxlines::{OutputRow, cruxlines_from_inputs};
+use cruxlines::{
+    EdgeMode, Options, OutputRow, SymbolKind, cruxlines_from_inputs,
+    cruxlines_from_inputs_with_options,
+};
 
 fn read_fixture(path: impl AsRef<Path>) -> (PathBuf, String) {
     let path = path.as_ref().to_path_buf();
@@ -40,7 +43,7 @@ fn finds_python_cross_file_references() {
         read_fixture("src/languages/python/fixtures/models.py"),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(
@@ -62,6 +65,46 @@ fn finds_python_cross_file_references() {
     );
 }
 
+#[test]
+fn flags_symbols_from_files_with_syntax_errors() {
+    let files = vec![
+        read_fixture("src/languages/python/fixtures/broken/models.py"),
+        read_fixture("src/languages/python/fixtures/broken/views.py"),
+        read_fixture("src/languages/python/fixtures/broken/app.py"),
+    ];
+    let in_views = |row: &&OutputRow| row.definition.path_str().ends_with("broken/views.py");
+
+    let rows = cruxlines_from_inputs(files.clone(), None).expect("analyze inputs");
+    let user = rows
+        .iter()
+        .find(|row| row.definition.name_str() == "User")
+        .expect("User row");
+    assert_eq!((user.parse_errors, user.parse_error), (0, false));
+    let render = rows
+        .iter()
+        .find(|row| row.definition.name_str() == "render")
+        .expect("render row");
+    assert!(
+        render.parse_errors > 0,
+        "expected the syntax error to be detected"
+    );
+    assert!(rows.iter().filter(in_views).all(|row| row.parse_errors > 0));
+    assert!(
+        rows.iter()
+            .filter(|row| row.definition.name_str() == "broken")
+            .all(|row| row.parse_error),
+        "a symbol read from the broken declaration must be flagged"
+    );
+
+    let options = Options {
+        strict_parse: true,
+        ..Options::default()
+    };
+    let strict = cruxlines_from_inputs_with_options(files, None, &options).expect("analyze inputs");
+    assert!(!strict.iter().any(|row| in_views(&row)));
+    assert!(strict.iter().any(|row| row.definition.name_str() == "User"));
+}
+
 #[test]
 fn finds_javascript_cross_file_references() {
     let files = vec![
@@ -70,7 +113,7 @@ fn finds_javascript_cross_file_references() {
         read_fixture("src/languages/javascript/fixtures/models.js"),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(
@@ -92,6 +135,34 @@ fn finds_javascript_cross_file_references() {
     );
 }
 
+#[test]
+fn finds_javascript_commonjs_references() {
+    let files = vec![
+        read_fixture("src/languages/javascript/fixtures/commonjs/app.js"),
+        read_fixture("src/languages/javascript/fixtures/commonjs/util.js"),
+        read_fixture("src/languages/javascript/fixtures/commonjs/lib/index.js"),
+    ];
+
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
+
+    for (name, definition) in [
+        ("formatName", "commonjs/util.js"),
+        ("slugify", "commonjs/util.js"),
+        ("VERSION", "commonjs/lib/index.js"),
+    ] {
+        assert!(
+            has_reference(&rows, name, definition, "commonjs/app.js"),
+            "expected reference to {name} in {definition} from app.js"
+        );
+    }
+    assert!(
+        !rows
+            .iter()
+            .any(|row| row.definition.name_str() == "capitalize"),
+        "capitalize is not exported"
+    );
+}
+
 #[test]
 fn finds_rust_cross_file_references() {
     let files = vec![
@@ -100,7 +171,7 @@ fn finds_rust_cross_file_references() {
         read_fixture("src/languages/rust/fixtures/models.rs"),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(
@@ -130,7 +201,7 @@ fn finds_java_cross_file_references() {
         read_fixture("src/languages/java/fixtures/Utils.java"),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(
@@ -143,6 +214,115 @@ fn finds_java_cross_file_references() {
     );
 }
 
+#[test]
+fn finds_java_references_across_packages() {
+    let files = vec![
+        read_fixture("src/languages/java/fixtures/com/acme/model/Account.java"),
+        read_fixture("src/languages/java/fixtures/com/acme/service/AccountService.java"),
+    ];
+
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
+
+    assert!(
+        has_reference(
+            &rows,
+            "Account",
+            "model/Account.java",
+            "service/AccountService.java"
+        ),
+        "expected reference to Account from AccountService.java"
+    );
+    assert!(
+        has_reference(
+            &rows,
+            "AccountService",
+            "service/AccountService.java",
+            "model/Account.java"
+        ),
+        "expected reference to AccountService from Account.java"
+    );
+    assert!(
+        has_reference(
+            &rows,
+            "Account.Status",
+            "model/Account.java",
+            "service/AccountService.java"
+        ),
+        "expected nested Account.Status to be referenced by its qualified name"
+    );
+    assert!(
+        has_reference(
+            &rows,
+            "deposit",
+            "model/Account.java",
+            "service/AccountService.java"
+        ),
+        "expected methods to be definitions"
+    );
+}
+
+#[test]
+fn links_same_named_symbols_to_the_imported_package() {
+    let cases = [
+        (
+            (
+                "pkgA/Handler.java",
+                "package com.acme.pkga;\n\npublic class Handler {}\n",
+            ),
+            (
+                "pkgB/Handler.java",
+                "package com.acme.pkgb;\n\npublic class Handler {}\n",
+            ),
+            (
+                "app/App.java",
+                "package com.acme.app;\n\nimport com.acme.pkga.Handler;\n\nclass App {\n    Handler handler;\n}\n",
+            ),
+        ),
+        (
+            ("pkgA/handler.ts", "export function Handler() {}\n"),
+            ("pkgB/handler.ts", "export function Handler() {}\n"),
+            (
+                "app/app.ts",
+                "import { Handler } from \"../pkgA/handler\";\n\nHandler();\n",
+            ),
+        ),
+        (
+            (
+                "pkgA/Handler.cs",
+                "namespace Acme.PkgA;\n\npublic class Handler {}\n",
+            ),
+            (
+                "pkgB/Handler.cs",
+                "namespace Acme.PkgB;\n\npublic class Handler {}\n",
+            ),
+            (
+                "app/App.cs",
+                "using Acme.PkgA;\n\nnamespace Acme.App;\n\nclass App {\n    Handler handler;\n}\n",
+            ),
+        ),
+    ];
+
+    for (imported, other, app) in cases {
+        let files = [imported, other, app]
+            .map(|(path, source)| (PathBuf::from(path), source.to_string()))
+            .to_vec();
+        let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
+
+        assert!(
+            has_reference(&rows, "Handler", imported.0, app.0),
+            "expected {} to reference Handler in {}",
+            app.0,
+            imported.0
+        );
+        assert!(
+            !has_reference(&rows, "Handler", other.0, app.0),
+            "expected {} not to reference Handler in {}",
+            app.0,
+            other.0
+        );
+    }
+}
+
 #[test]
 fn finds_kotlin_cross_file_references() {
     let files = vec![
@@ -151,7 +331,7 @@ fn finds_kotlin_cross_file_references() {
         read_fixture("src/languages/kotlin/fixtures/utils.kt"),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(
@@ -173,6 +353,123 @@ fn finds_kotlin_cross_file_references() {
     );
 }
 
+#[test]
+fn reports_the_name_line_of_wrapped_signatures() {
+    let files = vec![
+        read_fixture("src/languages/go/fixtures/wrapped/store.go"),
+        read_fixture("src/languages/javascript/fixtures/wrapped/api.ts"),
+        read_fixture("src/languages/javascript/fixtures/wrapped/consumer.ts"),
+    ];
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
+
+    for (name, line, column) in [
+        ("NewStore", 7, 6),
+        ("Lookup", 15, 3),
+        ("fetchUser", 1, 17),
+        ("formatUser", 8, 14),
+        ("retry", 14, 3),
+    ] {
+        let row = rows
+            .iter()
+            .find(|row| row.definition.name_str() == name)
+            .unwrap_or_else(|| panic!("expected a definition of {name}"));
+        assert_eq!(
+            (row.definition.line, row.definition.column),
+            (line, column),
+            "position of {name}"
+        );
+        assert!(
+            row.definition_line.contains(name),
+            "expected the crux line of {name} to show its name, got: {}",
+            row.definition_line
+        );
+    }
+}
+
+#[test]
+fn links_kotlin_extension_functions_and_companion_members() {
+    let files = vec![
+        read_fixture("src/languages/kotlin/fixtures/billing/Invoice.kt"),
+        read_fixture("src/languages/kotlin/fixtures/billing/Formatting.kt"),
+        read_fixture("src/languages/kotlin/fixtures/app/Checkout.kt"),
+    ];
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
+
+    assert!(
+        has_reference(
+            &rows,
+            "describe",
+            "billing/Formatting.kt",
+            "app/Checkout.kt"
+        ),
+        "expected the extension function to be referenced from Checkout.kt"
+    );
+    let invoice = rows
+        .iter()
+        .find(|row| {
+            row.definition.name_str() == "Invoice"
+                && row.definition.path_str().ends_with("billing/Invoice.kt")
+        })
+        .expect("Invoice definition");
+    assert!(
+        invoice.references.iter().any(|reference| {
+            reference.path_str().ends_with("billing/Formatting.kt") && reference.line == 5
+        }),
+        "expected an edge from the extension receiver to Invoice"
+    );
+    for member in ["Invoice.create", "Invoice.TAX_RATE"] {
+        assert!(
+            has_reference(&rows, member, "billing/Invoice.kt", "app/Checkout.kt"),
+            "expected a reference to {member} from Checkout.kt"
+        );
+    }
+}
+
+#[test]
+fn links_swift_extensions_to_the_extended_type() {
+    let files = vec![
+        read_fixture("src/languages/swift/fixtures/Sources/Billing/Invoice.swift"),
+        read_fixture("src/languages/swift/fixtures/Sources/Billing/Invoice+Formatting.swift"),
+        read_fixture("src/languages/swift/fixtures/Sources/App/Checkout.swift"),
+    ];
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
+
+    assert!(
+        has_reference(
+            &rows,
+            "describe",
+            "Billing/Invoice+Formatting.swift",
+            "App/Checkout.swift"
+        ),
+        "expected the extension method to be referenced from Checkout.swift"
+    );
+    let invoice = rows
+        .iter()
+        .find(|row| {
+            row.definition.name_str() == "Invoice"
+                && row.definition.path_str().ends_with("Billing/Invoice.swift")
+        })
+        .expect("Invoice definition");
+    assert!(
+        invoice.references.iter().any(|reference| {
+            reference
+                .path_str()
+                .ends_with("Billing/Invoice+Formatting.swift")
+                && reference.line == 2
+        }),
+        "expected an edge from the extension member to Invoice"
+    );
+    assert!(
+        has_reference(
+            &rows,
+            "Billable",
+            "Billing/Invoice.swift",
+            "Billing/Invoice.swift"
+        ),
+        "expected the protocol conformance to reference Billable"
+    );
+}
+
 #[test]
 fn finds_java_kotlin_cross_language_references() {
     let files = vec![
@@ -181,7 +478,7 @@ fn finds_java_kotlin_cross_language_references() {
         read_fixture("src/languages/kotlin/fixtures/interop.kt"),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(
@@ -216,7 +513,7 @@ fn kotlin_references_are_not_duplicated() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
     let add_row = rows
         .iter()
         .find(|row| row.definition.name_str() == "add")
@@ -243,7 +540,7 @@ fn finds_rust_type_identifier_references() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "User", "models.rs", "main.rs"),
@@ -259,7 +556,7 @@ fn finds_typescript_cross_file_references() {
         read_fixture("src/languages/javascript/fixtures/models.ts"),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(
@@ -288,7 +585,7 @@ fn finds_tsx_cross_file_references() {
         read_fixture("src/languages/javascript/fixtures/components.tsx"),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(
@@ -315,7 +612,7 @@ fn finds_cross_language_references_within_ecosystem() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "add", "utils.ts", "main.js"),
@@ -336,7 +633,7 @@ fn does_not_cross_language_references() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
     for row in &rows {
         let def_ext = extension(row.definition.path_str());
         for reference in &row.references {
@@ -365,7 +662,7 @@ fn ignores_non_exported_javascript_definitions() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
     assert!(
         !rows.iter().any(|row| row.definition.name_str() == "foo"),
         "expected non-exported foo to be ignored"
@@ -379,13 +676,66 @@ fn ignores_nested_python_definitions() {
         "def outer():\n    def inner():\n        return 1\n    return inner()\n".to_string(),
     )];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
     assert!(
         !rows.iter().any(|row| row.definition.name_str() == "inner"),
         "expected nested inner to be ignored"
     );
 }
 
+#[test]
+fn finds_decorated_python_functions_and_class_methods() {
+    let files = vec![
+        read_fixture("src/languages/python/fixtures/web/app.py"),
+        read_fixture("src/languages/python/fixtures/web/services.py"),
+    ];
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
+
+    assert!(
+        has_reference(&rows, "get_user", "web/app.py", "web/app.py"),
+        "expected the decorated route handler to be a definition"
+    );
+    for method in ["find", "normalize"] {
+        let row = rows
+            .iter()
+            .find(|row| {
+                row.definition.name_str() == method
+                    && row.definition.path_str().ends_with("web/services.py")
+            })
+            .unwrap_or_else(|| panic!("expected method {method}"));
+        assert_eq!(row.kind, SymbolKind::Method, "kind of {method}");
+        assert!(
+            row.references
+                .iter()
+                .any(|reference| reference.path_str().ends_with("web/app.py")),
+            "expected a reference to {method} from app.py"
+        );
+    }
+
+    let service = rows
+        .iter()
+        .find(|row| row.definition.name_str() == "UserService")
+        .expect("UserService definition");
+    let member_lines: Vec<usize> = service
+        .references
+        .iter()
+        .filter(|reference| reference.path_str().ends_with("web/services.py"))
+        .map(|reference| reference.line)
+        .collect();
+    // `__init__`, `find` and the decorated `normalize`.
+    assert!(
+        [17, 20, 27].iter().all(|line| member_lines.contains(line)),
+        "expected class membership edges, got {member_lines:?}"
+    );
+
+    for nested in ["decorator", "wrapper", "lookup"] {
+        assert!(
+            !rows.iter().any(|row| row.definition.name_str() == nested),
+            "expected nested {nested} to be ignored"
+        );
+    }
+}
+
 #[test]
 fn ties_are_sorted_by_definition_location() {
     let mut files = Vec::new();
@@ -405,7 +755,7 @@ fn ties_are_sorted_by_definition_location() {
     }
     files.push((PathBuf::from("use.py"), use_lines));
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
     let mut expected = rows.clone();
     expected.sort_by(|a, b| {
         b.rank
@@ -448,7 +798,7 @@ fn finds_go_cross_file_references() {
         read_fixture("src/languages/go/fixtures/models.go"),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(
@@ -479,6 +829,138 @@ fn finds_go_cross_file_references() {
     );
 }
 
+#[test]
+fn links_go_method_receivers_to_their_type() {
+    let files = vec![
+        read_fixture("src/languages/go/fixtures/main.go"),
+        read_fixture("src/languages/go/fixtures/models.go"),
+    ];
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
+    let user = rows
+        .iter()
+        .find(|row| {
+            row.definition.name_str() == "User" && row.definition.path_str().ends_with("models.go")
+        })
+        .expect("User definition");
+    let receiver_lines: Vec<usize> = user
+        .references
+        .iter()
+        .filter(|reference| reference.path_str().ends_with("models.go"))
+        .map(|reference| reference.line)
+        .collect();
+    // `func (u *User) Rename` and `func (u User) IsAdult`.
+    assert!(
+        receiver_lines.contains(&16) && receiver_lines.contains(&20),
+        "expected pointer and value receiver edges, got {receiver_lines:?}"
+    );
+}
+
+#[test]
+fn prefers_go_receiver_types_from_the_same_package() {
+    let files = vec![
+        (
+            PathBuf::from("models/user.go"),
+            "package models\n\ntype User struct{}\n\nfunc (u *User) Rename() {}\n".to_string(),
+        ),
+        (
+            PathBuf::from("legacy/user.go"),
+            "package legacy\n\ntype User struct{}\n".to_string(),
+        ),
+    ];
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
+    assert!(
+        has_reference(&rows, "User", "models/user.go", "models/user.go"),
+        "expected receiver edge to models.User"
+    );
+    assert!(
+        !has_reference(&rows, "User", "legacy/user.go", "models/user.go"),
+        "expected no receiver edge to legacy.User"
+    );
+}
+
+#[test]
+fn links_go_package_selectors_to_the_imported_package() {
+    let files = vec![
+        read_fixture("src/languages/go/fixtures/shop/cmd/server/main.go"),
+        read_fixture("src/languages/go/fixtures/shop/internal/auth/token.go"),
+        read_fixture("src/languages/go/fixtures/shop/internal/billing/invoice.go"),
+        read_fixture("src/languages/go/fixtures/shop/internal/money/format.go"),
+    ];
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
+    assert!(
+        has_reference(
+            &rows,
+            "Validate",
+            "internal/auth/token.go",
+            "cmd/server/main.go"
+        ),
+        "expected authz.Validate to link to the auth package"
+    );
+    assert!(
+        !has_reference(
+            &rows,
+            "Validate",
+            "internal/billing/invoice.go",
+            "cmd/server/main.go"
+        ),
+        "expected no edge to billing.Validate, which main.go does not import"
+    );
+    assert!(
+        has_reference(
+            &rows,
+            "Format",
+            "internal/money/format.go",
+            "cmd/server/main.go"
+        ),
+        "expected the dot import to bring money.Format into scope"
+    );
+}
+
+#[test]
+fn reports_the_same_positions_for_crlf_files() {
+    let crlf = vec![
+        read_fixture("src/languages/go/fixtures/crlf/greet.go"),
+        read_fixture("src/languages/go/fixtures/crlf/welcome.go"),
+    ];
+    assert!(
+        crlf.iter().all(|(_, source)| source.contains("\r\n")),
+        "fixtures must keep their CRLF line endings"
+    );
+    let lf: Vec<(PathBuf, String)> = crlf
+        .iter()
+        .map(|(path, source)| (path.clone(), source.replace("\r\n", "\n")))
+        .collect();
+    let positions = |inputs: Vec<(PathBuf, String)>| -> Vec<String> {
+        cruxlines_from_inputs(inputs, None)
+            .expect("analyze inputs")
+            .iter()
+            .map(|row| {
+                let references: Vec<(usize, usize)> = row
+                    .references
+                    .iter()
+                    .map(|reference| (reference.line, reference.column))
+                    .collect();
+                format!(
+                    "{} {}:{} {} <- {references:?}",
+                    row.definition.name_str(),
+                    row.definition.line,
+                    row.definition.column,
+                    row.definition_line
+                )
+            })
+            .collect()
+    };
+
+    let crlf = positions(crlf);
+    assert_eq!(crlf, positions(lf));
+    // `\tgreeting := "café"; return Greet(greeting)`: the column counts
+    // characters, so the two-byte `é` does not push the reference to 31.
+    assert!(
+        crlf.contains(&"Greet 4:6 func Greet(name string) string { <- [(4, 30)]".to_string()),
+        "{crlf:?}"
+    );
+}
+
 #[test]
 fn finds_go_constant_definitions() {
     let files = vec![
@@ -492,7 +974,7 @@ fn finds_go_constant_definitions() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "MaxRetries", "constants.go", "main.go"),
@@ -517,7 +999,7 @@ fn finds_go_variable_definitions() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "GlobalCounter", "globals.go", "main.go"),
@@ -542,7 +1024,7 @@ fn finds_go_method_definitions() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "Greet", "user.go", "main.go"),
@@ -567,7 +1049,7 @@ fn finds_go_type_identifier_references() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "Config", "types.go", "main.go"),
@@ -593,7 +1075,7 @@ fn ignores_go_nested_function_definitions() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     // outer is a top-level function and should be a definition
     assert!(
@@ -621,7 +1103,7 @@ fn finds_go_multiple_const_in_block() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "Foo", "constants.go", "main.go"),
@@ -650,7 +1132,7 @@ fn finds_go_multiple_var_in_block() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "X", "globals.go", "main.go"),
@@ -679,7 +1161,7 @@ fn finds_go_multiple_type_in_block() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "Point", "types.go", "main.go"),
@@ -699,7 +1181,7 @@ fn finds_csharp_cross_file_references() {
         read_fixture("src/languages/csharp/fixtures/Services.cs"),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     // Classes
     assert!(
@@ -755,6 +1237,62 @@ fn finds_csharp_cross_file_references() {
     );
 }
 
+#[test]
+fn merges_csharp_partial_classes_across_namespaced_files() {
+    let files = vec![
+        read_fixture("src/languages/csharp/fixtures/Billing/Invoice.cs"),
+        read_fixture("src/languages/csharp/fixtures/Billing/Invoice.Totals.cs"),
+        read_fixture("src/languages/csharp/fixtures/Billing/LineItem.cs"),
+        read_fixture("src/languages/csharp/fixtures/Checkout/CheckoutService.cs"),
+    ];
+
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
+
+    let invoices: Vec<&OutputRow> = rows
+        .iter()
+        .filter(|row| row.definition.name_str() == "Invoice")
+        .collect();
+    assert_eq!(
+        invoices.len(),
+        1,
+        "expected partial Invoice parts to merge into one definition"
+    );
+    assert!(
+        !invoices[0].references.is_empty()
+            && invoices[0].references.iter().all(|reference| reference
+                .path_str()
+                .ends_with("Checkout/CheckoutService.cs")),
+        "expected only CheckoutService.cs to reference Invoice, not the other partial part"
+    );
+    assert!(
+        has_reference(
+            &rows,
+            "LineItem",
+            "Billing/LineItem.cs",
+            "Billing/Invoice.cs"
+        ),
+        "expected reference to LineItem from another file in the same namespace"
+    );
+    assert!(
+        has_reference(
+            &rows,
+            "Total",
+            "Billing/Invoice.Totals.cs",
+            "Checkout/CheckoutService.cs"
+        ),
+        "expected methods to be definitions"
+    );
+    assert!(
+        has_reference(
+            &rows,
+            "Items",
+            "Billing/Invoice.cs",
+            "Billing/Invoice.Totals.cs"
+        ),
+        "expected properties to be definitions"
+    );
+}
+
 #[test]
 fn finds_csharp_interface_definitions() {
     let files = vec![
@@ -768,7 +1306,7 @@ fn finds_csharp_interface_definitions() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "IRepository", "Interfaces.cs", "Implementation.cs"),
@@ -793,7 +1331,7 @@ fn finds_csharp_struct_definitions() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "Point", "Structs.cs", "Usage.cs"),
@@ -818,7 +1356,7 @@ fn finds_csharp_enum_definitions() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "Status", "Enums.cs", "Task.cs"),
@@ -843,7 +1381,7 @@ fn finds_csharp_record_definitions() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "Person", "Records.cs", "Usage.cs"),
@@ -868,7 +1406,7 @@ fn finds_csharp_delegate_definitions() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "EventHandler", "Delegates.cs", "Usage.cs"),
@@ -893,7 +1431,7 @@ fn finds_csharp_types_in_namespace() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "Customer", "Models.cs", "Service.cs"),
@@ -914,7 +1452,7 @@ fn finds_csharp_generic_type_references() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "Repository", "Generic.cs", "Usage.cs"),
@@ -935,7 +1473,7 @@ fn ignores_csharp_nested_class_definitions() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     // Outer should be a definition
     assert!(
@@ -949,6 +1487,54 @@ fn ignores_csharp_nested_class_definitions() {
     );
 }
 
+#[test]
+fn finds_shell_cross_file_references() {
+    let files = vec![
+        read_fixture("src/languages/bash/fixtures/deploy.sh"),
+        read_fixture("src/languages/bash/fixtures/lib/common.sh"),
+        read_fixture("src/languages/bash/fixtures/release"),
+    ];
+
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
+
+    assert!(
+        has_reference(
+            &rows,
+            "log_info",
+            "src/languages/bash/fixtures/lib/common.sh",
+            "src/languages/bash/fixtures/deploy.sh"
+        ),
+        "expected reference to log_info from deploy.sh"
+    );
+    assert!(
+        has_reference(
+            &rows,
+            "require_command",
+            "src/languages/bash/fixtures/lib/common.sh",
+            "src/languages/bash/fixtures/deploy.sh"
+        ),
+        "expected reference to require_command from deploy.sh"
+    );
+    assert!(
+        has_reference(
+            &rows,
+            "log_info",
+            "src/languages/bash/fixtures/lib/common.sh",
+            "src/languages/bash/fixtures/release"
+        ),
+        "expected extensionless script with a shebang to be analyzed"
+    );
+    assert!(
+        has_reference(
+            &rows,
+            "LOG_PREFIX",
+            "src/languages/bash/fixtures/lib/common.sh",
+            "src/languages/bash/fixtures/lib/common.sh"
+        ),
+        "expected top-level variables to be definitions"
+    );
+}
+
 #[test]
 fn finds_php_cross_file_references() {
     let files = vec![
@@ -957,7 +1543,7 @@ fn finds_php_cross_file_references() {
         read_fixture("src/languages/php/fixtures/Services.php"),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     // Classes
     assert!(
@@ -991,6 +1577,48 @@ fn finds_php_cross_file_references() {
     );
 }
 
+#[test]
+fn links_php_methods_to_their_classes_across_namespaces() {
+    let files = vec![
+        read_fixture("src/languages/php/fixtures/app/Billing/Invoice.php"),
+        read_fixture("src/languages/php/fixtures/app/Http/InvoiceController.php"),
+        read_fixture("src/languages/php/fixtures/app/helpers.php"),
+    ];
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
+
+    for (name, file) in [
+        ("Invoice", "app/Billing/Invoice.php"),
+        ("addLine", "app/Billing/Invoice.php"),
+        ("total", "app/Billing/Invoice.php"),
+        ("format_amount", "app/helpers.php"),
+    ] {
+        assert!(
+            has_reference(&rows, name, file, "app/Http/InvoiceController.php"),
+            "expected a reference to {name} from InvoiceController.php"
+        );
+    }
+    let invoice = rows
+        .iter()
+        .find(|row| row.definition.name_str() == "Invoice")
+        .expect("Invoice definition");
+    assert!(
+        invoice.references.iter().any(|reference| reference
+            .path_str()
+            .ends_with("app/Billing/Invoice.php")
+            && reference.line == 19),
+        "expected an edge from the addLine method to Invoice"
+    );
+    assert!(
+        has_reference(
+            &rows,
+            "HasTotals",
+            "app/Billing/Invoice.php",
+            "app/Billing/Invoice.php"
+        ),
+        "expected the trait use to reference HasTotals"
+    );
+}
+
 #[test]
 fn finds_php_class_definitions() {
     let files = vec![
@@ -1004,7 +1632,7 @@ fn finds_php_class_definitions() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "User", "Models.php", "main.php"),
@@ -1029,7 +1657,7 @@ fn finds_php_interface_definitions() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "Repository", "Interfaces.php", "Implementation.php"),
@@ -1050,7 +1678,7 @@ fn finds_php_trait_definitions() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "Timestampable", "Traits.php", "Model.php"),
@@ -1075,7 +1703,7 @@ fn finds_php_enum_definitions() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "Status", "Enums.php", "Model.php"),
@@ -1100,7 +1728,7 @@ fn finds_php_function_definitions() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "add", "helpers.php", "main.php"),
@@ -1125,7 +1753,7 @@ fn finds_php_const_definitions() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "MAX_SIZE", "constants.php", "main.php"),
@@ -1150,7 +1778,7 @@ fn finds_php_types_in_namespace() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "Customer", "Models.php", "Service.php"),
@@ -1167,26 +1795,97 @@ fn finds_c_cross_file_references() {
         read_fixture("src/languages/c/fixtures/types.h"),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     // Function references
     assert!(
         has_reference(
             &rows,
-            "add",
+            "create_point",
             "src/languages/c/fixtures/main.c",
-            "src/languages/c/fixtures/types.h"
+            "src/languages/c/fixtures/main.c"
         ),
-        "expected reference to add function from types.h"
+        "expected reference to create_point function from main.c"
     );
     assert!(
         has_reference(
             &rows,
-            "create_point",
-            "src/languages/c/fixtures/main.c",
-            "src/languages/c/fixtures/types.h"
+            "Point",
+            "src/languages/c/fixtures/types.h",
+            "src/languages/c/fixtures/main.c"
+        ),
+        "expected reference to Point typedef from main.c"
+    );
+}
+
+#[test]
+fn links_c_prototypes_to_definitions() {
+    let files = vec![
+        read_fixture("src/languages/c/fixtures/app.c"),
+        read_fixture("src/languages/c/fixtures/geometry.c"),
+        read_fixture("src/languages/c/fixtures/geometry.h"),
+        read_fixture("src/languages/c/fixtures/types.h"),
+    ];
+
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
+
+    let area_rows: Vec<&OutputRow> = rows
+        .iter()
+        .filter(|row| row.definition.name_str() == "area")
+        .collect();
+    assert_eq!(
+        area_rows.len(),
+        1,
+        "expected prototype and body to be a single symbol"
+    );
+    assert!(
+        area_rows[0]
+            .definition
+            .path_str()
+            .ends_with("src/languages/c/fixtures/geometry.c"),
+        "expected the body to be the definition"
+    );
+    assert!(
+        has_reference(
+            &rows,
+            "area",
+            "src/languages/c/fixtures/geometry.c",
+            "src/languages/c/fixtures/app.c"
         ),
-        "expected reference to create_point function from types.h"
+        "expected call in app.c to reference the body in geometry.c"
+    );
+    assert!(
+        !area_rows[0]
+            .references
+            .iter()
+            .any(|reference| reference.path_str().ends_with("geometry.h")),
+        "expected the prototype not to count as a reference"
+    );
+}
+
+#[test]
+fn uses_c_prototype_without_definition_as_symbol() {
+    let files = vec![
+        (
+            PathBuf::from("vendor.h"),
+            "int vendor_init(void);\nextern int vendor_flags;\n".to_string(),
+        ),
+        (
+            PathBuf::from("main.c"),
+            "#include \"vendor.h\"\nint main(void) {\n    return vendor_init() + vendor_flags;\n}\n"
+                .to_string(),
+        ),
+    ];
+
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
+
+    assert!(
+        has_reference(&rows, "vendor_init", "vendor.h", "main.c"),
+        "expected prototype to stand in for a missing definition"
+    );
+    assert!(
+        has_reference(&rows, "vendor_flags", "vendor.h", "main.c"),
+        "expected extern declaration to stand in for a missing definition"
     );
 }
 
@@ -1203,7 +1902,7 @@ fn finds_c_function_definitions() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "add", "math.c", "main.c"),
@@ -1228,7 +1927,7 @@ fn finds_c_struct_definitions() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "Point", "types.h", "main.c"),
@@ -1253,7 +1952,7 @@ fn finds_c_enum_definitions() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "Color", "enums.h", "main.c"),
@@ -1278,7 +1977,7 @@ fn finds_c_typedef_definitions() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "Point", "types.h", "main.c"),
@@ -1303,7 +2002,7 @@ fn finds_c_union_definitions() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "Value", "types.h", "main.c"),
@@ -1324,7 +2023,7 @@ fn finds_c_global_variable_definitions() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "counter", "globals.c", "main.c"),
@@ -1349,7 +2048,7 @@ fn finds_c_multiple_declarators() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "width", "vars.c", "main.c"),
@@ -1374,7 +2073,7 @@ fn finds_cpp_cross_file_references() {
         read_fixture("src/languages/cpp/fixtures/types.hpp"),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     // Classes
     assert!(
@@ -1410,7 +2109,7 @@ fn finds_cpp_class_definitions() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "User", "models.hpp", "main.cpp"),
@@ -1435,7 +2134,7 @@ fn finds_cpp_struct_definitions() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "Point", "types.hpp", "main.cpp"),
@@ -1460,7 +2159,7 @@ fn finds_cpp_enum_class_definitions() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "Color", "enums.hpp", "main.cpp"),
@@ -1485,7 +2184,7 @@ fn finds_cpp_functions_in_namespace() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "add", "math.cpp", "main.cpp"),
@@ -1506,7 +2205,7 @@ fn finds_cpp_function_definitions() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "add", "utils.cpp", "main.cpp"),
@@ -1532,7 +2231,7 @@ fn finds_c_and_cpp_cross_language_references() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "add", "math.c", "main.cpp"),
@@ -1553,7 +2252,7 @@ fn finds_cpp_inheritance_references() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "Mammal", "base.hpp", "derived.cpp"),
@@ -1574,7 +2273,7 @@ fn finds_cpp_nested_namespace_definitions() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "helper", "utils.cpp", "main.cpp"),
@@ -1595,7 +2294,7 @@ fn finds_cpp_template_class_definitions() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "Container", "container.hpp", "main.cpp"),
@@ -1616,10 +2315,163 @@ fn finds_cpp_template_function_definitions() {
         ),
     ];
 
-    let rows = cruxlines_from_inputs(files, None);
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
 
     assert!(
         has_reference(&rows, "maximum", "algorithms.hpp", "main.cpp"),
         "expected reference to maximum template function"
     );
 }
+
+#[test]
+fn finds_ruby_cross_file_references() {
+    let files = vec![
+        read_fixture("src/languages/ruby/fixtures/main.rb"),
+        read_fixture("src/languages/ruby/fixtures/models.rb"),
+        read_fixture("src/languages/ruby/fixtures/utils.rb"),
+    ];
+
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
+
+    assert!(
+        has_reference(
+            &rows,
+            "User",
+            "src/languages/ruby/fixtures/models.rb",
+            "src/languages/ruby/fixtures/main.rb"
+        ),
+        "expected reference to Shop::User from main.rb"
+    );
+    assert!(
+        has_reference(
+            &rows,
+            "add",
+            "src/languages/ruby/fixtures/utils.rb",
+            "src/languages/ruby/fixtures/main.rb"
+        ),
+        "expected reference to Utils.add from main.rb"
+    );
+    assert!(
+        has_reference(
+            &rows,
+            "display_name",
+            "src/languages/ruby/fixtures/models.rb",
+            "src/languages/ruby/fixtures/main.rb"
+        ),
+        "expected reference to User#display_name from main.rb"
+    );
+}
+
+#[test]
+fn finds_ruby_scope_resolution_definitions() {
+    let files = vec![
+        read_fixture("src/languages/ruby/fixtures/main.rb"),
+        read_fixture("src/languages/ruby/fixtures/models.rb"),
+    ];
+
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
+
+    assert!(
+        has_reference(
+            &rows,
+            "Order",
+            "src/languages/ruby/fixtures/models.rb",
+            "src/languages/ruby/fixtures/main.rb"
+        ),
+        "expected `class Shop::Order` to define Order"
+    );
+    assert!(
+        has_reference(
+            &rows,
+            "DEFAULT_STATUS",
+            "src/languages/ruby/fixtures/models.rb",
+            "src/languages/ruby/fixtures/main.rb"
+        ),
+        "expected constant inside module to be a definition"
+    );
+}
+
+#[test]
+fn ignores_ruby_definitions_inside_methods() {
+    let files = vec![
+        (
+            PathBuf::from("defs.rb"),
+            "def outer\n  helper = 1\n  define_method(:inner) { helper }\nend\n".to_string(),
+        ),
+        (
+            PathBuf::from("main.rb"),
+            "require_relative \"defs\"\n\nouter\nhelper\n".to_string(),
+        ),
+    ];
+
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
+
+    assert!(
+        has_reference(&rows, "outer", "defs.rb", "main.rb"),
+        "expected top-level method definition"
+    );
+    assert!(
+        !rows.iter().any(|row| row.definition.name_str() == "helper"),
+        "expected local variables inside methods to be ignored"
+    );
+}
+
+#[test]
+fn finds_rakefile_definitions() {
+    let files = vec![
+        (
+            PathBuf::from("Rakefile"),
+            "BUILD_DIR = \"build\"\n\ntask :clean do\n  rm_rf BUILD_DIR\nend\n".to_string(),
+        ),
+        (
+            PathBuf::from("tasks/deploy.rake"),
+            "task :deploy do\n  puts BUILD_DIR\nend\n".to_string(),
+        ),
+    ];
+
+    let rows = cruxlines_from_inputs(files, None).expect("analyze inputs");
+
+    assert!(
+        has_reference(&rows, "BUILD_DIR", "Rakefile", "tasks/deploy.rake"),
+        "expected constant in Rakefile referenced from a .rake file"
+    );
+}
+
+#[test]
+fn call_edges_ignore_non_call_mentions() {
+    let files = vec![
+        (
+            PathBuf::from("defs.py"),
+            "LIMIT = 3\n\nclass Config:\n    pass\n\ndef run():\n    pass\n".to_string(),
+        ),
+        (
+            PathBuf::from("main.py"),
+            "from defs import LIMIT, Config, run\n\nconfig: Config = None\nrun()\nrun(LIMIT)\n"
+                .to_string(),
+        ),
+    ];
+    let rank = |edges: EdgeMode| {
+        let options = Options {
+            edges,
+            ..Options::default()
+        };
+        cruxlines_from_inputs_with_options(files.clone(), None, &options).expect("analyze inputs")
+    };
+    let names = |rows: &[OutputRow]| -> Vec<String> {
+        rows.iter()
+            .map(|row| row.definition.name_str().to_string())
+            .collect()
+    };
+
+    let refs = names(&rank(EdgeMode::References));
+    assert!(refs.contains(&"LIMIT".to_string()), "got {refs:?}");
+    assert!(refs.contains(&"Config".to_string()), "got {refs:?}");
+
+    let calls = rank(EdgeMode::Calls);
+    assert_eq!(names(&calls), vec!["run".to_string()]);
+    assert_eq!(
+        calls[0].references.len(),
+        2,
+        "expected one edge per call site"
+    );
+}
@@ -0,0 +1,6 @@
+fn main() {
+    let _request = Request;
+    let _archive = Archive;
+    let _snapshot = Snapshot;
+    let _client = Client;
+}
@@ -0,0 +1,5 @@
+fn main() {
+    let _schema = Schema;
+    let _stale = Stale;
+    let _output = Output;
+}